@@ -0,0 +1,225 @@
+// Package apikeys issues, checks and revokes the named, scoped API keys a
+// user can hold in addition to their session.
+package apikeys
+
+import (
+	"JourneyAppServer/config"
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ScopeEntriesRead  = "entries:read"
+	ScopeEntriesWrite = "entries:write"
+	ScopeImages       = "images"
+	ScopeAccount      = "account"
+)
+
+// AllScopes is what the key issued at sign-up gets.
+var AllScopes = []string{ScopeEntriesRead, ScopeEntriesWrite, ScopeImages, ScopeAccount}
+
+// DefaultKeyName names the key returned by create user and login.
+const DefaultKeyName = "default"
+
+// prefixLength covers "sk_" and the first 8 hex characters of the key.
+const prefixLength = 11
+
+// RotatedHeader is set on responses to requests made with a key that has
+// been rotated; its value is when the key stops working.
+const RotatedHeader = "X-API-Key-Rotated"
+
+var (
+	ErrInvalidKey     = errors.New("invalid API key")
+	ErrExpiredKey     = errors.New("API key has expired")
+	ErrRevokedKey     = errors.New("API key has been revoked")
+	ErrAlreadyRotated = errors.New("API key has already been rotated")
+)
+
+var rotationGrace = 72 * time.Hour
+
+// Configure sets how long rotated keys stay valid. It must run before the
+// server starts handling requests.
+func Configure(cfg config.APIKeysConfig) {
+	rotationGrace = time.Duration(cfg.RotationGraceHours) * time.Hour
+}
+
+// ValidateScopes rejects an empty list and any scope not in AllScopes, and
+// drops duplicates.
+func ValidateScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	seen := make(map[string]bool)
+	var valid []string
+	for _, s := range scopes {
+		if !HasScope(AllScopes, s) {
+			return nil, fmt.Errorf("unknown scope %q", s)
+		}
+		if !seen[s] {
+			seen[s] = true
+			valid = append(valid, s)
+		}
+	}
+	return valid, nil
+}
+
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Issue creates a new key for user and returns it; only its hash is stored,
+// so this is the one time the key is available. A zero expiresAt never
+// expires.
+func Issue(store *db.Store, user types.User, name string, scopes []string, expiresAt time.Time) (string, types.UserAPIKey, error) {
+	generated, err := utils.GenerateSecureAPIKey()
+	if err != nil {
+		return "", types.UserAPIKey{}, err
+	}
+	record, err := Register(store, user, name, scopes, generated.Key, expiresAt)
+	if err != nil {
+		return "", types.UserAPIKey{}, err
+	}
+	return generated.Key, record, nil
+}
+
+// Register stores a key generated elsewhere.
+func Register(store *db.Store, user types.User, name string, scopes []string, key string, expiresAt time.Time) (types.UserAPIKey, error) {
+	record := newRecord(user.UserID, user.Username, name, scopes, key, expiresAt)
+	if err := store.APIKeys.Create(record); err != nil {
+		return types.UserAPIKey{}, err
+	}
+	return record, nil
+}
+
+func newRecord(userID, username, name string, scopes []string, key string, expiresAt time.Time) types.UserAPIKey {
+	return types.UserAPIKey{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Username:  username,
+		Name:      name,
+		KeyHash:   utils.HashToken(key),
+		Prefix:    key[:min(prefixLength, len(key))],
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+}
+
+// Authenticate looks key up and checks it is still usable, recording the use.
+func Authenticate(store *db.Store, key string, now time.Time) (types.UserAPIKey, error) {
+	record, err := store.APIKeys.GetByHash(utils.HashToken(key))
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return types.UserAPIKey{}, ErrInvalidKey
+		}
+		return types.UserAPIKey{}, err
+	}
+	if !record.RevokedAt.IsZero() {
+		return types.UserAPIKey{}, ErrRevokedKey
+	}
+	if !record.ExpiresAt.IsZero() && now.After(record.ExpiresAt) {
+		return types.UserAPIKey{}, ErrExpiredKey
+	}
+
+	if err := store.APIKeys.Touch(record.ID, now); err != nil {
+		utils.LM.Logger.Printf("Error updating API key last used time for %s: %v", record.ID, err)
+	}
+	record.LastUsedAt = now
+	return record, nil
+}
+
+// Rotate replaces old with a new key of the same name and scopes. old keeps
+// working until the grace window ends (or its own expiry, if sooner). A key
+// with an expiry gets a new one the same length from now.
+func Rotate(store *db.Store, user types.User, old types.UserAPIKey) (string, types.UserAPIKey, error) {
+	generated, err := utils.GenerateSecureAPIKey()
+	if err != nil {
+		return "", types.UserAPIKey{}, err
+	}
+
+	var expiresAt time.Time
+	if !old.ExpiresAt.IsZero() {
+		expiresAt = time.Now().UTC().Add(old.ExpiresAt.Sub(old.CreatedAt))
+	}
+	// A login key's replacement still ends with its session.
+	if old.SessionID != "" {
+		expiresAt = old.ExpiresAt
+	}
+	record := newRecord(user.UserID, user.Username, old.Name, old.Scopes, generated.Key, expiresAt)
+	record.SessionID = old.SessionID
+
+	now := time.Now().UTC()
+	if err := store.APIKeys.Rotate(old.ID, record, now.Add(rotationGrace)); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return "", types.UserAPIKey{}, ErrAlreadyRotated
+		}
+		return "", types.UserAPIKey{}, err
+	}
+	return generated.Key, record, nil
+}
+
+// maxLoginKeys caps how many login keys a user can hold at once; signing in
+// past it revokes the oldest.
+const maxLoginKeys = 20
+
+// IssueLoginKey issues the key create user and login hand out: a new
+// default key with every scope, tied to sessionID. It is revoked along with
+// the session and expires with it if not sooner. Only its hash is kept, so
+// every sign-in gets its own key; the user's revoked and expired login keys
+// are deleted and the oldest live ones revoked past maxLoginKeys.
+func IssueLoginKey(store *db.Store, user types.User, sessionID string) (string, error) {
+	session, err := store.Sessions.Get(sessionID)
+	if err != nil {
+		return "", err
+	}
+	generated, err := utils.GenerateSecureAPIKey()
+	if err != nil {
+		return "", err
+	}
+	expiresAt := generated.ExpiresAt
+	if session.ExpiresAt.Before(expiresAt) {
+		expiresAt = session.ExpiresAt
+	}
+	record := newRecord(user.UserID, user.Username, DefaultKeyName, AllScopes, generated.Key, expiresAt)
+	record.SessionID = sessionID
+	if err := store.APIKeys.Create(record); err != nil {
+		return "", err
+	}
+
+	if err := pruneLoginKeys(store, user.Username, time.Now().UTC()); err != nil {
+		utils.LM.Logger.Printf("Error pruning login keys for %s: %v", user.Username, err)
+	}
+	return generated.Key, nil
+}
+
+func pruneLoginKeys(store *db.Store, username string, now time.Time) error {
+	keys, err := store.APIKeys.List(username)
+	if err != nil {
+		return err
+	}
+	// List is newest first.
+	live := 0
+	for _, k := range keys {
+		if k.SessionID == "" || !k.RevokedAt.IsZero() || (!k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)) {
+			continue
+		}
+		live++
+		if live > maxLoginKeys {
+			if err := store.APIKeys.Revoke(username, k.ID, now); err != nil && !errors.Is(err, db.ErrNotFound) {
+				return err
+			}
+		}
+	}
+	return store.APIKeys.PruneSessionKeys(username, now)
+}
@@ -0,0 +1,239 @@
+// Package atrest encrypts entry text, tag values and location names at rest
+// with envelope encryption: every user has a random data key, stored wrapped
+// by a master key from a MasterKeyProvider, and values are sealed with
+// AES-256-GCM under it. Full-text search on sealed text goes through a blind
+// index of keyed word hashes instead of MySQL's FULLTEXT index.
+//
+// Users with end-to-end encryption never send text to seal; their tag values
+// and location names are still sealed.
+package atrest
+
+import (
+	"JourneyAppServer/config"
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const keySize = 32
+
+var ErrCorrupt = errors.New("sealed value is corrupt")
+
+// Keyring implements db.FieldCipher. Unwrapped data keys are cached for the
+// life of the process, so the provider is only asked once per user.
+type Keyring struct {
+	provider MasterKeyProvider
+	keys     db.DataKeyRepository
+
+	mu    sync.Mutex
+	cache map[string]userKeys
+}
+
+type userKeys struct {
+	data  []byte
+	index []byte
+}
+
+var _ db.FieldCipher = (*Keyring)(nil)
+
+func NewKeyring(provider MasterKeyProvider, keys db.DataKeyRepository) *Keyring {
+	return &Keyring{
+		provider: provider,
+		keys:     keys,
+		cache:    make(map[string]userKeys),
+	}
+}
+
+// NewMySQLStore builds the MySQL store, sealing entry fields when cfg turns
+// encryption at rest on. The keyring is nil when it is off. index is passed
+// on to db.NewMySQLStore.
+func NewMySQLStore(sdb *sql.DB, cfg config.AtRestConfig, index db.SearchIndex) (*db.Store, *Keyring, error) {
+	store := db.NewMySQLStore(sdb, nil, index)
+	if !cfg.Enabled {
+		return store, nil, nil
+	}
+	provider, err := NewProvider(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Data keys are never sealed themselves, so the plain store's
+	// repository serves the keyring.
+	keyring := NewKeyring(provider, store.DataKeys)
+	return db.NewMySQLStore(sdb, keyring, index), keyring, nil
+}
+
+// userKeys returns userID's data key and the blind index key derived from
+// it, creating the data key on first use.
+func (k *Keyring) userKeys(userID string) (userKeys, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if keys, ok := k.cache[userID]; ok {
+		return keys, nil
+	}
+
+	stored, err := k.keys.Get(userID)
+	if errors.Is(err, db.ErrNotFound) {
+		if err := k.createDataKey(userID); err != nil {
+			return userKeys{}, err
+		}
+		stored, err = k.keys.Get(userID)
+	}
+	if err != nil {
+		return userKeys{}, err
+	}
+	data, err := k.provider.Unwrap(stored.WrappedKey, stored.MasterKeyID)
+	if err != nil {
+		return userKeys{}, err
+	}
+
+	mac := hmac.New(sha256.New, data)
+	mac.Write([]byte("journey blind index v1"))
+	keys := userKeys{data: data, index: mac.Sum(nil)}
+	k.cache[userID] = keys
+	return keys, nil
+}
+
+// createDataKey stores a new data key unless another server got there
+// first, in which case theirs is kept.
+func (k *Keyring) createDataKey(userID string) error {
+	data := make([]byte, keySize)
+	if _, err := rand.Read(data); err != nil {
+		return err
+	}
+	wrapped, keyID, err := k.provider.Wrap(data)
+	if err != nil {
+		return err
+	}
+	return k.keys.Create(types.DataKey{
+		UserID:      userID,
+		WrappedKey:  wrapped,
+		MasterKeyID: keyID,
+		CreatedAt:   time.Now().UTC(),
+	})
+}
+
+// Seal binds the value to userID, so it can't be moved to another user's
+// rows and opened with their key.
+func (k *Keyring) Seal(userID, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	keys, err := k.userKeys(userID)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(keys.data, []byte(plaintext), []byte(userID))
+	if err != nil {
+		return "", err
+	}
+	return db.SealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *Keyring) Open(userID, value string) (string, error) {
+	if !strings.HasPrefix(value, db.SealedPrefix) {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, db.SealedPrefix))
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	keys, err := k.userKeys(userID)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(keys.data, sealed, []byte(userID))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// IndexTokens hashes each distinct word of text. Words are runs of letters
+// and digits, lowercased, so "Hiking," and "hiking" match.
+func (k *Keyring) IndexTokens(userID, text string) ([]string, error) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return nil, nil
+	}
+	keys, err := k.userKeys(userID)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, word := range words {
+		token := blindToken(keys.index, "w:"+word)
+		if !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+// Token hashes value as a whole. The prefix keeps it from ever equalling a
+// word token.
+func (k *Keyring) Token(userID, value string) (string, error) {
+	keys, err := k.userKeys(userID)
+	if err != nil {
+		return "", err
+	}
+	return blindToken(keys.index, "v:"+value), nil
+}
+
+func blindToken(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// seal encrypts with AES-256-GCM and returns the nonce followed by the
+// ciphertext.
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrCorrupt
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,167 @@
+package atrest
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeKeyfile writes a keyfile with a new random key for each id, the last
+// being current, and returns its path.
+func writeKeyfile(t *testing.T, mode os.FileMode, ids ...string) string {
+	t.Helper()
+	var lines []string
+	for _, id := range ids {
+		key := make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, id+" "+base64.StdEncoding.EncodeToString(key))
+	}
+	path := filepath.Join(t.TempDir(), "keyfile")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newKeyring returns a keyring over a memory store holding alice and bob.
+func newKeyring(t *testing.T, keyfile string) (*Keyring, *db.Store) {
+	t.Helper()
+	store := db.NewMemoryStore()
+	for _, u := range []types.User{{UserID: "alice-id", Username: "alice"}, {UserID: "bob-id", Username: "bob"}} {
+		if err := store.Users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	provider, err := LoadKeyfile(keyfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewKeyring(provider, store.DataKeys), store
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	keyring, _ := newKeyring(t, writeKeyfile(t, 0o600, "k1"))
+
+	sealed, err := keyring.Seal("alice-id", "went hiking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, db.SealedPrefix) || strings.Contains(sealed, "hiking") {
+		t.Fatalf("sealed = %q", sealed)
+	}
+	opened, err := keyring.Open("alice-id", sealed)
+	if err != nil || opened != "went hiking" {
+		t.Fatalf("Open = %q, %v", opened, err)
+	}
+
+	// Values from before sealing was turned on pass through.
+	if opened, err := keyring.Open("alice-id", "plain"); err != nil || opened != "plain" {
+		t.Fatalf("Open plaintext = %q, %v", opened, err)
+	}
+}
+
+func TestOpenFailsForAnotherUser(t *testing.T) {
+	keyring, _ := newKeyring(t, writeKeyfile(t, 0o600, "k1"))
+	sealed, err := keyring.Seal("alice-id", "went hiking")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := keyring.Open("bob-id", sealed); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Open as bob: err = %v, want ErrCorrupt", err)
+	}
+
+	// Even under alice's own data key, the user ID is bound in as
+	// associated data.
+	keys, err := keyring.userKeys("alice-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, db.SealedPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := open(keys.data, raw, []byte("bob-id")); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("open with bob's ID: err = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestLoadKeyfileRejectsLoosePermissions(t *testing.T) {
+	for _, mode := range []os.FileMode{0o640, 0o604, 0o644} {
+		if _, err := LoadKeyfile(writeKeyfile(t, mode, "k1")); err == nil {
+			t.Errorf("mode %v: loaded, want an error", mode)
+		}
+	}
+	if _, err := LoadKeyfile(writeKeyfile(t, 0o600, "k1")); err != nil {
+		t.Errorf("mode 0600: %v", err)
+	}
+}
+
+func TestRekeyMovesDataKeysToTheNewMasterKey(t *testing.T) {
+	old := writeKeyfile(t, 0o600, "k1")
+	keyring, store := newKeyring(t, old)
+	sealed, err := keyring.Seal("alice-id", "went hiking")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Append k2, making it current.
+	rotated := writeKeyfile(t, 0o600, "k2")
+	k1, err := os.ReadFile(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := os.ReadFile(rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(rotated, append(k1, k2...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := LoadKeyfile(rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring = NewKeyring(provider, store.DataKeys)
+
+	result, err := keyring.Rekey(store.Entries, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Rewrapped != 1 {
+		t.Fatalf("rewrapped %d data keys, want 1", result.Rewrapped)
+	}
+	stored, err := store.DataKeys.Get("alice-id")
+	if err != nil || stored.MasterKeyID != "k2" {
+		t.Fatalf("data key = %+v, %v; want it under k2", stored, err)
+	}
+
+	// The data key itself is unchanged, so with k1 gone the value still
+	// opens.
+	if err := os.WriteFile(rotated, k2, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	provider, err = LoadKeyfile(rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := NewKeyring(provider, store.DataKeys).Open("alice-id", sealed)
+	if err != nil || opened != "went hiking" {
+		t.Fatalf("Open after rekey = %q, %v", opened, err)
+	}
+
+	if result, err := keyring.Rekey(store.Entries, 10); err != nil || result.Rewrapped != 0 {
+		t.Fatalf("second Rekey = %+v, %v; want nothing to do", result, err)
+	}
+}
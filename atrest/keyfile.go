@@ -0,0 +1,105 @@
+package atrest
+
+import (
+	"JourneyAppServer/config"
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MasterKeyProvider wraps and unwraps data keys. The keyfile provider does it
+// in process; a KMS-backed one would make the same calls remotely and never
+// hand out the master key.
+type MasterKeyProvider interface {
+	// CurrentKeyID names the master key Wrap uses.
+	CurrentKeyID() string
+	Wrap(dataKey []byte) (wrapped []byte, keyID string, err error)
+	Unwrap(wrapped []byte, keyID string) ([]byte, error)
+}
+
+var ErrUnknownMasterKey = errors.New("unknown master key")
+
+// NewProvider builds the master key provider cfg names.
+func NewProvider(cfg config.AtRestConfig) (MasterKeyProvider, error) {
+	switch cfg.Provider {
+	case "keyfile":
+		return LoadKeyfile(cfg.Keyfile)
+	}
+	return nil, fmt.Errorf("unknown at-rest key provider %q", cfg.Provider)
+}
+
+// Keyfile holds master keys read from a local file. Rotating the master key
+// means appending a new line and re-keying; old lines can be removed once no
+// data key is wrapped by them.
+type Keyfile struct {
+	keys    map[string][]byte
+	current string
+}
+
+// LoadKeyfile reads "<id> <base64 32-byte key>" lines, skipping blank lines
+// and "#" comments. The file must not be readable by group or others.
+func LoadKeyfile(path string) (*Keyfile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("keyfile %s must not be accessible by group or others (mode %v)", path, info.Mode().Perm())
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	k := &Keyfile{keys: make(map[string][]byte)}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("keyfile %s:%d: want \"<id> <base64 key>\"", path, line)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("keyfile %s:%d: key must be %d bytes of base64", path, line, keySize)
+		}
+		if _, ok := k.keys[fields[0]]; ok {
+			return nil, fmt.Errorf("keyfile %s:%d: duplicate key id %q", path, line, fields[0])
+		}
+		k.keys[fields[0]] = key
+		k.current = fields[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if k.current == "" {
+		return nil, fmt.Errorf("keyfile %s has no keys", path)
+	}
+	return k, nil
+}
+
+func (k *Keyfile) CurrentKeyID() string {
+	return k.current
+}
+
+// The key ID is bound to the wrapped key as associated data, so a data key
+// can't be passed off as wrapped by a different master key.
+func (k *Keyfile) Wrap(dataKey []byte) ([]byte, string, error) {
+	wrapped, err := seal(k.keys[k.current], dataKey, []byte(k.current))
+	return wrapped, k.current, err
+}
+
+func (k *Keyfile) Unwrap(wrapped []byte, keyID string) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMasterKey, keyID)
+	}
+	return open(key, wrapped, []byte(keyID))
+}
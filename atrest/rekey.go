@@ -0,0 +1,79 @@
+package atrest
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/utils"
+	"errors"
+	"time"
+)
+
+// RekeyResult counts what one Rekey call changed.
+type RekeyResult struct {
+	Rewrapped int
+	Sealed    int
+}
+
+// Rekey re-wraps every data key that isn't under the provider's current
+// master key, then seals entry values still stored in plaintext, batchSize
+// at a time until there is nothing left to do.
+func (k *Keyring) Rekey(entries db.EntryRepository, batchSize int) (RekeyResult, error) {
+	var result RekeyResult
+	current := k.provider.CurrentKeyID()
+	for {
+		stale, err := k.keys.ListStale(current, batchSize)
+		if err != nil {
+			return result, err
+		}
+		for _, key := range stale {
+			data, err := k.provider.Unwrap(key.WrappedKey, key.MasterKeyID)
+			if err != nil {
+				return result, err
+			}
+			wrapped, keyID, err := k.provider.Wrap(data)
+			if err != nil {
+				return result, err
+			}
+			err = k.keys.Rewrap(key.UserID, key.MasterKeyID, wrapped, keyID, time.Now().UTC())
+			if err != nil && !errors.Is(err, db.ErrNotFound) {
+				return result, err
+			}
+			if err == nil {
+				result.Rewrapped++
+			}
+		}
+		if len(stale) < batchSize {
+			break
+		}
+	}
+
+	for {
+		sealed, err := entries.SealPlaintext(batchSize)
+		result.Sealed += sealed
+		if err != nil {
+			return result, err
+		}
+		if sealed == 0 {
+			return result, nil
+		}
+	}
+}
+
+// RunRekeyer calls Rekey every interval until stop is closed.
+func (k *Keyring) RunRekeyer(entries db.EntryRepository, interval time.Duration, batchSize int, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			result, err := k.Rekey(entries, batchSize)
+			if err != nil {
+				utils.LM.Logger.Printf("Re-keying error: %v", err)
+			}
+			if result.Rewrapped > 0 || result.Sealed > 0 {
+				utils.LM.Logger.Printf("Re-keyed %d data keys and sealed %d values", result.Rewrapped, result.Sealed)
+			}
+		}
+	}
+}
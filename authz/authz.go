@@ -0,0 +1,139 @@
+// Package authz decides whether the authenticated caller may act on the user,
+// entry or S3 object a request names. Handlers never trust user IDs, usernames
+// or keys from the request on their own; they check them against the caller
+// resolved from the auth middleware's context.
+package authz
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/middleware"
+	"JourneyAppServer/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrForbidden       = errors.New("forbidden")
+)
+
+type Caller struct {
+	UserID   string
+	Username string
+}
+
+// Username returns the authenticated username without loading the user, for
+// checks that only need the name (like S3 key prefixes).
+func Username(r *http.Request) (string, error) {
+	username, ok := middleware.GetUsernameFromContext(r.Context())
+	if !ok || username == "" {
+		return "", ErrUnauthenticated
+	}
+	return username, nil
+}
+
+// CallerFromRequest resolves the user the auth middleware authenticated.
+func CallerFromRequest(store *db.Store, r *http.Request) (Caller, error) {
+	username, err := Username(r)
+	if err != nil {
+		return Caller{}, err
+	}
+	user, err := store.Users.GetByUsername(username)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return Caller{}, ErrUnauthenticated
+		}
+		return Caller{}, err
+	}
+	return Caller{UserID: user.UserID, Username: user.Username}, nil
+}
+
+// RequireUser checks the username and/or user ID a request claims to act for.
+// Empty values are allowed; callers fill them in from the Caller.
+func (c Caller) RequireUser(username, userID string) error {
+	if username != "" && username != c.Username {
+		return fmt.Errorf("%w: %s acting as user %s", ErrForbidden, c.Username, username)
+	}
+	if userID != "" && userID != c.UserID {
+		return fmt.Errorf("%w: %s acting as user id %s", ErrForbidden, c.Username, userID)
+	}
+	return nil
+}
+
+// RequireEntry loads the entry key names and checks the caller owns it.
+// Entries that don't exist are reported as db.ErrNotFound, not ErrForbidden,
+// so existence isn't leaked across users.
+func (c Caller) RequireEntry(store *db.Store, key db.EntryKey) error {
+	if err := c.RequireUser("", key.UserID); err != nil {
+		return err
+	}
+	entry, err := store.Entries.Get(key)
+	if err != nil {
+		return err
+	}
+	if entry.UserID != c.UserID || entry.Username != c.Username {
+		return fmt.Errorf("%w: %s accessing entry %s", ErrForbidden, c.Username, key.ID)
+	}
+	return nil
+}
+
+// ImagePrefix is the S3 prefix every one of username's images lives under.
+func ImagePrefix(username string) string {
+	return fmt.Sprintf("images/%s/", username)
+}
+
+// RequireImageKey checks that an S3 object key belongs to username.
+func RequireImageKey(username, key string) error {
+	if username == "" {
+		return ErrUnauthenticated
+	}
+	if !strings.HasPrefix(key, ImagePrefix(username)) || strings.Contains(key, "..") {
+		return fmt.Errorf("%w: %s accessing image %s", ErrForbidden, username, key)
+	}
+	return nil
+}
+
+// RequireImageKeys is RequireImageKey for every key in keys.
+func RequireImageKeys(username string, keys []string) error {
+	for _, key := range keys {
+		if err := RequireImageKey(username, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check resolves the caller and verifies they may act as username/userID
+// (either may be empty). On failure it writes the 401/403/500 response itself
+// and returns false.
+func Check(w http.ResponseWriter, r *http.Request, store *db.Store, username, userID string) (Caller, bool) {
+	caller, err := CallerFromRequest(store, r)
+	if err == nil {
+		err = caller.RequireUser(username, userID)
+	}
+	if err != nil {
+		if !WriteError(w, err) {
+			utils.LM.Logger.Printf("Error resolving caller: %v", err)
+			http.Error(w, "Error authorizing request", http.StatusInternalServerError)
+		}
+		return Caller{}, false
+	}
+	return caller, true
+}
+
+// WriteError maps an authorization failure onto its status code. It reports
+// whether it wrote a response, so other errors can be handled by the caller.
+func WriteError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrUnauthenticated):
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	case errors.Is(err, ErrForbidden):
+		utils.LM.Logger.Printf("Authorization denied: %v", err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package authz
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRequireUser(t *testing.T) {
+	alice := Caller{UserID: "alice-id", Username: "alice"}
+
+	tests := []struct {
+		name     string
+		username string
+		userID   string
+		wantErr  error
+	}{
+		{"empty claims", "", "", nil},
+		{"own username", "alice", "", nil},
+		{"own user id", "", "alice-id", nil},
+		{"both own", "alice", "alice-id", nil},
+		{"other username", "bob", "", ErrForbidden},
+		{"other user id", "", "bob-id", ErrForbidden},
+		{"own username with other id", "alice", "bob-id", ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := alice.RequireUser(tt.username, tt.userID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RequireUser(%q, %q) = %v, want %v", tt.username, tt.userID, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequireImageKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr error
+	}{
+		{"images/alice/entry/photo.jpg", nil},
+		{"images/bob/entry/photo.jpg", ErrForbidden},
+		{"images/alice2/entry/photo.jpg", ErrForbidden},
+		{"images/alice/../bob/entry/photo.jpg", ErrForbidden},
+		{"alice/entry/photo.jpg", ErrForbidden},
+		{"", ErrForbidden},
+	}
+	for _, tt := range tests {
+		if err := RequireImageKey("alice", tt.key); !errors.Is(err, tt.wantErr) {
+			t.Errorf("RequireImageKey(alice, %q) = %v, want %v", tt.key, err, tt.wantErr)
+		}
+	}
+
+	if err := RequireImageKey("", "images//x"); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("RequireImageKey with no user = %v, want ErrUnauthenticated", err)
+	}
+}
+
+func TestRequireEntry(t *testing.T) {
+	store := db.NewMemoryStore()
+	for _, u := range []types.User{
+		{UserID: "alice-id", Username: "alice"},
+		{UserID: "bob-id", Username: "bob"},
+	} {
+		if err := store.Users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := store.Entries.Create(types.Entry{ID: "e1", UserID: "alice-id", Username: "alice", Text: "hi", Timestamp: ts}); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := Caller{UserID: "alice-id", Username: "alice"}
+	bob := Caller{UserID: "bob-id", Username: "bob"}
+
+	if err := alice.RequireEntry(store, db.EntryKey{ID: "e1", UserID: "alice-id", Timestamp: ts}); err != nil {
+		t.Fatalf("owner denied: %v", err)
+	}
+	if err := bob.RequireEntry(store, db.EntryKey{ID: "e1", UserID: "alice-id", Timestamp: ts}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("bob naming alice's key = %v, want ErrForbidden", err)
+	}
+	if err := bob.RequireEntry(store, db.EntryKey{ID: "e1", UserID: "bob-id", Timestamp: ts}); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("bob naming his own id on alice's entry = %v, want ErrNotFound", err)
+	}
+}
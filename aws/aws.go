@@ -1,32 +1,42 @@
 package aws
 
 import (
+	"JourneyAppServer/authz"
+	appconfig "JourneyAppServer/config"
 	"JourneyAppServer/types"
 	"context"
+	"errors"
 	"fmt"
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"net/http"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
-var s3Client *s3.Client
+var (
+	s3Client *s3.Client
+	bucket   string
+)
 
-func init() {
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("us-west-2"))
+// Init must be called before any of the S3 helpers or handlers are used.
+func Init(s3Config appconfig.S3Config) error {
+	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(s3Config.Region))
 	if err != nil {
-		panic(fmt.Errorf("unable to load AWS config: %w", err))
+		return fmt.Errorf("unable to load AWS config: %w", err)
 	}
 
 	fmt.Println("Successfully loaded credentials...")
 	s3Client = s3.NewFromConfig(cfg)
+	bucket = s3Config.Bucket
 	fmt.Println("Successfully created new s3Client from config...")
+	return nil
 }
 
-func GeneratePresignedUploadURL(bucket, key string) (string, error) {
+func GeneratePresignedUploadURL(key string) (string, error) {
 	fmt.Println("Generating a new presigned url...")
 	presignClient := s3.NewPresignClient(s3Client)
 	fmt.Println("Successfully created new presignClient")
@@ -53,9 +63,22 @@ func PresignPutHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	caller, err := authz.Username(r)
+	if err == nil && caller != username {
+		err = fmt.Errorf("%w: %s presigning upload for %s", authz.ErrForbidden, caller, username)
+	}
+	if err != nil {
+		authz.WriteError(w, err)
+		return
+	}
+
 	key := fmt.Sprintf("%s/%s/%s/%s", "images", username, entryId, filename)
+	if err := authz.RequireImageKey(caller, key); err != nil {
+		authz.WriteError(w, err)
+		return
+	}
 	fmt.Println("Key:", key)
-	url, err := GeneratePresignedUploadURL("winapps-myjourney", key)
+	url, err := GeneratePresignedUploadURL(key)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -67,7 +90,6 @@ func PresignPutHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func generatePresignedGetURL(key string) (string, error) {
-	bucket := "winapps-myjourney"
 	presignClient := s3.NewPresignClient(s3Client)
 	req, err := presignClient.PresignGetObject(context.TODO(), &s3.GetObjectInput{
 		Bucket: &bucket,
@@ -91,6 +113,15 @@ func PresignGetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	username, err := authz.Username(r)
+	if err == nil {
+		err = authz.RequireImageKey(username, key)
+	}
+	if err != nil {
+		authz.WriteError(w, err)
+		return
+	}
+
 	url, err := generatePresignedGetURL(key)
 	if err != nil {
 		http.Error(w, "Error generating pre-signed GET URL", http.StatusInternalServerError)
@@ -103,7 +134,7 @@ func PresignGetHandler(w http.ResponseWriter, r *http.Request) {
 
 func DeleteImage(prefix string) types.DeleteImageResponse {
 	_, err := s3Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
-		Bucket: aws.String("winapps-myjourney"),
+		Bucket: aws.String(bucket),
 		Key:    aws.String(prefix),
 	})
 	if err != nil {
@@ -118,10 +149,26 @@ func DeleteImage(prefix string) types.DeleteImageResponse {
 	}
 }
 
+// ImageExists reports whether the object key is still in the bucket.
+func ImageExists(key string) (bool, error) {
+	_, err := s3Client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *s3types.NotFound
+		if errors.As(err, &notFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 func BulkDeleteImages(username, entryId string) types.DeleteImageResponse {
 	prefix := fmt.Sprintf("images/%s/%s/", username, entryId)
 
-	objects, err := listEntryObjects(context.TODO(), "winapps-myjourney", prefix)
+	objects, err := listEntryObjects(context.TODO(), prefix)
 	if err != nil {
 		fmt.Println("Error listing images for entry", entryId)
 		return types.DeleteImageResponse{
@@ -132,7 +179,7 @@ func BulkDeleteImages(username, entryId string) types.DeleteImageResponse {
 	for _, object := range objects {
 		fmt.Printf("Deleting object: %s\n", *object.Key)
 		_, err := s3Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
-			Bucket: aws.String("winapps-myjourney"),
+			Bucket: aws.String(bucket),
 			Key:    object.Key,
 		})
 		if err != nil {
@@ -148,7 +195,7 @@ func BulkDeleteImages(username, entryId string) types.DeleteImageResponse {
 	}
 }
 
-func listEntryObjects(ctx context.Context, bucket, prefix string) ([]s3types.Object, error) {
+func listEntryObjects(ctx context.Context, prefix string) ([]s3types.Object, error) {
 	var objects []s3types.Object
 
 	paginator := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
@@ -0,0 +1,131 @@
+// Command admin runs one-off account maintenance against the MySQL database.
+//
+//	admin [-config file] unlock <username>  lift a login lockout on an account
+//	admin [-config file] unlock-ip <ip>     lift a login lockout on a client IP
+//	admin [-config file] rekey              re-wrap data keys under the current
+//	                                        master key and seal plaintext values
+//	admin [-config file] analyze            work out the plain text and stats of
+//	                                        entries written before they were kept
+//	admin [-config file] reindex            rebuild the embedded search index;
+//	                                        stop the server first
+package main
+
+import (
+	"JourneyAppServer/atrest"
+	"JourneyAppServer/config"
+	"JourneyAppServer/db"
+	"JourneyAppServer/lockout"
+	"JourneyAppServer/textindex"
+	"JourneyAppServer/utils"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// analyzeBatchSize is how many entries analyze and reindex read at a time.
+const analyzeBatchSize = 500
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: admin [-config file] unlock <username> | unlock-ip <ip> | rekey | analyze | reindex")
+	os.Exit(2)
+}
+
+func main() {
+	configPath := flag.String("config", os.Getenv("JOURNEY_CONFIG"), "path to the JSON config file")
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 1 || (args[0] != "rekey" && args[0] != "analyze" && args[0] != "reindex" && len(args) < 2) {
+		usage()
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := utils.SetupDailyLogging(cfg.Log); err != nil {
+		log.Fatal(err)
+	}
+	defer utils.LM.Close()
+
+	sdb, err := db.OpenMySQL(cfg.MySQL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer sdb.Close()
+
+	// Only reindex opens the embedded search index, so the rest can run
+	// alongside the server, which keeps it open.
+	var index *textindex.Index
+	var searchIndex db.SearchIndex
+	if args[0] == "reindex" {
+		if cfg.Search.Backend != "embedded" {
+			log.Fatal("search.backend is mysql, whose FULLTEXT index MySQL keeps up to date itself")
+		}
+		if index, err = textindex.Open(cfg.Search.IndexDir); err != nil {
+			log.Fatal(err)
+		}
+		searchIndex = index
+	}
+	store, keyring, err := atrest.NewMySQLStore(sdb, cfg.AtRest, searchIndex)
+	if err != nil {
+		log.Fatal(err)
+	}
+	guard := lockout.NewGuard(store, cfg.Login)
+
+	switch args[0] {
+	case "unlock":
+		if err := guard.UnlockUser(args[1]); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Unlocked user %s.\n", args[1])
+	case "unlock-ip":
+		if err := guard.UnlockIP(args[1]); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Unlocked client IP %s.\n", args[1])
+	case "rekey":
+		if keyring == nil {
+			log.Fatal("encryption at rest is not enabled (atRest.enabled)")
+		}
+		result, err := keyring.Rekey(store.Entries, cfg.AtRest.RekeyBatchSize)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Re-wrapped %d data keys and sealed %d values.\n", result.Rewrapped, result.Sealed)
+	case "analyze":
+		fmt.Printf("Analyzed %d entries.\n", analyzeAll(store.Entries))
+		if cfg.Search.Backend == "embedded" {
+			fmt.Println("Run reindex to add them to the search index.")
+		}
+	case "reindex":
+		// Entries without plain text yet would be left out.
+		analyzed := analyzeAll(store.Entries)
+		indexed, err := db.Reindex(store.Entries, index, analyzeBatchSize)
+		if closeErr := index.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Analyzed %d entries and indexed %d.\n", analyzed, indexed)
+	default:
+		usage()
+	}
+}
+
+// analyzeAll runs AnalyzeText until there is nothing left for it to do and
+// returns how many entries it analyzed.
+func analyzeAll(entries db.EntryRepository) int {
+	total := 0
+	for {
+		analyzed, err := entries.AnalyzeText(analyzeBatchSize)
+		total += analyzed
+		if err != nil {
+			log.Fatal(err)
+		}
+		if analyzed == 0 {
+			return total
+		}
+	}
+}
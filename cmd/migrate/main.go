@@ -0,0 +1,87 @@
+// Command migrate applies, reverts and reports on the versioned MySQL schema
+// migrations embedded in the migrations package.
+//
+//	migrate [-config file] up        apply every pending migration
+//	migrate [-config file] down [n]  revert the last n applied migrations (default 1)
+//	migrate [-config file] status    list migrations and whether they have been applied
+package main
+
+import (
+	"JourneyAppServer/config"
+	"JourneyAppServer/db"
+	"JourneyAppServer/migrations"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: migrate [-config file] up | down [n] | status")
+	os.Exit(2)
+}
+
+func main() {
+	configPath := flag.String("config", os.Getenv("JOURNEY_CONFIG"), "path to the JSON config file")
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 1 {
+		usage()
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sdb, err := db.OpenMySQL(cfg.MySQL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer sdb.Close()
+
+	migrator, err := migrations.NewMigrator(sdb)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Applied %d migration(s).\n", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				usage()
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Reverted %d migration(s).\n", reverted)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				state += " (modified since applied)"
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"JourneyAppServer/apikeys"
+	"JourneyAppServer/atrest"
+	"JourneyAppServer/aws"
+	"JourneyAppServer/config"
+	"JourneyAppServer/db"
+	"JourneyAppServer/lockout"
+	"JourneyAppServer/notify"
+	"JourneyAppServer/passwords"
+	"JourneyAppServer/ratelimit"
+	"JourneyAppServer/revisions"
+	"JourneyAppServer/textindex"
+	"JourneyAppServer/trash"
+	"JourneyAppServer/utils"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 60 * time.Second
+	idleTimeout       = 120 * time.Second
+	// shutdownTimeout bounds how long in-flight requests get to finish after
+	// SIGTERM before the server closes their connections.
+	shutdownTimeout = 30 * time.Second
+)
+
+func main() {
+	configPath := flag.String("config", os.Getenv("JOURNEY_CONFIG"), "path to the JSON config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := utils.SetupDailyLogging(cfg.Log); err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	utils.ConfigureJWT(cfg.JWT)
+	if err := utils.ConfigureTrustedProxies(cfg.Server); err != nil {
+		log.Fatalf("Failed to configure trusted proxies: %v", err)
+	}
+	apikeys.Configure(cfg.APIKeys)
+	passwords.Configure(cfg.Passwords)
+	revisions.Configure(cfg.Revisions)
+	trash.Configure(cfg.Trash)
+	if err := aws.Init(cfg.S3); err != nil {
+		log.Fatalf("Failed to init AWS: %v", err)
+	}
+	if err := db.InitMySQL(cfg.MySQL); err != nil {
+		log.Fatalf("Failed to init MySQL: %v", err)
+	}
+
+	connectCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	db.MongoClient, err = mongo.Connect(connectCtx, options.Client().ApplyURI(cfg.Mongo.URI))
+	cancel()
+	if err != nil {
+		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+	fmt.Println("Successfully connected to MongoDB")
+
+	var searchIndex db.SearchIndex
+	if cfg.Search.Backend == "embedded" {
+		index, err := textindex.Open(cfg.Search.IndexDir)
+		if err != nil {
+			log.Fatalf("Failed to open the search index: %v", err)
+		}
+		searchIndex = index
+	}
+	store, keyring, err := atrest.NewMySQLStore(db.SDB, cfg.AtRest, searchIndex)
+	if err != nil {
+		log.Fatalf("Failed to set up encryption at rest: %v", err)
+	}
+	rekeyStop := make(chan struct{})
+	if keyring != nil && cfg.AtRest.RekeyIntervalMinutes > 0 {
+		go keyring.RunRekeyer(store.Entries, time.Duration(cfg.AtRest.RekeyIntervalMinutes)*time.Minute, cfg.AtRest.RekeyBatchSize, rekeyStop)
+	}
+	purgeStop := make(chan struct{})
+	if cfg.Trash.PurgeIntervalMinutes > 0 {
+		go trash.RunPurger(store, time.Duration(cfg.Trash.PurgeIntervalMinutes)*time.Minute, purgeStop)
+	}
+
+	var backend ratelimit.Backend = ratelimit.NewMemoryBackend(time.Duration(cfg.RateLimit.IdleTimeoutSeconds) * time.Second)
+	if cfg.RateLimit.Backend == "mysql" {
+		backend = ratelimit.NewMySQLBackend(db.SDB)
+	}
+	limiter := ratelimit.New(cfg.RateLimit, backend)
+
+	notifier, err := notify.New(cfg.Notifier)
+	if err != nil {
+		log.Fatalf("Failed to set up notifier: %v", err)
+	}
+	passwordManager := passwords.NewManager(store, notifier, cfg.Passwords)
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:           routes(store, limiter, lockout.NewGuard(store, cfg.Login), passwordManager),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.Server.TLS.Enabled() {
+			fmt.Printf("Server running on port %d (TLS)...\n", cfg.Server.Port)
+			serveErr <- server.ListenAndServeTLS(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
+			return
+		}
+		fmt.Printf("Server running on port %d...\n", cfg.Server.Port)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	exitCode := 0
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Server error: %v", err)
+			exitCode = 1
+		}
+	case <-ctx.Done():
+		fmt.Println("Shutting down, draining in-flight requests...")
+		utils.LM.Logger.Println("Received shutdown signal, draining in-flight requests")
+		if err := shutdown(server); err != nil {
+			exitCode = 1
+		}
+	}
+
+	limiter.Close()
+	close(rekeyStop)
+	close(purgeStop)
+	if searchIndex != nil {
+		if err := searchIndex.Close(); err != nil {
+			log.Printf("Failed to close the search index: %v", err)
+		}
+	}
+	closeResources()
+	os.Exit(exitCode)
+}
+
+func shutdown(server *http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Graceful shutdown did not finish: %v", err)
+		server.Close()
+		return err
+	}
+	return nil
+}
+
+// closeResources runs once no more requests are being served.
+func closeResources() {
+	if err := db.SDB.Close(); err != nil {
+		log.Printf("Failed to close MySQL database: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.MongoClient.Disconnect(ctx); err != nil {
+		log.Printf("Failed to disconnect from MongoDB: %v", err)
+	}
+
+	utils.LM.Logger.Println("Server stopped")
+	if err := utils.LM.Close(); err != nil {
+		log.Printf("Failed to close log file: %v", err)
+	}
+}
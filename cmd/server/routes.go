@@ -0,0 +1,109 @@
+package main
+
+import (
+	"JourneyAppServer/apikeys"
+	"JourneyAppServer/aws"
+	"JourneyAppServer/db"
+	authHandlers "JourneyAppServer/handlers/auth"
+	entriesHandlers "JourneyAppServer/handlers/entries"
+	userHandlers "JourneyAppServer/handlers/users"
+	"JourneyAppServer/lockout"
+	"JourneyAppServer/middleware"
+	"JourneyAppServer/passwords"
+	"JourneyAppServer/ratelimit"
+	"net/http"
+)
+
+// routes builds the API router. Patterns use http.ServeMux's method and
+// {param} syntax, so a request with the wrong method gets a 405 with an Allow
+// header before it reaches a handler. Each pattern is also the key its rate
+// limit policy is looked up by.
+func routes(store *db.Store, limiter *ratelimit.Limiter, guard *lockout.Guard, passwordManager *passwords.Manager) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// public routes are limited per client IP.
+	public := func(pattern string, handler http.HandlerFunc) {
+		mux.HandleFunc(pattern, limiter.Wrap(pattern, handler))
+	}
+	// authed routes are limited per client IP before authentication, so bad
+	// credentials can't hammer the session and key lookups, then per user
+	// after it, and need an API key granting scope.
+	authed := func(pattern, scope string, handler http.HandlerFunc) {
+		mux.HandleFunc(pattern, limiter.WrapIP(pattern, middleware.CombinedAuthMiddleware(store, scope, limiter.Wrap(pattern, handler))))
+	}
+
+	// Login & Users
+	public("POST /api/validate/username", userHandlers.ValidateUsernameHandler(store))
+	public("POST /api/users/create", userHandlers.CreateUserHandler(store))
+	public("POST /api/users/login", userHandlers.LoginHandler(store, guard))
+	public("POST /api/users/login/verify", userHandlers.VerifyLoginHandler(store, guard))
+	authed("GET /api/users/list", apikeys.ScopeAccount, userHandlers.ListUsersHandler(store))
+	authed("GET /api/users/get", apikeys.ScopeAccount, userHandlers.GetUserHandler(store))
+	// Replaced by /api/users/password/change, which checks the current password.
+	// public("PUT /api/users/update", userHandlers.UpdateUserHandler(store))
+	authed("DELETE /api/users/delete", apikeys.ScopeAccount, userHandlers.DeleteAccountHandler(store))
+
+	// Sessions
+	public("POST /api/auth/refresh", authHandlers.RefreshHandler(store))
+	public("POST /api/auth/logout", authHandlers.LogoutHandler(store))
+	authed("GET /api/auth/sessions", apikeys.ScopeAccount, authHandlers.ListSessionsHandler(store))
+	authed("DELETE /api/auth/sessions/{id}", apikeys.ScopeAccount, authHandlers.RevokeSessionHandler(store))
+
+	// Passwords
+	authed("POST /api/users/password/change", apikeys.ScopeAccount, userHandlers.ChangePasswordHandler(store, guard, passwordManager))
+	public("POST /api/users/password/forgot", userHandlers.ForgotPasswordHandler(store, passwordManager))
+	public("POST /api/users/password/reset", userHandlers.ResetPasswordHandler(store, guard, passwordManager))
+
+	// Two-factor authentication
+	authed("GET /api/users/2fa", apikeys.ScopeAccount, userHandlers.TwoFactorStatusHandler(store))
+	authed("POST /api/users/2fa/enroll", apikeys.ScopeAccount, userHandlers.EnrollTwoFactorHandler(store))
+	authed("POST /api/users/2fa/confirm", apikeys.ScopeAccount, userHandlers.ConfirmTwoFactorHandler(store))
+	authed("POST /api/users/2fa/disable", apikeys.ScopeAccount, userHandlers.DisableTwoFactorHandler(store, guard))
+
+	// End-to-end encryption
+	authed("GET /api/users/e2ee", apikeys.ScopeAccount, userHandlers.EncryptionStatusHandler(store))
+	authed("POST /api/users/e2ee", apikeys.ScopeAccount, userHandlers.EnableEncryptionHandler(store, guard))
+
+	// API keys
+	authed("POST /api/users/apiKeys", apikeys.ScopeAccount, userHandlers.CreateAPIKeyHandler(store))
+	authed("GET /api/users/apiKeys", apikeys.ScopeAccount, userHandlers.ListAPIKeysHandler(store))
+	authed("DELETE /api/users/apiKeys/{id}", apikeys.ScopeAccount, userHandlers.RevokeAPIKeyHandler(store))
+	// Any key may rotate itself; the handler checks scopes for other keys.
+	authed("POST /api/users/rotateKey", "", userHandlers.RotateAPIKeyHandler(store))
+
+	// Entries
+	authed("GET /api/entries/list", apikeys.ScopeEntriesRead, entriesHandlers.ListEntriesHandler(store)) // being deprecated
+	authed("POST /api/entries/create", apikeys.ScopeEntriesWrite, entriesHandlers.CreateNewEntryHandler(store))
+	authed("GET /api/entries/get", apikeys.ScopeEntriesRead, entriesHandlers.GetEntryHandler(store))
+	authed("PUT /api/entries/update", apikeys.ScopeEntriesWrite, entriesHandlers.UpdateEntryHandler(store))
+	authed("PATCH /api/entries/update", apikeys.ScopeEntriesWrite, entriesHandlers.PatchEntryHandler(store))
+	// PresignPutHandler has never checked the method, so this route accepts any.
+	authed("/api/entries/getPresignedPutURL", apikeys.ScopeImages, aws.PresignPutHandler)
+	authed("GET /api/entries/getPresignedGetURL", apikeys.ScopeImages, aws.PresignGetHandler)
+	authed("DELETE /api/entries/delete", apikeys.ScopeEntriesWrite, entriesHandlers.DeleteEntryHandler(store))
+	authed("POST /api/entries/search", apikeys.ScopeEntriesRead, entriesHandlers.SearchEntriesHandler(store))
+	authed("GET /api/entries/listUniqueLocations", apikeys.ScopeEntriesRead, entriesHandlers.ListUniqueLocationsHandler(store))
+	authed("GET /api/entries/listUniqueTags", apikeys.ScopeEntriesRead, entriesHandlers.ListUniqueTagsHandler(store))
+	authed("DELETE /api/entries/deleteTag", apikeys.ScopeEntriesWrite, entriesHandlers.DeleteTagHandler(store))
+	authed("DELETE /api/entries/deleteLocation", apikeys.ScopeEntriesWrite, entriesHandlers.DeleteLocationHandler(store))
+	authed("DELETE /api/entries/deleteImage", apikeys.ScopeImages, entriesHandlers.DeleteImageHandler(store))
+	authed("PUT /api/entries/addImage", apikeys.ScopeImages, entriesHandlers.AddImageHandler(store))
+	authed("PUT /api/entries/addLocation", apikeys.ScopeEntriesWrite, entriesHandlers.AddLocationHandler(store))
+	authed("PUT /api/entries/addTag", apikeys.ScopeEntriesWrite, entriesHandlers.AddTagHandler(store))
+	authed("GET /api/entries/revisions", apikeys.ScopeEntriesRead, entriesHandlers.ListRevisionsHandler(store))
+	authed("GET /api/entries/revisions/diff", apikeys.ScopeEntriesRead, entriesHandlers.DiffRevisionsHandler(store))
+	authed("POST /api/entries/revisions/restore", apikeys.ScopeEntriesWrite, entriesHandlers.RestoreRevisionHandler(store))
+	authed("GET /api/entries/trash", apikeys.ScopeEntriesRead, entriesHandlers.ListTrashHandler(store))
+	authed("POST /api/entries/trash/restore", apikeys.ScopeEntriesWrite, entriesHandlers.RestoreEntryHandler(store))
+	authed("DELETE /api/entries/trash", apikeys.ScopeEntriesWrite, entriesHandlers.EmptyTrashHandler(store))
+	//mux.HandleFunc("/fix", entriesHandlers.FixTimestampHandler)
+
+	// Entries by ID. These resolve the entry among the caller's own, so the
+	// timestamp is data rather than part of the address.
+	authed("GET /api/v2/entries/{id}", apikeys.ScopeEntriesRead, entriesHandlers.GetEntryByIDHandler(store))
+	authed("PUT /api/v2/entries/{id}", apikeys.ScopeEntriesWrite, entriesHandlers.ReplaceEntryHandler(store))
+	authed("PATCH /api/v2/entries/{id}", apikeys.ScopeEntriesWrite, entriesHandlers.PatchEntryByIDHandler(store))
+	authed("DELETE /api/v2/entries/{id}", apikeys.ScopeEntriesWrite, entriesHandlers.DeleteEntryByIDHandler(store))
+
+	return mux
+}
@@ -0,0 +1,604 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// devJWTSecret is the secret the server has always signed tokens with. It is
+// only accepted outside of production so local setups keep working.
+const devJWTSecret = "my-temp-secret-key-here"
+
+type Config struct {
+	// Env is "local", "staging" or "production".
+	Env       string          `json:"env"`
+	Server    ServerConfig    `json:"server"`
+	MySQL     MySQLConfig     `json:"mysql"`
+	Mongo     MongoConfig     `json:"mongo"`
+	S3        S3Config        `json:"s3"`
+	JWT       JWTConfig       `json:"jwt"`
+	Log       LogConfig       `json:"log"`
+	RateLimit RateLimitConfig `json:"rateLimit"`
+	Login     LoginConfig     `json:"login"`
+	APIKeys   APIKeysConfig   `json:"apiKeys"`
+	Passwords PasswordsConfig `json:"passwords"`
+	Notifier  NotifierConfig  `json:"notifier"`
+	AtRest    AtRestConfig    `json:"atRest"`
+	Revisions RevisionsConfig `json:"revisions"`
+	Trash     TrashConfig     `json:"trash"`
+	Search    SearchConfig    `json:"search"`
+}
+
+type ServerConfig struct {
+	Port int       `json:"port"`
+	TLS  TLSConfig `json:"tls"`
+	// TrustedProxies are the addresses or CIDR ranges of the proxies in
+	// front of the server. X-Forwarded-For is only believed when a request
+	// comes from one of them; otherwise any client could pick its own IP.
+	TrustedProxies []string `json:"trustedProxies"`
+}
+
+// TrustedProxyPrefixes parses TrustedProxies, a single address being a
+// range of one.
+func (s ServerConfig) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(s.TrustedProxies))
+	for _, proxy := range s.TrustedProxies {
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an IP address nor a CIDR range", proxy)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// TLSConfig is enabled when both files are set; otherwise the server speaks
+// plain HTTP (e.g. behind a proxy that terminates TLS).
+type TLSConfig struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
+
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+type MySQLConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Database string `json:"database"`
+}
+
+func (m MySQLConfig) DSN() string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local", m.User, m.Password, m.Host, m.Port, m.Database)
+}
+
+type MongoConfig struct {
+	URI string `json:"uri"`
+}
+
+type S3Config struct {
+	Bucket string `json:"bucket"`
+	Region string `json:"region"`
+}
+
+type JWTConfig struct {
+	Secret string `json:"secret"`
+}
+
+type LogConfig struct {
+	Dir string `json:"dir"`
+}
+
+type RateLimitConfig struct {
+	// Backend is "memory" (per process) or "mysql" (shared by every server
+	// pointed at the same database).
+	Backend string `json:"backend"`
+	// IdleTimeoutSeconds is how long an unused counter is kept around.
+	IdleTimeoutSeconds int                        `json:"idleTimeoutSeconds"`
+	Default            RateLimitPolicy            `json:"default"`
+	Routes             map[string]RateLimitPolicy `json:"routes"`
+	Users              map[string]RateLimitPolicy `json:"users"`
+	// PerIP limits each client IP across the authenticated routes. It is
+	// counted before authentication, so requests with bad credentials are
+	// throttled too.
+	PerIP RateLimitPolicy `json:"perIP"`
+}
+
+// RateLimitPolicy allows Requests per WindowSeconds.
+type RateLimitPolicy struct {
+	Requests      int `json:"requests"`
+	WindowSeconds int `json:"windowSeconds"`
+}
+
+// LoginConfig controls brute-force protection on login. Failures are counted
+// over the last WindowMinutes.
+type LoginConfig struct {
+	WindowMinutes int `json:"windowMinutes"`
+	// After DelayAfterFailures failures, each further attempt has to wait
+	// twice as long as the last, up to MaxDelaySeconds.
+	DelayAfterFailures int `json:"delayAfterFailures"`
+	MaxDelaySeconds    int `json:"maxDelaySeconds"`
+	// An account is locked after LockoutFailures failures; a client IP after
+	// IPLockoutFailures failures across any accounts.
+	LockoutFailures   int `json:"lockoutFailures"`
+	IPLockoutFailures int `json:"ipLockoutFailures"`
+	LockoutMinutes    int `json:"lockoutMinutes"`
+}
+
+type APIKeysConfig struct {
+	// RotationGraceHours is how long a rotated key keeps working alongside
+	// its replacement, so clients still holding it have time to pick up the
+	// new one.
+	RotationGraceHours int `json:"rotationGraceHours"`
+}
+
+type PasswordsConfig struct {
+	MinLength int `json:"minLength"`
+	// ResetTokenMinutes is how long a password reset token can be used for.
+	ResetTokenMinutes int `json:"resetTokenMinutes"`
+	// Algorithm is "argon2id" or "bcrypt". Passwords hashed any other way
+	// (or with other parameters) are rehashed the next time they are used.
+	Algorithm  string       `json:"algorithm"`
+	BcryptCost int          `json:"bcryptCost"`
+	Argon2     Argon2Config `json:"argon2"`
+}
+
+type Argon2Config struct {
+	MemoryKiB   int `json:"memoryKiB"`
+	Iterations  int `json:"iterations"`
+	Parallelism int `json:"parallelism"`
+}
+
+// NotifierConfig picks how messages such as password reset links reach
+// users. "local" appends them to File (or the server log when File is empty)
+// and is meant for development; in production File is required.
+type NotifierConfig struct {
+	Backend string `json:"backend"`
+	File    string `json:"file"`
+}
+
+// AtRestConfig controls server-side encryption of entry text, tag values and
+// location names. Each user's values are sealed with their own data key,
+// which is stored wrapped by a master key from Provider.
+type AtRestConfig struct {
+	Enabled bool `json:"enabled"`
+	// Provider is where master keys come from. Only "keyfile" exists so far.
+	Provider string `json:"provider"`
+	// Keyfile holds one "<id> <base64 32-byte key>" per line. The last key
+	// wraps data keys; the others are kept to unwrap keys not yet re-keyed.
+	Keyfile string `json:"keyfile"`
+	// RekeyIntervalMinutes is how often the server re-wraps data keys under
+	// the current master key and seals values written before encryption was
+	// on. 0 leaves that to "admin rekey".
+	RekeyIntervalMinutes int `json:"rekeyIntervalMinutes"`
+	RekeyBatchSize       int `json:"rekeyBatchSize"`
+}
+
+// RevisionsConfig limits how much entry history is kept for each user. The
+// oldest revisions are dropped first; 0 means no limit.
+type RevisionsConfig struct {
+	MaxPerEntry int `json:"maxPerEntry"`
+	MaxPerUser  int `json:"maxPerUser"`
+	MaxAgeDays  int `json:"maxAgeDays"`
+}
+
+// TrashConfig controls how long deleted entries, and their images in S3,
+// are kept before they are purged for good.
+type TrashConfig struct {
+	RetentionDays int `json:"retentionDays"`
+	// PurgeIntervalMinutes is how often the server purges entries past
+	// retention. 0 turns the purger off.
+	PurgeIntervalMinutes int `json:"purgeIntervalMinutes"`
+	PurgeBatchSize       int `json:"purgeBatchSize"`
+}
+
+// SearchConfig picks what searches entry text. "mysql" is MySQL's FULLTEXT
+// index. "embedded" is an index the server keeps in IndexDir itself, which
+// also matches word prefixes and typos; run "admin reindex" with the server
+// stopped to rebuild it, which only one process can have it open for.
+type SearchConfig struct {
+	Backend  string `json:"backend"`
+	IndexDir string `json:"indexDir"`
+}
+
+// Default returns the values the server used before it was configurable.
+func Default() Config {
+	return Config{
+		Env: "local",
+		Server: ServerConfig{
+			Port: 6913,
+		},
+		MySQL: MySQLConfig{
+			Host:     "127.0.0.1",
+			Port:     3306,
+			Database: "journey_app",
+		},
+		Mongo: MongoConfig{
+			URI: "mongodb://127.0.0.1:27017",
+		},
+		S3: S3Config{
+			Bucket: "winapps-myjourney",
+			Region: "us-west-2",
+		},
+		JWT: JWTConfig{
+			Secret: devJWTSecret,
+		},
+		Log: LogConfig{
+			Dir: "./logs",
+		},
+		RateLimit: RateLimitConfig{
+			Backend:            "memory",
+			IdleTimeoutSeconds: 600,
+			Default:            RateLimitPolicy{Requests: 100, WindowSeconds: 1},
+			// Keys are the route patterns from cmd/server/routes.go.
+			Routes: map[string]RateLimitPolicy{
+				"POST /api/users/login":           {Requests: 10, WindowSeconds: 60},
+				"POST /api/users/login/verify":    {Requests: 10, WindowSeconds: 60},
+				"POST /api/users/password/forgot": {Requests: 5, WindowSeconds: 3600},
+				"POST /api/users/password/reset":  {Requests: 10, WindowSeconds: 3600},
+				"POST /api/validate/username":     {Requests: 30, WindowSeconds: 60},
+				"POST /api/users/create":          {Requests: 5, WindowSeconds: 3600},
+				"POST /api/auth/refresh":          {Requests: 30, WindowSeconds: 60},
+			},
+			Users: map[string]RateLimitPolicy{},
+			PerIP: RateLimitPolicy{Requests: 200, WindowSeconds: 1},
+		},
+		Login: LoginConfig{
+			WindowMinutes:      15,
+			DelayAfterFailures: 3,
+			MaxDelaySeconds:    30,
+			LockoutFailures:    10,
+			IPLockoutFailures:  100,
+			LockoutMinutes:     15,
+		},
+		APIKeys: APIKeysConfig{
+			RotationGraceHours: 72,
+		},
+		Passwords: PasswordsConfig{
+			MinLength:         8,
+			ResetTokenMinutes: 30,
+			Algorithm:         "argon2id",
+			BcryptCost:        12,
+			// OWASP's minimum recommendation for argon2id.
+			Argon2: Argon2Config{MemoryKiB: 19456, Iterations: 2, Parallelism: 1},
+		},
+		Notifier: NotifierConfig{
+			Backend: "local",
+		},
+		AtRest: AtRestConfig{
+			Provider:             "keyfile",
+			RekeyIntervalMinutes: 60,
+			RekeyBatchSize:       500,
+		},
+		Revisions: RevisionsConfig{
+			MaxPerEntry: 50,
+			MaxPerUser:  5000,
+		},
+		Trash: TrashConfig{
+			RetentionDays:        30,
+			PurgeIntervalMinutes: 60,
+			PurgeBatchSize:       100,
+		},
+		Search: SearchConfig{
+			Backend:  "mysql",
+			IndexDir: "./search-index",
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, then the JSON file at path
+// (skipped when path is empty), then environment variables, and validates the
+// result.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("reading config file: %w", err)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return Config{}, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(&cfg, os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	strs := []struct {
+		names []string
+		dest  *string
+	}{
+		{[]string{"JOURNEY_ENV"}, &cfg.Env},
+		{[]string{"JOURNEY_TLS_CERT_FILE"}, &cfg.Server.TLS.CertFile},
+		{[]string{"JOURNEY_TLS_KEY_FILE"}, &cfg.Server.TLS.KeyFile},
+		{[]string{"JOURNEY_MYSQL_HOST"}, &cfg.MySQL.Host},
+		// DBU and DBP are what the deployment has always exported.
+		{[]string{"DBU", "JOURNEY_MYSQL_USER"}, &cfg.MySQL.User},
+		{[]string{"DBP", "JOURNEY_MYSQL_PASSWORD"}, &cfg.MySQL.Password},
+		{[]string{"JOURNEY_MYSQL_DATABASE"}, &cfg.MySQL.Database},
+		{[]string{"JOURNEY_MONGO_URI"}, &cfg.Mongo.URI},
+		{[]string{"JOURNEY_S3_BUCKET"}, &cfg.S3.Bucket},
+		{[]string{"JOURNEY_S3_REGION"}, &cfg.S3.Region},
+		{[]string{"JOURNEY_JWT_SECRET"}, &cfg.JWT.Secret},
+		{[]string{"JOURNEY_LOG_DIR"}, &cfg.Log.Dir},
+		{[]string{"JOURNEY_RATE_LIMIT_BACKEND"}, &cfg.RateLimit.Backend},
+		{[]string{"JOURNEY_PASSWORD_ALGORITHM"}, &cfg.Passwords.Algorithm},
+		{[]string{"JOURNEY_NOTIFIER_BACKEND"}, &cfg.Notifier.Backend},
+		{[]string{"JOURNEY_NOTIFIER_FILE"}, &cfg.Notifier.File},
+		{[]string{"JOURNEY_AT_REST_KEYFILE"}, &cfg.AtRest.Keyfile},
+		{[]string{"JOURNEY_SEARCH_BACKEND"}, &cfg.Search.Backend},
+		{[]string{"JOURNEY_SEARCH_INDEX_DIR"}, &cfg.Search.IndexDir},
+	}
+	for _, s := range strs {
+		// Later names win, so the JOURNEY_* form overrides a legacy variable.
+		for _, name := range s.names {
+			if v, ok := lookup(name); ok {
+				*s.dest = v
+			}
+		}
+	}
+
+	ints := []struct {
+		name string
+		dest *int
+	}{
+		{"JOURNEY_PORT", &cfg.Server.Port},
+		{"JOURNEY_MYSQL_PORT", &cfg.MySQL.Port},
+	}
+	for _, i := range ints {
+		v, ok := lookup(i.name)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%s must be a number, got %q", i.name, v)
+		}
+		*i.dest = n
+	}
+
+	// JOURNEY_TRUSTED_PROXIES is a comma-separated list.
+	if v, ok := lookup("JOURNEY_TRUSTED_PROXIES"); ok {
+		cfg.Server.TrustedProxies = nil
+		for _, proxy := range strings.Split(v, ",") {
+			if proxy = strings.TrimSpace(proxy); proxy != "" {
+				cfg.Server.TrustedProxies = append(cfg.Server.TrustedProxies, proxy)
+			}
+		}
+	}
+
+	bools := []struct {
+		name string
+		dest *bool
+	}{
+		{"JOURNEY_AT_REST_ENABLED", &cfg.AtRest.Enabled},
+	}
+	for _, b := range bools {
+		v, ok := lookup(b.name)
+		if !ok {
+			continue
+		}
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false, got %q", b.name, v)
+		}
+		*b.dest = enabled
+	}
+	return nil
+}
+
+// Validate reports every problem with the configuration at once.
+func (c Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch c.Env {
+	case "local", "staging", "production":
+	default:
+		add("env must be local, staging or production, got %q", c.Env)
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		add("server.port must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	if (c.Server.TLS.CertFile == "") != (c.Server.TLS.KeyFile == "") {
+		add("server.tls.certFile and server.tls.keyFile must be set together")
+	}
+	for _, f := range []string{c.Server.TLS.CertFile, c.Server.TLS.KeyFile} {
+		if f == "" {
+			continue
+		}
+		if _, err := os.Stat(f); err != nil {
+			add("server.tls: %v", err)
+		}
+	}
+
+	if _, err := c.Server.TrustedProxyPrefixes(); err != nil {
+		add("server.trustedProxies: %v", err)
+	}
+
+	if c.MySQL.Host == "" {
+		add("mysql.host is required")
+	}
+	if c.MySQL.Port < 1 || c.MySQL.Port > 65535 {
+		add("mysql.port must be between 1 and 65535, got %d", c.MySQL.Port)
+	}
+	if c.MySQL.User == "" {
+		add("mysql.user is required (or set DBU)")
+	}
+	if c.MySQL.Database == "" {
+		add("mysql.database is required")
+	}
+
+	if u, err := url.Parse(c.Mongo.URI); err != nil || (u.Scheme != "mongodb" && u.Scheme != "mongodb+srv") {
+		add("mongo.uri must be a mongodb:// or mongodb+srv:// URI, got %q", c.Mongo.URI)
+	}
+
+	if c.S3.Bucket == "" {
+		add("s3.bucket is required")
+	}
+	if c.S3.Region == "" {
+		add("s3.region is required")
+	}
+
+	if c.JWT.Secret == "" {
+		add("jwt.secret is required")
+	} else if c.Env == "production" && (c.JWT.Secret == devJWTSecret || len(c.JWT.Secret) < 32) {
+		add("jwt.secret must be a unique value of at least 32 characters in production")
+	}
+
+	if c.Log.Dir == "" {
+		add("log.dir is required")
+	}
+
+	switch c.RateLimit.Backend {
+	case "memory", "mysql":
+	default:
+		add("rateLimit.backend must be memory or mysql, got %q", c.RateLimit.Backend)
+	}
+	if c.RateLimit.IdleTimeoutSeconds < 1 {
+		add("rateLimit.idleTimeoutSeconds must be positive")
+	}
+	checkPolicy := func(name string, p RateLimitPolicy) {
+		if p.Requests < 1 || p.WindowSeconds < 1 {
+			add("rateLimit %s: requests and windowSeconds must be positive", name)
+		}
+	}
+	checkPolicy("default", c.RateLimit.Default)
+	checkPolicy("perIP", c.RateLimit.PerIP)
+	for route, p := range c.RateLimit.Routes {
+		checkPolicy("route "+route, p)
+	}
+	for user, p := range c.RateLimit.Users {
+		checkPolicy("user "+user, p)
+	}
+
+	for name, v := range map[string]int{
+		"windowMinutes":      c.Login.WindowMinutes,
+		"delayAfterFailures": c.Login.DelayAfterFailures,
+		"maxDelaySeconds":    c.Login.MaxDelaySeconds,
+		"lockoutFailures":    c.Login.LockoutFailures,
+		"ipLockoutFailures":  c.Login.IPLockoutFailures,
+		"lockoutMinutes":     c.Login.LockoutMinutes,
+	} {
+		if v < 1 {
+			add("login.%s must be positive", name)
+		}
+	}
+	if c.Login.DelayAfterFailures >= c.Login.LockoutFailures {
+		add("login.delayAfterFailures must be below login.lockoutFailures")
+	}
+
+	if c.APIKeys.RotationGraceHours < 0 {
+		add("apiKeys.rotationGraceHours must not be negative")
+	}
+
+	if c.Passwords.MinLength < 1 {
+		add("passwords.minLength must be positive")
+	}
+	if c.Passwords.ResetTokenMinutes < 1 {
+		add("passwords.resetTokenMinutes must be positive")
+	}
+	switch c.Passwords.Algorithm {
+	case "argon2id", "bcrypt":
+	default:
+		add("passwords.algorithm must be argon2id or bcrypt, got %q", c.Passwords.Algorithm)
+	}
+	// bcrypt.MinCost and bcrypt.MaxCost.
+	if c.Passwords.BcryptCost < 4 || c.Passwords.BcryptCost > 31 {
+		add("passwords.bcryptCost must be between 4 and 31, got %d", c.Passwords.BcryptCost)
+	}
+	if c.Passwords.Argon2.MemoryKiB < 8*c.Passwords.Argon2.Parallelism || c.Passwords.Argon2.Iterations < 1 ||
+		c.Passwords.Argon2.Parallelism < 1 || c.Passwords.Argon2.Parallelism > 255 {
+		add("passwords.argon2 needs iterations >= 1, parallelism 1-255 and memoryKiB >= 8 * parallelism")
+	}
+
+	switch c.Notifier.Backend {
+	case "local":
+		// Without a file, reset tokens go to the server log, which in
+		// production others can read.
+		if c.Env == "production" && c.Notifier.File == "" {
+			add("notifier.file is required for the local backend in production")
+		}
+	default:
+		add("notifier.backend must be local, got %q", c.Notifier.Backend)
+	}
+
+	switch c.AtRest.Provider {
+	case "keyfile":
+		if c.AtRest.Enabled && c.AtRest.Keyfile == "" {
+			add("atRest.keyfile is required when atRest is enabled")
+		}
+	default:
+		add("atRest.provider must be keyfile, got %q", c.AtRest.Provider)
+	}
+	if c.AtRest.RekeyIntervalMinutes < 0 {
+		add("atRest.rekeyIntervalMinutes must not be negative")
+	}
+	if c.AtRest.RekeyBatchSize < 1 {
+		add("atRest.rekeyBatchSize must be positive")
+	}
+
+	if c.Revisions.MaxPerEntry < 0 {
+		add("revisions.maxPerEntry must not be negative")
+	}
+	if c.Revisions.MaxPerUser < 0 {
+		add("revisions.maxPerUser must not be negative")
+	}
+	if c.Revisions.MaxAgeDays < 0 {
+		add("revisions.maxAgeDays must not be negative")
+	}
+
+	if c.Trash.RetentionDays < 0 {
+		add("trash.retentionDays must not be negative")
+	}
+	if c.Trash.PurgeIntervalMinutes < 0 {
+		add("trash.purgeIntervalMinutes must not be negative")
+	}
+	if c.Trash.PurgeBatchSize < 1 {
+		add("trash.purgeBatchSize must be positive")
+	}
+
+	switch c.Search.Backend {
+	case "mysql":
+	case "embedded":
+		if c.Search.IndexDir == "" {
+			add("search.indexDir is required for the embedded backend")
+		}
+		// The index holds entries' words in the clear.
+		if c.AtRest.Enabled {
+			add("search.backend embedded can't be used with atRest.enabled")
+		}
+	default:
+		add("search.backend must be mysql or embedded, got %q", c.Search.Backend)
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,559 @@
+package db
+
+import (
+	"JourneyAppServer/markdown"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryDB is the shared state behind the in-memory repositories. It mirrors
+// the MySQL schema closely enough for handlers to be exercised without a
+// database, including the users -> entries cascade on delete.
+type memoryDB struct {
+	mu      sync.RWMutex
+	users   map[string]types.User
+	entries map[string]types.Entry
+	// blindIndex maps an entry ID to its E2EE search tokens.
+	blindIndex map[string][]string
+	// plainText maps an entry ID to its text without markdown, like the
+	// plain_text column.
+	plainText map[string]string
+	// index is the SearchIndex kept alongside, or nil to search plainText
+	// directly as a stand-in for the FULLTEXT index.
+	index     SearchIndex
+	revisions []memoryRevision
+	// revisionSeq orders revisions across entries, like revision_id.
+	revisionSeq int64
+	sessions    map[string]types.Session
+	apiKeys     map[string]types.UserAPIKey
+
+	twoFactor     map[string]types.TwoFactor
+	recoveryCodes []memoryRecoveryCode
+	challenges    map[string]types.LoginChallenge
+
+	passwordResets map[string]types.PasswordResetToken
+	encryption     map[string]types.UserEncryption
+	dataKeys       map[string]types.DataKey
+	events         []types.AnalyticsEvent
+
+	loginAttempts []memoryLoginAttempt
+	lockouts      map[string]time.Time
+}
+
+type memoryUsers struct{ *memoryDB }
+type memoryEntries struct{ *memoryDB }
+type memorySessions struct{ *memoryDB }
+type memoryAPIKeys struct{ *memoryDB }
+type memoryTwoFactor struct{ *memoryDB }
+type memoryPasswordResets struct{ *memoryDB }
+type memoryEncryption struct{ *memoryDB }
+type memoryDataKeys struct{ *memoryDB }
+type memoryLoginAttempts struct{ *memoryDB }
+type memoryEvents struct{ *memoryDB }
+
+func NewMemoryStore() *Store {
+	return NewIndexedMemoryStore(nil)
+}
+
+// NewIndexedMemoryStore is NewMemoryStore with entry text searched through
+// index, which it keeps up to date.
+func NewIndexedMemoryStore(index SearchIndex) *Store {
+	m := &memoryDB{
+		index:      index,
+		users:      make(map[string]types.User),
+		entries:    make(map[string]types.Entry),
+		blindIndex: make(map[string][]string),
+		plainText:  make(map[string]string),
+		sessions:   make(map[string]types.Session),
+		apiKeys:    make(map[string]types.UserAPIKey),
+
+		twoFactor:  make(map[string]types.TwoFactor),
+		challenges: make(map[string]types.LoginChallenge),
+
+		passwordResets: make(map[string]types.PasswordResetToken),
+		encryption:     make(map[string]types.UserEncryption),
+		dataKeys:       make(map[string]types.DataKey),
+		lockouts:       make(map[string]time.Time),
+	}
+	return &Store{
+		Users:          memoryUsers{m},
+		Entries:        memoryEntries{m},
+		Sessions:       memorySessions{m},
+		APIKeys:        memoryAPIKeys{m},
+		TwoFactor:      memoryTwoFactor{m},
+		PasswordResets: memoryPasswordResets{m},
+		Encryption:     memoryEncryption{m},
+		DataKeys:       memoryDataKeys{m},
+		LoginAttempts:  memoryLoginAttempts{m},
+		Events:         memoryEvents{m},
+	}
+}
+
+func (m memoryUsers) Create(user types.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Username == user.Username {
+			return fmt.Errorf("duplicate user: %s", user.Username)
+		}
+	}
+	m.users[user.UserID] = user
+	return nil
+}
+
+func (m memoryUsers) find(match func(types.User) bool) (types.User, error) {
+	for _, u := range m.users {
+		if match(u) {
+			return u, nil
+		}
+	}
+	return types.User{}, ErrNotFound
+}
+
+func (m memoryUsers) GetByUsername(username string) (types.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.find(func(u types.User) bool { return u.Username == username })
+}
+
+func (m memoryUsers) UsernameExists(username string) (bool, error) {
+	_, err := m.GetByUsername(username)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (m memoryUsers) List() ([]types.UserListItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var users []types.UserListItem
+	for _, u := range m.users {
+		users = append(users, types.UserListItem{UserID: u.UserID, Username: u.Username})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+func (m memoryUsers) update(match func(types.User) bool, apply func(*types.User)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, err := m.find(match)
+	if err != nil {
+		return err
+	}
+	apply(&user)
+	m.users[user.UserID] = user
+	return nil
+}
+
+func (m memoryUsers) UpdatePassword(username, hashedPassword, salt string) error {
+	return m.update(func(u types.User) bool { return u.Username == username }, func(u *types.User) {
+		u.Password = hashedPassword
+		u.Salt = salt
+	})
+}
+
+func (m memoryUsers) Delete(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, err := m.find(func(u types.User) bool { return u.Username == username })
+	if err != nil {
+		return err
+	}
+	delete(m.users, user.UserID)
+	for id, e := range m.entries {
+		if e.UserID == user.UserID {
+			delete(m.entries, id)
+			delete(m.blindIndex, id)
+			delete(m.plainText, id)
+		}
+	}
+	if m.index != nil {
+		if err := m.index.RemoveUser(user.UserID); err != nil {
+			utils.LM.Logger.Printf("Error removing user %s from the search index: %v", username, err)
+		}
+	}
+	m.keepRevisions(func(r memoryRevision) bool { return r.userID != user.UserID })
+	for id, s := range m.sessions {
+		if s.UserID == user.UserID {
+			delete(m.sessions, id)
+		}
+	}
+	for id, k := range m.apiKeys {
+		if k.UserID == user.UserID {
+			delete(m.apiKeys, id)
+		}
+	}
+	delete(m.twoFactor, user.UserID)
+	m.deleteRecoveryCodes(user.UserID)
+	for hash, c := range m.challenges {
+		if c.UserID == user.UserID {
+			delete(m.challenges, hash)
+		}
+	}
+	for hash, t := range m.passwordResets {
+		if t.UserID == user.UserID {
+			delete(m.passwordResets, hash)
+		}
+	}
+	delete(m.encryption, user.UserID)
+	delete(m.dataKeys, user.UserID)
+	return nil
+}
+
+// copyEntry returns an entry whose slices don't alias the stored copy.
+func copyEntry(e types.Entry) types.Entry {
+	e.Locations = append([]types.LocationData{}, e.Locations...)
+	e.Tags = append([]types.TagData{}, e.Tags...)
+	e.Images = append([]string{}, e.Images...)
+	if e.Stats != nil {
+		stats := *e.Stats
+		stats.Outline = append([]types.OutlineHeading{}, stats.Outline...)
+		e.Stats = &stats
+	}
+	if e.Encrypted != nil {
+		// Blind index tokens live in memoryDB.blindIndex, like their table.
+		enc := *e.Encrypted
+		enc.BlindIndex = nil
+		e.Encrypted = &enc
+	}
+	return e
+}
+
+// lookup finds a live entry; lookupTrashed finds one in the trash.
+func (m memoryEntries) lookup(key EntryKey) (types.Entry, bool) {
+	e, ok := m.lookupAny(key)
+	return e, ok && e.DeletedAt == nil
+}
+
+func (m memoryEntries) lookupTrashed(key EntryKey) (types.Entry, bool) {
+	e, ok := m.lookupAny(key)
+	return e, ok && e.DeletedAt != nil
+}
+
+func (m memoryEntries) lookupAny(key EntryKey) (types.Entry, bool) {
+	e, ok := m.entries[key.ID]
+	if !ok || e.UserID != key.UserID || (!key.Timestamp.IsZero() && !e.Timestamp.Equal(key.Timestamp)) {
+		return types.Entry{}, false
+	}
+	return e, true
+}
+
+func (m memoryEntries) Create(entry types.Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.entries[entry.ID]; ok {
+		return fmt.Errorf("duplicate entry: %s", entry.ID)
+	}
+	found := false
+	for _, u := range m.users {
+		if u.UserID == entry.UserID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("foreign key constraint fails: user %s", entry.UserID)
+	}
+	if entry.LastUpdated.IsZero() {
+		entry.LastUpdated = time.Now().UTC()
+	}
+	entry.Version = 1
+	// copyEntry drops the blind index, so it's kept aside first.
+	if entry.Encrypted != nil {
+		m.blindIndex[entry.ID] = append([]string(nil), entry.Encrypted.BlindIndex...)
+	}
+	entry = copyEntry(entry)
+	m.analyze(&entry)
+	m.entries[entry.ID] = entry
+	return nil
+}
+
+func (m memoryEntries) Get(key EntryKey) (types.Entry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.lookup(key)
+	if !ok {
+		return types.Entry{}, ErrNotFound
+	}
+	return copyEntry(e), nil
+}
+
+// modify applies a change to an entry, saving it as it was as a revision
+// unless apply fails.
+func (m memoryEntries) modify(key EntryKey, reason string, apply func(*types.Entry) error) error {
+	_, err := m.modifyVersion(key, reason, 0, apply)
+	return err
+}
+
+// modifyVersion is modify for a change made against version, which has to
+// be the entry's current one unless it is 0. It returns the changed entry.
+func (m memoryEntries) modifyVersion(key EntryKey, reason string, version int64, apply func(*types.Entry) error) (types.Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.lookup(key)
+	if !ok {
+		return types.Entry{}, ErrNotFound
+	}
+	if version != 0 && e.Version != version {
+		return types.Entry{}, ErrVersionMismatch
+	}
+	snapshot := m.snapshot(e)
+	if err := apply(&e); err != nil {
+		return types.Entry{}, err
+	}
+	e.Version++
+	m.saveRevision(e, reason, snapshot)
+	m.entries[e.ID] = e
+	return copyEntry(e), nil
+}
+
+func (m memoryEntries) Patch(key EntryKey, patch types.EntryPatch, version int64) (types.Entry, error) {
+	return m.modifyVersion(key, RevisionUpdate, version, func(e *types.Entry) error {
+		if patch.Text != nil {
+			e.Text = *patch.Text
+		}
+		if patch.Timestamp != nil {
+			e.Timestamp = *patch.Timestamp
+		}
+		if patch.Encrypted != nil {
+			e.Text = ""
+			e.Encrypted = copyEntry(types.Entry{Encrypted: patch.Encrypted}).Encrypted
+			m.blindIndex[e.ID] = append([]string(nil), patch.Encrypted.BlindIndex...)
+		}
+		e.LastUpdated = patch.LastUpdated
+		if e.LastUpdated.IsZero() {
+			e.LastUpdated = time.Now().UTC()
+		}
+		if patch.Locations != nil {
+			e.Locations = append([]types.LocationData{}, *patch.Locations...)
+		}
+		if patch.Tags != nil {
+			e.Tags = append([]types.TagData{}, *patch.Tags...)
+		}
+		if patch.Images != nil {
+			e.Images = append([]string{}, *patch.Images...)
+		}
+		if patch.Text != nil || patch.Encrypted != nil {
+			m.analyze(e)
+		}
+		return nil
+	})
+}
+
+// analyze works out e's stats and plain text from its text, or drops them
+// for an E2EE entry. Callers hold the lock.
+func (m memoryEntries) analyze(e *types.Entry) {
+	if e.Encrypted != nil {
+		e.Stats = nil
+		delete(m.plainText, e.ID)
+		if m.index != nil {
+			updateIndex(m.index, e.UserID, e.ID, nil)
+		}
+		return
+	}
+	analysis := markdown.Analyze(e.Text)
+	e.Stats = &analysis.Stats
+	m.plainText[e.ID] = analysis.PlainText
+	if m.index != nil {
+		updateIndex(m.index, e.UserID, e.ID, &analysis.PlainText)
+	}
+}
+
+func (m memoryEntries) Delete(key EntryKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.lookup(key)
+	if !ok {
+		return ErrNotFound
+	}
+	deletedAt := time.Now().UTC()
+	e.DeletedAt = &deletedAt
+	m.entries[e.ID] = e
+	return nil
+}
+
+func (m memoryEntries) ReplaceTags(key EntryKey, tags []types.TagData) error {
+	return m.modify(key, RevisionUpdate, func(e *types.Entry) error {
+		e.Tags = append([]types.TagData{}, tags...)
+		e.LastUpdated = time.Now().UTC()
+		return nil
+	})
+}
+
+func (m memoryEntries) ReplaceLocations(key EntryKey, locations []types.LocationData) error {
+	return m.modify(key, RevisionUpdate, func(e *types.Entry) error {
+		e.Locations = append([]types.LocationData{}, locations...)
+		e.LastUpdated = time.Now().UTC()
+		return nil
+	})
+}
+
+func (m memoryEntries) ReplaceImages(key EntryKey, images []string) error {
+	return m.modify(key, RevisionUpdate, func(e *types.Entry) error {
+		e.Images = append([]string{}, images...)
+		e.LastUpdated = time.Now().UTC()
+		return nil
+	})
+}
+
+func (m memoryEntries) DeleteImage(key EntryKey, image string) error {
+	return m.modify(key, RevisionUpdate, func(e *types.Entry) error {
+		for i, img := range e.Images {
+			if img == image {
+				e.Images = append(e.Images[:i:i], e.Images[i+1:]...)
+				e.LastUpdated = time.Now().UTC()
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+}
+
+func (m memoryEntries) ImageKeys(entryID string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]string(nil), m.entries[entryID].Images...), nil
+}
+
+func (m memoryEntries) UserImageKeys(username string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var keys []string
+	for _, e := range m.entries {
+		if e.Username == username {
+			keys = append(keys, e.Images...)
+		}
+	}
+	return keys, nil
+}
+
+// userEntries returns copies of username's entries sorted by timestamp,
+// newest first unless oldestFirst is set.
+func (m memoryEntries) userEntries(username string, oldestFirst bool) []types.Entry {
+	var entries []types.Entry
+	for _, e := range m.entries {
+		if e.Username == username && e.DeletedAt == nil {
+			entries = append(entries, copyEntry(e))
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if oldestFirst {
+			return entries[i].Timestamp.Before(entries[j].Timestamp)
+		}
+		return entries[i].Timestamp.After(entries[j].Timestamp)
+	})
+	return entries
+}
+
+func paginate[T any](items []T, page, limit int64) []T {
+	offset := (page - 1) * limit
+	if offset < 0 || offset >= int64(len(items)) {
+		return nil
+	}
+	end := offset + limit
+	if end > int64(len(items)) {
+		end = int64(len(items))
+	}
+	return items[offset:end]
+}
+
+func (m memoryEntries) List(params types.ListEntriesParams) ([]types.EntryListItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := m.userEntries(params.User, strings.ToLower(params.SortRule) == "oldest")
+
+	var results []types.EntryListItem
+	for _, e := range paginate(entries, params.Page, params.Limit) {
+		results = append(results, types.EntryListItem{
+			ID:        e.ID,
+			Text:      e.Text,
+			Timestamp: e.Timestamp,
+			Locations: e.Locations,
+			Tags:      e.Tags,
+			Images:    e.Images,
+			Encrypted: e.Encrypted,
+		})
+	}
+	return results, nil
+}
+
+func (m memoryEntries) UniqueTags(username string) ([]types.TagData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	seen := make(map[types.TagData]bool)
+	var tags []types.TagData
+	for _, e := range m.entries {
+		if e.Username != username || e.DeletedAt != nil {
+			continue
+		}
+		for _, tag := range e.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].Key < tags[j].Key })
+	return tags, nil
+}
+
+func (m memoryEntries) UniqueLocations(username string) ([]types.LocationData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	seen := make(map[types.LocationData]bool)
+	var locations []types.LocationData
+	for _, e := range m.entries {
+		if e.Username != username || e.DeletedAt != nil {
+			continue
+		}
+		for _, loc := range e.Locations {
+			if !seen[loc] {
+				seen[loc] = true
+				locations = append(locations, loc)
+			}
+		}
+	}
+	sort.SliceStable(locations, func(i, j int) bool { return locations[i].DisplayName < locations[j].DisplayName })
+	return locations, nil
+}
+
+// SealPlaintext has nothing to do: the memory store isn't at rest anywhere.
+func (m memoryEntries) SealPlaintext(limit int) (int, error) {
+	return 0, nil
+}
+
+// AnalyzeText has nothing to do either, since every entry here was written
+// by code that analyzes it.
+func (m memoryEntries) AnalyzeText(limit int) (int, error) {
+	return 0, nil
+}
+
+func (m memoryEntries) PlainTexts(after string, limit int) ([]EntryText, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var texts []EntryText
+	for id, text := range m.plainText {
+		if id > after {
+			texts = append(texts, EntryText{UserID: m.entries[id].UserID, EntryID: id, PlainText: text})
+		}
+	}
+	sort.Slice(texts, func(i, j int) bool { return texts[i].EntryID < texts[j].EntryID })
+	if len(texts) > limit {
+		texts = texts[:limit]
+	}
+	return texts, nil
+}
+
+func (m memoryEvents) Record(event types.AnalyticsEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+	return nil
+}
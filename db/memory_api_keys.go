@@ -0,0 +1,129 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"fmt"
+	"sort"
+	"time"
+)
+
+func copyAPIKey(k types.UserAPIKey) types.UserAPIKey {
+	k.Scopes = append([]string{}, k.Scopes...)
+	return k
+}
+
+func (m memoryAPIKeys) Create(key types.UserAPIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkNewAPIKey(key); err != nil {
+		return err
+	}
+	m.apiKeys[key.ID] = copyAPIKey(key)
+	return nil
+}
+
+// checkNewAPIKey applies the table's constraints to a key about to be
+// inserted. The caller holds the lock.
+func (m memoryAPIKeys) checkNewAPIKey(key types.UserAPIKey) error {
+	if _, ok := m.apiKeys[key.ID]; ok {
+		return fmt.Errorf("duplicate api key: %s", key.ID)
+	}
+	for _, k := range m.apiKeys {
+		if k.KeyHash == key.KeyHash {
+			return fmt.Errorf("duplicate api key hash")
+		}
+	}
+	if _, ok := m.users[key.UserID]; !ok {
+		return fmt.Errorf("foreign key constraint fails: user %s", key.UserID)
+	}
+	return nil
+}
+
+func (m memoryAPIKeys) GetByHash(hash string) (types.UserAPIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, k := range m.apiKeys {
+		if k.KeyHash == hash {
+			return copyAPIKey(k), nil
+		}
+	}
+	return types.UserAPIKey{}, ErrNotFound
+}
+
+func (m memoryAPIKeys) Get(username, keyID string) (types.UserAPIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	k, ok := m.apiKeys[keyID]
+	if !ok || k.Username != username {
+		return types.UserAPIKey{}, ErrNotFound
+	}
+	return copyAPIKey(k), nil
+}
+
+func (m memoryAPIKeys) List(username string) ([]types.UserAPIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var keys []types.UserAPIKey
+	for _, k := range m.apiKeys {
+		if k.Username == username {
+			keys = append(keys, copyAPIKey(k))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (m memoryAPIKeys) Touch(keyID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if k, ok := m.apiKeys[keyID]; ok {
+		k.LastUsedAt = at
+		m.apiKeys[keyID] = k
+	}
+	return nil
+}
+
+func (m memoryAPIKeys) Revoke(username, keyID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.apiKeys[keyID]
+	if !ok || k.Username != username || !k.RevokedAt.IsZero() {
+		return ErrNotFound
+	}
+	k.RevokedAt = at
+	m.apiKeys[keyID] = k
+	return nil
+}
+
+func (m memoryAPIKeys) Rotate(oldID string, replacement types.UserAPIKey, graceUntil time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.apiKeys[oldID]
+	if !ok || k.ReplacedBy != "" || !k.RevokedAt.IsZero() {
+		return ErrNotFound
+	}
+	if err := m.checkNewAPIKey(replacement); err != nil {
+		return err
+	}
+	k.ReplacedBy = replacement.ID
+	if k.ExpiresAt.IsZero() || graceUntil.Before(k.ExpiresAt) {
+		k.ExpiresAt = graceUntil
+	}
+	m.apiKeys[oldID] = k
+	m.apiKeys[replacement.ID] = copyAPIKey(replacement)
+	return nil
+}
+
+func (m memoryAPIKeys) PruneSessionKeys(username string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, k := range m.apiKeys {
+		if k.Username != username || k.SessionID == "" {
+			continue
+		}
+		if !k.RevokedAt.IsZero() || (!k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)) {
+			delete(m.apiKeys, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"fmt"
+	"sort"
+	"time"
+)
+
+func (m memoryDataKeys) Get(userID string) (types.DataKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	key, ok := m.dataKeys[userID]
+	if !ok {
+		return types.DataKey{}, ErrNotFound
+	}
+	key.WrappedKey = append([]byte(nil), key.WrappedKey...)
+	return key, nil
+}
+
+func (m memoryDataKeys) Create(key types.DataKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[key.UserID]; !ok {
+		return fmt.Errorf("foreign key constraint fails: user %s", key.UserID)
+	}
+	if _, ok := m.dataKeys[key.UserID]; ok {
+		return nil
+	}
+	key.WrappedKey = append([]byte(nil), key.WrappedKey...)
+	m.dataKeys[key.UserID] = key
+	return nil
+}
+
+func (m memoryDataKeys) ListStale(masterKeyID string, limit int) ([]types.DataKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var keys []types.DataKey
+	for _, key := range m.dataKeys {
+		if key.MasterKeyID != masterKeyID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].UserID < keys[j].UserID })
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys, nil
+}
+
+func (m memoryDataKeys) Rewrap(userID, oldMasterKeyID string, wrappedKey []byte, masterKeyID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.dataKeys[userID]
+	if !ok || key.MasterKeyID != oldMasterKeyID {
+		return ErrNotFound
+	}
+	key.WrappedKey = append([]byte(nil), wrappedKey...)
+	key.MasterKeyID = masterKeyID
+	key.RewrappedAt = at
+	m.dataKeys[userID] = key
+	return nil
+}
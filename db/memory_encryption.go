@@ -0,0 +1,31 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"fmt"
+)
+
+func (m memoryEncryption) Get(userID string) (types.UserEncryption, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	enc, ok := m.encryption[userID]
+	if !ok {
+		return types.UserEncryption{}, ErrNotFound
+	}
+	enc.WrappedKey = append([]byte(nil), enc.WrappedKey...)
+	return enc, nil
+}
+
+func (m memoryEncryption) Save(enc types.UserEncryption) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[enc.UserID]; !ok {
+		return fmt.Errorf("foreign key constraint fails: user %s", enc.UserID)
+	}
+	if existing, ok := m.encryption[enc.UserID]; ok {
+		enc.EnabledAt = existing.EnabledAt
+	}
+	enc.WrappedKey = append([]byte(nil), enc.WrappedKey...)
+	m.encryption[enc.UserID] = enc
+	return nil
+}
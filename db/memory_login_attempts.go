@@ -0,0 +1,86 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"time"
+)
+
+type memoryLoginAttempt struct {
+	types.LoginAttempt
+	cleared bool
+}
+
+func (m memoryLoginAttempts) Record(attempt types.LoginAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loginAttempts = append(m.loginAttempts, memoryLoginAttempt{LoginAttempt: attempt})
+	return nil
+}
+
+func (m memoryLoginAttempts) Failures(username, clientIP string, since time.Time) (byUser, byIP types.LoginFailures, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	count := func(f *types.LoginFailures, a memoryLoginAttempt) {
+		f.Count++
+		if a.AttemptedAt.After(f.Last) {
+			f.Last = a.AttemptedAt
+		}
+	}
+	for _, a := range m.loginAttempts {
+		if a.Succeeded || a.cleared || a.AttemptedAt.Before(since) {
+			continue
+		}
+		if a.Username == username {
+			count(&byUser, a)
+		}
+		if a.ClientIP == clientIP {
+			count(&byIP, a)
+		}
+	}
+	return byUser, byIP, nil
+}
+
+func (m memoryLoginAttempts) clear(match func(memoryLoginAttempt) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.loginAttempts {
+		if match(m.loginAttempts[i]) {
+			m.loginAttempts[i].cleared = true
+		}
+	}
+}
+
+func (m memoryLoginAttempts) ClearUser(username string) error {
+	m.clear(func(a memoryLoginAttempt) bool { return a.Username == username })
+	return nil
+}
+
+func (m memoryLoginAttempts) ClearIP(clientIP string) error {
+	m.clear(func(a memoryLoginAttempt) bool { return a.ClientIP == clientIP })
+	return nil
+}
+
+func (m memoryLoginAttempts) Lock(key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if until.After(m.lockouts[key]) {
+		m.lockouts[key] = until
+	}
+	return nil
+}
+
+func (m memoryLoginAttempts) LockedUntil(key string) (time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lockouts[key], nil
+}
+
+func (m memoryLoginAttempts) Unlock(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.lockouts[key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.lockouts, key)
+	return nil
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"fmt"
+	"time"
+)
+
+func (m memoryPasswordResets) Create(token types.PasswordResetToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[token.UserID]; !ok {
+		return fmt.Errorf("foreign key constraint fails: user %s", token.UserID)
+	}
+	if _, ok := m.passwordResets[token.Hash]; ok {
+		return fmt.Errorf("duplicate password reset token")
+	}
+	m.passwordResets[token.Hash] = token
+	return nil
+}
+
+func (m memoryPasswordResets) Get(hash string) (types.PasswordResetToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.passwordResets[hash]
+	if !ok {
+		return types.PasswordResetToken{}, ErrNotFound
+	}
+	return t, nil
+}
+
+func (m memoryPasswordResets) Use(hash string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.passwordResets[hash]
+	if !ok || !t.UsedAt.IsZero() {
+		return ErrNotFound
+	}
+	t.UsedAt = at
+	m.passwordResets[hash] = t
+	return nil
+}
+
+func (m memoryPasswordResets) InvalidateAll(userID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for hash, t := range m.passwordResets {
+		if t.UserID == userID && t.UsedAt.IsZero() {
+			t.UsedAt = at
+			m.passwordResets[hash] = t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"sort"
+	"time"
+)
+
+type memoryRevision struct {
+	types.EntryRevision
+	id     int64
+	userID string
+}
+
+// snapshot captures e, E2EE tokens included, for a revision. Callers hold
+// the lock.
+func (m memoryEntries) snapshot(e types.Entry) types.EntrySnapshot {
+	e = copyEntry(e)
+	if e.Encrypted != nil {
+		e.Encrypted.BlindIndex = append([]string(nil), m.blindIndex[e.ID]...)
+	}
+	return types.EntrySnapshot{
+		Text:      e.Text,
+		Locations: e.Locations,
+		Tags:      e.Tags,
+		Images:    e.Images,
+		Encrypted: e.Encrypted,
+	}
+}
+
+func (m memoryEntries) saveRevision(e types.Entry, reason string, snapshot types.EntrySnapshot) {
+	var next int64 = 1
+	for _, r := range m.revisions {
+		if r.EntryID == e.ID && r.Revision >= next {
+			next = r.Revision + 1
+		}
+	}
+	m.revisionSeq++
+	m.revisions = append(m.revisions, memoryRevision{
+		EntryRevision: types.EntryRevision{
+			EntryID:   e.ID,
+			Revision:  next,
+			Reason:    reason,
+			CreatedAt: time.Now().UTC(),
+			Snapshot:  snapshot,
+		},
+		id:     m.revisionSeq,
+		userID: e.UserID,
+	})
+}
+
+// keepRevisions drops every revision keep returns false for.
+func (m *memoryDB) keepRevisions(keep func(memoryRevision) bool) {
+	kept := m.revisions[:0]
+	for _, r := range m.revisions {
+		if keep(r) {
+			kept = append(kept, r)
+		}
+	}
+	m.revisions = kept
+}
+
+// copyRevision returns a revision whose snapshot doesn't alias the stored
+// one.
+func copyRevision(r types.EntryRevision) types.EntryRevision {
+	e := copyEntry(types.Entry{
+		Locations: r.Snapshot.Locations,
+		Tags:      r.Snapshot.Tags,
+		Images:    r.Snapshot.Images,
+	})
+	r.Snapshot.Locations, r.Snapshot.Tags, r.Snapshot.Images = e.Locations, e.Tags, e.Images
+	if r.Snapshot.Encrypted != nil {
+		enc := *r.Snapshot.Encrypted
+		enc.BlindIndex = append([]string(nil), enc.BlindIndex...)
+		r.Snapshot.Encrypted = &enc
+	}
+	return r
+}
+
+func (m memoryEntries) Revisions(key EntryKey) ([]types.EntryRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.lookup(key); !ok {
+		return nil, ErrNotFound
+	}
+	revisions := []types.EntryRevision{}
+	for _, r := range m.revisions {
+		if r.EntryID == key.ID {
+			revisions = append(revisions, copyRevision(r.EntryRevision))
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision > revisions[j].Revision })
+	return revisions, nil
+}
+
+func (m memoryEntries) revision(key EntryKey, revision int64) (types.EntryRevision, error) {
+	if _, ok := m.lookup(key); !ok {
+		return types.EntryRevision{}, ErrNotFound
+	}
+	for _, r := range m.revisions {
+		if r.EntryID == key.ID && r.Revision == revision {
+			return copyRevision(r.EntryRevision), nil
+		}
+	}
+	return types.EntryRevision{}, ErrNotFound
+}
+
+func (m memoryEntries) Revision(key EntryKey, revision int64) (types.EntryRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.revision(key, revision)
+}
+
+func (m memoryEntries) Restore(key EntryKey, revision int64, dropImages []string) error {
+	return m.modify(key, RevisionRestore, func(e *types.Entry) error {
+		rev, err := m.revision(key, revision)
+		if err != nil {
+			return err
+		}
+		snap := rev.Snapshot
+		e.Text = snap.Text
+		e.Locations = snap.Locations
+		e.Tags = snap.Tags
+		e.Images = withoutImages(snap.Images, dropImages)
+		e.Encrypted = nil
+		delete(m.blindIndex, e.ID)
+		if snap.Encrypted != nil {
+			e.Encrypted = copyEntry(types.Entry{Encrypted: snap.Encrypted}).Encrypted
+			m.blindIndex[e.ID] = snap.Encrypted.BlindIndex
+		}
+		m.analyze(e)
+		e.LastUpdated = time.Now().UTC()
+		return nil
+	})
+}
+
+func (m memoryEntries) PruneRevisions(userID, entryID string, keepPerEntry, keepPerUser int, olderThan time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// m.revisions is in creation order, so the newest are at the end.
+	newest := func(match func(memoryRevision) bool, keep int) map[int64]bool {
+		kept := make(map[int64]bool)
+		for i := len(m.revisions) - 1; i >= 0 && len(kept) < keep; i-- {
+			if match(m.revisions[i]) {
+				kept[m.revisions[i].id] = true
+			}
+		}
+		return kept
+	}
+	if keepPerEntry > 0 {
+		kept := newest(func(r memoryRevision) bool { return r.EntryID == entryID }, keepPerEntry)
+		m.keepRevisions(func(r memoryRevision) bool { return r.EntryID != entryID || kept[r.id] })
+	}
+	if keepPerUser > 0 {
+		kept := newest(func(r memoryRevision) bool { return r.userID == userID }, keepPerUser)
+		m.keepRevisions(func(r memoryRevision) bool { return r.userID != userID || kept[r.id] })
+	}
+	if !olderThan.IsZero() {
+		m.keepRevisions(func(r memoryRevision) bool { return r.userID != userID || !r.CreatedAt.Before(olderThan) })
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package db
+
+import (
+	"JourneyAppServer/geo"
+	"JourneyAppServer/search"
+	"JourneyAppServer/types"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// words lowercases text into its runs of letters and digits, each with a
+// space on either side, so a phrase is found with strings.Contains.
+func words(text string) string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return " " + strings.Join(fields, " ") + " "
+}
+
+// needle is what a text term approximates MATCH() with in text normalized
+// by words: whole words or phrases, or the start of a word for prefixes.
+func needle(term search.Text) string {
+	if term.Prefix {
+		return " " + strings.Join(term.Words(), " ")
+	}
+	return " " + strings.Join(term.Words(), " ") + " "
+}
+
+// matches evaluates a parsed query against e, whose plain text has been
+// normalized by words. matched has what the search index matched for each
+// text term, if there is one.
+func matches(e types.Entry, text string, expr search.Expr, matched textMatches) bool {
+	switch x := expr.(type) {
+	case search.And:
+		for _, term := range x.Terms {
+			if !matches(e, text, term, matched) {
+				return false
+			}
+		}
+		return true
+	case search.Or:
+		for _, term := range x.Terms {
+			if matches(e, text, term, matched) {
+				return true
+			}
+		}
+		return false
+	case search.Not:
+		return !matches(e, text, x.Expr, matched)
+	case search.Text:
+		if matched != nil {
+			_, ok := matched[x][e.ID]
+			return ok
+		}
+		return strings.Contains(text, needle(x))
+	case search.Tag:
+		return anyTag(e.Tags, []types.TagData{{Key: x.Key}})
+	case search.Location:
+		return anyLocation(e.Locations, []types.LocationData{{DisplayName: x.Name}})
+	case search.Before:
+		return e.Timestamp.Before(x.Time)
+	case search.After:
+		return !e.Timestamp.Before(x.Time)
+	case search.Has:
+		switch x.What {
+		case search.HasImage:
+			return len(e.Images) > 0
+		case search.HasLocation:
+			return len(e.Locations) > 0
+		case search.HasTag:
+			return len(e.Tags) > 0
+		}
+	}
+	return false
+}
+
+// relevance stands in for MATCH()'s score: how often terms appear in text
+// normalized by words.
+func relevance(text string, terms []search.Text) float64 {
+	score := 0
+	for _, term := range terms {
+		score += strings.Count(text, needle(term))
+	}
+	return float64(score)
+}
+
+func (m memoryEntries) Search(req types.SearchEntriesRequest, query search.Expr) ([]SearchHit, int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var from, to time.Time
+	if req.Timeframe == "custom" {
+		from, to = customRange(req)
+	} else {
+		from = timeframeStart(req.Timeframe, time.Now())
+	}
+
+	terms := search.TextTerms(query)
+	// matched and scores are what the search index found, if there is one.
+	var matched textMatches
+	var scores map[string]float64
+	if m.index != nil {
+		user, err := memoryUsers{m.memoryDB}.find(func(u types.User) bool { return u.Username == req.User })
+		if err == ErrNotFound {
+			return nil, 0, nil
+		}
+		if matched, err = matchTerms(m.index, user.UserID, query); err != nil {
+			return nil, 0, err
+		}
+		scores = matched.score(terms)
+	}
+	var hits []SearchHit
+	for _, e := range m.userEntries(req.User, req.SortRule == "Oldest") {
+		plainText := m.plainText[e.ID]
+		text := words(plainText)
+		if query != nil && !matches(e, text, query, matched) {
+			continue
+		}
+		if len(req.BlindTokens) > 0 && !allTokens(m.blindIndex[e.ID], req.BlindTokens) {
+			continue
+		}
+		if len(req.Locations) > 0 && !anyLocation(e.Locations, req.Locations) {
+			continue
+		}
+		if !matchesTags(e.Tags, req) {
+			continue
+		}
+		distance, ok := matchesGeo(e.Locations, req)
+		if !ok {
+			continue
+		}
+		if !from.IsZero() && e.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && e.Timestamp.After(to) {
+			continue
+		}
+		hit := SearchHit{Entry: e, PlainText: plainText, Distance: distance}
+		if matched != nil {
+			hit.Score = scores[e.ID]
+		} else {
+			hit.Score = relevance(text, terms)
+		}
+		hits = append(hits, hit)
+	}
+	switch {
+	case req.Nearest != nil:
+		sort.SliceStable(hits, func(i, j int) bool { return *hits[i].Distance < *hits[j].Distance })
+		if len(hits) > req.Nearest.Count {
+			hits = hits[:req.Nearest.Count]
+		}
+	case req.SortRule == "Relevance":
+		// userEntries has them newest first, which breaks ties.
+		sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	}
+	return paginate(hits, req.Page, req.Limit), int64(len(hits)), nil
+}
+
+// matchesGeo reports whether one of locations is inside req's WithinRadius
+// and WithinBounds, or whether there is one at all for Nearest. The
+// distance is the closest such location's from the point of Nearest or
+// WithinRadius, if req has one.
+func matchesGeo(locations []types.LocationData, req types.SearchEntriesRequest) (*float64, bool) {
+	if req.WithinRadius == nil && req.WithinBounds == nil && req.Nearest == nil {
+		return nil, true
+	}
+	var closest *float64
+	found := false
+	for _, loc := range locations {
+		if r := req.WithinRadius; r != nil && geo.Distance(r.Latitude, r.Longitude, loc.Latitude, loc.Longitude) > r.Meters {
+			continue
+		}
+		if b := req.WithinBounds; b != nil && !geo.Bounds(*b).Contains(loc.Latitude, loc.Longitude) {
+			continue
+		}
+		found = true
+		var d float64
+		switch {
+		case req.Nearest != nil:
+			d = geo.Distance(req.Nearest.Latitude, req.Nearest.Longitude, loc.Latitude, loc.Longitude)
+		case req.WithinRadius != nil:
+			d = geo.Distance(req.WithinRadius.Latitude, req.WithinRadius.Longitude, loc.Latitude, loc.Longitude)
+		default:
+			continue
+		}
+		if closest == nil || d < *closest {
+			closest = &d
+		}
+	}
+	return closest, found
+}
+
+func anyLocation(have, want []types.LocationData) bool {
+	for _, w := range want {
+		for _, h := range have {
+			if h.DisplayName == w.DisplayName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// anyTag reports whether have has any one of want, by key, and by value too
+// for those with one.
+func anyTag(have, want []types.TagData) bool {
+	for _, w := range want {
+		for _, h := range have {
+			if h.Key == w.Key && (w.Value == "" || h.Value == w.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesTags is req's tag filter.
+func matchesTags(have []types.TagData, req types.SearchEntriesRequest) bool {
+	if req.TagMode == types.TagModeAll {
+		for _, w := range req.Tags {
+			if !anyTag(have, []types.TagData{w}) {
+				return false
+			}
+		}
+	} else if len(req.Tags) > 0 && !anyTag(have, req.Tags) {
+		return false
+	}
+	return !anyTag(have, req.ExcludeTags)
+}
+
+func allTokens(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"fmt"
+	"sort"
+	"time"
+)
+
+func (m memorySessions) Create(session types.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[session.ID]; ok {
+		return fmt.Errorf("duplicate session: %s", session.ID)
+	}
+	if _, ok := m.users[session.UserID]; !ok {
+		return fmt.Errorf("foreign key constraint fails: user %s", session.UserID)
+	}
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m memorySessions) Get(sessionID string) (types.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sessions[sessionID]
+	if !ok {
+		return types.Session{}, ErrNotFound
+	}
+	return s, nil
+}
+
+func (m memorySessions) GetByRefreshHash(hash string) (types.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, s := range m.sessions {
+		if s.RefreshTokenHash == hash || (s.PreviousTokenHash != "" && s.PreviousTokenHash == hash) {
+			return s, nil
+		}
+	}
+	return types.Session{}, ErrNotFound
+}
+
+func (m memorySessions) Rotate(sessionID, oldHash, newHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[sessionID]
+	if !ok || s.RefreshTokenHash != oldHash || !s.RevokedAt.IsZero() {
+		return ErrNotFound
+	}
+	s.PreviousTokenHash = s.RefreshTokenHash
+	s.RefreshTokenHash = newHash
+	s.LastUsedAt = time.Now().UTC()
+	m.sessions[sessionID] = s
+	return nil
+}
+
+func (m memorySessions) ListActive(username string) ([]types.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := time.Now()
+	var sessions []types.Session
+	for _, s := range m.sessions {
+		if s.Username == username && s.RevokedAt.IsZero() && s.ExpiresAt.After(now) {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, nil
+}
+
+func (m memorySessions) Revoke(sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[sessionID]
+	if !ok || !s.RevokedAt.IsZero() {
+		return ErrNotFound
+	}
+	s.RevokedAt = time.Now().UTC()
+	m.sessions[sessionID] = s
+	m.revokeSessionKeys(func(k types.UserAPIKey) bool { return k.SessionID == sessionID }, s.RevokedAt)
+	return nil
+}
+
+func (m memorySessions) RevokeAllForUser(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	for id, s := range m.sessions {
+		if s.Username == username && s.RevokedAt.IsZero() {
+			s.RevokedAt = now
+			m.sessions[id] = s
+		}
+	}
+	m.revokeSessionKeys(func(k types.UserAPIKey) bool { return k.Username == username && k.SessionID != "" }, now)
+	return nil
+}
+
+// revokeSessionKeys revokes the unrevoked API keys matching match. The
+// caller holds the lock.
+func (m memorySessions) revokeSessionKeys(match func(types.UserAPIKey) bool, at time.Time) {
+	for id, k := range m.apiKeys {
+		if match(k) && k.RevokedAt.IsZero() {
+			k.RevokedAt = at
+			m.apiKeys[id] = k
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"sort"
+	"time"
+)
+
+// trashed returns copies of the trashed entries match accepts, oldest
+// deletion first.
+func (m memoryEntries) trashed(match func(types.Entry) bool) []types.Entry {
+	var entries []types.Entry
+	for _, e := range m.entries {
+		if e.DeletedAt != nil && match(e) {
+			entries = append(entries, copyEntry(e))
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].DeletedAt.Before(*entries[j].DeletedAt) })
+	return entries
+}
+
+func (m memoryEntries) ListTrash(userID string, page, limit int64) ([]types.EntryListItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := m.trashed(func(e types.Entry) bool { return e.UserID == userID })
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	results := []types.EntryListItem{}
+	for _, e := range paginate(entries, page, limit) {
+		results = append(results, types.EntryListItem{
+			ID:        e.ID,
+			Text:      e.Text,
+			Timestamp: e.Timestamp,
+			Locations: e.Locations,
+			Tags:      e.Tags,
+			Images:    e.Images,
+			Encrypted: e.Encrypted,
+			DeletedAt: e.DeletedAt,
+		})
+	}
+	return results, nil
+}
+
+func (m memoryEntries) Undelete(key EntryKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.lookupTrashed(key)
+	if !ok {
+		return ErrNotFound
+	}
+	e.DeletedAt = nil
+	m.entries[e.ID] = e
+	return nil
+}
+
+func (m memoryEntries) Trashed(userID string, before time.Time, limit int) ([]types.Entry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := m.trashed(func(e types.Entry) bool {
+		return (userID == "" || e.UserID == userID) && (before.IsZero() || e.DeletedAt.Before(before))
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (m memoryEntries) Purge(key EntryKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.lookupTrashed(key); !ok {
+		return ErrNotFound
+	}
+	delete(m.entries, key.ID)
+	delete(m.blindIndex, key.ID)
+	delete(m.plainText, key.ID)
+	if m.index != nil {
+		updateIndex(m.index, key.UserID, key.ID, nil)
+	}
+	m.keepRevisions(func(r memoryRevision) bool { return r.EntryID != key.ID })
+	return nil
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"fmt"
+	"time"
+)
+
+type memoryRecoveryCode struct {
+	userID   string
+	codeHash string
+	used     bool
+}
+
+func (m memoryTwoFactor) Get(userID string) (types.TwoFactor, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tf, ok := m.twoFactor[userID]
+	if !ok {
+		return types.TwoFactor{}, ErrNotFound
+	}
+	return tf, nil
+}
+
+func (m memoryTwoFactor) SavePending(userID, secret string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[userID]; !ok {
+		return fmt.Errorf("foreign key constraint fails: user %s", userID)
+	}
+	if tf, ok := m.twoFactor[userID]; ok && !tf.EnabledAt.IsZero() {
+		return nil
+	}
+	m.twoFactor[userID] = types.TwoFactor{UserID: userID, Secret: secret, CreatedAt: at}
+	return nil
+}
+
+// deleteRecoveryCodes expects the caller to hold the lock.
+func (m *memoryDB) deleteRecoveryCodes(userID string) {
+	kept := m.recoveryCodes[:0]
+	for _, c := range m.recoveryCodes {
+		if c.userID != userID {
+			kept = append(kept, c)
+		}
+	}
+	m.recoveryCodes = kept
+}
+
+func (m memoryTwoFactor) Enable(userID string, at time.Time, recoveryCodeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tf, ok := m.twoFactor[userID]
+	if !ok || !tf.EnabledAt.IsZero() {
+		return ErrNotFound
+	}
+	tf.EnabledAt = at
+	m.twoFactor[userID] = tf
+	m.deleteRecoveryCodes(userID)
+	for _, hash := range recoveryCodeHashes {
+		m.recoveryCodes = append(m.recoveryCodes, memoryRecoveryCode{userID: userID, codeHash: hash})
+	}
+	return nil
+}
+
+func (m memoryTwoFactor) Disable(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.twoFactor[userID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.twoFactor, userID)
+	m.deleteRecoveryCodes(userID)
+	return nil
+}
+
+func (m memoryTwoFactor) UseStep(userID string, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tf, ok := m.twoFactor[userID]
+	if !ok || (tf.LastUsedStep != 0 && tf.LastUsedStep >= step) {
+		return ErrNotFound
+	}
+	tf.LastUsedStep = step
+	m.twoFactor[userID] = tf
+	return nil
+}
+
+func (m memoryTwoFactor) UseRecoveryCode(userID, codeHash string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, c := range m.recoveryCodes {
+		if c.userID == userID && c.codeHash == codeHash && !c.used {
+			m.recoveryCodes[i].used = true
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m memoryTwoFactor) RecoveryCodesRemaining(userID string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	count := 0
+	for _, c := range m.recoveryCodes {
+		if c.userID == userID && !c.used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m memoryTwoFactor) CreateChallenge(c types.LoginChallenge) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[c.UserID]; !ok {
+		return fmt.Errorf("foreign key constraint fails: user %s", c.UserID)
+	}
+	m.challenges[c.Hash] = c
+	return nil
+}
+
+func (m memoryTwoFactor) GetChallenge(hash string) (types.LoginChallenge, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, ok := m.challenges[hash]
+	if !ok {
+		return types.LoginChallenge{}, ErrNotFound
+	}
+	return c, nil
+}
+
+func (m memoryTwoFactor) FailChallenge(hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.challenges[hash]; ok {
+		c.Attempts++
+		m.challenges[hash] = c
+	}
+	return nil
+}
+
+func (m memoryTwoFactor) ConsumeChallenge(hash string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.challenges[hash]
+	if !ok || !c.ConsumedAt.IsZero() {
+		return ErrNotFound
+	}
+	c.ConsumedAt = at
+	m.challenges[hash] = c
+	return nil
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type mysqlAPIKeys struct {
+	sdb *sql.DB
+}
+
+const apiKeyColumns = `
+        key_id, user_id, username, name, key_hash, key_prefix, scopes,
+        created_at, last_used_at, expires_at, revoked_at, replaced_by, session_id
+    `
+
+func scanAPIKey(row rowScanner) (types.UserAPIKey, error) {
+	var k types.UserAPIKey
+	var scopes string
+	var lastUsed, expiresAt, revokedAt sql.NullTime
+	var replacedBy, sessionID sql.NullString
+	err := row.Scan(
+		&k.ID, &k.UserID, &k.Username, &k.Name, &k.KeyHash, &k.Prefix, &scopes,
+		&k.CreatedAt, &lastUsed, &expiresAt, &revokedAt, &replacedBy, &sessionID,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return types.UserAPIKey{}, ErrNotFound
+		}
+		return types.UserAPIKey{}, err
+	}
+	k.Scopes = []string{}
+	if scopes != "" {
+		k.Scopes = strings.Split(scopes, ",")
+	}
+	k.LastUsedAt = lastUsed.Time
+	k.ExpiresAt = expiresAt.Time
+	k.RevokedAt = revokedAt.Time
+	k.ReplacedBy = replacedBy.String
+	k.SessionID = sessionID.String
+	return k, nil
+}
+
+// nullTime stores the zero time as NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func (m *mysqlAPIKeys) Create(key types.UserAPIKey) error {
+	return insertAPIKey(m.sdb, key)
+}
+
+func insertAPIKey(q queryer, key types.UserAPIKey) error {
+	query := `
+        INSERT INTO api_keys (
+            key_id, user_id, username, name, key_hash, key_prefix, scopes,
+            created_at, last_used_at, expires_at, session_id
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+	_, err := q.Exec(query,
+		key.ID, key.UserID, key.Username, key.Name, key.KeyHash, key.Prefix, strings.Join(key.Scopes, ","),
+		key.CreatedAt, nullTime(key.LastUsedAt), nullTime(key.ExpiresAt),
+		sql.NullString{String: key.SessionID, Valid: key.SessionID != ""},
+	)
+	return err
+}
+
+func (m *mysqlAPIKeys) GetByHash(hash string) (types.UserAPIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = ?`
+	return scanAPIKey(m.sdb.QueryRow(query, hash))
+}
+
+func (m *mysqlAPIKeys) Get(username, keyID string) (types.UserAPIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_id = ? AND username = ?`
+	return scanAPIKey(m.sdb.QueryRow(query, keyID, username))
+}
+
+func (m *mysqlAPIKeys) List(username string) ([]types.UserAPIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE username = ? ORDER BY created_at DESC`
+	rows, err := m.sdb.Query(query, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []types.UserAPIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (m *mysqlAPIKeys) Touch(keyID string, at time.Time) error {
+	_, err := m.sdb.Exec(`UPDATE api_keys SET last_used_at = ? WHERE key_id = ?`, at, keyID)
+	return err
+}
+
+func (m *mysqlAPIKeys) Revoke(username, keyID string, at time.Time) error {
+	query := `UPDATE api_keys SET revoked_at = ? WHERE key_id = ? AND username = ? AND revoked_at IS NULL`
+	return execAffecting(m.sdb, query, at, keyID, username)
+}
+
+func (m *mysqlAPIKeys) Rotate(oldID string, replacement types.UserAPIKey, graceUntil time.Time) error {
+	return inTx(m.sdb, func(tx *sql.Tx) error {
+		// The update claims the old key first, so of two concurrent rotations
+		// only one gets to insert a replacement.
+		query := `
+            UPDATE api_keys
+            SET replaced_by = ?, expires_at = LEAST(COALESCE(expires_at, ?), ?)
+            WHERE key_id = ? AND replaced_by IS NULL AND revoked_at IS NULL
+        `
+		if err := execAffecting(tx, query, replacement.ID, graceUntil, graceUntil, oldID); err != nil {
+			return err
+		}
+		return insertAPIKey(tx, replacement)
+	})
+}
+
+func (m *mysqlAPIKeys) PruneSessionKeys(username string, now time.Time) error {
+	query := `
+        DELETE FROM api_keys
+        WHERE username = ? AND session_id IS NOT NULL
+            AND (revoked_at IS NOT NULL OR expires_at <= ?)
+    `
+	_, err := m.sdb.Exec(query, username, now)
+	return err
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"database/sql"
+	"time"
+)
+
+type mysqlDataKeys struct {
+	sdb *sql.DB
+}
+
+func scanDataKey(row rowScanner) (types.DataKey, error) {
+	var key types.DataKey
+	var rewrappedAt sql.NullTime
+	if err := row.Scan(&key.UserID, &key.WrappedKey, &key.MasterKeyID, &key.CreatedAt, &rewrappedAt); err != nil {
+		return types.DataKey{}, err
+	}
+	key.RewrappedAt = rewrappedAt.Time
+	return key, nil
+}
+
+func (m *mysqlDataKeys) Get(userID string) (types.DataKey, error) {
+	query := `SELECT user_id, wrapped_key, master_key_id, created_at, rewrapped_at FROM user_data_keys WHERE user_id = ?`
+	key, err := scanDataKey(m.sdb.QueryRow(query, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return types.DataKey{}, ErrNotFound
+		}
+		return types.DataKey{}, err
+	}
+	return key, nil
+}
+
+func (m *mysqlDataKeys) Create(key types.DataKey) error {
+	query := `
+        INSERT IGNORE INTO user_data_keys (user_id, wrapped_key, master_key_id, created_at)
+        VALUES (?, ?, ?, ?)
+    `
+	_, err := m.sdb.Exec(query, key.UserID, key.WrappedKey, key.MasterKeyID, key.CreatedAt)
+	return err
+}
+
+func (m *mysqlDataKeys) ListStale(masterKeyID string, limit int) ([]types.DataKey, error) {
+	query := `
+        SELECT user_id, wrapped_key, master_key_id, created_at, rewrapped_at
+        FROM user_data_keys
+        WHERE master_key_id != ?
+        LIMIT ?
+    `
+	rows, err := m.sdb.Query(query, masterKeyID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []types.DataKey
+	for rows.Next() {
+		key, err := scanDataKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (m *mysqlDataKeys) Rewrap(userID, oldMasterKeyID string, wrappedKey []byte, masterKeyID string, at time.Time) error {
+	query := `
+        UPDATE user_data_keys
+        SET wrapped_key = ?, master_key_id = ?, rewrapped_at = ?
+        WHERE user_id = ? AND master_key_id = ?
+    `
+	return execAffecting(m.sdb, query, wrappedKey, masterKeyID, at, userID, oldMasterKeyID)
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"database/sql"
+)
+
+type mysqlEncryption struct {
+	sdb *sql.DB
+}
+
+func (m *mysqlEncryption) Get(userID string) (types.UserEncryption, error) {
+	query := `
+        SELECT user_id, wrapped_key, key_algorithm, kdf_params, enabled_at, updated_at
+        FROM user_encryption
+        WHERE user_id = ?
+    `
+	var enc types.UserEncryption
+	var kdfParams sql.NullString
+	err := m.sdb.QueryRow(query, userID).Scan(&enc.UserID, &enc.WrappedKey, &enc.Algorithm, &kdfParams, &enc.EnabledAt, &enc.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return types.UserEncryption{}, ErrNotFound
+		}
+		return types.UserEncryption{}, err
+	}
+	enc.KDFParams = kdfParams.String
+	return enc, nil
+}
+
+func (m *mysqlEncryption) Save(enc types.UserEncryption) error {
+	// enabled_at keeps the time E2EE was first turned on.
+	query := `
+        INSERT INTO user_encryption (user_id, wrapped_key, key_algorithm, kdf_params, enabled_at, updated_at)
+        VALUES (?, ?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            wrapped_key = VALUES(wrapped_key),
+            key_algorithm = VALUES(key_algorithm),
+            kdf_params = VALUES(kdf_params),
+            updated_at = VALUES(updated_at)
+    `
+	kdfParams := sql.NullString{String: enc.KDFParams, Valid: enc.KDFParams != ""}
+	_, err := m.sdb.Exec(query, enc.UserID, enc.WrappedKey, enc.Algorithm, kdfParams, enc.EnabledAt, enc.UpdatedAt)
+	return err
+}
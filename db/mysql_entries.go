@@ -0,0 +1,785 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+type mysqlEntries struct {
+	sdb    *sql.DB
+	cipher FieldCipher
+	index  SearchIndex
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func inTx(sdb *sql.DB, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := sdb.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+	return fn(tx)
+}
+
+// where is the condition selecting key's entry, with its columns prefixed by
+// alias, and the condition's arguments.
+func (key EntryKey) where(alias string) (string, []interface{}) {
+	cond := alias + "entry_id = ? AND " + alias + "user_id = ?"
+	args := []interface{}{key.ID, key.UserID}
+	if !key.Timestamp.IsZero() {
+		cond += " AND " + alias + "timestamp = ?"
+		args = append(args, key.Timestamp)
+	}
+	return cond, args
+}
+
+func entryExists(q queryer, key EntryKey) (bool, error) {
+	var exists bool
+	cond, args := key.where("")
+	checkQuery := `
+        SELECT EXISTS(
+            SELECT 1 FROM entries
+            WHERE ` + cond + ` AND deleted_at IS NULL
+        )
+    `
+	err := q.QueryRow(checkQuery, args...).Scan(&exists)
+	if err != nil {
+		utils.LM.Logger.Printf("Error checking entry existence: entry=%s, userId=%s, error=%v", key.ID, key.UserID, err)
+	}
+	return exists, err
+}
+
+func touchEntry(q queryer, key EntryKey) error {
+	cond, args := key.where("")
+	updateQuery := `
+        UPDATE entries
+        SET last_updated = NOW(), version = version + 1
+        WHERE ` + cond + ` AND deleted_at IS NULL
+    `
+	_, err := q.Exec(updateQuery, args...)
+	if err != nil {
+		utils.LM.Logger.Printf("Error updating last_updated for entry %s: %v", key.ID, err)
+	}
+	return err
+}
+
+// insertLocations takes the names' tokens from sealLocations alongside them.
+func insertLocations(q queryer, entryID string, locations []types.LocationData, nameTokens []sql.NullString) error {
+	locQuery := `
+        INSERT INTO entry_locations (entry_id, latitude, longitude, display_name, display_name_token)
+        VALUES (?, ?, ?, ?, ?)
+    `
+	for i, loc := range locations {
+		if _, err := q.Exec(locQuery, entryID, loc.Latitude, loc.Longitude, loc.DisplayName, nameTokens[i]); err != nil {
+			utils.LM.Logger.Printf("Error inserting location for entry %s: lat=%f, lon=%f, name=%s, error=%v",
+				entryID, loc.Latitude, loc.Longitude, loc.DisplayName, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func insertTags(q queryer, entryID string, tags []types.TagData, valueTokens []sql.NullString) error {
+	tagQuery := `
+        INSERT INTO entry_tags (entry_id, tag_key, tag_value, tag_value_token)
+        VALUES (?, ?, ?, ?)
+    `
+	for i, tag := range tags {
+		if _, err := q.Exec(tagQuery, entryID, tag.Key, tag.Value, valueTokens[i]); err != nil {
+			utils.LM.Logger.Printf("Error inserting tag for entry %s: key=%s, value=%s, error=%v",
+				entryID, tag.Key, tag.Value, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func insertImages(q queryer, entryID string, images []string) error {
+	imgQuery := `
+        INSERT INTO entry_images (entry_id, image_url)
+        VALUES (?, ?)
+    `
+	for _, image := range images {
+		if _, err := q.Exec(imgQuery, entryID, image); err != nil {
+			utils.LM.Logger.Printf("Error inserting image for entry %s: url=%s, error=%v", entryID, image, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func replaceLocations(q queryer, entryID string, locations []types.LocationData, nameTokens []sql.NullString) error {
+	if _, err := q.Exec(`DELETE FROM entry_locations WHERE entry_id = ?`, entryID); err != nil {
+		utils.LM.Logger.Printf("Error deleting existing locations for entry %s: %v", entryID, err)
+		return err
+	}
+	return insertLocations(q, entryID, locations, nameTokens)
+}
+
+func replaceTags(q queryer, entryID string, tags []types.TagData, valueTokens []sql.NullString) error {
+	if _, err := q.Exec(`DELETE FROM entry_tags WHERE entry_id = ?`, entryID); err != nil {
+		utils.LM.Logger.Printf("Error deleting existing tags for entry %s: %v", entryID, err)
+		return err
+	}
+	return insertTags(q, entryID, tags, valueTokens)
+}
+
+func replaceImages(q queryer, entryID string, images []string) error {
+	if _, err := q.Exec(`DELETE FROM entry_images WHERE entry_id = ?`, entryID); err != nil {
+		utils.LM.Logger.Printf("Error deleting existing images for entry %s: %v", entryID, err)
+		return err
+	}
+	return insertImages(q, entryID, images)
+}
+
+// envelope rebuilds an entry's EncryptedPayload from its columns, or returns
+// nil for a plaintext entry.
+func envelope(ciphertext, wrappedKey, nonce []byte, algorithm sql.NullString) *types.EncryptedPayload {
+	if ciphertext == nil {
+		return nil
+	}
+	return &types.EncryptedPayload{
+		Ciphertext: ciphertext,
+		WrappedKey: wrappedKey,
+		Nonce:      nonce,
+		Algorithm:  algorithm.String,
+	}
+}
+
+func replaceBlindIndex(q queryer, entryID string, tokens []string) error {
+	if _, err := q.Exec(`DELETE FROM entry_blind_index WHERE entry_id = ?`, entryID); err != nil {
+		utils.LM.Logger.Printf("Error deleting blind index for entry %s: %v", entryID, err)
+		return err
+	}
+	// INSERT IGNORE drops duplicate tokens rather than failing the write.
+	for _, token := range tokens {
+		if _, err := q.Exec(`INSERT IGNORE INTO entry_blind_index (entry_id, token) VALUES (?, ?)`, entryID, token); err != nil {
+			utils.LM.Logger.Printf("Error inserting blind index token for entry %s: %v", entryID, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// loadEntryChildren fills in the locations, tags and images of an entry.
+func loadEntryChildren(q queryer, entry *types.Entry) error {
+	entry.Locations = []types.LocationData{}
+	locRows, err := q.Query(`SELECT latitude, longitude, display_name FROM entry_locations WHERE entry_id = ?`, entry.ID)
+	if err != nil {
+		utils.LM.Logger.Printf("Error querying locations for entry %s: %v", entry.ID, err)
+		return err
+	}
+	defer locRows.Close()
+	for locRows.Next() {
+		var loc types.LocationData
+		var displayName sql.NullString
+		if err := locRows.Scan(&loc.Latitude, &loc.Longitude, &displayName); err != nil {
+			utils.LM.Logger.Printf("Error scanning location for entry %s: %v", entry.ID, err)
+			return err
+		}
+		loc.DisplayName = displayName.String
+		entry.Locations = append(entry.Locations, loc)
+	}
+	if err := locRows.Err(); err != nil {
+		utils.LM.Logger.Printf("Location row iteration error for entry %s: %v", entry.ID, err)
+		return err
+	}
+
+	entry.Tags = []types.TagData{}
+	tagRows, err := q.Query(`SELECT tag_key, tag_value FROM entry_tags WHERE entry_id = ?`, entry.ID)
+	if err != nil {
+		utils.LM.Logger.Printf("Error querying tags for entry %s: %v", entry.ID, err)
+		return err
+	}
+	defer tagRows.Close()
+	for tagRows.Next() {
+		var tag types.TagData
+		var value sql.NullString
+		if err := tagRows.Scan(&tag.Key, &value); err != nil {
+			utils.LM.Logger.Printf("Error scanning tag for entry %s: %v", entry.ID, err)
+			return err
+		}
+		tag.Value = value.String
+		entry.Tags = append(entry.Tags, tag)
+	}
+	if err := tagRows.Err(); err != nil {
+		utils.LM.Logger.Printf("Tag row iteration error for entry %s: %v", entry.ID, err)
+		return err
+	}
+
+	entry.Images = []string{}
+	imgRows, err := q.Query(`SELECT image_url FROM entry_images WHERE entry_id = ?`, entry.ID)
+	if err != nil {
+		utils.LM.Logger.Printf("Error querying images for entry %s: %v", entry.ID, err)
+		return err
+	}
+	defer imgRows.Close()
+	for imgRows.Next() {
+		var image string
+		if err := imgRows.Scan(&image); err != nil {
+			utils.LM.Logger.Printf("Error scanning image for entry %s: %v", entry.ID, err)
+			return err
+		}
+		entry.Images = append(entry.Images, image)
+	}
+	if err := imgRows.Err(); err != nil {
+		utils.LM.Logger.Printf("Image row iteration error for entry %s: %v", entry.ID, err)
+		return err
+	}
+	return nil
+}
+
+func (m *mysqlEntries) Create(entry types.Entry) error {
+	text := sealedText{}
+	var err error
+	if entry.Encrypted != nil {
+		text.tokens = entry.Encrypted.BlindIndex
+	} else if text, err = m.sealText(entry.UserID, entry.Text); err != nil {
+		return err
+	}
+	locations, nameTokens, err := m.sealLocations(entry.UserID, entry.Locations)
+	if err != nil {
+		return err
+	}
+	tags, valueTokens, err := m.sealTags(entry.UserID, entry.Tags)
+	if err != nil {
+		return err
+	}
+
+	err = inTx(m.sdb, func(tx *sql.Tx) error {
+		entryQuery := `
+            INSERT INTO entries (entry_id, user_id, username, text, plain_text, stats, timestamp,
+                ciphertext, wrapped_key, nonce, algorithm)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        `
+		var ciphertext, wrappedKey, nonce []byte
+		var algorithm sql.NullString
+		if entry.Encrypted != nil {
+			ciphertext, wrappedKey, nonce = entry.Encrypted.Ciphertext, entry.Encrypted.WrappedKey, entry.Encrypted.Nonce
+			algorithm = sql.NullString{String: entry.Encrypted.Algorithm, Valid: true}
+		}
+		_, err := tx.Exec(entryQuery, entry.ID, entry.UserID, entry.Username, text.text, text.plainText, text.stats,
+			entry.Timestamp, ciphertext, wrappedKey, nonce, algorithm)
+		if err != nil {
+			utils.LM.Logger.Printf("Error inserting entry into database: user=%s, error=%v", entry.Username, err)
+			return err
+		}
+		if len(text.tokens) > 0 {
+			if err := replaceBlindIndex(tx, entry.ID, text.tokens); err != nil {
+				return err
+			}
+		}
+		if err := insertLocations(tx, entry.ID, locations, nameTokens); err != nil {
+			return err
+		}
+		if err := insertTags(tx, entry.ID, tags, valueTokens); err != nil {
+			return err
+		}
+		return insertImages(tx, entry.ID, entry.Images)
+	})
+	if err == nil {
+		updateIndex(m.index, entry.UserID, entry.ID, text.indexed)
+	}
+	return err
+}
+
+func (m *mysqlEntries) Get(key EntryKey) (types.Entry, error) {
+	return m.get(m.sdb, key)
+}
+
+// get loads and opens an entry through q, so it can be used inside a
+// transaction.
+func (m *mysqlEntries) get(q queryer, key EntryKey) (types.Entry, error) {
+	cond, args := key.where("")
+	query := `
+        SELECT entry_id, user_id, username, text, timestamp, last_updated, ciphertext, wrapped_key, nonce, algorithm, version, stats
+        FROM entries
+        WHERE ` + cond + ` AND deleted_at IS NULL
+    `
+	entry, err := scanEntry(q.QueryRow(query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return types.Entry{}, ErrNotFound
+		}
+		utils.LM.Logger.Printf("Error querying entry from database: id=%s, userId=%s, timestamp=%v, error=%v", key.ID, key.UserID, key.Timestamp, err)
+		return types.Entry{}, err
+	}
+
+	if err := loadEntryChildren(q, &entry); err != nil {
+		return types.Entry{}, err
+	}
+	if err := m.open(&entry); err != nil {
+		return types.Entry{}, err
+	}
+	return entry, nil
+}
+
+// lockVersion locks an entry's row for the rest of tx and checks it is at
+// version, unless version is 0.
+func lockVersion(tx *sql.Tx, key EntryKey, version int64) error {
+	var current int64
+	cond, args := key.where("")
+	err := tx.QueryRow(`
+        SELECT version FROM entries
+        WHERE `+cond+` AND deleted_at IS NULL
+        FOR UPDATE
+    `, args...).Scan(&current)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if version != 0 && current != version {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+func (m *mysqlEntries) Patch(key EntryKey, patch types.EntryPatch, version int64) (types.Entry, error) {
+	var text sealedText
+	var err error
+	if patch.Text != nil {
+		if text, err = m.sealText(key.UserID, *patch.Text); err != nil {
+			return types.Entry{}, err
+		}
+	}
+	var locations []types.LocationData
+	var nameTokens []sql.NullString
+	if patch.Locations != nil {
+		if locations, nameTokens, err = m.sealLocations(key.UserID, *patch.Locations); err != nil {
+			return types.Entry{}, err
+		}
+	}
+	var tags []types.TagData
+	var valueTokens []sql.NullString
+	if patch.Tags != nil {
+		if tags, valueTokens, err = m.sealTags(key.UserID, *patch.Tags); err != nil {
+			return types.Entry{}, err
+		}
+	}
+
+	var patched types.Entry
+	err = inTx(m.sdb, func(tx *sql.Tx) error {
+		if err := lockVersion(tx, key, version); err != nil {
+			return err
+		}
+		if err := m.saveRevision(tx, key, RevisionUpdate); err != nil {
+			return err
+		}
+
+		var sets []string
+		var args []interface{}
+		if patch.Text != nil {
+			sets = append(sets, "text = ?", "plain_text = ?", "stats = ?")
+			args = append(args, text.text, text.plainText, text.stats)
+		}
+		if patch.Timestamp != nil {
+			sets = append(sets, "timestamp = ?")
+			args = append(args, *patch.Timestamp)
+		}
+		if patch.Encrypted != nil {
+			// Writing ciphertext also drops any plaintext left from
+			// before the user turned E2EE on.
+			sets = append(sets, "text = ''", "plain_text = NULL", "stats = NULL",
+				"ciphertext = ?", "wrapped_key = ?", "nonce = ?", "algorithm = ?")
+			args = append(args, patch.Encrypted.Ciphertext, patch.Encrypted.WrappedKey, patch.Encrypted.Nonce, patch.Encrypted.Algorithm)
+		}
+		lastUpdated := patch.LastUpdated
+		if lastUpdated.IsZero() {
+			lastUpdated = time.Now().UTC()
+		}
+		sets = append(sets, "last_updated = ?", "version = version + 1")
+		args = append(args, lastUpdated)
+		cond, keyArgs := key.where("")
+		args = append(args, keyArgs...)
+
+		updateQuery := "UPDATE entries SET " + strings.Join(sets, ", ") + " WHERE " + cond
+		if _, err := tx.Exec(updateQuery, args...); err != nil {
+			utils.LM.Logger.Printf("Error updating entry: id=%s, userId=%s, error=%v", key.ID, key.UserID, err)
+			return err
+		}
+		if patch.Encrypted != nil {
+			text.tokens = patch.Encrypted.BlindIndex
+		}
+		if patch.Encrypted != nil || (patch.Text != nil && m.cipher != nil) {
+			if err := replaceBlindIndex(tx, key.ID, text.tokens); err != nil {
+				return err
+			}
+		}
+
+		if patch.Locations != nil {
+			if err := replaceLocations(tx, key.ID, locations, nameTokens); err != nil {
+				return err
+			}
+		}
+		if patch.Tags != nil {
+			if err := replaceTags(tx, key.ID, tags, valueTokens); err != nil {
+				return err
+			}
+		}
+		if patch.Images != nil {
+			if err := replaceImages(tx, key.ID, *patch.Images); err != nil {
+				return err
+			}
+		}
+		if patch.Timestamp != nil && !key.Timestamp.IsZero() {
+			key.Timestamp = *patch.Timestamp
+		}
+		var err error
+		patched, err = m.get(tx, key)
+		return err
+	})
+	if err == nil && patch.Encrypted != nil {
+		updateIndex(m.index, key.UserID, key.ID, nil)
+	} else if err == nil && patch.Text != nil {
+		updateIndex(m.index, key.UserID, key.ID, text.indexed)
+	}
+	return patched, err
+}
+
+func (m *mysqlEntries) Delete(key EntryKey) error {
+	cond, args := key.where("")
+	deleteQuery := `
+        UPDATE entries
+        SET deleted_at = ?
+        WHERE ` + cond + ` AND deleted_at IS NULL
+    `
+	result, err := m.sdb.Exec(deleteQuery, append([]interface{}{time.Now().UTC()}, args...)...)
+	if err != nil {
+		utils.LM.Logger.Printf("Error deleting entry from database: id=%s, userId=%s, timestamp=%v, error=%v", key.ID, key.UserID, key.Timestamp, err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		utils.LM.Logger.Printf("Error checking rows affected for entry deletion: id=%s, userId=%s, error=%v", key.ID, key.UserID, err)
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// replaceChildren runs replace against an existing entry, saving a revision
+// first, and bumps its last_updated.
+func (m *mysqlEntries) replaceChildren(key EntryKey, replace func(tx *sql.Tx) error) error {
+	return inTx(m.sdb, func(tx *sql.Tx) error {
+		if err := m.saveRevision(tx, key, RevisionUpdate); err != nil {
+			return err
+		}
+		if err := replace(tx); err != nil {
+			return err
+		}
+		return touchEntry(tx, key)
+	})
+}
+
+func (m *mysqlEntries) ReplaceTags(key EntryKey, tags []types.TagData) error {
+	tags, valueTokens, err := m.sealTags(key.UserID, tags)
+	if err != nil {
+		return err
+	}
+	return m.replaceChildren(key, func(tx *sql.Tx) error {
+		return replaceTags(tx, key.ID, tags, valueTokens)
+	})
+}
+
+func (m *mysqlEntries) ReplaceLocations(key EntryKey, locations []types.LocationData) error {
+	locations, nameTokens, err := m.sealLocations(key.UserID, locations)
+	if err != nil {
+		return err
+	}
+	return m.replaceChildren(key, func(tx *sql.Tx) error {
+		return replaceLocations(tx, key.ID, locations, nameTokens)
+	})
+}
+
+func (m *mysqlEntries) ReplaceImages(key EntryKey, images []string) error {
+	return m.replaceChildren(key, func(tx *sql.Tx) error {
+		return replaceImages(tx, key.ID, images)
+	})
+}
+
+func (m *mysqlEntries) DeleteImage(key EntryKey, image string) error {
+	return m.replaceChildren(key, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`DELETE FROM entry_images WHERE entry_id = ? AND image_url = ?`, key.ID, image)
+		if err != nil {
+			utils.LM.Logger.Printf("Error deleting image %s from entry %s in database: %v", image, key.ID, err)
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+func (m *mysqlEntries) ImageKeys(entryID string) ([]string, error) {
+	rows, err := m.sdb.Query(`SELECT image_url FROM entry_images WHERE entry_id = ?`, entryID)
+	if err != nil {
+		utils.LM.Logger.Printf("Error querying images for entry %s: %v", entryID, err)
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+func (m *mysqlEntries) UserImageKeys(username string) ([]string, error) {
+	query := `
+        SELECT ei.image_url
+        FROM entries e
+        JOIN entry_images ei ON e.entry_id = ei.entry_id
+        WHERE e.username = ?
+    `
+	rows, err := m.sdb.Query(query, username)
+	if err != nil {
+		utils.LM.Logger.Printf("Error querying entry images for user %s: %v", username, err)
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+func (m *mysqlEntries) List(params types.ListEntriesParams) ([]types.EntryListItem, error) {
+	sortDir := "DESC"
+	if strings.ToLower(params.SortRule) == "oldest" {
+		sortDir = "ASC"
+	}
+	query := `
+        SELECT entry_id, user_id, username, text, timestamp, last_updated, ciphertext, wrapped_key, nonce, algorithm, version, stats
+        FROM entries
+        WHERE username = ? AND deleted_at IS NULL
+        ORDER BY timestamp ` + sortDir + `
+        LIMIT ? OFFSET ?
+    `
+	rows, err := m.sdb.Query(query, params.User, params.Limit, (params.Page-1)*params.Limit)
+	if err != nil {
+		utils.LM.Logger.Printf("Error listing entries: user=%s, error=%v", params.User, err)
+		return nil, err
+	}
+	entries, err := scanEntries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []types.EntryListItem
+	for _, e := range entries {
+		if err := loadEntryChildren(m.sdb, &e); err != nil {
+			return nil, err
+		}
+		if err := m.open(&e); err != nil {
+			return nil, err
+		}
+		results = append(results, types.EntryListItem{
+			ID:        e.ID,
+			Text:      e.Text,
+			Timestamp: e.Timestamp,
+			Locations: e.Locations,
+			Tags:      e.Tags,
+			Images:    e.Images,
+			Encrypted: e.Encrypted,
+		})
+	}
+	return results, nil
+}
+
+// scanEntry reads entry_id, user_id, username, text, timestamp, last_updated,
+// the four encryption columns, version and stats, in that order, followed by
+// any extra columns into extra.
+func scanEntry(row rowScanner, extra ...interface{}) (types.Entry, error) {
+	var e types.Entry
+	var ciphertext, wrappedKey, nonce []byte
+	var algorithm, stats sql.NullString
+	dest := []interface{}{&e.ID, &e.UserID, &e.Username, &e.Text, &e.Timestamp, &e.LastUpdated,
+		&ciphertext, &wrappedKey, &nonce, &algorithm, &e.Version, &stats}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return types.Entry{}, err
+	}
+	e.Encrypted = envelope(ciphertext, wrappedKey, nonce, algorithm)
+	if stats.Valid {
+		e.Stats = &types.EntryStats{}
+		if err := json.Unmarshal([]byte(stats.String), e.Stats); err != nil {
+			return types.Entry{}, err
+		}
+	}
+	return e, nil
+}
+
+func scanEntries(rows *sql.Rows) ([]types.Entry, error) {
+	defer rows.Close()
+	var entries []types.Entry
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			utils.LM.Logger.Printf("Error scanning entry row: %v", err)
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (m *mysqlEntries) UniqueTags(username string) ([]types.TagData, error) {
+	query := `
+        SELECT DISTINCT et.tag_key, et.tag_value
+        FROM entry_tags et
+        JOIN entries e ON et.entry_id = e.entry_id
+        WHERE e.username = ? AND e.deleted_at IS NULL
+        ORDER BY et.tag_key
+    `
+	rows, err := m.sdb.Query(query, username)
+	if err != nil {
+		utils.LM.Logger.Printf("Error querying unique tags for user %s: %v", username, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []types.TagData
+	for rows.Next() {
+		var tag types.TagData
+		var value sql.NullString
+		if err := rows.Scan(&tag.Key, &value); err != nil {
+			utils.LM.Logger.Printf("Error scanning tag for user %s: %v", username, err)
+			return nil, err
+		}
+		tag.Value = value.String
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return m.openTags(username, tags)
+}
+
+func (m *mysqlEntries) UniqueLocations(username string) ([]types.LocationData, error) {
+	query := `
+        SELECT DISTINCT el.latitude, el.longitude, el.display_name
+        FROM entry_locations el
+        JOIN entries e ON el.entry_id = e.entry_id
+        WHERE e.username = ? AND e.deleted_at IS NULL
+        ORDER BY el.display_name
+    `
+	rows, err := m.sdb.Query(query, username)
+	if err != nil {
+		utils.LM.Logger.Printf("Error querying unique locations for user %s: %v", username, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locations []types.LocationData
+	for rows.Next() {
+		var loc types.LocationData
+		var displayName sql.NullString
+		if err := rows.Scan(&loc.Latitude, &loc.Longitude, &displayName); err != nil {
+			utils.LM.Logger.Printf("Error scanning location for user %s: %v", username, err)
+			return nil, err
+		}
+		loc.DisplayName = displayName.String
+		locations = append(locations, loc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return m.openLocations(username, locations)
+}
+
+func (m *mysqlEntries) AnalyzeText(limit int) (int, error) {
+	rows, err := m.sdb.Query(`
+        SELECT entry_id, user_id, text FROM entries
+        WHERE stats IS NULL AND ciphertext IS NULL
+        LIMIT ?
+    `, limit)
+	if err != nil {
+		return 0, err
+	}
+	type row struct{ id, userID, text string }
+	var found []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.userID, &r.text); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		found = append(found, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	analyzed := 0
+	for _, r := range found {
+		text := r.text
+		if m.cipher != nil {
+			if text, err = m.cipher.Open(r.userID, text); err != nil {
+				return analyzed, err
+			}
+		}
+		sealed, err := m.sealText(r.userID, text)
+		if err != nil {
+			return analyzed, err
+		}
+		// The text is left as it is, so a write made since this read it
+		// wins.
+		updated := false
+		err = inTx(m.sdb, func(tx *sql.Tx) error {
+			result, err := tx.Exec(`
+                UPDATE entries SET plain_text = ?, stats = ?
+                WHERE entry_id = ? AND text = ? AND stats IS NULL
+            `, sealed.plainText, sealed.stats, r.id, r.text)
+			if err != nil {
+				return err
+			}
+			if n, err := result.RowsAffected(); err != nil || n == 0 {
+				return err
+			}
+			updated = true
+			if m.cipher == nil {
+				return nil
+			}
+			return replaceBlindIndex(tx, r.id, sealed.tokens)
+		})
+		if err != nil {
+			utils.LM.Logger.Printf("Error analyzing text of entry %s: %v", r.id, err)
+			return analyzed, err
+		}
+		if updated {
+			analyzed++
+			updateIndex(m.index, r.userID, r.id, sealed.indexed)
+		}
+	}
+	return analyzed, nil
+}
@@ -0,0 +1,22 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"database/sql"
+	"encoding/json"
+)
+
+type mysqlEvents struct {
+	sdb *sql.DB
+}
+
+func (m *mysqlEvents) Record(event types.AnalyticsEvent) error {
+	metadataJSON, _ := json.Marshal(event.Metadata)
+	analyticsQuery := `
+        INSERT INTO analytics_events (
+            user_id, event_type, object_type, object_id, event_time, metadata
+        ) VALUES (?, ?, ?, ?, NOW(), ?)
+    `
+	_, err := m.sdb.Exec(analyticsQuery, event.UserID, event.EventType, event.ObjectType, event.ObjectID, string(metadataJSON))
+	return err
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"database/sql"
+	"time"
+)
+
+type mysqlLoginAttempts struct {
+	sdb *sql.DB
+}
+
+func (m *mysqlLoginAttempts) Record(attempt types.LoginAttempt) error {
+	query := `
+        INSERT INTO login_attempts (username, client_ip, succeeded, attempted_at)
+        VALUES (?, ?, ?, ?)
+    `
+	_, err := m.sdb.Exec(query, attempt.Username, attempt.ClientIP, attempt.Succeeded, attempt.AttemptedAt)
+	return err
+}
+
+func (m *mysqlLoginAttempts) failures(column, value string, since time.Time) (types.LoginFailures, error) {
+	query := `
+        SELECT COUNT(*), MAX(attempted_at)
+        FROM login_attempts
+        WHERE ` + column + ` = ? AND succeeded = FALSE AND cleared_at IS NULL AND attempted_at >= ?
+    `
+	var f types.LoginFailures
+	var last sql.NullTime
+	if err := m.sdb.QueryRow(query, value, since).Scan(&f.Count, &last); err != nil {
+		return types.LoginFailures{}, err
+	}
+	f.Last = last.Time
+	return f, nil
+}
+
+func (m *mysqlLoginAttempts) Failures(username, clientIP string, since time.Time) (byUser, byIP types.LoginFailures, err error) {
+	if byUser, err = m.failures("username", username, since); err != nil {
+		return
+	}
+	byIP, err = m.failures("client_ip", clientIP, since)
+	return
+}
+
+func (m *mysqlLoginAttempts) ClearUser(username string) error {
+	_, err := m.sdb.Exec(`UPDATE login_attempts SET cleared_at = ? WHERE username = ? AND cleared_at IS NULL`, time.Now().UTC(), username)
+	return err
+}
+
+func (m *mysqlLoginAttempts) ClearIP(clientIP string) error {
+	_, err := m.sdb.Exec(`UPDATE login_attempts SET cleared_at = ? WHERE client_ip = ? AND cleared_at IS NULL`, time.Now().UTC(), clientIP)
+	return err
+}
+
+func (m *mysqlLoginAttempts) Lock(key string, until time.Time) error {
+	query := `
+        INSERT INTO login_lockouts (lockout_key, locked_until, created_at)
+        VALUES (?, ?, ?)
+        ON DUPLICATE KEY UPDATE locked_until = GREATEST(locked_until, VALUES(locked_until))
+    `
+	_, err := m.sdb.Exec(query, key, until, time.Now().UTC())
+	return err
+}
+
+func (m *mysqlLoginAttempts) LockedUntil(key string) (time.Time, error) {
+	var until time.Time
+	err := m.sdb.QueryRow(`SELECT locked_until FROM login_lockouts WHERE lockout_key = ?`, key).Scan(&until)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return until, err
+}
+
+func (m *mysqlLoginAttempts) Unlock(key string) error {
+	return execAffecting(m.sdb, `DELETE FROM login_lockouts WHERE lockout_key = ?`, key)
+}
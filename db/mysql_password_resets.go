@@ -0,0 +1,51 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"database/sql"
+	"time"
+)
+
+type mysqlPasswordResets struct {
+	sdb *sql.DB
+}
+
+func (m *mysqlPasswordResets) Create(token types.PasswordResetToken) error {
+	query := `
+        INSERT INTO password_reset_tokens (token_hash, user_id, username, requested_ip, created_at, expires_at)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `
+	_, err := m.sdb.Exec(query, token.Hash, token.UserID, token.Username, token.RequestedIP, token.CreatedAt, token.ExpiresAt)
+	return err
+}
+
+func (m *mysqlPasswordResets) Get(hash string) (types.PasswordResetToken, error) {
+	query := `
+        SELECT token_hash, user_id, username, requested_ip, created_at, expires_at, used_at
+        FROM password_reset_tokens WHERE token_hash = ?
+    `
+	var t types.PasswordResetToken
+	var requestedIP sql.NullString
+	var usedAt sql.NullTime
+	err := m.sdb.QueryRow(query, hash).Scan(&t.Hash, &t.UserID, &t.Username, &requestedIP, &t.CreatedAt, &t.ExpiresAt, &usedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return types.PasswordResetToken{}, ErrNotFound
+		}
+		return types.PasswordResetToken{}, err
+	}
+	t.RequestedIP = requestedIP.String
+	t.UsedAt = usedAt.Time
+	return t, nil
+}
+
+func (m *mysqlPasswordResets) Use(hash string, at time.Time) error {
+	query := `UPDATE password_reset_tokens SET used_at = ? WHERE token_hash = ? AND used_at IS NULL`
+	return execAffecting(m.sdb, query, at, hash)
+}
+
+func (m *mysqlPasswordResets) InvalidateAll(userID string, at time.Time) error {
+	query := `UPDATE password_reset_tokens SET used_at = ? WHERE user_id = ? AND used_at IS NULL`
+	_, err := m.sdb.Exec(query, at, userID)
+	return err
+}
@@ -0,0 +1,247 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// saveRevision records the entry as it is before a change, as part of the
+// change's transaction. It returns ErrNotFound if the entry doesn't exist.
+func (m *mysqlEntries) saveRevision(tx *sql.Tx, key EntryKey, reason string) error {
+	// Locking the entry's row keeps concurrent changes from picking the
+	// same revision number.
+	var locked string
+	cond, args := key.where("")
+	err := tx.QueryRow(`
+        SELECT entry_id FROM entries
+        WHERE `+cond+` AND deleted_at IS NULL
+        FOR UPDATE
+    `, args...).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	entry, err := m.get(tx, key)
+	if err != nil {
+		return err
+	}
+	snapshot := types.EntrySnapshot{
+		Text:      entry.Text,
+		Locations: entry.Locations,
+		Tags:      entry.Tags,
+		Images:    entry.Images,
+		Encrypted: entry.Encrypted,
+	}
+	if entry.Encrypted != nil {
+		// E2EE tokens can't be recomputed here, so a restore needs them.
+		rows, err := tx.Query(`SELECT token FROM entry_blind_index WHERE entry_id = ?`, key.ID)
+		if err != nil {
+			return err
+		}
+		if snapshot.Encrypted.BlindIndex, err = scanStrings(rows); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	value := string(data)
+	if m.cipher != nil {
+		if value, err = m.cipher.Seal(key.UserID, value); err != nil {
+			return err
+		}
+	}
+
+	var next int64
+	err = tx.QueryRow(`SELECT COALESCE(MAX(revision), 0) + 1 FROM entry_revisions WHERE entry_id = ?`, key.ID).Scan(&next)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+        INSERT INTO entry_revisions (entry_id, user_id, revision, reason, snapshot, created_at)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `, key.ID, key.UserID, next, reason, value, time.Now().UTC())
+	if err != nil {
+		utils.LM.Logger.Printf("Error saving revision %d of entry %s: %v", next, key.ID, err)
+	}
+	return err
+}
+
+func (m *mysqlEntries) scanRevision(row rowScanner, userID string) (types.EntryRevision, error) {
+	var rev types.EntryRevision
+	var snapshot string
+	if err := row.Scan(&rev.EntryID, &rev.Revision, &rev.Reason, &snapshot, &rev.CreatedAt); err != nil {
+		return types.EntryRevision{}, err
+	}
+	if m.cipher != nil {
+		var err error
+		if snapshot, err = m.cipher.Open(userID, snapshot); err != nil {
+			utils.LM.Logger.Printf("Error opening revision %d of entry %s: %v", rev.Revision, rev.EntryID, err)
+			return types.EntryRevision{}, err
+		}
+	}
+	if err := json.Unmarshal([]byte(snapshot), &rev.Snapshot); err != nil {
+		return types.EntryRevision{}, err
+	}
+	return rev, nil
+}
+
+func (m *mysqlEntries) Revisions(key EntryKey) ([]types.EntryRevision, error) {
+	exists, err := entryExists(m.sdb, key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	rows, err := m.sdb.Query(`
+        SELECT entry_id, revision, reason, snapshot, created_at
+        FROM entry_revisions
+        WHERE entry_id = ? AND user_id = ?
+        ORDER BY revision DESC
+    `, key.ID, key.UserID)
+	if err != nil {
+		utils.LM.Logger.Printf("Error querying revisions of entry %s: %v", key.ID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []types.EntryRevision{}
+	for rows.Next() {
+		rev, err := m.scanRevision(rows, key.UserID)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+func (m *mysqlEntries) Revision(key EntryKey, revision int64) (types.EntryRevision, error) {
+	return m.revision(m.sdb, key, revision)
+}
+
+func (m *mysqlEntries) revision(q queryer, key EntryKey, revision int64) (types.EntryRevision, error) {
+	cond, args := key.where("e.")
+	row := q.QueryRow(`
+        SELECT r.entry_id, r.revision, r.reason, r.snapshot, r.created_at
+        FROM entry_revisions r
+        JOIN entries e ON r.entry_id = e.entry_id
+        WHERE r.revision = ? AND `+cond+` AND e.deleted_at IS NULL
+    `, append([]interface{}{revision}, args...)...)
+	rev, err := m.scanRevision(row, key.UserID)
+	if err == sql.ErrNoRows {
+		return types.EntryRevision{}, ErrNotFound
+	}
+	return rev, err
+}
+
+func (m *mysqlEntries) Restore(key EntryKey, revision int64, dropImages []string) error {
+	var indexed *string
+	err := inTx(m.sdb, func(tx *sql.Tx) error {
+		rev, err := m.revision(tx, key, revision)
+		if err != nil {
+			return err
+		}
+		snap := rev.Snapshot
+		text := sealedText{}
+		if snap.Encrypted != nil {
+			text.tokens = snap.Encrypted.BlindIndex
+		} else if text, err = m.sealText(key.UserID, snap.Text); err != nil {
+			return err
+		}
+		locations, nameTokens, err := m.sealLocations(key.UserID, snap.Locations)
+		if err != nil {
+			return err
+		}
+		tags, valueTokens, err := m.sealTags(key.UserID, snap.Tags)
+		if err != nil {
+			return err
+		}
+
+		if err := m.saveRevision(tx, key, RevisionRestore); err != nil {
+			return err
+		}
+		var ciphertext, wrappedKey, nonce []byte
+		var algorithm sql.NullString
+		if snap.Encrypted != nil {
+			ciphertext, wrappedKey, nonce = snap.Encrypted.Ciphertext, snap.Encrypted.WrappedKey, snap.Encrypted.Nonce
+			algorithm = sql.NullString{String: snap.Encrypted.Algorithm, Valid: true}
+		}
+		cond, keyArgs := key.where("")
+		_, err = tx.Exec(`
+            UPDATE entries
+            SET text = ?, plain_text = ?, stats = ?, ciphertext = ?, wrapped_key = ?, nonce = ?, algorithm = ?,
+                last_updated = ?, version = version + 1
+            WHERE `+cond,
+			append([]interface{}{text.text, text.plainText, text.stats, ciphertext, wrappedKey, nonce, algorithm,
+				time.Now().UTC()}, keyArgs...)...)
+		if err != nil {
+			utils.LM.Logger.Printf("Error restoring revision %d of entry %s: %v", revision, key.ID, err)
+			return err
+		}
+		if err := replaceBlindIndex(tx, key.ID, text.tokens); err != nil {
+			return err
+		}
+		if err := replaceLocations(tx, key.ID, locations, nameTokens); err != nil {
+			return err
+		}
+		if err := replaceTags(tx, key.ID, tags, valueTokens); err != nil {
+			return err
+		}
+		indexed = text.indexed
+		return replaceImages(tx, key.ID, withoutImages(snap.Images, dropImages))
+	})
+	if err == nil {
+		updateIndex(m.index, key.UserID, key.ID, indexed)
+	}
+	return err
+}
+
+func (m *mysqlEntries) PruneRevisions(userID, entryID string, keepPerEntry, keepPerUser int, olderThan time.Time) error {
+	// pruneBeyond deletes the rows of the scope from the keep+1'th newest
+	// down, found with an OFFSET since MySQL can't DELETE with one.
+	pruneBeyond := func(column, scope string, id interface{}, keep int) error {
+		var cutoff int64
+		err := m.sdb.QueryRow(`
+            SELECT `+column+` FROM entry_revisions WHERE `+scope+` = ?
+            ORDER BY `+column+` DESC LIMIT 1 OFFSET ?
+        `, id, keep).Scan(&cutoff)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		_, err = m.sdb.Exec(`DELETE FROM entry_revisions WHERE `+scope+` = ? AND `+column+` <= ?`, id, cutoff)
+		return err
+	}
+
+	if keepPerEntry > 0 {
+		if err := pruneBeyond("revision", "entry_id", entryID, keepPerEntry); err != nil {
+			utils.LM.Logger.Printf("Error pruning revisions of entry %s: %v", entryID, err)
+			return err
+		}
+	}
+	if keepPerUser > 0 {
+		if err := pruneBeyond("revision_id", "user_id", userID, keepPerUser); err != nil {
+			utils.LM.Logger.Printf("Error pruning revisions of user %s: %v", userID, err)
+			return err
+		}
+	}
+	if !olderThan.IsZero() {
+		_, err := m.sdb.Exec(`DELETE FROM entry_revisions WHERE user_id = ? AND created_at < ?`, userID, olderThan)
+		if err != nil {
+			utils.LM.Logger.Printf("Error pruning old revisions of user %s: %v", userID, err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,406 @@
+package db
+
+import (
+	"JourneyAppServer/markdown"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"database/sql"
+	"encoding/json"
+	"sort"
+)
+
+// The helpers below apply m.cipher to entry fields on their way in and out
+// of MySQL. They all leave values untouched when encryption at rest is off.
+
+// sealedText is entry text as it is written to the entries table.
+type sealedText struct {
+	text string
+	// plainText and stats come from markdown.Analyze. They are NULL for
+	// E2EE entries, whose text the server can't read.
+	plainText, stats sql.NullString
+	// tokens is the blind index of the plain text, which takes over from
+	// the FULLTEXT index for sealed entries.
+	tokens []string
+	// indexed is the plain text before it is sealed, for the SearchIndex.
+	indexed *string
+}
+
+// sealText analyzes text and seals it and its plain text for userID.
+func (m *mysqlEntries) sealText(userID, text string) (sealedText, error) {
+	analysis := markdown.Analyze(text)
+	stats, err := m.sealStats(userID, analysis.Stats)
+	if err != nil {
+		return sealedText{}, err
+	}
+	sealed := sealedText{
+		text:      text,
+		plainText: sql.NullString{String: analysis.PlainText, Valid: true},
+		stats:     sql.NullString{String: stats, Valid: true},
+		indexed:   &analysis.PlainText,
+	}
+	if m.cipher == nil || text == "" {
+		return sealed, nil
+	}
+	if sealed.text, err = m.cipher.Seal(userID, text); err != nil {
+		return sealedText{}, err
+	}
+	if sealed.plainText.String, err = m.cipher.Seal(userID, analysis.PlainText); err != nil {
+		return sealedText{}, err
+	}
+	if sealed.tokens, err = m.cipher.IndexTokens(userID, analysis.PlainText); err != nil {
+		return sealedText{}, err
+	}
+	return sealed, nil
+}
+
+// sealStats encodes stats for the stats column, with the outline's headings
+// sealed like tag values.
+func (m *mysqlEntries) sealStats(userID string, stats types.EntryStats) (string, error) {
+	if m.cipher != nil {
+		outline := make([]types.OutlineHeading, len(stats.Outline))
+		for i, heading := range stats.Outline {
+			text, err := m.cipher.Seal(userID, heading.Text)
+			if err != nil {
+				return "", err
+			}
+			outline[i] = types.OutlineHeading{Level: heading.Level, Text: text}
+		}
+		stats.Outline = outline
+	}
+	encoded, err := json.Marshal(stats)
+	return string(encoded), err
+}
+
+// sealTags also returns each value's token, for filtering on it.
+func (m *mysqlEntries) sealTags(userID string, tags []types.TagData) ([]types.TagData, []sql.NullString, error) {
+	tokens := make([]sql.NullString, len(tags))
+	if m.cipher == nil {
+		return tags, tokens, nil
+	}
+	sealed := make([]types.TagData, len(tags))
+	for i, tag := range tags {
+		value, err := m.cipher.Seal(userID, tag.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		if tag.Value != "" {
+			token, err := m.cipher.Token(userID, tag.Value)
+			if err != nil {
+				return nil, nil, err
+			}
+			tokens[i] = sql.NullString{String: token, Valid: true}
+		}
+		sealed[i] = types.TagData{Key: tag.Key, Value: value}
+	}
+	return sealed, tokens, nil
+}
+
+// sealLocations also returns each name's token, for filtering on it.
+func (m *mysqlEntries) sealLocations(userID string, locations []types.LocationData) ([]types.LocationData, []sql.NullString, error) {
+	tokens := make([]sql.NullString, len(locations))
+	if m.cipher == nil {
+		return locations, tokens, nil
+	}
+	sealed := make([]types.LocationData, len(locations))
+	for i, loc := range locations {
+		name, err := m.cipher.Seal(userID, loc.DisplayName)
+		if err != nil {
+			return nil, nil, err
+		}
+		if loc.DisplayName != "" {
+			token, err := m.cipher.Token(userID, loc.DisplayName)
+			if err != nil {
+				return nil, nil, err
+			}
+			tokens[i] = sql.NullString{String: token, Valid: true}
+		}
+		sealed[i] = types.LocationData{Latitude: loc.Latitude, Longitude: loc.Longitude, DisplayName: name}
+	}
+	return sealed, tokens, nil
+}
+
+// open reverses sealText, sealTags and sealLocations on a loaded entry.
+func (m *mysqlEntries) open(entry *types.Entry) error {
+	if m.cipher == nil {
+		return nil
+	}
+	var err error
+	if entry.Text, err = m.cipher.Open(entry.UserID, entry.Text); err != nil {
+		utils.LM.Logger.Printf("Error opening text of entry %s: %v", entry.ID, err)
+		return err
+	}
+	if entry.Stats != nil {
+		for i := range entry.Stats.Outline {
+			if entry.Stats.Outline[i].Text, err = m.cipher.Open(entry.UserID, entry.Stats.Outline[i].Text); err != nil {
+				utils.LM.Logger.Printf("Error opening outline of entry %s: %v", entry.ID, err)
+				return err
+			}
+		}
+	}
+	for i := range entry.Tags {
+		if entry.Tags[i].Value, err = m.cipher.Open(entry.UserID, entry.Tags[i].Value); err != nil {
+			utils.LM.Logger.Printf("Error opening tag of entry %s: %v", entry.ID, err)
+			return err
+		}
+	}
+	for i := range entry.Locations {
+		if entry.Locations[i].DisplayName, err = m.cipher.Open(entry.UserID, entry.Locations[i].DisplayName); err != nil {
+			utils.LM.Logger.Printf("Error opening location of entry %s: %v", entry.ID, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mysqlEntries) userID(username string) (string, error) {
+	var userID string
+	err := m.sdb.QueryRow(`SELECT user_id FROM users WHERE username = ?`, username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return userID, err
+}
+
+const blindIndexExists = "EXISTS (SELECT 1 FROM entry_blind_index bi WHERE bi.entry_id = e.entry_id AND bi.token = ?)"
+
+// openTags and openLocations decrypt the results of UniqueTags and
+// UniqueLocations. Sealing isn't deterministic, so DISTINCT can't remove
+// duplicates in SQL; they are removed here instead.
+func (m *mysqlEntries) openTags(username string, tags []types.TagData) ([]types.TagData, error) {
+	if m.cipher == nil || len(tags) == 0 {
+		return tags, nil
+	}
+	userID, err := m.userID(username)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[types.TagData]bool)
+	var opened []types.TagData
+	for _, tag := range tags {
+		if tag.Value, err = m.cipher.Open(userID, tag.Value); err != nil {
+			return nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			opened = append(opened, tag)
+		}
+	}
+	sort.SliceStable(opened, func(i, j int) bool { return opened[i].Key < opened[j].Key })
+	return opened, nil
+}
+
+func (m *mysqlEntries) openLocations(username string, locations []types.LocationData) ([]types.LocationData, error) {
+	if m.cipher == nil || len(locations) == 0 {
+		return locations, nil
+	}
+	userID, err := m.userID(username)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[types.LocationData]bool)
+	var opened []types.LocationData
+	for _, loc := range locations {
+		if loc.DisplayName, err = m.cipher.Open(userID, loc.DisplayName); err != nil {
+			return nil, err
+		}
+		if !seen[loc] {
+			seen[loc] = true
+			opened = append(opened, loc)
+		}
+	}
+	sort.SliceStable(opened, func(i, j int) bool { return opened[i].DisplayName < opened[j].DisplayName })
+	return opened, nil
+}
+
+// SealPlaintext seals values written before encryption at rest was turned
+// on, revision snapshots included, a batch of each kind at a time, and fills
+// in the tokens of tag values sealed before they had any. Each UPDATE only
+// applies if the value is unchanged, so it can't clobber a concurrent write.
+func (m *mysqlEntries) SealPlaintext(limit int) (int, error) {
+	if m.cipher == nil {
+		return 0, nil
+	}
+	plaintext := SealedPrefix + "%"
+	sealed := 0
+
+	rows, err := m.sdb.Query(`
+        SELECT entry_id, user_id, text FROM entries
+        WHERE text != '' AND text NOT LIKE ?
+        LIMIT ?
+    `, plaintext, limit)
+	if err != nil {
+		return sealed, err
+	}
+	type row struct{ id, userID, value string }
+	scanRows := func(rows *sql.Rows) ([]row, error) {
+		defer rows.Close()
+		var found []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.userID, &r.value); err != nil {
+				return nil, err
+			}
+			found = append(found, r)
+		}
+		return found, rows.Err()
+	}
+	entries, err := scanRows(rows)
+	if err != nil {
+		return sealed, err
+	}
+	for _, e := range entries {
+		text, err := m.sealText(e.userID, e.value)
+		if err != nil {
+			return sealed, err
+		}
+		err = inTx(m.sdb, func(tx *sql.Tx) error {
+			result, err := tx.Exec(`
+                UPDATE entries SET text = ?, plain_text = ?, stats = ?
+                WHERE entry_id = ? AND text = ?
+            `, text.text, text.plainText, text.stats, e.id, e.value)
+			if err != nil {
+				return err
+			}
+			if n, err := result.RowsAffected(); err != nil || n == 0 {
+				return err
+			}
+			sealed++
+			return replaceBlindIndex(tx, e.id, text.tokens)
+		})
+		if err != nil {
+			return sealed, err
+		}
+	}
+
+	rows, err = m.sdb.Query(`
+        SELECT et.tag_id, e.user_id, et.tag_value
+        FROM entry_tags et
+        JOIN entries e ON et.entry_id = e.entry_id
+        WHERE et.tag_value != '' AND et.tag_value NOT LIKE ?
+        LIMIT ?
+    `, plaintext, limit)
+	if err != nil {
+		return sealed, err
+	}
+	tags, err := scanRows(rows)
+	if err != nil {
+		return sealed, err
+	}
+	for _, t := range tags {
+		value, err := m.cipher.Seal(t.userID, t.value)
+		if err != nil {
+			return sealed, err
+		}
+		token, err := m.cipher.Token(t.userID, t.value)
+		if err != nil {
+			return sealed, err
+		}
+		result, err := m.sdb.Exec(`
+            UPDATE entry_tags SET tag_value = ?, tag_value_token = ?
+            WHERE tag_id = ? AND tag_value = ?
+        `, value, token, t.id, t.value)
+		if err != nil {
+			return sealed, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			sealed++
+		}
+	}
+
+	// Tag values sealed before tag_value_token was added have no token yet.
+	rows, err = m.sdb.Query(`
+        SELECT et.tag_id, e.user_id, et.tag_value
+        FROM entry_tags et
+        JOIN entries e ON et.entry_id = e.entry_id
+        WHERE et.tag_value LIKE ? AND et.tag_value_token IS NULL
+        LIMIT ?
+    `, plaintext, limit)
+	if err != nil {
+		return sealed, err
+	}
+	if tags, err = scanRows(rows); err != nil {
+		return sealed, err
+	}
+	for _, t := range tags {
+		value, err := m.cipher.Open(t.userID, t.value)
+		if err != nil {
+			return sealed, err
+		}
+		token, err := m.cipher.Token(t.userID, value)
+		if err != nil {
+			return sealed, err
+		}
+		result, err := m.sdb.Exec(`
+            UPDATE entry_tags SET tag_value_token = ?
+            WHERE tag_id = ? AND tag_value = ?
+        `, token, t.id, t.value)
+		if err != nil {
+			return sealed, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			sealed++
+		}
+	}
+
+	rows, err = m.sdb.Query(`
+        SELECT el.location_id, e.user_id, el.display_name
+        FROM entry_locations el
+        JOIN entries e ON el.entry_id = e.entry_id
+        WHERE el.display_name != '' AND el.display_name NOT LIKE ?
+        LIMIT ?
+    `, plaintext, limit)
+	if err != nil {
+		return sealed, err
+	}
+	locations, err := scanRows(rows)
+	if err != nil {
+		return sealed, err
+	}
+	for _, l := range locations {
+		name, err := m.cipher.Seal(l.userID, l.value)
+		if err != nil {
+			return sealed, err
+		}
+		token, err := m.cipher.Token(l.userID, l.value)
+		if err != nil {
+			return sealed, err
+		}
+		result, err := m.sdb.Exec(`
+            UPDATE entry_locations SET display_name = ?, display_name_token = ?
+            WHERE location_id = ? AND display_name = ?
+        `, name, token, l.id, l.value)
+		if err != nil {
+			return sealed, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			sealed++
+		}
+	}
+
+	rows, err = m.sdb.Query(`
+        SELECT revision_id, user_id, snapshot FROM entry_revisions
+        WHERE snapshot NOT LIKE ?
+        LIMIT ?
+    `, plaintext, limit)
+	if err != nil {
+		return sealed, err
+	}
+	revisions, err := scanRows(rows)
+	if err != nil {
+		return sealed, err
+	}
+	for _, r := range revisions {
+		snapshot, err := m.cipher.Seal(r.userID, r.value)
+		if err != nil {
+			return sealed, err
+		}
+		result, err := m.sdb.Exec(`UPDATE entry_revisions SET snapshot = ? WHERE revision_id = ? AND snapshot = ?`, snapshot, r.id, r.value)
+		if err != nil {
+			return sealed, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			sealed++
+		}
+	}
+	return sealed, nil
+}
@@ -0,0 +1,579 @@
+package db
+
+import (
+	"JourneyAppServer/geo"
+	"JourneyAppServer/search"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// timeframeStart maps a SearchEntriesRequest.Timeframe onto the earliest
+// timestamp it includes. The zero time means no lower bound.
+func timeframeStart(timeframe string, now time.Time) time.Time {
+	switch timeframe {
+	case "Past year":
+		return now.AddDate(-1, 0, 0)
+	case "Past 6 months":
+		return now.AddDate(0, -6, 0)
+	case "Past 3 months":
+		return now.AddDate(0, -3, 0)
+	case "Past 30 days":
+		return now.AddDate(0, 0, -30)
+	}
+	return time.Time{}
+}
+
+// customRange parses FromDate/ToDate for the "custom" timeframe, ignoring
+// values that aren't RFC3339.
+func customRange(req types.SearchEntriesRequest) (from, to time.Time) {
+	if req.FromDate != "" {
+		if t, err := time.Parse(time.RFC3339, req.FromDate); err == nil {
+			from = t
+		}
+	}
+	if req.ToDate != "" {
+		if t, err := time.Parse(time.RFC3339, req.ToDate); err == nil {
+			to = t
+		}
+	}
+	return from, to
+}
+
+// matchAgainst is the MATCH() search string for a text term: a phrase for
+// phrases and words that are several words to MySQL, like "well-known".
+func matchAgainst(text search.Text) string {
+	words := text.Words()
+	if text.Phrase || len(words) > 1 {
+		return `"` + strings.Join(words, " ") + `"`
+	}
+	if text.Prefix {
+		return words[0] + "*"
+	}
+	return words[0]
+}
+
+// queryCondition compiles a parsed query into a condition on the entries
+// aliased e, and the condition's arguments. matched has what the search
+// index matched for each text term, and is nil for the FULLTEXT index,
+// which the condition searches itself.
+func (m *mysqlEntries) queryCondition(userID string, expr search.Expr, matched textMatches) (string, []interface{}, error) {
+	switch e := expr.(type) {
+	case search.And, search.Or:
+		terms, op := []search.Expr(nil), " AND "
+		if and, ok := e.(search.And); ok {
+			terms = and.Terms
+		} else {
+			terms, op = e.(search.Or).Terms, " OR "
+		}
+		conds := make([]string, len(terms))
+		var args []interface{}
+		for i, term := range terms {
+			cond, condArgs, err := m.queryCondition(userID, term, matched)
+			if err != nil {
+				return "", nil, err
+			}
+			conds[i] = cond
+			args = append(args, condArgs...)
+		}
+		return "(" + strings.Join(conds, op) + ")", args, nil
+	case search.Not:
+		cond, args, err := m.queryCondition(userID, e.Expr, matched)
+		return "NOT " + cond, args, err
+	case search.Text:
+		if matched == nil {
+			return m.fulltextCondition(userID, e)
+		}
+		return idsCondition(matched[e])
+	case search.Tag:
+		return m.tagCondition(userID, []types.TagData{{Key: e.Key}})
+	case search.Location:
+		return m.locationCondition(userID, []types.LocationData{{DisplayName: e.Name}})
+	case search.Before:
+		return "e.timestamp < ?", []interface{}{e.Time}, nil
+	case search.After:
+		return "e.timestamp >= ?", []interface{}{e.Time}, nil
+	case search.Has:
+		table := map[string]string{
+			search.HasImage:    "entry_images",
+			search.HasLocation: "entry_locations",
+			search.HasTag:      "entry_tags",
+		}[e.What]
+		return "EXISTS (SELECT 1 FROM " + table + " h WHERE h.entry_id = e.entry_id)", nil, nil
+	}
+	return "", nil, fmt.Errorf("unknown search expression %T", expr)
+}
+
+// tagCondition matches entries with any one of tags: by key, and by value
+// too for those with one. Sealed values are compared by their token.
+func (m *mysqlEntries) tagCondition(userID string, tags []types.TagData) (string, []interface{}, error) {
+	conds := make([]string, len(tags))
+	var args []interface{}
+	for i, tag := range tags {
+		switch {
+		case tag.Value == "":
+			conds[i] = "et.tag_key = ?"
+			args = append(args, tag.Key)
+		case m.cipher == nil:
+			conds[i] = "(et.tag_key = ? AND et.tag_value = ?)"
+			args = append(args, tag.Key, tag.Value)
+		default:
+			token, err := m.cipher.Token(userID, tag.Value)
+			if err != nil {
+				return "", nil, err
+			}
+			conds[i] = "(et.tag_key = ? AND (et.tag_value = ? OR et.tag_value_token = ?))"
+			args = append(args, tag.Key, tag.Value, token)
+		}
+	}
+	return "EXISTS (SELECT 1 FROM entry_tags et WHERE et.entry_id = e.entry_id AND (" +
+		strings.Join(conds, " OR ") + "))", args, nil
+}
+
+// tagsCondition is req's tag filter, or "" if it has none: an EXISTS for
+// any of its tags or one for each of them, and a NOT EXISTS for those it
+// excludes.
+func (m *mysqlEntries) tagsCondition(userID string, req types.SearchEntriesRequest) (string, []interface{}, error) {
+	var conds []string
+	var args []interface{}
+	add := func(not string, tags []types.TagData) error {
+		cond, condArgs, err := m.tagCondition(userID, tags)
+		conds = append(conds, not+cond)
+		args = append(args, condArgs...)
+		return err
+	}
+	if req.TagMode == types.TagModeAll {
+		for _, tag := range req.Tags {
+			if err := add("", []types.TagData{tag}); err != nil {
+				return "", nil, err
+			}
+		}
+	} else if len(req.Tags) > 0 {
+		if err := add("", req.Tags); err != nil {
+			return "", nil, err
+		}
+	}
+	if len(req.ExcludeTags) > 0 {
+		if err := add("NOT ", req.ExcludeTags); err != nil {
+			return "", nil, err
+		}
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+// locationCondition matches entries at any one of locations, by name.
+// Sealed names are compared by their token.
+func (m *mysqlEntries) locationCondition(userID string, locations []types.LocationData) (string, []interface{}, error) {
+	conds := make([]string, len(locations))
+	var args []interface{}
+	for i, loc := range locations {
+		if m.cipher == nil {
+			conds[i] = "el.display_name = ?"
+			args = append(args, loc.DisplayName)
+			continue
+		}
+		token, err := m.cipher.Token(userID, loc.DisplayName)
+		if err != nil {
+			return "", nil, err
+		}
+		conds[i] = "(el.display_name = ? OR el.display_name_token = ?)"
+		args = append(args, loc.DisplayName, token)
+	}
+	return "EXISTS (SELECT 1 FROM entry_locations el WHERE el.entry_id = e.entry_id AND (" +
+		strings.Join(conds, " OR ") + "))", args, nil
+}
+
+// geoCondition matches entries with a location inside req's WithinRadius
+// and WithinBounds, or with any location for Nearest. It is "" if req has
+// none of them.
+func geoCondition(req types.SearchEntriesRequest) (string, []interface{}) {
+	if req.WithinRadius == nil && req.WithinBounds == nil && req.Nearest == nil {
+		return "", nil
+	}
+	cond, args := locationsWithin(req)
+	return "EXISTS (SELECT 1 FROM entry_locations el WHERE " + cond + ")", args
+}
+
+// locationsWithin is the condition on a row of entry_locations el that it
+// is one of e's locations inside req's WithinRadius and WithinBounds.
+// Circles are narrowed down to a box first, so the SPATIAL index is used
+// for both.
+func locationsWithin(req types.SearchEntriesRequest) (string, []interface{}) {
+	conds := []string{"el.entry_id = e.entry_id"}
+	var args []interface{}
+	if r := req.WithinRadius; r != nil {
+		box, boxArgs := boundsCondition(geo.Around(r.Latitude, r.Longitude, r.Meters))
+		conds = append(conds, box, "ST_Distance_Sphere(el.point, POINT(?, ?)) <= ?")
+		args = append(append(args, boxArgs...), r.Longitude, r.Latitude, r.Meters)
+	}
+	if b := req.WithinBounds; b != nil {
+		box, boxArgs := boundsCondition(geo.Bounds(*b))
+		conds = append(conds, box)
+		args = append(args, boxArgs...)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// boundsCondition matches a location el inside b, edges included.
+func boundsCondition(b geo.Bounds) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	for _, part := range b.Split() {
+		conds = append(conds, "MBRCovers(ST_MakeEnvelope(POINT(?, ?), POINT(?, ?)), el.point)")
+		args = append(args, part.West, part.South, part.East, part.North)
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args
+}
+
+// nearestDistance is how far the closest of an entry's locations that
+// req's filters match is from the point of its Nearest or WithinRadius, in
+// metres, or NULL if it has neither. MySQL has no index for nearest
+// neighbours, so this is measured for every entry the rest of the search
+// matches.
+func nearestDistance(req types.SearchEntriesRequest) (string, []interface{}) {
+	var lat, lon float64
+	switch {
+	case req.Nearest != nil:
+		lat, lon = req.Nearest.Latitude, req.Nearest.Longitude
+	case req.WithinRadius != nil:
+		lat, lon = req.WithinRadius.Latitude, req.WithinRadius.Longitude
+	default:
+		return "NULL", nil
+	}
+	cond, args := locationsWithin(req)
+	return "(SELECT MIN(ST_Distance_Sphere(el.point, POINT(?, ?))) FROM entry_locations el WHERE " + cond + ")",
+		append([]interface{}{lon, lat}, args...)
+}
+
+// fulltextCondition matches a text term against both kinds of entry:
+// MATCH() on plain text not yet sealed, and the blind index for sealed text.
+// The blind index only has whole words, so phrases become all of their
+// words and prefixes the whole word.
+func (m *mysqlEntries) fulltextCondition(userID string, text search.Text) (string, []interface{}, error) {
+	match := "MATCH(e.plain_text) AGAINST (? IN BOOLEAN MODE)"
+	if m.cipher == nil {
+		return match, []interface{}{matchAgainst(text)}, nil
+	}
+	clause := "(COALESCE(e.plain_text, '') NOT LIKE ? AND " + match + ")"
+	args := []interface{}{SealedPrefix + "%", matchAgainst(text)}
+	tokens, err := m.cipher.IndexTokens(userID, strings.Join(text.Words(), " "))
+	if err != nil || len(tokens) == 0 {
+		return clause, args, err
+	}
+	conds := make([]string, len(tokens))
+	args = append(args, SealedPrefix+"%")
+	for i, token := range tokens {
+		conds[i] = blindIndexExists
+		args = append(args, token)
+	}
+	return "(" + clause + " OR (e.text LIKE ? AND " + strings.Join(conds, " AND ") + "))", args, nil
+}
+
+// idsCondition matches the entries a search index matched.
+func idsCondition(ids map[string]float64) (string, []interface{}, error) {
+	if len(ids) == 0 {
+		return "FALSE", nil, nil
+	}
+	args := make([]interface{}, 0, len(ids))
+	for _, id := range sortedIDs(ids) {
+		args = append(args, id)
+	}
+	return "e.entry_id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")", args, nil
+}
+
+func sortedIDs(ids map[string]float64) []string {
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// relevance scores entries against the text terms of a query, with what the
+// search index matched for them, or nil for the FULLTEXT index.
+func (m *mysqlEntries) relevance(userID string, terms []search.Text, matched textMatches) (string, []interface{}, error) {
+	if len(terms) == 0 {
+		return "0", nil, nil
+	}
+	if matched == nil {
+		return m.fulltextScore(userID, terms)
+	}
+	scores := matched.score(terms)
+	if len(scores) == 0 {
+		return "0", nil, nil
+	}
+	var args []interface{}
+	for _, id := range sortedIDs(scores) {
+		args = append(args, id, scores[id])
+	}
+	return "CASE e.entry_id" + strings.Repeat(" WHEN ? THEN ?", len(scores)) + " ELSE 0 END", args, nil
+}
+
+// fulltextScore is MATCH()'s score for plain text not yet sealed, and the
+// number of the terms' words in the blind index for sealed text.
+func (m *mysqlEntries) fulltextScore(userID string, terms []search.Text) (string, []interface{}, error) {
+	against := make([]string, len(terms))
+	for i, term := range terms {
+		against[i] = matchAgainst(term)
+	}
+	score := "MATCH(e.plain_text) AGAINST (? IN BOOLEAN MODE)"
+	scoreArgs := []interface{}{strings.Join(against, " ")}
+	if m.cipher == nil {
+		return score, scoreArgs, nil
+	}
+
+	var tokens []interface{}
+	for _, term := range terms {
+		termTokens, err := m.cipher.IndexTokens(userID, strings.Join(term.Words(), " "))
+		if err != nil {
+			return "", nil, err
+		}
+		for _, token := range termTokens {
+			tokens = append(tokens, token)
+		}
+	}
+	sealedScore := "0"
+	if len(tokens) > 0 {
+		sealedScore = "(SELECT COUNT(*) FROM entry_blind_index bi WHERE bi.entry_id = e.entry_id AND bi.token IN (?" +
+			strings.Repeat(", ?", len(tokens)-1) + "))"
+	}
+	args := append([]interface{}{SealedPrefix + "%"}, tokens...)
+	return "IF(e.text LIKE ?, " + sealedScore + ", " + score + ")", append(args, scoreArgs...), nil
+}
+
+func (m *mysqlEntries) Search(req types.SearchEntriesRequest, query search.Expr) ([]SearchHit, int64, error) {
+	var args []interface{}
+	whereClauses := []string{"e.username = ?", "e.deleted_at IS NULL"}
+	args = append(args, req.User)
+
+	// userID is only needed to compute blind index tokens and to look text
+	// up in a search index other than FULLTEXT.
+	_, fulltext := m.index.(mysqlFulltext)
+	var userID string
+	filtered := query != nil || len(req.Locations) > 0 || len(req.Tags) > 0 || len(req.ExcludeTags) > 0
+	if m.cipher != nil && filtered || !fulltext && search.HasText(query) {
+		var err error
+		if userID, err = m.userID(req.User); err != nil {
+			if err == ErrNotFound {
+				return nil, 0, nil
+			}
+			return nil, 0, err
+		}
+	}
+
+	// score is the relevance of each entry, with its own arguments since it
+	// comes before the WHERE clause.
+	var matched textMatches
+	if !fulltext {
+		var err error
+		if matched, err = matchTerms(m.index, userID, query); err != nil {
+			return nil, 0, err
+		}
+	}
+	terms := search.TextTerms(query)
+	score, scoreArgs, err := m.relevance(userID, terms, matched)
+	if err != nil {
+		return nil, 0, err
+	}
+	if query != nil {
+		cond, condArgs, err := m.queryCondition(userID, query, matched)
+		if err != nil {
+			return nil, 0, err
+		}
+		whereClauses = append(whereClauses, cond)
+		args = append(args, condArgs...)
+	}
+
+	for _, token := range req.BlindTokens {
+		whereClauses = append(whereClauses, blindIndexExists)
+		args = append(args, token)
+	}
+
+	if len(req.Locations) > 0 {
+		cond, condArgs, err := m.locationCondition(userID, req.Locations)
+		if err != nil {
+			return nil, 0, err
+		}
+		whereClauses = append(whereClauses, cond)
+		args = append(args, condArgs...)
+	}
+	if cond, condArgs, err := m.tagsCondition(userID, req); err != nil {
+		return nil, 0, err
+	} else if cond != "" {
+		whereClauses = append(whereClauses, cond)
+		args = append(args, condArgs...)
+	}
+
+	distance, distanceArgs := nearestDistance(req)
+	if cond, condArgs := geoCondition(req); cond != "" {
+		whereClauses = append(whereClauses, cond)
+		args = append(args, condArgs...)
+	}
+
+	if req.Timeframe == "custom" {
+		from, to := customRange(req)
+		if !from.IsZero() {
+			whereClauses = append(whereClauses, "e.timestamp >= ?")
+			args = append(args, from)
+		}
+		if !to.IsZero() {
+			whereClauses = append(whereClauses, "e.timestamp <= ?")
+			args = append(args, to)
+		}
+	} else if start := timeframeStart(req.Timeframe, time.Now()); !start.IsZero() {
+		whereClauses = append(whereClauses, "e.timestamp >= ?")
+		args = append(args, start)
+	}
+
+	where := " WHERE " + strings.Join(whereClauses, " AND ")
+
+	var total int64
+	if err := m.sdb.QueryRow("SELECT COUNT(*) FROM entries e"+where, args...).Scan(&total); err != nil {
+		utils.LM.Logger.Printf("Error counting search results: user=%s, error=%v", req.User, err)
+		return nil, 0, err
+	}
+
+	orderBy := " ORDER BY e.timestamp DESC"
+	switch {
+	case req.Nearest != nil:
+		orderBy = " ORDER BY distance ASC, e.timestamp DESC"
+	case req.SortRule == "Oldest":
+		orderBy = " ORDER BY e.timestamp ASC"
+	case req.SortRule == "Relevance" && len(terms) > 0:
+		orderBy = " ORDER BY score DESC, e.timestamp DESC"
+	}
+
+	// Nearest caps the results at its count, pages included.
+	offset, limit := (req.Page-1)*req.Limit, req.Limit
+	if req.Nearest != nil {
+		total = min(total, int64(req.Nearest.Count))
+		if limit = min(limit, total-offset); limit <= 0 {
+			return nil, total, nil
+		}
+	}
+
+	pageQuery := `
+        SELECT e.entry_id, e.user_id, e.username, e.text, e.timestamp, e.last_updated,
+            e.ciphertext, e.wrapped_key, e.nonce, e.algorithm, e.version, e.stats, e.plain_text,
+            ` + score + ` AS score, ` + distance + ` AS distance FROM entries e` + where + orderBy + " LIMIT ? OFFSET ?"
+	args = append(append(append(scoreArgs, distanceArgs...), args...), limit, offset)
+
+	rows, err := m.sdb.Query(pageQuery, args...)
+	if err != nil {
+		utils.LM.Logger.Printf("Error querying entries: user=%s, error=%v", req.User, err)
+		return nil, 0, err
+	}
+	hits, err := scanSearchHits(rows)
+	if err != nil {
+		utils.LM.Logger.Printf("Row iteration error: user=%s, error=%v", req.User, err)
+		return nil, 0, err
+	}
+
+	for i := range hits {
+		if err := loadEntryChildren(m.sdb, &hits[i].Entry); err != nil {
+			return nil, 0, err
+		}
+		if err := m.open(&hits[i].Entry); err != nil {
+			return nil, 0, err
+		}
+		if m.cipher != nil {
+			if hits[i].PlainText, err = m.cipher.Open(hits[i].Entry.UserID, hits[i].PlainText); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	return hits, total, nil
+}
+
+func scanSearchHits(rows *sql.Rows) ([]SearchHit, error) {
+	defer rows.Close()
+	var hits []SearchHit
+	for rows.Next() {
+		var hit SearchHit
+		var plainText sql.NullString
+		var distance sql.NullFloat64
+		var err error
+		if hit.Entry, err = scanEntry(rows, &plainText, &hit.Score, &distance); err != nil {
+			return nil, err
+		}
+		hit.PlainText = plainText.String
+		if distance.Valid {
+			hit.Distance = &distance.Float64
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// mysqlFulltext is the SearchIndex MySQL keeps itself: the FULLTEXT index on
+// plain_text, and the blind index for sealed entries. Search compiles text
+// terms into its query rather than calling Match, so results can be ranked
+// and paged in one go.
+type mysqlFulltext struct{ m *mysqlEntries }
+
+func (mysqlFulltext) Index(userID, entryID, plainText string) error { return nil }
+func (mysqlFulltext) Remove(userID, entryID string) error           { return nil }
+func (mysqlFulltext) RemoveUser(userID string) error                { return nil }
+func (mysqlFulltext) Clear() error                                  { return nil }
+func (mysqlFulltext) Close() error                                  { return nil }
+
+func (f mysqlFulltext) Match(userID string, term search.Text) (map[string]float64, error) {
+	cond, args, err := f.m.fulltextCondition(userID, term)
+	if err != nil {
+		return nil, err
+	}
+	score, scoreArgs, err := f.m.fulltextScore(userID, []search.Text{term})
+	if err != nil {
+		return nil, err
+	}
+	args = append(append(scoreArgs, userID), args...)
+	rows, err := f.m.sdb.Query(`
+        SELECT e.entry_id, `+score+` FROM entries e
+        WHERE e.user_id = ? AND `+cond, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	matched := make(map[string]float64)
+	for rows.Next() {
+		var id string
+		var score float64
+		if err := rows.Scan(&id, &score); err != nil {
+			return nil, err
+		}
+		matched[id] = score
+	}
+	return matched, rows.Err()
+}
+
+func (m *mysqlEntries) PlainTexts(after string, limit int) ([]EntryText, error) {
+	rows, err := m.sdb.Query(`
+        SELECT entry_id, user_id, plain_text FROM entries
+        WHERE entry_id > ? AND plain_text IS NOT NULL
+        ORDER BY entry_id
+        LIMIT ?
+    `, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var texts []EntryText
+	for rows.Next() {
+		var text EntryText
+		if err := rows.Scan(&text.EntryID, &text.UserID, &text.PlainText); err != nil {
+			return nil, err
+		}
+		if m.cipher != nil {
+			if text.PlainText, err = m.cipher.Open(text.UserID, text.PlainText); err != nil {
+				return nil, err
+			}
+		}
+		texts = append(texts, text)
+	}
+	return texts, rows.Err()
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"reflect"
+	"testing"
+)
+
+// tokenCipher stands in for atrest's keyring; only Token is used here.
+type tokenCipher struct{ FieldCipher }
+
+func (tokenCipher) Token(userID, value string) (string, error) {
+	return "tok(" + userID + "," + value + ")", nil
+}
+
+func TestTagsCondition(t *testing.T) {
+	const (
+		exists = "EXISTS (SELECT 1 FROM entry_tags et WHERE et.entry_id = e.entry_id AND ("
+		key    = "et.tag_key = ?"
+		pair   = "(et.tag_key = ? AND et.tag_value = ?)"
+		sealed = "(et.tag_key = ? AND (et.tag_value = ? OR et.tag_value_token = ?))"
+	)
+	trip := types.TagData{Key: "trip"}
+	mood := types.TagData{Key: "mood", Value: "happy"}
+	tests := []struct {
+		name   string
+		cipher FieldCipher
+		req    types.SearchEntriesRequest
+		cond   string
+		args   []interface{}
+	}{
+		{
+			name: "none",
+			req:  types.SearchEntriesRequest{},
+			cond: "",
+		},
+		{
+			name: "any key",
+			req:  types.SearchEntriesRequest{Tags: []types.TagData{trip}},
+			cond: exists + key + "))",
+			args: []interface{}{"trip"},
+		},
+		{
+			name: "any key=value",
+			req:  types.SearchEntriesRequest{Tags: []types.TagData{mood}},
+			cond: exists + pair + "))",
+			args: []interface{}{"mood", "happy"},
+		},
+		{
+			name: "any of several",
+			req:  types.SearchEntriesRequest{TagMode: types.TagModeAny, Tags: []types.TagData{trip, mood}},
+			cond: exists + key + " OR " + pair + "))",
+			args: []interface{}{"trip", "mood", "happy"},
+		},
+		{
+			name: "all key",
+			req:  types.SearchEntriesRequest{TagMode: types.TagModeAll, Tags: []types.TagData{trip}},
+			cond: exists + key + "))",
+			args: []interface{}{"trip"},
+		},
+		{
+			name: "all key=value",
+			req:  types.SearchEntriesRequest{TagMode: types.TagModeAll, Tags: []types.TagData{mood}},
+			cond: exists + pair + "))",
+			args: []interface{}{"mood", "happy"},
+		},
+		{
+			name: "all of several",
+			req:  types.SearchEntriesRequest{TagMode: types.TagModeAll, Tags: []types.TagData{trip, mood}},
+			cond: exists + key + ")) AND " + exists + pair + "))",
+			args: []interface{}{"trip", "mood", "happy"},
+		},
+		{
+			name: "exclude key",
+			req:  types.SearchEntriesRequest{ExcludeTags: []types.TagData{trip}},
+			cond: "NOT " + exists + key + "))",
+			args: []interface{}{"trip"},
+		},
+		{
+			name: "exclude key=value",
+			req:  types.SearchEntriesRequest{ExcludeTags: []types.TagData{mood}},
+			cond: "NOT " + exists + pair + "))",
+			args: []interface{}{"mood", "happy"},
+		},
+		{
+			name: "any with exclude",
+			req:  types.SearchEntriesRequest{Tags: []types.TagData{trip}, ExcludeTags: []types.TagData{mood}},
+			cond: exists + key + ")) AND NOT " + exists + pair + "))",
+			args: []interface{}{"trip", "mood", "happy"},
+		},
+		{
+			name: "all with exclude",
+			req:  types.SearchEntriesRequest{TagMode: types.TagModeAll, Tags: []types.TagData{trip, mood}, ExcludeTags: []types.TagData{trip}},
+			cond: exists + key + ")) AND " + exists + pair + ")) AND NOT " + exists + key + "))",
+			args: []interface{}{"trip", "mood", "happy", "trip"},
+		},
+		{
+			name:   "sealed key=value",
+			cipher: tokenCipher{},
+			req:    types.SearchEntriesRequest{TagMode: types.TagModeAll, Tags: []types.TagData{trip, mood}},
+			cond:   exists + key + ")) AND " + exists + sealed + "))",
+			args:   []interface{}{"trip", "mood", "happy", "tok(alice-id,happy)"},
+		},
+		{
+			name:   "sealed exclude",
+			cipher: tokenCipher{},
+			req:    types.SearchEntriesRequest{ExcludeTags: []types.TagData{mood}},
+			cond:   "NOT " + exists + sealed + "))",
+			args:   []interface{}{"mood", "happy", "tok(alice-id,happy)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mysqlEntries{cipher: tt.cipher}
+			cond, args, err := m.tagsCondition("alice-id", tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cond != tt.cond {
+				t.Errorf("cond =\n\t%s\nwant\n\t%s", cond, tt.cond)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"database/sql"
+)
+
+type mysqlSessions struct {
+	sdb *sql.DB
+}
+
+const sessionColumns = `
+        session_id, user_id, username, refresh_token_hash, previous_token_hash,
+        device_name, user_agent, client_ip, created_at, last_used_at, expires_at, revoked_at
+    `
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row rowScanner) (types.Session, error) {
+	var s types.Session
+	var previousHash, deviceName, userAgent, clientIP sql.NullString
+	var revokedAt sql.NullTime
+	err := row.Scan(
+		&s.ID, &s.UserID, &s.Username, &s.RefreshTokenHash, &previousHash,
+		&deviceName, &userAgent, &clientIP, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &revokedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return types.Session{}, ErrNotFound
+		}
+		return types.Session{}, err
+	}
+	s.PreviousTokenHash = previousHash.String
+	s.DeviceName = deviceName.String
+	s.UserAgent = userAgent.String
+	s.ClientIP = clientIP.String
+	s.RevokedAt = revokedAt.Time
+	return s, nil
+}
+
+func (m *mysqlSessions) Create(session types.Session) error {
+	query := `
+        INSERT INTO sessions (
+            session_id, user_id, username, refresh_token_hash,
+            device_name, user_agent, client_ip, created_at, last_used_at, expires_at
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+	_, err := m.sdb.Exec(query,
+		session.ID, session.UserID, session.Username, session.RefreshTokenHash,
+		session.DeviceName, session.UserAgent, session.ClientIP,
+		session.CreatedAt, session.LastUsedAt, session.ExpiresAt,
+	)
+	if err != nil {
+		utils.LM.Logger.Printf("Error inserting session: username=%s, error=%v", session.Username, err)
+	}
+	return err
+}
+
+func (m *mysqlSessions) Get(sessionID string) (types.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE session_id = ?`
+	return scanSession(m.sdb.QueryRow(query, sessionID))
+}
+
+func (m *mysqlSessions) GetByRefreshHash(hash string) (types.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE refresh_token_hash = ? OR previous_token_hash = ? LIMIT 1`
+	return scanSession(m.sdb.QueryRow(query, hash, hash))
+}
+
+func (m *mysqlSessions) Rotate(sessionID, oldHash, newHash string) error {
+	query := `
+        UPDATE sessions
+        SET previous_token_hash = refresh_token_hash, refresh_token_hash = ?, last_used_at = NOW()
+        WHERE session_id = ? AND refresh_token_hash = ? AND revoked_at IS NULL
+    `
+	return execAffecting(m.sdb, query, newHash, sessionID, oldHash)
+}
+
+func (m *mysqlSessions) ListActive(username string) ([]types.Session, error) {
+	query := `
+        SELECT ` + sessionColumns + `
+        FROM sessions
+        WHERE username = ? AND revoked_at IS NULL AND expires_at > NOW()
+        ORDER BY last_used_at DESC
+    `
+	rows, err := m.sdb.Query(query, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []types.Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (m *mysqlSessions) Revoke(sessionID string) error {
+	return inTx(m.sdb, func(tx *sql.Tx) error {
+		query := `UPDATE sessions SET revoked_at = NOW() WHERE session_id = ? AND revoked_at IS NULL`
+		if err := execAffecting(tx, query, sessionID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`UPDATE api_keys SET revoked_at = NOW() WHERE session_id = ? AND revoked_at IS NULL`, sessionID)
+		return err
+	})
+}
+
+func (m *mysqlSessions) RevokeAllForUser(username string) error {
+	return inTx(m.sdb, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`UPDATE sessions SET revoked_at = NOW() WHERE username = ? AND revoked_at IS NULL`, username); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`UPDATE api_keys SET revoked_at = NOW() WHERE username = ? AND session_id IS NOT NULL AND revoked_at IS NULL`, username)
+		return err
+	})
+}
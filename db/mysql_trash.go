@@ -0,0 +1,126 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"database/sql"
+	"time"
+)
+
+func (m *mysqlEntries) ListTrash(userID string, page, limit int64) ([]types.EntryListItem, error) {
+	query := `
+        SELECT entry_id, user_id, username, text, timestamp, last_updated, ciphertext, wrapped_key, nonce, algorithm, version, stats, deleted_at
+        FROM entries
+        WHERE user_id = ? AND deleted_at IS NOT NULL
+        ORDER BY deleted_at DESC
+        LIMIT ? OFFSET ?
+    `
+	rows, err := m.sdb.Query(query, userID, limit, (page-1)*limit)
+	if err != nil {
+		utils.LM.Logger.Printf("Error listing trash: userId=%s, error=%v", userID, err)
+		return nil, err
+	}
+	entries, err := scanTrashed(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []types.EntryListItem{}
+	for _, e := range entries {
+		if err := loadEntryChildren(m.sdb, &e); err != nil {
+			return nil, err
+		}
+		if err := m.open(&e); err != nil {
+			return nil, err
+		}
+		results = append(results, types.EntryListItem{
+			ID:        e.ID,
+			Text:      e.Text,
+			Timestamp: e.Timestamp,
+			Locations: e.Locations,
+			Tags:      e.Tags,
+			Images:    e.Images,
+			Encrypted: e.Encrypted,
+			DeletedAt: e.DeletedAt,
+		})
+	}
+	return results, nil
+}
+
+// scanTrashed is scanEntries for queries that also select deleted_at.
+func scanTrashed(rows *sql.Rows) ([]types.Entry, error) {
+	defer rows.Close()
+	var entries []types.Entry
+	for rows.Next() {
+		var deletedAt time.Time
+		e, err := scanEntry(rows, &deletedAt)
+		if err != nil {
+			utils.LM.Logger.Printf("Error scanning trashed entry row: %v", err)
+			return nil, err
+		}
+		e.DeletedAt = &deletedAt
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (m *mysqlEntries) Undelete(key EntryKey) error {
+	cond, args := key.where("")
+	return execAffecting(m.sdb, `
+        UPDATE entries
+        SET deleted_at = NULL
+        WHERE `+cond+` AND deleted_at IS NOT NULL
+    `, args...)
+}
+
+func (m *mysqlEntries) Trashed(userID string, before time.Time, limit int) ([]types.Entry, error) {
+	query := `
+        SELECT entry_id, user_id, username, text, timestamp, last_updated, ciphertext, wrapped_key, nonce, algorithm, version, stats, deleted_at
+        FROM entries
+        WHERE deleted_at IS NOT NULL
+    `
+	var args []interface{}
+	if userID != "" {
+		query += " AND user_id = ?"
+		args = append(args, userID)
+	}
+	if !before.IsZero() {
+		query += " AND deleted_at < ?"
+		args = append(args, before)
+	}
+	query += " ORDER BY deleted_at LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := m.sdb.Query(query, args...)
+	if err != nil {
+		utils.LM.Logger.Printf("Error querying trashed entries: userId=%s, error=%v", userID, err)
+		return nil, err
+	}
+	entries, err := scanTrashed(rows)
+	if err != nil {
+		return nil, err
+	}
+	// Only the images are needed to purge, and they are never sealed.
+	for i := range entries {
+		if entries[i].Images, err = m.ImageKeys(entries[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Purge relies on ON DELETE CASCADE for the entry's children and revisions.
+func (m *mysqlEntries) Purge(key EntryKey) error {
+	cond, args := key.where("")
+	err := execAffecting(m.sdb, `
+        DELETE FROM entries
+        WHERE `+cond+` AND deleted_at IS NOT NULL
+    `, args...)
+	if err != nil && err != ErrNotFound {
+		utils.LM.Logger.Printf("Error purging entry: id=%s, userId=%s, error=%v", key.ID, key.UserID, err)
+	}
+	if err == nil {
+		updateIndex(m.index, key.UserID, key.ID, nil)
+	}
+	return err
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"database/sql"
+	"time"
+)
+
+type mysqlTwoFactor struct {
+	sdb *sql.DB
+}
+
+func (m *mysqlTwoFactor) Get(userID string) (types.TwoFactor, error) {
+	query := `SELECT user_id, secret, created_at, enabled_at, last_used_step FROM user_totp WHERE user_id = ?`
+	var tf types.TwoFactor
+	var enabledAt sql.NullTime
+	var lastUsedStep sql.NullInt64
+	err := m.sdb.QueryRow(query, userID).Scan(&tf.UserID, &tf.Secret, &tf.CreatedAt, &enabledAt, &lastUsedStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return types.TwoFactor{}, ErrNotFound
+		}
+		return types.TwoFactor{}, err
+	}
+	tf.EnabledAt = enabledAt.Time
+	tf.LastUsedStep = lastUsedStep.Int64
+	return tf, nil
+}
+
+func (m *mysqlTwoFactor) SavePending(userID, secret string, at time.Time) error {
+	// The WHERE on the update leaves an enabled factor untouched.
+	query := `
+        INSERT INTO user_totp (user_id, secret, created_at)
+        VALUES (?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            secret = IF(enabled_at IS NULL, VALUES(secret), secret),
+            created_at = IF(enabled_at IS NULL, VALUES(created_at), created_at)
+    `
+	_, err := m.sdb.Exec(query, userID, secret, at)
+	return err
+}
+
+func (m *mysqlTwoFactor) Enable(userID string, at time.Time, recoveryCodeHashes []string) error {
+	return inTx(m.sdb, func(tx *sql.Tx) error {
+		query := `UPDATE user_totp SET enabled_at = ? WHERE user_id = ? AND enabled_at IS NULL`
+		if err := execAffecting(tx, query, at, userID); err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, recoveryCodeHashes)
+	})
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID string, hashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if _, err := tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mysqlTwoFactor) Disable(userID string) error {
+	return inTx(m.sdb, func(tx *sql.Tx) error {
+		if err := execAffecting(tx, `DELETE FROM user_totp WHERE user_id = ?`, userID); err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, nil)
+	})
+}
+
+func (m *mysqlTwoFactor) UseStep(userID string, step int64) error {
+	query := `
+        UPDATE user_totp SET last_used_step = ?
+        WHERE user_id = ? AND (last_used_step IS NULL OR last_used_step < ?)
+    `
+	return execAffecting(m.sdb, query, step, userID, step)
+}
+
+func (m *mysqlTwoFactor) UseRecoveryCode(userID, codeHash string, at time.Time) error {
+	query := `
+        UPDATE recovery_codes SET used_at = ?
+        WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+        LIMIT 1
+    `
+	return execAffecting(m.sdb, query, at, userID, codeHash)
+}
+
+func (m *mysqlTwoFactor) RecoveryCodesRemaining(userID string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL`
+	err := m.sdb.QueryRow(query, userID).Scan(&count)
+	return count, err
+}
+
+func (m *mysqlTwoFactor) CreateChallenge(c types.LoginChallenge) error {
+	query := `
+        INSERT INTO login_challenges (challenge_hash, user_id, username, session_option, created_at, expires_at)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `
+	_, err := m.sdb.Exec(query, c.Hash, c.UserID, c.Username, c.SessionOption, c.CreatedAt, c.ExpiresAt)
+	return err
+}
+
+func (m *mysqlTwoFactor) GetChallenge(hash string) (types.LoginChallenge, error) {
+	query := `
+        SELECT challenge_hash, user_id, username, session_option, created_at, expires_at, attempts, consumed_at
+        FROM login_challenges WHERE challenge_hash = ?
+    `
+	var c types.LoginChallenge
+	var consumedAt sql.NullTime
+	err := m.sdb.QueryRow(query, hash).Scan(
+		&c.Hash, &c.UserID, &c.Username, &c.SessionOption, &c.CreatedAt, &c.ExpiresAt, &c.Attempts, &consumedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return types.LoginChallenge{}, ErrNotFound
+		}
+		return types.LoginChallenge{}, err
+	}
+	c.ConsumedAt = consumedAt.Time
+	return c, nil
+}
+
+func (m *mysqlTwoFactor) FailChallenge(hash string) error {
+	_, err := m.sdb.Exec(`UPDATE login_challenges SET attempts = attempts + 1 WHERE challenge_hash = ?`, hash)
+	return err
+}
+
+func (m *mysqlTwoFactor) ConsumeChallenge(hash string, at time.Time) error {
+	query := `UPDATE login_challenges SET consumed_at = ? WHERE challenge_hash = ? AND consumed_at IS NULL`
+	return execAffecting(m.sdb, query, at, hash)
+}
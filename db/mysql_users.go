@@ -0,0 +1,141 @@
+package db
+
+import (
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"database/sql"
+	"fmt"
+)
+
+type mysqlUsers struct {
+	sdb *sql.DB
+	// index is the entries' SearchIndex, which drops a user's entries along
+	// with them.
+	index SearchIndex
+}
+
+const userColumns = `user_id, username, password, salt, font`
+
+func scanUser(row *sql.Row) (types.User, error) {
+	var user types.User
+	var font sql.NullString
+	err := row.Scan(&user.UserID, &user.Username, &user.Password, &user.Salt, &font)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return types.User{}, ErrNotFound
+		}
+		return types.User{}, err
+	}
+	user.Font = font.String
+	return user, nil
+}
+
+func (m *mysqlUsers) Create(user types.User) error {
+	query := `
+        INSERT INTO users (user_id, username, password, salt, font)
+        VALUES (?, ?, ?, ?, ?)
+    `
+	result, err := m.sdb.Exec(query, user.UserID, user.Username, user.Password, user.Salt, user.Font)
+	if err != nil {
+		utils.LM.Logger.Printf("Error inserting new user into the database: %v", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected != 1 {
+		utils.LM.Logger.Printf("Unexpected result from user insert: result = %d", rowsAffected)
+		return fmt.Errorf("unexpected rows affected inserting user: %d", rowsAffected)
+	}
+	return nil
+}
+
+func (m *mysqlUsers) GetByUsername(username string) (types.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = ?`
+	user, err := scanUser(m.sdb.QueryRow(query, username))
+	if err != nil && err != ErrNotFound {
+		utils.LM.Logger.Printf("Error querying user from database: username=%s, error=%v", username, err)
+	}
+	return user, err
+}
+
+func (m *mysqlUsers) UsernameExists(username string) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)`
+	if err := m.sdb.QueryRow(query, username).Scan(&exists); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return exists, nil
+}
+
+func (m *mysqlUsers) List() ([]types.UserListItem, error) {
+	rows, err := m.sdb.Query(`SELECT user_id, username FROM users ORDER BY username`)
+	if err != nil {
+		utils.LM.Logger.Printf("Error listing users: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []types.UserListItem
+	for rows.Next() {
+		var user types.UserListItem
+		if err := rows.Scan(&user.UserID, &user.Username); err != nil {
+			utils.LM.Logger.Printf("Error scanning user row: %v", err)
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (m *mysqlUsers) UpdatePassword(username, hashedPassword, salt string) error {
+	result, err := m.sdb.Exec(`UPDATE users SET password = ?, salt = ? WHERE username = ?`, hashedPassword, salt, username)
+	if err != nil {
+		utils.LM.Logger.Printf("Error updating password for user %s: %v", username, err)
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *mysqlUsers) Delete(username string) error {
+	var userID string
+	err := m.sdb.QueryRow(`SELECT user_id FROM users WHERE username = ?`, username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		utils.LM.Logger.Printf("Error looking up user %s to delete: %v", username, err)
+		return err
+	}
+
+	result, err := m.sdb.Exec(`DELETE FROM users WHERE username = ?`, username)
+	if err != nil {
+		utils.LM.Logger.Printf("Error deleting user %s from database: %v", username, err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		utils.LM.Logger.Printf("Error checking rows affected for user %s: %v", username, err)
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	if err := m.index.RemoveUser(userID); err != nil {
+		utils.LM.Logger.Printf("Error removing user %s from the search index: %v", username, err)
+	}
+	return nil
+}
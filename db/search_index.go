@@ -0,0 +1,104 @@
+package db
+
+import (
+	"JourneyAppServer/search"
+	"JourneyAppServer/utils"
+)
+
+// SearchIndex finds entries by the words of their plain text. The store
+// keeps it in line with entries as they are created, edited, restored and
+// purged; trashed entries stay in it until they are purged, and searches
+// leave them out. MySQL's FULLTEXT index, the default, keeps itself in line,
+// so writing to it does nothing.
+type SearchIndex interface {
+	// Index adds or replaces the plain text of one of userID's entries.
+	Index(userID, entryID, plainText string) error
+	// Remove drops an entry from the index, if it is there.
+	Remove(userID, entryID string) error
+	// RemoveUser drops every one of userID's entries.
+	RemoveUser(userID string) error
+	// Clear empties the index, as before Reindex rebuilds it.
+	Clear() error
+	// Match returns the IDs of userID's entries that term matches, with
+	// scores that are higher the better they match.
+	Match(userID string, term search.Text) (map[string]float64, error)
+	Close() error
+}
+
+// EntryText is the plain text of an entry, as a SearchIndex is given it.
+type EntryText struct {
+	UserID    string
+	EntryID   string
+	PlainText string
+}
+
+// Reindex rebuilds index from the plain text of every entry, reading batch
+// entries at a time, and returns how many it indexed.
+func Reindex(entries EntryRepository, index SearchIndex, batch int) (int, error) {
+	if err := index.Clear(); err != nil {
+		return 0, err
+	}
+	indexed := 0
+	after := ""
+	for {
+		texts, err := entries.PlainTexts(after, batch)
+		if err != nil {
+			return indexed, err
+		}
+		for _, text := range texts {
+			if err := index.Index(text.UserID, text.EntryID, text.PlainText); err != nil {
+				return indexed, err
+			}
+			indexed++
+		}
+		if len(texts) < batch {
+			return indexed, nil
+		}
+		after = texts[len(texts)-1].EntryID
+	}
+}
+
+// updateIndex brings index in line with an entry just written to the store:
+// its new plain text, or nil if the server can't read it. A failure is
+// logged rather than returned, as the write itself has been made; a reindex
+// brings the index back in line.
+func updateIndex(index SearchIndex, userID, entryID string, plainText *string) {
+	var err error
+	if plainText != nil {
+		err = index.Index(userID, entryID, *plainText)
+	} else {
+		err = index.Remove(userID, entryID)
+	}
+	if err != nil {
+		utils.LM.Logger.Printf("Error updating the search index: id=%s, userId=%s, error=%v", entryID, userID, err)
+	}
+}
+
+// textMatches has what a SearchIndex matched for each text term of a query.
+type textMatches map[search.Text]map[string]float64
+
+func matchTerms(index SearchIndex, userID string, query search.Expr) (textMatches, error) {
+	matched := make(textMatches)
+	var err error
+	search.Walk(query, func(expr search.Expr, _ bool) {
+		text, ok := expr.(search.Text)
+		if !ok || err != nil {
+			return
+		}
+		if _, done := matched[text]; !done {
+			matched[text], err = index.Match(userID, text)
+		}
+	})
+	return matched, err
+}
+
+// score adds up what terms matched for each entry.
+func (t textMatches) score(terms []search.Text) map[string]float64 {
+	scores := make(map[string]float64)
+	for _, term := range terms {
+		for id, score := range t[term] {
+			scores[id] += score
+		}
+	}
+	return scores
+}
@@ -0,0 +1,269 @@
+package db
+
+import (
+	"JourneyAppServer/search"
+	"JourneyAppServer/types"
+	"errors"
+	"slices"
+	"time"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// ErrVersionMismatch is returned by a write made against a version of an
+// entry that is no longer current.
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// SealedPrefix starts every value a FieldCipher seals, which tells sealed
+// values apart from ones written before encryption at rest was turned on.
+const SealedPrefix = "$enc$v1$"
+
+// FieldCipher encrypts entry text, tag values and location names at rest
+// with per-user keys. Stores built without one keep them in plaintext.
+type FieldCipher interface {
+	// Seal returns "" for "" and otherwise a value starting with SealedPrefix.
+	Seal(userID, plaintext string) (string, error)
+	// Open returns values without SealedPrefix unchanged.
+	Open(userID, value string) (string, error)
+	// IndexTokens returns the blind index tokens for the words of text.
+	IndexTokens(userID, text string) ([]string, error)
+	// Token returns the blind index token of an exact value, e.g. a
+	// location name, so it can still be compared for equality.
+	Token(userID, value string) (string, error)
+}
+
+// EntryKey identifies a single entry owned by a user. The v1 endpoints name
+// entries by their timestamp as well, and it is only compared when set; the
+// ID alone is unique.
+type EntryKey struct {
+	ID        string
+	UserID    string
+	Timestamp time.Time
+}
+
+type UserRepository interface {
+	Create(user types.User) error
+	GetByUsername(username string) (types.User, error)
+	UsernameExists(username string) (bool, error)
+	List() ([]types.UserListItem, error)
+	UpdatePassword(username, hashedPassword, salt string) error
+	Delete(username string) error
+}
+
+type EntryRepository interface {
+	Create(entry types.Entry) error
+	Get(key EntryKey) (types.Entry, error)
+	// Patch applies patch and returns the entry as it is afterwards. Unless
+	// version is 0, it has to be the entry's current version or
+	// ErrVersionMismatch is returned.
+	Patch(key EntryKey, patch types.EntryPatch, version int64) (types.Entry, error)
+	// Delete moves an entry to the trash. Trashed entries are left out of
+	// every other method here except the trash ones below.
+	Delete(key EntryKey) error
+	ReplaceTags(key EntryKey, tags []types.TagData) error
+	ReplaceLocations(key EntryKey, locations []types.LocationData) error
+	ReplaceImages(key EntryKey, images []string) error
+	DeleteImage(key EntryKey, image string) error
+	ImageKeys(entryID string) ([]string, error)
+	UserImageKeys(username string) ([]string, error)
+	List(params types.ListEntriesParams) ([]types.EntryListItem, error)
+	// Search returns a page of the entries matching req and query, which is
+	// req.SearchQuery parsed and nil if it has no terms, and how many match in
+	// all.
+	Search(req types.SearchEntriesRequest, query search.Expr) ([]SearchHit, int64, error)
+	UniqueTags(username string) ([]types.TagData, error)
+	UniqueLocations(username string) ([]types.LocationData, error)
+	// SealPlaintext seals up to limit text, tag value, location name and
+	// revision snapshot values still stored in plaintext, and adds tokens to
+	// sealed tag values without one, returning how many it did. It is a
+	// no-op for stores without a FieldCipher.
+	SealPlaintext(limit int) (int, error)
+	// AnalyzeText fills in the plain text and stats of up to limit entries
+	// written before the server kept them, returning how many it did.
+	AnalyzeText(limit int) (int, error)
+	// PlainTexts returns the plain text of up to limit entries with IDs
+	// after after, in ID order, for rebuilding a SearchIndex. E2EE entries
+	// and those AnalyzeText hasn't got to are left out.
+	PlainTexts(after string, limit int) ([]EntryText, error)
+
+	// Every change made through Patch, Restore or the Replace methods first
+	// saves the entry as it was as a revision and bumps its version.
+
+	// Revisions returns the entry's revisions, newest first.
+	Revisions(key EntryKey) ([]types.EntryRevision, error)
+	Revision(key EntryKey, revision int64) (types.EntryRevision, error)
+	// Restore replaces every field of the entry with those of a revision,
+	// leaving out the images in dropImages.
+	Restore(key EntryKey, revision int64, dropImages []string) error
+	// PruneRevisions deletes the oldest revisions beyond keepPerEntry for
+	// entryID and keepPerUser for userID, and any made before olderThan. A
+	// zero limit or time is no limit.
+	PruneRevisions(userID, entryID string, keepPerEntry, keepPerUser int, olderThan time.Time) error
+
+	// ListTrash pages through userID's trash, most recently deleted first.
+	ListTrash(userID string, page, limit int64) ([]types.EntryListItem, error)
+	// Undelete moves an entry back out of the trash.
+	Undelete(key EntryKey) error
+	// Trashed returns up to limit trashed entries with their images, oldest
+	// deletion first: userID's, or everyone's if it is empty, and only those
+	// deleted before before unless it is zero.
+	Trashed(userID string, before time.Time, limit int) ([]types.Entry, error)
+	// Purge permanently deletes a trashed entry and its revisions.
+	Purge(key EntryKey) error
+}
+
+// SearchHit is an entry found by a search.
+type SearchHit struct {
+	Entry types.Entry
+	// Score is how relevant the entry is to the search query, higher being
+	// better. It is 0 without a query.
+	Score float64
+	// PlainText is the entry's text without markdown, for snippets.
+	PlainText string
+	// Distance is how far in metres the entry's closest location is from
+	// the search's point, or nil if it has none.
+	Distance *float64
+}
+
+// Revision reasons.
+const (
+	RevisionUpdate  = "update"
+	RevisionRestore = "restore"
+)
+
+// withoutImages returns images less those in drop, for Restore.
+func withoutImages(images, drop []string) []string {
+	if len(drop) == 0 {
+		return images
+	}
+	kept := []string{}
+	for _, image := range images {
+		if !slices.Contains(drop, image) {
+			kept = append(kept, image)
+		}
+	}
+	return kept
+}
+
+type SessionRepository interface {
+	Create(session types.Session) error
+	Get(sessionID string) (types.Session, error)
+	// GetByRefreshHash matches either the current or the previous refresh
+	// token hash so callers can detect a replayed token.
+	GetByRefreshHash(hash string) (types.Session, error)
+	// Rotate swaps in newHash only if oldHash is still current, so two
+	// concurrent refreshes with the same token can't both succeed.
+	Rotate(sessionID, oldHash, newHash string) error
+	ListActive(username string) ([]types.Session, error)
+	// Revoke and RevokeAllForUser also revoke the API keys issued with the
+	// sessions they end.
+	Revoke(sessionID string) error
+	RevokeAllForUser(username string) error
+}
+
+type APIKeyRepository interface {
+	Create(key types.UserAPIKey) error
+	GetByHash(hash string) (types.UserAPIKey, error)
+	Get(username, keyID string) (types.UserAPIKey, error)
+	// List returns every key the user has, including revoked and expired ones.
+	List(username string) ([]types.UserAPIKey, error)
+	Touch(keyID string, at time.Time) error
+	// Revoke returns ErrNotFound unless keyID is an unrevoked key of username.
+	Revoke(username, keyID string, at time.Time) error
+	// Rotate stores replacement and, in the same transaction, points the
+	// active, not yet rotated key oldID at it and brings its expiry forward
+	// to graceUntil. It returns ErrNotFound, storing nothing, when the old
+	// key has already been rotated or revoked.
+	Rotate(oldID string, replacement types.UserAPIKey, graceUntil time.Time) error
+	// PruneSessionKeys deletes the user's keys that belong to a session and
+	// have been revoked or have expired by now.
+	PruneSessionKeys(username string, now time.Time) error
+}
+
+type TwoFactorRepository interface {
+	Get(userID string) (types.TwoFactor, error)
+	// SavePending stores a new secret for an enrollment that hasn't been
+	// confirmed, replacing any earlier unconfirmed one.
+	SavePending(userID, secret string, at time.Time) error
+	// Enable turns the factor on and replaces the recovery codes.
+	Enable(userID string, at time.Time, recoveryCodeHashes []string) error
+	Disable(userID string) error
+	// UseStep records a TOTP time step as used; it returns ErrNotFound if that
+	// step (or a later one) has already been used.
+	UseStep(userID string, step int64) error
+	// UseRecoveryCode marks an unused code as used, or returns ErrNotFound.
+	UseRecoveryCode(userID, codeHash string, at time.Time) error
+	RecoveryCodesRemaining(userID string) (int, error)
+
+	CreateChallenge(challenge types.LoginChallenge) error
+	GetChallenge(hash string) (types.LoginChallenge, error)
+	FailChallenge(hash string) error
+	// ConsumeChallenge returns ErrNotFound if the challenge was already used.
+	ConsumeChallenge(hash string, at time.Time) error
+}
+
+type PasswordResetRepository interface {
+	Create(token types.PasswordResetToken) error
+	Get(hash string) (types.PasswordResetToken, error)
+	// Use marks an unused token as used, or returns ErrNotFound.
+	Use(hash string, at time.Time) error
+	// InvalidateAll marks every unused token of the user as used.
+	InvalidateAll(userID string, at time.Time) error
+}
+
+// EncryptionRepository holds the wrapped key material of users who have
+// turned on end-to-end encryption.
+type EncryptionRepository interface {
+	Get(userID string) (types.UserEncryption, error)
+	// Save stores enc, replacing the wrapped key of a user who already has
+	// one but keeping their original EnabledAt.
+	Save(enc types.UserEncryption) error
+}
+
+// DataKeyRepository holds each user's at-rest data key, wrapped by a master
+// key.
+type DataKeyRepository interface {
+	Get(userID string) (types.DataKey, error)
+	// Create stores key unless the user already has one, in which case it
+	// does nothing; callers should Get the key that won.
+	Create(key types.DataKey) error
+	// ListStale returns up to limit keys wrapped by a master key other than
+	// masterKeyID.
+	ListStale(masterKeyID string, limit int) ([]types.DataKey, error)
+	// Rewrap replaces a key's wrapping if it is still wrapped by
+	// oldMasterKeyID, and returns ErrNotFound otherwise.
+	Rewrap(userID, oldMasterKeyID string, wrappedKey []byte, masterKeyID string, at time.Time) error
+}
+
+type LoginAttemptRepository interface {
+	Record(attempt types.LoginAttempt) error
+	// Failures counts uncleared failed attempts since the given time, once by
+	// username and once by client IP.
+	Failures(username, clientIP string, since time.Time) (byUser, byIP types.LoginFailures, err error)
+	ClearUser(username string) error
+	ClearIP(clientIP string) error
+	// Lock sets (or extends) a lockout on key, e.g. "user:alice".
+	Lock(key string, until time.Time) error
+	// LockedUntil returns the zero time when key isn't locked.
+	LockedUntil(key string) (time.Time, error)
+	Unlock(key string) error
+}
+
+type EventRepository interface {
+	Record(event types.AnalyticsEvent) error
+}
+
+// Store bundles the repositories handlers depend on so they never reach for
+// SDB or MongoClient directly.
+type Store struct {
+	Users          UserRepository
+	Entries        EntryRepository
+	Sessions       SessionRepository
+	APIKeys        APIKeyRepository
+	TwoFactor      TwoFactorRepository
+	PasswordResets PasswordResetRepository
+	Encryption     EncryptionRepository
+	DataKeys       DataKeyRepository
+	LoginAttempts  LoginAttemptRepository
+	Events         EventRepository
+}
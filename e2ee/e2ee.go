@@ -0,0 +1,159 @@
+// Package e2ee is the server side of opt-in end-to-end encrypted journals.
+// Clients encrypt entry text before sending it and compute blind index tokens
+// (keyed hashes of its words) for search; the server only stores the wrapped
+// key material and envelopes, and checks they are well formed. Nothing here
+// can decrypt them.
+package e2ee
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/search"
+	"JourneyAppServer/types"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// MaxCiphertextBytes bounds one entry's envelope. The column could hold
+	// far more, but plaintext entries are limited to a TEXT column.
+	MaxCiphertextBytes = 1 << 20
+	maxWrappedKeyBytes = 1024
+	maxNonceBytes      = 64
+	maxAlgorithmLength = 50
+	maxKDFParamsLength = 255
+
+	// MaxBlindTokens bounds the tokens per entry and per search.
+	MaxBlindTokens = 1000
+	maxTokenLength = 128
+)
+
+var (
+	ErrNotEnabled     = errors.New("end-to-end encryption is not enabled")
+	ErrPlaintext      = errors.New("entry text must be sent encrypted")
+	ErrInvalidPayload = errors.New("invalid encrypted payload")
+	ErrInvalidKey     = errors.New("invalid wrapped key")
+	ErrInvalidSearch  = errors.New("invalid search for encrypted entries")
+)
+
+// Get returns userID's key material, or ErrNotEnabled.
+func Get(store *db.Store, userID string) (types.UserEncryption, error) {
+	enc, err := store.Encryption.Get(userID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return types.UserEncryption{}, ErrNotEnabled
+		}
+		return types.UserEncryption{}, err
+	}
+	return enc, nil
+}
+
+// Enabled reports whether userID's entries are end-to-end encrypted.
+func Enabled(store *db.Store, userID string) (bool, error) {
+	_, err := Get(store, userID)
+	if errors.Is(err, ErrNotEnabled) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Enable turns E2EE on for userID, or replaces the wrapped key if it is
+// already on. There is no way back: the server can't decrypt existing
+// entries to turn them into plaintext.
+func Enable(store *db.Store, userID string, req types.EnableEncryptionRequest) error {
+	if len(req.WrappedKey) == 0 || len(req.WrappedKey) > maxWrappedKeyBytes {
+		return fmt.Errorf("%w: wrappedKey must be 1-%d bytes", ErrInvalidKey, maxWrappedKeyBytes)
+	}
+	if req.Algorithm == "" || len(req.Algorithm) > maxAlgorithmLength {
+		return fmt.Errorf("%w: algorithm must be 1-%d characters", ErrInvalidKey, maxAlgorithmLength)
+	}
+	if len(req.KDFParams) > maxKDFParamsLength {
+		return fmt.Errorf("%w: kdfParams must be at most %d characters", ErrInvalidKey, maxKDFParamsLength)
+	}
+	now := time.Now().UTC()
+	return store.Encryption.Save(types.UserEncryption{
+		UserID:     userID,
+		WrappedKey: req.WrappedKey,
+		Algorithm:  req.Algorithm,
+		KDFParams:  req.KDFParams,
+		EnabledAt:  now,
+		UpdatedAt:  now,
+	})
+}
+
+// CheckEntry validates the text and envelope of an entry being written.
+// Users with E2EE on may only send an envelope; everyone else may only send
+// text. An entry with neither is fine either way.
+func CheckEntry(enabled bool, text string, payload *types.EncryptedPayload) error {
+	if !enabled {
+		if payload != nil {
+			return ErrNotEnabled
+		}
+		return nil
+	}
+	if text != "" {
+		return ErrPlaintext
+	}
+	if payload == nil {
+		return nil
+	}
+	switch {
+	case len(payload.Ciphertext) == 0 || len(payload.Ciphertext) > MaxCiphertextBytes:
+		return fmt.Errorf("%w: ciphertext must be 1-%d bytes", ErrInvalidPayload, MaxCiphertextBytes)
+	case len(payload.WrappedKey) == 0 || len(payload.WrappedKey) > maxWrappedKeyBytes:
+		return fmt.Errorf("%w: wrappedKey must be 1-%d bytes", ErrInvalidPayload, maxWrappedKeyBytes)
+	case len(payload.Nonce) > maxNonceBytes:
+		return fmt.Errorf("%w: nonce must be at most %d bytes", ErrInvalidPayload, maxNonceBytes)
+	case payload.Algorithm == "" || len(payload.Algorithm) > maxAlgorithmLength:
+		return fmt.Errorf("%w: algorithm must be 1-%d characters", ErrInvalidPayload, maxAlgorithmLength)
+	}
+	if err := checkTokens(payload.BlindIndex); err != nil {
+		return fmt.Errorf("%w: blindIndex %v", ErrInvalidPayload, err)
+	}
+	return nil
+}
+
+// CheckSearch makes sure a search fits the user's mode: MATCH() AGAINST has
+// nothing to match for encrypted entries, so their text is searched by blind
+// tokens instead. query is req.SearchQuery parsed; its other terms, such as
+// tags and dates, work either way.
+func CheckSearch(enabled bool, req types.SearchEntriesRequest, query search.Expr) error {
+	if !enabled {
+		if len(req.BlindTokens) > 0 {
+			return ErrNotEnabled
+		}
+		return nil
+	}
+	if search.HasText(query) {
+		return fmt.Errorf("%w: send blindTokens instead of text in searchQuery", ErrInvalidSearch)
+	}
+	if err := checkTokens(req.BlindTokens); err != nil {
+		return fmt.Errorf("%w: blindTokens %v", ErrInvalidSearch, err)
+	}
+	return nil
+}
+
+func checkTokens(tokens []string) error {
+	if len(tokens) > MaxBlindTokens {
+		return fmt.Errorf("may hold at most %d tokens", MaxBlindTokens)
+	}
+	for _, token := range tokens {
+		if token == "" || len(token) > maxTokenLength {
+			return fmt.Errorf("tokens must be 1-%d characters", maxTokenLength)
+		}
+	}
+	return nil
+}
+
+// WriteError writes a 400 for the errors above and reports whether it did,
+// so other errors can be handled by the caller.
+func WriteError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrNotEnabled), errors.Is(err, ErrPlaintext), errors.Is(err, ErrInvalidPayload),
+		errors.Is(err, ErrInvalidKey), errors.Is(err, ErrInvalidSearch):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return true
+	}
+	return false
+}
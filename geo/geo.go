@@ -0,0 +1,90 @@
+// Package geo is the geometry entry search needs for locations: distances
+// on the Earth's surface, and boxes of latitudes and longitudes.
+package geo
+
+import "math"
+
+// EarthRadius is the radius, in metres, distances are measured on. It is
+// the one MySQL's ST_Distance_Sphere uses, so every store agrees.
+const EarthRadius = 6370986
+
+// Valid reports whether lat and lon are a point on the Earth.
+func Valid(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// Distance is the great-circle distance in metres between two points, by
+// the haversine formula.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat, dLon := radians(lat2-lat1), radians(lon2-lon1)
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(radians(lat1))*math.Cos(radians(lat2))*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * EarthRadius * math.Asin(math.Sqrt(math.Min(h, 1)))
+}
+
+// Bounds is a box of latitudes and longitudes. West is more than East for a
+// box that crosses the antimeridian.
+type Bounds struct {
+	South, West, North, East float64
+}
+
+// Valid reports whether b is a box on the Earth.
+func (b Bounds) Valid() bool {
+	return Valid(b.South, b.West) && Valid(b.North, b.East) && b.South <= b.North
+}
+
+// Contains reports whether the point is in b, edges included.
+func (b Bounds) Contains(lat, lon float64) bool {
+	if lat < b.South || lat > b.North {
+		return false
+	}
+	if b.West <= b.East {
+		return lon >= b.West && lon <= b.East
+	}
+	return lon >= b.West || lon <= b.East
+}
+
+// Split returns b as boxes that don't cross the antimeridian: b itself, or
+// its parts either side of it.
+func (b Bounds) Split() []Bounds {
+	if b.West <= b.East {
+		return []Bounds{b}
+	}
+	return []Bounds{
+		{South: b.South, West: b.West, North: b.North, East: 180},
+		{South: b.South, West: -180, North: b.North, East: b.East},
+	}
+}
+
+// Around returns a box holding every point within meters of a point, for
+// narrowing a search down before measuring distances. It spans every
+// longitude if the circle reaches a pole.
+func Around(lat, lon, meters float64) Bounds {
+	angle := degrees(meters / EarthRadius)
+	b := Bounds{South: math.Max(lat-angle, -90), North: math.Min(lat+angle, 90), West: -180, East: 180}
+	if b.South == -90 || b.North == 90 {
+		return b
+	}
+	// The widest the circle gets in longitude, which is at a latitude a
+	// little nearer the pole than its centre.
+	ratio := math.Sin(radians(angle)) / math.Cos(radians(lat))
+	if ratio >= 1 {
+		return b
+	}
+	dLon := degrees(math.Asin(ratio))
+	b.West, b.East = wrap(lon-dLon), wrap(lon+dLon)
+	return b
+}
+
+// wrap brings a longitude back into [-180, 180].
+func wrap(lon float64) float64 {
+	switch {
+	case lon < -180:
+		return lon + 360
+	case lon > 180:
+		return lon - 360
+	}
+	return lon
+}
+
+func radians(deg float64) float64 { return deg * math.Pi / 180 }
+func degrees(rad float64) float64 { return rad * 180 / math.Pi }
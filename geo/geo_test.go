@@ -0,0 +1,83 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	for _, tc := range []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"same point", 38.7223, -9.1393, 38.7223, -9.1393, 0},
+		{"Lisbon to Porto", 38.7223, -9.1393, 41.1579, -8.6291, 274000},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, 111190},
+		{"pole to pole", 90, 0, -90, 0, math.Pi * EarthRadius},
+	} {
+		if got := Distance(tc.lat1, tc.lon1, tc.lat2, tc.lon2); math.Abs(got-tc.want) > tc.want/100+1 {
+			t.Errorf("%s: Distance = %.0f, want about %.0f", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestBoundsContains(t *testing.T) {
+	portugal := Bounds{South: 36.9, West: -9.6, North: 42.2, East: -6.2}
+	fiji := Bounds{South: -21, West: 176, North: -12, East: -178}
+	for _, tc := range []struct {
+		name     string
+		b        Bounds
+		lat, lon float64
+		want     bool
+	}{
+		{"inside", portugal, 38.7, -9.1, true},
+		{"on the edge", portugal, 42.2, -6.2, true},
+		{"north of it", portugal, 43.3, -8.4, false},
+		{"east of it", portugal, 40.4, -3.7, false},
+		{"west of the antimeridian", fiji, -17.7, 178.1, true},
+		{"east of the antimeridian", fiji, -16.5, -179.9, true},
+		{"outside across the antimeridian", fiji, -17.7, 170, false},
+	} {
+		if got := tc.b.Contains(tc.lat, tc.lon); got != tc.want {
+			t.Errorf("%s: Contains = %v, want %v", tc.name, got, tc.want)
+		}
+		inParts := false
+		for _, part := range tc.b.Split() {
+			inParts = inParts || part.Contains(tc.lat, tc.lon)
+		}
+		if inParts != tc.want {
+			t.Errorf("%s: in the parts Split returns = %v, want %v", tc.name, inParts, tc.want)
+		}
+	}
+}
+
+func TestAroundHoldsTheCircle(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		lat, lon, rad float64
+	}{
+		{"Lisbon", 38.7223, -9.1393, 50000},
+		{"far north", 78.2232, 15.6267, 300000},
+		{"by the antimeridian", -17.7, 179.9, 100000},
+		{"over the pole", 89.5, 0, 100000},
+	} {
+		b := Around(tc.lat, tc.lon, tc.rad)
+		// Points on the circle, every 10 degrees of bearing.
+		for bearing := 0.0; bearing < 360; bearing += 10 {
+			lat, lon := destination(tc.lat, tc.lon, bearing, tc.rad*0.999)
+			if !b.Contains(lat, lon) {
+				t.Errorf("%s: %+v doesn't contain %.4f, %.4f at bearing %.0f", tc.name, b, lat, lon, bearing)
+			}
+		}
+	}
+}
+
+// destination is the point meters from a point at bearing degrees.
+func destination(lat, lon, bearing, meters float64) (float64, float64) {
+	angle := meters / EarthRadius
+	lat1, lon1, theta := radians(lat), radians(lon), radians(bearing)
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(angle) + math.Cos(lat1)*math.Sin(angle)*math.Cos(theta))
+	lon2 := lon1 + math.Atan2(math.Sin(theta)*math.Sin(angle)*math.Cos(lat1), math.Cos(angle)-math.Sin(lat1)*math.Sin(lat2))
+	return degrees(lat2), wrap(degrees(lon2))
+}
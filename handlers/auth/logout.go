@@ -0,0 +1,70 @@
+package authHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// LogoutHandler ends the session the refresh token belongs to. It needs no
+// access token, so a client whose access token already expired can still log
+// out.
+func LogoutHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req types.LogoutRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.RefreshToken == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		response, err := logout(store, req, r)
+		if err != nil {
+			http.Error(w, "Error logging out", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func logout(store *db.Store, req types.LogoutRequest, r *http.Request) (types.LogoutResponse, error) {
+	session, err := store.Sessions.GetByRefreshHash(utils.HashToken(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			// Already gone; logging out is idempotent.
+			return types.LogoutResponse{Success: true}, nil
+		}
+		utils.LM.Logger.Printf("Error looking up session for logout: %v", err)
+		return types.LogoutResponse{Success: false}, err
+	}
+
+	if err := store.Sessions.Revoke(session.ID); err != nil && !errors.Is(err, db.ErrNotFound) {
+		utils.LM.Logger.Printf("Error revoking session: session=%s, error=%v", session.ID, err)
+		return types.LogoutResponse{Success: false}, err
+	}
+
+	go func() {
+		err := store.Events.Record(types.AnalyticsEvent{
+			UserID:     session.UserID,
+			EventType:  "logout",
+			ObjectType: "session",
+			ObjectID:   session.ID,
+			Metadata:   utils.RequestMetadata(r),
+		})
+		if err != nil {
+			utils.LM.Logger.Printf("Analytics logging error: %v", err)
+		}
+	}()
+
+	return types.LogoutResponse{Success: true}, nil
+}
@@ -0,0 +1,90 @@
+package authHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/middleware"
+	"JourneyAppServer/sessions"
+	"JourneyAppServer/types"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func startSession(t *testing.T) (*db.Store, sessions.Tokens) {
+	t.Helper()
+	store := db.NewMemoryStore()
+	alice := types.User{UserID: "alice-id", Username: "alice"}
+	if err := store.Users.Create(alice); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := sessions.Start(store, alice, "weekly", sessions.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, tokens
+}
+
+// authorized reports whether ValidateJWTMiddleware lets accessToken through.
+func authorized(t *testing.T, store *db.Store, accessToken string) bool {
+	t.Helper()
+	reached := false
+	handler := middleware.ValidateJWTMiddleware(store, func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, withBearer(httptest.NewRequest(http.MethodGet, "/api/users/get", nil), accessToken))
+	if reached != (rec.Code == http.StatusOK) {
+		t.Fatalf("status = %d but handler reached = %v", rec.Code, reached)
+	}
+	return reached
+}
+
+func TestLogoutEndsTheSessionForAccessTokens(t *testing.T) {
+	store, tokens := startSession(t)
+	if !authorized(t, store, tokens.AccessToken) {
+		t.Fatal("new session's access token was turned away")
+	}
+
+	body, _ := json.Marshal(types.LogoutRequest{RefreshToken: tokens.RefreshToken})
+	rec := httptest.NewRecorder()
+	LogoutHandler(store).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/auth/logout", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("logout status = %d", rec.Code)
+	}
+
+	// The access token hasn't expired, but its session has ended.
+	if authorized(t, store, tokens.AccessToken) {
+		t.Fatal("access token still works after logout")
+	}
+	if _, err := sessions.Refresh(store, tokens.RefreshToken); err == nil {
+		t.Fatal("refresh token still works after logout")
+	}
+}
+
+func TestRevokedSessionsAreTurnedAway(t *testing.T) {
+	store, tokens := startSession(t)
+	_, other := startSession(t)
+
+	r := httptest.NewRequest(http.MethodDelete, "/api/auth/sessions/"+tokens.SessionID, nil)
+	r.SetPathValue("id", tokens.SessionID)
+	rec := httptest.NewRecorder()
+	middleware.ValidateJWTMiddleware(store, RevokeSessionHandler(store)).ServeHTTP(rec, withBearer(r, tokens.AccessToken))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revoke status = %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	if authorized(t, store, tokens.AccessToken) {
+		t.Fatal("access token of a revoked session still works")
+	}
+	// A token for a session this store has never seen is no better.
+	if authorized(t, store, other.AccessToken) {
+		t.Fatal("access token of an unknown session works")
+	}
+}
+
+func withBearer(r *http.Request, accessToken string) *http.Request {
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	return r
+}
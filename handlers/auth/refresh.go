@@ -0,0 +1,46 @@
+package authHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/sessions"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+func RefreshHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req types.RefreshRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.RefreshToken == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		tokens, err := sessions.Refresh(store, req.RefreshToken)
+		if err != nil {
+			if errors.Is(err, sessions.ErrInvalidRefreshToken) {
+				http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+				return
+			}
+			utils.LM.Logger.Printf("Error refreshing session: %v", err)
+			http.Error(w, "Error refreshing session", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.RefreshResponse{
+			Success:        true,
+			Token:          tokens.AccessToken,
+			TokenExpiresAt: tokens.TokenExpiresAt,
+			RefreshToken:   tokens.RefreshToken,
+		})
+	}
+}
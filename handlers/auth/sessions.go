@@ -0,0 +1,82 @@
+package authHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/middleware"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+func ListSessionsHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		username, ok := middleware.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		currentID, _ := middleware.GetSessionIDFromContext(r.Context())
+
+		active, err := store.Sessions.ListActive(username)
+		if err != nil {
+			utils.LM.Logger.Printf("Error listing sessions: username=%s, error=%v", username, err)
+			http.Error(w, "Error listing sessions", http.StatusInternalServerError)
+			return
+		}
+
+		response := types.ListSessionsResponse{Sessions: []types.SessionListItem{}}
+		for _, s := range active {
+			response.Sessions = append(response.Sessions, types.SessionListItem{
+				Session: s,
+				Current: s.ID == currentID,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// RevokeSessionHandler signs one of the caller's devices out.
+func RevokeSessionHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		username, ok := middleware.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		sessionID := r.PathValue("id")
+		session, err := store.Sessions.Get(sessionID)
+		if err != nil || session.Username != username {
+			if err != nil && !errors.Is(err, db.ErrNotFound) {
+				utils.LM.Logger.Printf("Error fetching session: session=%s, error=%v", sessionID, err)
+				http.Error(w, "Error revoking session", http.StatusInternalServerError)
+				return
+			}
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+
+		if err := store.Sessions.Revoke(sessionID); err != nil && !errors.Is(err, db.ErrNotFound) {
+			utils.LM.Logger.Printf("Error revoking session: session=%s, error=%v", sessionID, err)
+			http.Error(w, "Error revoking session", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.RevokeSessionResponse{Success: true})
+	}
+}
@@ -1,125 +1,85 @@
 package entriesHandlers
 
 import (
+	"JourneyAppServer/authz"
 	"JourneyAppServer/db"
+	"JourneyAppServer/geo"
 	"JourneyAppServer/types"
 	"JourneyAppServer/utils"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 )
 
-func AddLocationHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var req types.AddLocationRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
+func AddLocationHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
 
-	response, err := addLocation(req, r)
-	if err != nil {
-		http.Error(w, "Error adding the location", http.StatusInternalServerError)
-		return
-	}
+		var req types.AddLocationRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
+		caller, ok := authz.Check(w, r, store, req.Username, req.UserID)
+		if !ok {
+			return
+		}
+		req.Username, req.UserID = caller.Username, caller.UserID
+		if !checkLocations(w, req.Locations) {
+			return
+		}
 
-func addLocation(req types.AddLocationRequest, r *http.Request) (types.AddLocationResponse, error) {
-	tx, err := db.SDB.Begin()
-	if err != nil {
-		utils.LM.Logger.Printf("Error starting transaction for location addition: entry=%s, error=%v", req.EntryID, err)
-		return types.AddLocationResponse{Success: false}, err
-	}
-	defer func() {
+		response, err := addLocation(store, req, r)
 		if err != nil {
-			tx.Rollback()
+			http.Error(w, "Error adding the location", http.StatusInternalServerError)
 			return
 		}
-		tx.Commit()
-	}()
-
-	var exists bool
-	checkQuery := `
-        SELECT EXISTS(
-            SELECT 1 FROM entries 
-            WHERE entry_id = ? AND user_id = ? AND timestamp = ?
-        )
-    `
-	err = tx.QueryRow(checkQuery, req.EntryID, req.UserID, req.Timestamp).Scan(&exists)
-	if err != nil {
-		utils.LM.Logger.Printf("Error checking entry existence: entry=%s, userId=%s, error=%v", req.EntryID, req.UserID, err)
-		return types.AddLocationResponse{Success: false}, err
-	}
-	if !exists {
-		utils.LM.Logger.Printf("Entry not found for location addition: entry=%s, userId=%s, timestamp=%v", req.EntryID, req.UserID, req.Timestamp)
-		return types.AddLocationResponse{Success: false}, nil
-	}
 
-	deleteQuery := `
-        DELETE FROM entry_locations 
-        WHERE entry_id = ?
-    `
-	_, err = tx.Exec(deleteQuery, req.EntryID)
-	if err != nil {
-		utils.LM.Logger.Printf("Error deleting existing locations for entry %s: %v", req.EntryID, err)
-		return types.AddLocationResponse{Success: false}, err
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
 	}
+}
 
-	if len(req.Locations) > 0 {
-		insertQuery := `
-            INSERT INTO entry_locations (entry_id, latitude, longitude, display_name)
-            VALUES (?, ?, ?, ?)
-        `
-		for _, loc := range req.Locations {
-			_, err = tx.Exec(insertQuery, req.EntryID, loc.Latitude, loc.Longitude, loc.DisplayName)
-			if err != nil {
-				utils.LM.Logger.Printf("Error inserting new location for entry %s: lat=%f, lon=%f, name=%s, error=%v",
-					req.EntryID, loc.Latitude, loc.Longitude, loc.DisplayName, err)
-				return types.AddLocationResponse{Success: false}, err
-			}
+// checkLocations makes sure every location is a point on the Earth, as
+// spatial search needs, writing an error and returning false if one isn't.
+func checkLocations(w http.ResponseWriter, locations []types.LocationData) bool {
+	for _, loc := range locations {
+		if !geo.Valid(loc.Latitude, loc.Longitude) {
+			http.Error(w, "Invalid location: latitude must be within -90 to 90 and longitude within -180 to 180", http.StatusBadRequest)
+			return false
 		}
 	}
+	return true
+}
 
-	updateQuery := `
-        UPDATE entries 
-        SET last_updated = NOW() 
-        WHERE entry_id = ? AND user_id = ? AND timestamp = ?
-    `
-	_, err = tx.Exec(updateQuery, req.EntryID, req.UserID, req.Timestamp)
+func addLocation(store *db.Store, req types.AddLocationRequest, r *http.Request) (types.AddLocationResponse, error) {
+	key := db.EntryKey{ID: req.EntryID, UserID: req.UserID, Timestamp: req.Timestamp}
+	err := store.Entries.ReplaceLocations(key, req.Locations)
 	if err != nil {
-		utils.LM.Logger.Printf("Error updating last_updated for entry %s: %v", req.EntryID, err)
+		if errors.Is(err, db.ErrNotFound) {
+			utils.LM.Logger.Printf("Entry not found for location addition: entry=%s, userId=%s, timestamp=%v", req.EntryID, req.UserID, req.Timestamp)
+			return types.AddLocationResponse{Success: false}, nil
+		}
 		return types.AddLocationResponse{Success: false}, err
 	}
-	
+	pruneRevisions(store, req.UserID, req.EntryID)
+
 	go func() {
-		ip := r.Header.Get("X-Forwarded-For")
-		if ip == "" {
-			ip = r.RemoteAddr
-		}
-		metadata := map[string]string{
-			"source":         "api",
-			"client_ip":      ip,
-			"user_agent":     r.Header.Get("User-Agent"),
-			"app_version":    r.Header.Get("X-App-Version"),
-			"os_version":     r.Header.Get("X-OS-Version"),
-			"device_model":   r.Header.Get("X-Device-Model"),
-			"location_count": strconv.Itoa(len(req.Locations)),
-		}
-		metadataJSON, _ := json.Marshal(metadata)
-		analyticsQuery := `
-            INSERT INTO analytics_events (
-                user_id, event_type, object_type, object_id, event_time, metadata
-            ) VALUES (?, ?, ?, ?, NOW(), ?)
-        `
-		_, err := db.SDB.Exec(analyticsQuery, req.UserID, "add_location", "entry", req.EntryID, string(metadataJSON))
+		metadata := utils.RequestMetadata(r)
+		metadata["location_count"] = strconv.Itoa(len(req.Locations))
+		err := store.Events.Record(types.AnalyticsEvent{
+			UserID:     req.UserID,
+			EventType:  "add_location",
+			ObjectType: "entry",
+			ObjectID:   req.EntryID,
+			Metadata:   metadata,
+		})
 		if err != nil {
 			utils.LM.Logger.Printf("Analytics logging error for location addition to entry %s: %v", req.EntryID, err)
 		}
@@ -0,0 +1,169 @@
+package entriesHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/internal/testutil"
+	"JourneyAppServer/types"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+var aliceTimestamp = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestStore(t *testing.T) *db.Store {
+	t.Helper()
+	return seedTestStore(t, db.NewMemoryStore())
+}
+
+// seedTestStore adds alice, bob and alice's entry to store.
+func seedTestStore(t *testing.T, store *db.Store) *db.Store {
+	t.Helper()
+	testutil.AddUsers(t, store)
+	err := store.Entries.Create(types.Entry{
+		ID:        "alice-entry",
+		UserID:    "alice-id",
+		Username:  "alice",
+		Text:      "alice's private thoughts",
+		Timestamp: aliceTimestamp,
+		Tags:      []types.TagData{{Key: "secret"}},
+		Images:    []string{"images/alice/alice-entry/photo.jpg"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestCrossUserAccessIsForbidden(t *testing.T) {
+	getQuery := url.Values{
+		"id":        {"alice-entry"},
+		"userId":    {"alice-id"},
+		"timestamp": {aliceTimestamp.Format(time.RFC3339)},
+	}.Encode()
+
+	tests := []struct {
+		name    string
+		handler func(*db.Store) http.HandlerFunc
+		req     *http.Request
+	}{
+		{"get", GetEntryHandler, testutil.Request(http.MethodGet, "/api/entries/get?"+getQuery, "bob", nil)},
+		{"update", UpdateEntryHandler, putRequest("bob", "*", types.UpdateEntryRequest{
+			ID: "alice-entry", UserID: "alice-id", Timestamp: aliceTimestamp, Text: "pwned",
+		})},
+		{"update by username", UpdateEntryHandler, putRequest("bob", "*", types.UpdateEntryRequest{
+			ID: "alice-entry", Username: "alice", Timestamp: aliceTimestamp, Text: "pwned",
+		})},
+		{"delete", DeleteEntryHandler, testutil.Request(http.MethodDelete, "/api/entries/delete?id=alice-entry", "bob", DeleteEntryRequest{
+			UserID: "alice-id", Timestamp: aliceTimestamp,
+		})},
+		{"create as other user", CreateNewEntryHandler, testutil.Request(http.MethodPost, "/api/entries/create", "bob", types.CreateNewEntryRequest{
+			UserID: "alice-id", Username: "alice", Text: "forged", Timestamp: time.Now(),
+		})},
+		{"create with other user's image", CreateNewEntryHandler, testutil.Request(http.MethodPost, "/api/entries/create", "bob", types.CreateNewEntryRequest{
+			Text: "mine", Timestamp: time.Now(), Images: []string{"images/alice/alice-entry/photo.jpg"},
+		})},
+		{"search", SearchEntriesHandler, testutil.Request(http.MethodPost, "/api/entries/search?user=alice", "bob", types.SearchEntriesRequest{})},
+		{"unique tags", ListUniqueTagsHandler, testutil.Request(http.MethodGet, "/api/entries/listUniqueTags?user=alice", "bob", nil)},
+		{"unique locations", ListUniqueLocationsHandler, testutil.Request(http.MethodGet, "/api/entries/listUniqueLocations?user=alice", "bob", nil)},
+		{"list", ListEntriesHandler, testutil.Request(http.MethodGet, "/api/entries/list?user=alice&limit=10&page=1", "bob", nil)},
+		{"add tag", AddTagHandler, testutil.Request(http.MethodPut, "/api/entries/addTag", "bob", types.AddTagRequest{
+			UserID: "alice-id", EntryID: "alice-entry", Timestamp: aliceTimestamp, Tags: []types.TagData{{Key: "x"}},
+		})},
+		{"delete tag", DeleteTagHandler, testutil.Request(http.MethodDelete, "/api/entries/deleteTag", "bob", types.DeleteTagRequest{
+			UserID: "alice-id", EntryID: "alice-entry", Timestamp: aliceTimestamp,
+		})},
+		{"add location", AddLocationHandler, testutil.Request(http.MethodPut, "/api/entries/addLocation", "bob", types.AddLocationRequest{
+			UserID: "alice-id", EntryID: "alice-entry", Timestamp: aliceTimestamp,
+		})},
+		{"delete location", DeleteLocationHandler, testutil.Request(http.MethodDelete, "/api/entries/deleteLocation", "bob", types.DeleteLocationRequest{
+			UserID: "alice-id", EntryID: "alice-entry", Timestamp: aliceTimestamp,
+		})},
+		{"add other user's image", AddImageHandler, testutil.Request(http.MethodPut, "/api/entries/addImage", "bob", types.AddImageRequest{
+			EntryID: "alice-entry", Timestamp: aliceTimestamp, Images: []string{"images/alice/alice-entry/photo.jpg"},
+		})},
+		{"delete other user's image", DeleteImageHandler, testutil.Request(http.MethodDelete, "/api/entries/deleteImage", "bob", types.DeleteImageRequest{
+			EntryID: "alice-entry", Timestamp: aliceTimestamp, ImageToDelete: "images/alice/alice-entry/photo.jpg",
+		})},
+		{"restore from trash", RestoreEntryHandler, testutil.Request(http.MethodPost, "/api/entries/trash/restore", "bob", types.RestoreEntryRequest{
+			ID: "alice-entry", UserID: "alice-id", Timestamp: aliceTimestamp,
+		})},
+		{"restore revision", RestoreRevisionHandler, testutil.Request(http.MethodPost, "/api/entries/revisions/restore", "bob", types.RestoreRevisionRequest{
+			ID: "alice-entry", UserID: "alice-id", Timestamp: aliceTimestamp, Revision: 1,
+		})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore(t)
+			rec := httptest.NewRecorder()
+			tt.handler(store).ServeHTTP(rec, tt.req)
+			if rec.Code != http.StatusForbidden {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, http.StatusForbidden, rec.Body.String())
+			}
+
+			entry, err := store.Entries.Get(db.EntryKey{ID: "alice-entry", UserID: "alice-id", Timestamp: aliceTimestamp})
+			if err != nil {
+				t.Fatalf("alice's entry is gone: %v", err)
+			}
+			if entry.Text != "alice's private thoughts" || len(entry.Tags) != 1 || len(entry.Images) != 1 {
+				t.Fatalf("alice's entry was modified: %+v", entry)
+			}
+		})
+	}
+}
+
+func TestOwnEntryIsNotReachableByOmittingUser(t *testing.T) {
+	// With no userId in the body the caller's own id is used, so bob can't
+	// reach alice's entry even without naming her.
+	store := newTestStore(t)
+	rec := httptest.NewRecorder()
+	UpdateEntryHandler(store).ServeHTTP(rec, putRequest("bob", "*", types.UpdateEntryRequest{
+		ID: "alice-entry", Timestamp: aliceTimestamp, Text: "pwned",
+	}))
+
+	var resp types.UpdateEntryResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Success {
+		t.Fatal("bob updated alice's entry")
+	}
+	entry, _ := store.Entries.Get(db.EntryKey{ID: "alice-entry", UserID: "alice-id", Timestamp: aliceTimestamp})
+	if entry.Text != "alice's private thoughts" {
+		t.Fatalf("alice's entry was modified: %q", entry.Text)
+	}
+}
+
+func TestOwnerIsAllowed(t *testing.T) {
+	store := newTestStore(t)
+	query := url.Values{
+		"id":        {"alice-entry"},
+		"userId":    {"alice-id"},
+		"timestamp": {aliceTimestamp.Format(time.RFC3339)},
+	}.Encode()
+
+	rec := httptest.NewRecorder()
+	GetEntryHandler(store).ServeHTTP(rec, testutil.Request(http.MethodGet, "/api/entries/get?"+query, "alice", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	ListUniqueTagsHandler(store).ServeHTTP(rec, testutil.Request(http.MethodGet, "/api/entries/listUniqueTags", "alice", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+}
+
+func TestUnauthenticatedRequestIsRejected(t *testing.T) {
+	store := newTestStore(t)
+	rec := httptest.NewRecorder()
+	SearchEntriesHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/search?user=alice", "", types.SearchEntriesRequest{}))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", rec.Code)
+	}
+}
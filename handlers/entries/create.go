@@ -1,128 +1,94 @@
 package entriesHandlers
 
 import (
+	"JourneyAppServer/authz"
 	"JourneyAppServer/db"
 	"JourneyAppServer/types"
 	"JourneyAppServer/utils"
 	"encoding/json"
-	"github.com/google/uuid"
 	"net/http"
-)
-
-func CreateNewEntryHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var req types.CreateNewEntryRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
 
-	if req.Locations == nil || len(req.Locations) <= 0 {
-		req.Locations = make([]types.LocationData, 0)
-	}
-	if req.Tags == nil || len(req.Tags) <= 0 {
-		req.Tags = make([]types.TagData, 0)
-	}
-	if req.Images == nil || len(req.Images) <= 0 {
-		req.Images = make([]string, 0)
-	}
-
-	response, err := createNewEntry(req, r)
-	if err != nil {
-		http.Error(w, "Error creating new entry", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
+	"github.com/google/uuid"
+)
 
-func createNewEntry(req types.CreateNewEntryRequest, r *http.Request) (types.CreateNewEntryResponse, error) {
-	entryID := uuid.New().String()
+func CreateNewEntryHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
 
-	tx, err := db.SDB.Begin()
-	if err != nil {
-		return types.CreateNewEntryResponse{}, err
-	}
-	defer func() {
+		var req types.CreateNewEntryRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
 		if err != nil {
-			tx.Rollback()
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
-		tx.Commit()
-	}()
 
-	entryQuery := `
-        INSERT INTO entries (entry_id, user_id, username, text, timestamp)
-        VALUES (?, ?, ?, ?, ?)
-    `
-	_, err = tx.Exec(entryQuery, entryID, req.UserID, req.Username, req.Text, req.Timestamp)
-	if err != nil {
-		utils.LM.Logger.Printf("Error inserting entry into database: user=%s, error=%v", req.Username, err)
-		return types.CreateNewEntryResponse{}, err
-	}
+		caller, ok := authz.Check(w, r, store, req.Username, req.UserID)
+		if !ok {
+			return
+		}
+		req.Username, req.UserID = caller.Username, caller.UserID
+		if err := authz.RequireImageKeys(caller.Username, req.Images); err != nil {
+			authz.WriteError(w, err)
+			return
+		}
+		if !checkEncryption(w, store, caller.UserID, req.Text, req.Encrypted) {
+			return
+		}
+		if !checkLocations(w, req.Locations) {
+			return
+		}
 
-	for _, loc := range req.Locations {
-		locQuery := `
-            INSERT INTO entry_locations (entry_id, latitude, longitude, display_name)
-            VALUES (?, ?, ?, ?)
-        `
-		_, err = tx.Exec(locQuery, entryID, loc.Latitude, loc.Longitude, loc.DisplayName)
-		if err != nil {
-			utils.LM.Logger.Printf("Error inserting location for entry %s: %v", entryID, err)
-			return types.CreateNewEntryResponse{}, err
+		if req.Locations == nil || len(req.Locations) <= 0 {
+			req.Locations = make([]types.LocationData, 0)
+		}
+		if req.Tags == nil || len(req.Tags) <= 0 {
+			req.Tags = make([]types.TagData, 0)
+		}
+		if req.Images == nil || len(req.Images) <= 0 {
+			req.Images = make([]string, 0)
 		}
-	}
 
-	for _, tag := range req.Tags {
-		tagQuery := `
-            INSERT INTO entry_tags (entry_id, tag_key, tag_value)
-            VALUES (?, ?, ?)
-        `
-		_, err = tx.Exec(tagQuery, entryID, tag.Key, tag.Value)
+		response, err := createNewEntry(store, req, r)
 		if err != nil {
-			utils.LM.Logger.Printf("Error inserting tag for entry %s: %v", entryID, err)
-			return types.CreateNewEntryResponse{}, err
+			http.Error(w, "Error creating new entry", http.StatusInternalServerError)
+			return
 		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", entryETag(response.Version))
+		json.NewEncoder(w).Encode(response)
 	}
+}
 
-	for _, image := range req.Images {
-		imageQuery := `
-            INSERT INTO entry_images (entry_id, image_url)
-            VALUES (?, ?)
-        `
-		_, err = tx.Exec(imageQuery, entryID, image)
-		if err != nil {
-			utils.LM.Logger.Printf("Error inserting image for entry %s: %v", entryID, err)
-			return types.CreateNewEntryResponse{}, err
-		}
+func createNewEntry(store *db.Store, req types.CreateNewEntryRequest, r *http.Request) (types.CreateNewEntryResponse, error) {
+	entryID := uuid.New().String()
+
+	err := store.Entries.Create(types.Entry{
+		ID:        entryID,
+		UserID:    req.UserID,
+		Username:  req.Username,
+		Text:      req.Text,
+		Timestamp: req.Timestamp,
+		Locations: req.Locations,
+		Tags:      req.Tags,
+		Images:    req.Images,
+		Encrypted: req.Encrypted,
+	})
+	if err != nil {
+		return types.CreateNewEntryResponse{}, err
 	}
 
 	go func() {
-		ip := r.Header.Get("X-Forwarded-For")
-		if ip == "" {
-			ip = r.RemoteAddr
-		}
-		metadata := map[string]string{
-			"source":       "api",
-			"client_ip":    ip,
-			"user_agent":   r.Header.Get("User-Agent"),
-			"app_version":  r.Header.Get("X-App-Version"),
-			"os_version":   r.Header.Get("X-OS-Version"),
-			"device_model": r.Header.Get("X-Device-Model"),
-		}
-		metadataJSON, _ := json.Marshal(metadata)
-		analyticsQuery := `
-            INSERT INTO analytics_events (
-                user_id, event_type, object_type, object_id, event_time, metadata
-            ) VALUES (?, ?, ?, ?, NOW(), ?)
-        `
-		_, err := db.SDB.Exec(analyticsQuery, req.UserID, "create entry", "entry", entryID, string(metadataJSON))
+		err := store.Events.Record(types.AnalyticsEvent{
+			UserID:     req.UserID,
+			EventType:  "create entry",
+			ObjectType: "entry",
+			ObjectID:   entryID,
+			Metadata:   utils.RequestMetadata(r),
+		})
 		if err != nil {
 			utils.LM.Logger.Printf("Analytics logging error for entry %s: %v", entryID, err)
 		}
@@ -138,6 +104,9 @@ func createNewEntry(req types.CreateNewEntryRequest, r *http.Request) (types.Cre
 		LastUpdated: req.Timestamp,
 		Locations:   req.Locations,
 		Tags:        req.Tags,
+		Images:      req.Images,
+		Encrypted:   withoutBlindIndex(req.Encrypted),
+		Version:     1,
 	}, nil
 
 	//newEntry := types.Entry{
@@ -1,10 +1,12 @@
 package entriesHandlers
 
 import (
-	"JourneyAppServer/aws"
+	"JourneyAppServer/authz"
 	"JourneyAppServer/db"
+	"JourneyAppServer/types"
 	"JourneyAppServer/utils"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -15,128 +17,68 @@ type DeleteEntryRequest struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
-func DeleteEntryHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "Missing required param \"id\".", http.StatusBadRequest)
-		return
-	}
-	var req DeleteEntryRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	success, err := deleteEntry(id, req.UserID, req.Timestamp, r)
-	if err != nil {
-		http.Error(w, "Error deleting the entry", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"success": %v}`, success)
-}
+func DeleteEntryHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
 
-func deleteEntry(id, userId string, timestamp time.Time, r *http.Request) (bool, error) {
-	tx, err := db.SDB.Begin()
-	if err != nil {
-		utils.LM.Logger.Printf("Error starting transaction for entry deletion: id=%s, userId=%s, error=%v", id, userId, err)
-		return false, err
-	}
-	defer func() {
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "Missing required param \"id\".", http.StatusBadRequest)
+			return
+		}
+		var req DeleteEntryRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
 		if err != nil {
-			tx.Rollback()
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
-		tx.Commit()
-	}()
 
-	imgQuery := `
-        SELECT image_url 
-        FROM entry_images 
-        WHERE entry_id = ?
-    `
-	imgRows, err := tx.Query(imgQuery, id)
-	if err != nil {
-		utils.LM.Logger.Printf("Error querying images for entry %s: %v", id, err)
-		return false, err
-	}
-	defer imgRows.Close()
-
-	var imageKeys []string
-	for imgRows.Next() {
-		var imageKey string
-		if err := imgRows.Scan(&imageKey); err != nil {
-			utils.LM.Logger.Printf("Error scanning image key for entry %s: %v", id, err)
-			return false, err
+		caller, ok := authz.Check(w, r, store, "", req.UserID)
+		if !ok {
+			return
 		}
-		imageKeys = append(imageKeys, imageKey)
-	}
-	if err := imgRows.Err(); err != nil {
-		utils.LM.Logger.Printf("Image row iteration error for entry %s: %v", id, err)
-		return false, err
-	}
+		req.UserID = caller.UserID
 
-	for _, imageKey := range imageKeys {
-		if res := aws.DeleteImage(imageKey); !res.Success {
-			utils.LM.Logger.Printf("Error deleting S3 image %s for entry %s", imageKey, id)
-		} else {
-			utils.LM.Logger.Printf("Successfully deleted S3 image %s for entry %s", imageKey, id)
+		success, err := deleteEntry(store, id, req.UserID, req.Timestamp, r)
+		if err != nil {
+			http.Error(w, "Error deleting the entry", http.StatusInternalServerError)
+			return
 		}
-	}
 
-	deleteQuery := `
-        DELETE FROM entries 
-        WHERE entry_id = ? AND user_id = ? AND timestamp = ?
-    `
-	result, err := tx.Exec(deleteQuery, id, userId, timestamp)
-	if err != nil {
-		utils.LM.Logger.Printf("Error deleting entry from database: id=%s, userId=%s, timestamp=%v, error=%v", id, userId, timestamp, err)
-		return false, err
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"success": %v}`, success)
 	}
+}
 
-	rowsAffected, err := result.RowsAffected()
+// deleteEntry moves the entry to the trash. Its images stay in S3 until the
+// entry is purged.
+func deleteEntry(store *db.Store, id, userId string, timestamp time.Time, r *http.Request) (bool, error) {
+	err := store.Entries.Delete(db.EntryKey{ID: id, UserID: userId, Timestamp: timestamp})
 	if err != nil {
-		utils.LM.Logger.Printf("Error checking rows affected for entry deletion: id=%s, userId=%s, error=%v", id, userId, err)
+		if errors.Is(err, db.ErrNotFound) {
+			utils.LM.Logger.Printf("No entry found to delete: id=%s, userId=%s, timestamp=%v", id, userId, timestamp)
+			return false, nil
+		}
 		return false, err
 	}
-	if rowsAffected == 0 {
-		utils.LM.Logger.Printf("No entry found to delete: id=%s, userId=%s, timestamp=%v", id, userId, timestamp)
-		return false, nil
-	}
 
 	go func() {
-		ip := r.Header.Get("X-Forwarded-For")
-		if ip == "" {
-			ip = r.RemoteAddr
-		}
-		metadata := map[string]string{
-			"source":       "api",
-			"client_ip":    ip,
-			"user_agent":   r.Header.Get("User-Agent"),
-			"app_version":  r.Header.Get("X-App-Version"),
-			"os_version":   r.Header.Get("X-OS-Version"),
-			"device_model": r.Header.Get("X-Device-Model"),
-		}
-		metadataJSON, _ := json.Marshal(metadata)
-		analyticsQuery := `
-            INSERT INTO analytics_events (
-                user_id, event_type, object_type, object_id, event_time, metadata
-            ) VALUES (?, ?, ?, ?, NOW(), ?)
-        `
-		_, err := db.SDB.Exec(analyticsQuery, userId, "delete_entry", "entry", id, string(metadataJSON))
+		err := store.Events.Record(types.AnalyticsEvent{
+			UserID:     userId,
+			EventType:  "delete_entry",
+			ObjectType: "entry",
+			ObjectID:   id,
+			Metadata:   utils.RequestMetadata(r),
+		})
 		if err != nil {
 			utils.LM.Logger.Printf("Analytics logging error for entry deletion %s: %v", id, err)
 		}
 	}()
 
-	utils.LM.Logger.Printf("Successfully deleted entry: id=%s, userId=%s, timestamp=%v", id, userId, timestamp)
+	utils.LM.Logger.Printf("Successfully moved entry to trash: id=%s, userId=%s, timestamp=%v", id, userId, timestamp)
 	return true, nil
 
 	////var deleteImagesFromAWSResult = aws.BulkDeleteImages()
@@ -0,0 +1,36 @@
+package entriesHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/e2ee"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"net/http"
+)
+
+// checkEncryption makes sure an entry write matches the user's E2EE mode,
+// writing a 400 or 500 and returning false if it doesn't.
+func checkEncryption(w http.ResponseWriter, store *db.Store, userID, text string, payload *types.EncryptedPayload) bool {
+	enabled, err := e2ee.Enabled(store, userID)
+	if err != nil {
+		utils.LM.Logger.Printf("Encryption lookup error: userId=%s, error=%v", userID, err)
+		http.Error(w, "Error checking entry encryption", http.StatusInternalServerError)
+		return false
+	}
+	if err := e2ee.CheckEntry(enabled, text, payload); err != nil {
+		e2ee.WriteError(w, err)
+		return false
+	}
+	return true
+}
+
+// withoutBlindIndex drops the blind index tokens, which are write-only, from
+// an envelope being echoed back.
+func withoutBlindIndex(payload *types.EncryptedPayload) *types.EncryptedPayload {
+	if payload == nil {
+		return nil
+	}
+	p := *payload
+	p.BlindIndex = nil
+	return &p
+}
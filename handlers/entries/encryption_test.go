@@ -0,0 +1,181 @@
+package entriesHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/e2ee"
+	"JourneyAppServer/internal/testutil"
+	"JourneyAppServer/types"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+// encryptedStore is newTestStore with E2EE turned on for alice.
+func encryptedStore(t *testing.T) *db.Store {
+	t.Helper()
+	store := newTestStore(t)
+	err := e2ee.Enable(store, "alice-id", types.EnableEncryptionRequest{WrappedKey: []byte("alice-content-key"), Algorithm: "AES-256-GCM"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func envelope(ciphertext string, blindIndex ...string) *types.EncryptedPayload {
+	return &types.EncryptedPayload{
+		Ciphertext: []byte(ciphertext),
+		WrappedKey: []byte("entry-key"),
+		Nonce:      []byte("nonce"),
+		Algorithm:  "AES-256-GCM",
+		BlindIndex: blindIndex,
+	}
+}
+
+func createEncrypted(t *testing.T, store *db.Store, payload *types.EncryptedPayload, timestamp time.Time) types.CreateNewEntryResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	CreateNewEntryHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/create", "alice", types.CreateNewEntryRequest{
+		Timestamp: timestamp,
+		Encrypted: payload,
+	}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	var response types.CreateNewEntryResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestE2EEUserCannotWritePlaintext(t *testing.T) {
+	store := encryptedStore(t)
+
+	rec := httptest.NewRecorder()
+	CreateNewEntryHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/create", "alice", types.CreateNewEntryRequest{
+		Text:      "in the clear",
+		Timestamp: aliceTimestamp,
+	}))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("create: status = %d, want 400", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	UpdateEntryHandler(store).ServeHTTP(rec, putRequest("alice", "*", types.UpdateEntryRequest{
+		ID: "alice-entry", UserID: "alice-id", Timestamp: aliceTimestamp, Text: "in the clear",
+	}))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("update: status = %d, want 400", rec.Code)
+	}
+
+	// And the other way round: bob hasn't turned E2EE on.
+	rec = httptest.NewRecorder()
+	CreateNewEntryHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/create", "bob", types.CreateNewEntryRequest{
+		Timestamp: aliceTimestamp,
+		Encrypted: envelope("ciphertext"),
+	}))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("envelope without E2EE: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestEncryptedEntryRoundTrips(t *testing.T) {
+	store := encryptedStore(t)
+	created := createEncrypted(t, store, envelope("first ciphertext", "token-a"), aliceTimestamp)
+	if created.Encrypted == nil || string(created.Encrypted.Ciphertext) != "first ciphertext" || created.Encrypted.BlindIndex != nil {
+		t.Fatalf("create echoed %+v", created.Encrypted)
+	}
+
+	get := func() types.Entry {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		GetEntryByIDHandler(store).ServeHTTP(rec, byID(http.MethodGet, created.ID, "alice", "", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("get: status %d, body %q", rec.Code, rec.Body.String())
+		}
+		var entry types.Entry
+		if err := json.NewDecoder(rec.Body).Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		return entry
+	}
+
+	entry := get()
+	if entry.Text != "" || entry.Encrypted == nil {
+		t.Fatalf("stored entry: text %q, envelope %+v", entry.Text, entry.Encrypted)
+	}
+	want := envelope("first ciphertext")
+	got := entry.Encrypted
+	if !bytes.Equal(got.Ciphertext, want.Ciphertext) || !bytes.Equal(got.WrappedKey, want.WrappedKey) ||
+		!bytes.Equal(got.Nonce, want.Nonce) || got.Algorithm != want.Algorithm || got.BlindIndex != nil {
+		t.Fatalf("envelope = %+v, want %+v", got, want)
+	}
+
+	rec := httptest.NewRecorder()
+	UpdateEntryHandler(store).ServeHTTP(rec, putRequest("alice", "*", types.UpdateEntryRequest{
+		ID: created.ID, UserID: "alice-id", Timestamp: aliceTimestamp, Encrypted: envelope("second ciphertext", "token-b"),
+	}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	if got := get().Encrypted; got == nil || string(got.Ciphertext) != "second ciphertext" {
+		t.Fatalf("envelope after update = %+v", got)
+	}
+}
+
+func TestEncryptedSearchUsesBlindTokens(t *testing.T) {
+	store := encryptedStore(t)
+	lake := createEncrypted(t, store, envelope("lake day", "t-lake", "t-day"), aliceTimestamp.Add(time.Hour))
+	hike := createEncrypted(t, store, envelope("hike day", "t-hike", "t-day"), aliceTimestamp.Add(2*time.Hour))
+
+	search := func(req types.SearchEntriesRequest) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		SearchEntriesHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/search?user=alice", "alice", req))
+		return rec
+	}
+
+	tests := []struct {
+		tokens []string
+		want   []string
+	}{
+		{[]string{"t-lake"}, []string{lake.ID}},
+		{[]string{"t-day"}, []string{hike.ID, lake.ID}},
+		{[]string{"t-day", "t-hike"}, []string{hike.ID}},
+		{[]string{"t-swim"}, nil},
+	}
+	for _, tt := range tests {
+		rec := search(types.SearchEntriesRequest{BlindTokens: tt.tokens})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%v: status %d, body %q", tt.tokens, rec.Code, rec.Body.String())
+		}
+		var response types.SearchEntriesResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, result := range response.Results {
+			if result.Entry.Encrypted != nil && result.Entry.Encrypted.BlindIndex != nil {
+				t.Errorf("%v: result %s leaks its blind index", tt.tokens, result.Entry.ID)
+			}
+			got = append(got, result.Entry.ID)
+		}
+		sort.Strings(got)
+		sort.Strings(tt.want)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%v: matched %v, want %v", tt.tokens, got, tt.want)
+		}
+	}
+
+	if rec := search(types.SearchEntriesRequest{SearchQuery: "lake"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("text query: status = %d, want 400", rec.Code)
+	}
+	// Terms other than text still work.
+	if rec := search(types.SearchEntriesRequest{SearchQuery: "-has:image", BlindTokens: []string{"t-day"}}); rec.Code != http.StatusOK {
+		t.Errorf("non-text query with tokens: status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+}
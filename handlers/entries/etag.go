@@ -0,0 +1,90 @@
+package entriesHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errInvalidIfMatch = errors.New(`If-Match must be "*" or a single entry ETag`)
+
+// entryETag is the ETag of an entry at version. Versions only go up, so it
+// is a strong validator.
+func entryETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatchVersion reads the entry version named by the If-Match header, and
+// whether the header was sent at all. "*" matches any version and comes
+// back as 0.
+func ifMatchVersion(r *http.Request) (int64, bool, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, false, nil
+	}
+	if header == "*" {
+		return 0, true, nil
+	}
+	if len(header) < 3 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, true, errInvalidIfMatch
+	}
+	version, err := strconv.ParseInt(header[1:len(header)-1], 10, 64)
+	if err != nil || version < 1 {
+		return 0, true, errInvalidIfMatch
+	}
+	return version, true, nil
+}
+
+// requireIfMatch is ifMatchVersion for writes that can't be made without
+// the header, writing a 400 or 428 and returning false if it is malformed or
+// missing.
+func requireIfMatch(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	version, sent, err := ifMatchVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, false
+	}
+	if !sent {
+		http.Error(w, "Missing required header \"If-Match\"", http.StatusPreconditionRequired)
+		return 0, false
+	}
+	return version, true
+}
+
+// writeEntry writes entry as the response body along with its ETag.
+func writeEntry(w http.ResponseWriter, status int, entry types.Entry) {
+	entry.Encrypted = withoutBlindIndex(entry.Encrypted)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", entryETag(entry.Version))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(entry)
+}
+
+// writeConflict answers a write made against a stale version with a 412
+// carrying the entry as it is now.
+func writeConflict(w http.ResponseWriter, store *db.Store, key db.EntryKey) {
+	current, err := store.Entries.Get(key)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, "Entry not found", http.StatusNotFound)
+			return
+		}
+		utils.LM.Logger.Printf("Error loading entry after a version conflict: id=%s, userId=%s, error=%v", key.ID, key.UserID, err)
+		http.Error(w, "Error updating the entry", http.StatusInternalServerError)
+		return
+	}
+	current.Encrypted = withoutBlindIndex(current.Encrypted)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", entryETag(current.Version))
+	w.WriteHeader(http.StatusPreconditionFailed)
+	json.NewEncoder(w).Encode(types.EntryConflictResponse{
+		Error:   "version_mismatch",
+		Message: "The entry has changed since it was read",
+		Current: current,
+	})
+}
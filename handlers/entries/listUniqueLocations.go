@@ -1,6 +1,7 @@
 package entriesHandlers
 
 import (
+	"JourneyAppServer/authz"
 	"JourneyAppServer/db"
 	"JourneyAppServer/types"
 	"JourneyAppServer/utils"
@@ -8,54 +9,35 @@ import (
 	"net/http"
 )
 
-func ListUniqueLocationsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
+func ListUniqueLocationsHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
 
-	user := r.URL.Query().Get("user")
-	if user == "" {
-		http.Error(w, "Missing required query param \"user\"", http.StatusBadRequest)
-		return
-	}
+		// "user" is optional now that the caller comes from the auth context,
+		// but if it's sent it has to be the caller.
+		caller, ok := authz.Check(w, r, store, r.URL.Query().Get("user"), "")
+		if !ok {
+			return
+		}
+		user := caller.Username
 
-	response, err := listUniqueLocations(user, r)
-	if err != nil {
-		http.Error(w, "Error listing unique locations", http.StatusInternalServerError)
-		return
-	}
+		response, err := listUniqueLocations(store, user, r)
+		if err != nil {
+			http.Error(w, "Error listing unique locations", http.StatusInternalServerError)
+			return
+		}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
 }
 
-func listUniqueLocations(user string, r *http.Request) ([]types.LocationData, error) {
-	query := `
-        SELECT DISTINCT el.latitude, el.longitude, el.display_name
-        FROM entry_locations el
-        JOIN entries e ON el.entry_id = e.entry_id
-        WHERE e.username = ?
-        ORDER BY el.display_name
-    `
-	rows, err := db.SDB.Query(query, user)
+func listUniqueLocations(store *db.Store, user string, r *http.Request) ([]types.LocationData, error) {
+	locations, err := store.Entries.UniqueLocations(user)
 	if err != nil {
-		utils.LM.Logger.Printf("Error querying unique locations for user %s: %v", user, err)
-		return nil, err
-	}
-	defer rows.Close()
-
-	var locations []types.LocationData
-	for rows.Next() {
-		var loc types.LocationData
-		if err := rows.Scan(&loc.Latitude, &loc.Longitude, &loc.DisplayName); err != nil {
-			utils.LM.Logger.Printf("Error scanning location for user %s: %v", user, err)
-			return nil, err
-		}
-		locations = append(locations, loc)
-	}
-	if err := rows.Err(); err != nil {
-		utils.LM.Logger.Printf("Row iteration error for unique locations, user %s: %v", user, err)
 		return nil, err
 	}
 
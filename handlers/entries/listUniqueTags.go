@@ -1,6 +1,7 @@
 package entriesHandlers
 
 import (
+	"JourneyAppServer/authz"
 	"JourneyAppServer/db"
 	"JourneyAppServer/types"
 	"JourneyAppServer/utils"
@@ -8,54 +9,35 @@ import (
 	"net/http"
 )
 
-func ListUniqueTagsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
+func ListUniqueTagsHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
 
-	user := r.URL.Query().Get("user")
-	if user == "" {
-		http.Error(w, "Missing required query param \"user\"", http.StatusBadRequest)
-		return
-	}
+		// "user" is optional now that the caller comes from the auth context,
+		// but if it's sent it has to be the caller.
+		caller, ok := authz.Check(w, r, store, r.URL.Query().Get("user"), "")
+		if !ok {
+			return
+		}
+		user := caller.Username
 
-	response, err := listUniqueTags(user, r)
-	if err != nil {
-		http.Error(w, "Error listing unique tags", http.StatusInternalServerError)
-		return
-	}
+		response, err := listUniqueTags(store, user, r)
+		if err != nil {
+			http.Error(w, "Error listing unique tags", http.StatusInternalServerError)
+			return
+		}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
 }
 
-func listUniqueTags(user string, r *http.Request) ([]types.TagData, error) {
-	query := `
-        SELECT DISTINCT et.tag_key, et.tag_value
-        FROM entry_tags et
-        JOIN entries e ON et.entry_id = e.entry_id
-        WHERE e.username = ?
-        ORDER BY et.tag_key
-    `
-	rows, err := db.SDB.Query(query, user)
+func listUniqueTags(store *db.Store, user string, r *http.Request) ([]types.TagData, error) {
+	tags, err := store.Entries.UniqueTags(user)
 	if err != nil {
-		utils.LM.Logger.Printf("Error querying unique tags for user %s: %v", user, err)
-		return nil, err
-	}
-	defer rows.Close()
-
-	var tags []types.TagData
-	for rows.Next() {
-		var tag types.TagData
-		if err := rows.Scan(&tag.Key, &tag.Value); err != nil {
-			utils.LM.Logger.Printf("Error scanning tag for user %s: %v", user, err)
-			return nil, err
-		}
-		tags = append(tags, tag)
-	}
-	if err := rows.Err(); err != nil {
-		utils.LM.Logger.Printf("Row iteration error for unique tags, user %s: %v", user, err)
 		return nil, err
 	}
 
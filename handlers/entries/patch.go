@@ -0,0 +1,202 @@
+package entriesHandlers
+
+import (
+	"JourneyAppServer/authz"
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PatchEntryHandler applies a JSON Merge Patch (RFC 7386) to an entry.
+// Members left out of the body are left alone and null clears one, which a
+// PUT to /api/entries/update can't do. The If-Match header has to carry the
+// ETag the client last read; if the entry has changed since, nothing is
+// written and the current entry comes back with a 412.
+func PatchEntryHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		key, ok := queryEntryKey(w, r)
+		if !ok {
+			return
+		}
+		servePatch(w, r, store, key)
+	}
+}
+
+// servePatch applies the request's merge patch to the caller's entry named
+// by key.
+func servePatch(w http.ResponseWriter, r *http.Request, store *db.Store, key db.EntryKey) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+			http.Error(w, "Content-Type must be application/merge-patch+json", http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	patch, err := parseEntryPatch(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	caller, ok := authz.Check(w, r, store, "", "")
+	if !ok {
+		return
+	}
+	key.UserID = caller.UserID
+	if !checkPatch(w, store, caller, patch) {
+		return
+	}
+
+	entry, err := patchEntry(store, key, patch, version, r)
+	if err != nil {
+		writePatchError(w, store, key, err)
+		return
+	}
+	writeEntry(w, http.StatusOK, entry)
+}
+
+// checkPatch checks the images, locations and text a patch writes like a
+// create would, writing an error and returning false if they aren't allowed.
+func checkPatch(w http.ResponseWriter, store *db.Store, caller authz.Caller, patch types.EntryPatch) bool {
+	if patch.Images != nil {
+		if err := authz.RequireImageKeys(caller.Username, *patch.Images); err != nil {
+			authz.WriteError(w, err)
+			return false
+		}
+	}
+	if patch.Locations != nil && !checkLocations(w, *patch.Locations) {
+		return false
+	}
+	if patch.Text == nil && patch.Encrypted == nil {
+		return true
+	}
+	var text string
+	if patch.Text != nil {
+		text = *patch.Text
+	}
+	return checkEncryption(w, store, caller.UserID, text, patch.Encrypted)
+}
+
+func writePatchError(w http.ResponseWriter, store *db.Store, key db.EntryKey, err error) {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		http.Error(w, "Entry not found", http.StatusNotFound)
+	case errors.Is(err, db.ErrVersionMismatch):
+		writeConflict(w, store, key)
+	default:
+		http.Error(w, "Error updating the entry", http.StatusInternalServerError)
+	}
+}
+
+// parseEntryPatch reads a merge patch of an entry's text, timestamp,
+// locations, tags, images and encrypted envelope. Any other member is
+// rejected rather than silently ignored.
+func parseEntryPatch(body io.Reader) (types.EntryPatch, error) {
+	var members map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&members); err != nil {
+		return types.EntryPatch{}, errors.New("Invalid request body: it must be a JSON object")
+	}
+
+	var patch types.EntryPatch
+	var unknown []string
+	for name, raw := range members {
+		isNull := strings.TrimSpace(string(raw)) == "null"
+		var err error
+		switch name {
+		case "text":
+			text := ""
+			if !isNull {
+				err = json.Unmarshal(raw, &text)
+			}
+			patch.Text = &text
+		case "timestamp":
+			if isNull {
+				return types.EntryPatch{}, errors.New("Invalid request body: \"timestamp\" can't be removed")
+			}
+			var timestamp time.Time
+			if err = json.Unmarshal(raw, &timestamp); err == nil && timestamp.IsZero() {
+				err = errors.New("zero timestamp")
+			}
+			patch.Timestamp = &timestamp
+		case "locations":
+			locations := []types.LocationData{}
+			if !isNull {
+				err = json.Unmarshal(raw, &locations)
+			}
+			patch.Locations = &locations
+		case "tags":
+			tags := []types.TagData{}
+			if !isNull {
+				err = json.Unmarshal(raw, &tags)
+			}
+			patch.Tags = &tags
+		case "images":
+			images := []string{}
+			if !isNull {
+				err = json.Unmarshal(raw, &images)
+			}
+			patch.Images = &images
+		case "encrypted":
+			// An entry can't go back to plaintext, so there is nothing
+			// for null to mean here.
+			if isNull {
+				return types.EntryPatch{}, errors.New("Invalid request body: \"encrypted\" can't be removed")
+			}
+			err = json.Unmarshal(raw, &patch.Encrypted)
+		default:
+			unknown = append(unknown, name)
+		}
+		if err != nil {
+			return types.EntryPatch{}, fmt.Errorf("Invalid request body property %q", name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return types.EntryPatch{}, fmt.Errorf("Unknown request body properties: %s", strings.Join(unknown, ", "))
+	}
+	return patch, nil
+}
+
+func patchEntry(store *db.Store, key db.EntryKey, patch types.EntryPatch, version int64, r *http.Request) (types.Entry, error) {
+	entry, err := store.Entries.Patch(key, patch, version)
+	if err != nil {
+		if errors.Is(err, db.ErrVersionMismatch) {
+			utils.LM.Logger.Printf("Stale patch of entry: id=%s, userId=%s, version=%d", key.ID, key.UserID, version)
+		}
+		return types.Entry{}, err
+	}
+	pruneRevisions(store, key.UserID, key.ID)
+
+	go func() {
+		err := store.Events.Record(types.AnalyticsEvent{
+			UserID:     key.UserID,
+			EventType:  "patch_entry",
+			ObjectType: "entry",
+			ObjectID:   key.ID,
+			Metadata:   utils.RequestMetadata(r),
+		})
+		if err != nil {
+			utils.LM.Logger.Printf("Analytics logging error for entry patch %s: %v", key.ID, err)
+		}
+	}()
+
+	utils.LM.Logger.Printf("Successfully patched entry: id=%s, userId=%s, version=%d", key.ID, key.UserID, entry.Version)
+	return entry, nil
+}
@@ -0,0 +1,198 @@
+package entriesHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/internal/testutil"
+	"JourneyAppServer/types"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+var aliceQuery = url.Values{
+	"id":        {"alice-entry"},
+	"timestamp": {aliceTimestamp.Format(time.RFC3339)},
+}.Encode()
+
+func patchRequest(target, username, ifMatch string, body interface{}) *http.Request {
+	r := testutil.Request(http.MethodPatch, target, username, body)
+	r.Header.Set("Content-Type", "application/merge-patch+json")
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	return r
+}
+
+// putRequest is a PUT /api/entries/update with If-Match set, as it has to be.
+func putRequest(username, ifMatch string, body types.UpdateEntryRequest) *http.Request {
+	r := testutil.Request(http.MethodPut, "/api/entries/update", username, body)
+	r.Header.Set("If-Match", ifMatch)
+	return r
+}
+
+func aliceEntry(t *testing.T, store *db.Store) types.Entry {
+	t.Helper()
+	entry, err := store.Entries.Get(db.EntryKey{ID: "alice-entry", UserID: "alice-id", Timestamp: aliceTimestamp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+func TestPatchClearsFields(t *testing.T) {
+	store := newTestStore(t)
+	rec := httptest.NewRecorder()
+	PatchEntryHandler(store).ServeHTTP(rec, patchRequest("/api/entries/update?"+aliceQuery, "alice", `"1"`, map[string]interface{}{
+		"text":   "",
+		"tags":   nil,
+		"images": []string{},
+	}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+	if etag := rec.Header().Get("ETag"); etag != `"2"` {
+		t.Fatalf("ETag = %s, want \"2\"", etag)
+	}
+
+	entry := aliceEntry(t, store)
+	if entry.Text != "" || len(entry.Tags) != 0 || len(entry.Images) != 0 || entry.Version != 2 {
+		t.Fatalf("entry wasn't cleared: %+v", entry)
+	}
+}
+
+func TestPatchLeavesMissingFieldsAlone(t *testing.T) {
+	store := newTestStore(t)
+	rec := httptest.NewRecorder()
+	PatchEntryHandler(store).ServeHTTP(rec, patchRequest("/api/entries/update?"+aliceQuery, "alice", "*", map[string]interface{}{
+		"tags": []types.TagData{{Key: "travel", Value: "lisbon"}},
+	}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+
+	entry := aliceEntry(t, store)
+	if entry.Text != "alice's private thoughts" || len(entry.Images) != 1 {
+		t.Fatalf("untouched fields changed: %+v", entry)
+	}
+	if len(entry.Tags) != 1 || entry.Tags[0].Key != "travel" {
+		t.Fatalf("tags = %+v, want [travel]", entry.Tags)
+	}
+}
+
+func TestPatchRejectsLocationsOffTheEarth(t *testing.T) {
+	store := newTestStore(t)
+	rec := httptest.NewRecorder()
+	PatchEntryHandler(store).ServeHTTP(rec, patchRequest("/api/entries/update?"+aliceQuery, "alice", "*", map[string]interface{}{
+		"locations": []types.LocationData{{Latitude: 91, Longitude: 0}},
+	}))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	if entry := aliceEntry(t, store); len(entry.Locations) != 0 {
+		t.Fatalf("locations = %+v, want none", entry.Locations)
+	}
+}
+
+func TestPatchRequiresIfMatch(t *testing.T) {
+	store := newTestStore(t)
+	rec := httptest.NewRecorder()
+	PatchEntryHandler(store).ServeHTTP(rec, patchRequest("/api/entries/update?"+aliceQuery, "alice", "", map[string]interface{}{"text": "new"}))
+	if rec.Code != http.StatusPreconditionRequired {
+		t.Fatalf("status = %d, want 428", rec.Code)
+	}
+}
+
+func TestPatchRejectsUnknownMembers(t *testing.T) {
+	store := newTestStore(t)
+	rec := httptest.NewRecorder()
+	PatchEntryHandler(store).ServeHTTP(rec, patchRequest("/api/entries/update?"+aliceQuery, "alice", "*", map[string]interface{}{"userId": "bob-id"}))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestPatchOfOtherUsersEntryIsNotFound(t *testing.T) {
+	store := newTestStore(t)
+	rec := httptest.NewRecorder()
+	PatchEntryHandler(store).ServeHTTP(rec, patchRequest("/api/entries/update?"+aliceQuery, "bob", "*", map[string]interface{}{"text": "pwned"}))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+	if entry := aliceEntry(t, store); entry.Text != "alice's private thoughts" {
+		t.Fatalf("alice's entry was modified: %q", entry.Text)
+	}
+}
+
+func TestStaleWritesConflict(t *testing.T) {
+	store := newTestStore(t)
+
+	// Another device's write moves the entry on to version 2.
+	rec := httptest.NewRecorder()
+	PatchEntryHandler(store).ServeHTTP(rec, patchRequest("/api/entries/update?"+aliceQuery, "alice", `"1"`, map[string]interface{}{"text": "from the phone"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+
+	tests := []struct {
+		name    string
+		handler func(*db.Store) http.HandlerFunc
+		req     *http.Request
+	}{
+		{"patch", PatchEntryHandler, patchRequest("/api/entries/update?"+aliceQuery, "alice", `"1"`, map[string]interface{}{"text": "from the laptop"})},
+		{"put", UpdateEntryHandler, putRequest("alice", `"1"`, types.UpdateEntryRequest{
+			ID: "alice-entry", Timestamp: aliceTimestamp, Text: "from the laptop",
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(store).ServeHTTP(rec, tt.req)
+			if rec.Code != http.StatusPreconditionFailed {
+				t.Fatalf("status = %d, want 412 (body %q)", rec.Code, rec.Body.String())
+			}
+			var resp types.EntryConflictResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Current.Text != "from the phone" || resp.Current.Version != 2 {
+				t.Fatalf("current = %+v, want the phone's version 2", resp.Current)
+			}
+			if entry := aliceEntry(t, store); entry.Text != "from the phone" {
+				t.Fatalf("stale write was applied: %q", entry.Text)
+			}
+		})
+	}
+}
+
+func TestUpdateRequiresIfMatch(t *testing.T) {
+	store := newTestStore(t)
+	rec := httptest.NewRecorder()
+	UpdateEntryHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPut, "/api/entries/update", "alice", types.UpdateEntryRequest{
+		ID: "alice-entry", Timestamp: aliceTimestamp, Text: "edited",
+	}))
+	if rec.Code != http.StatusPreconditionRequired {
+		t.Fatalf("status = %d, want 428 (body %q)", rec.Code, rec.Body.String())
+	}
+	if entry := aliceEntry(t, store); entry.Text != "alice's private thoughts" {
+		t.Fatalf("update without If-Match was applied: %q", entry.Text)
+	}
+
+	// "*" opts out of the version check.
+	rec = httptest.NewRecorder()
+	UpdateEntryHandler(store).ServeHTTP(rec, putRequest("alice", "*", types.UpdateEntryRequest{
+		ID: "alice-entry", Timestamp: aliceTimestamp, Text: "edited",
+	}))
+	var resp types.UpdateEntryResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || resp.Version != 2 {
+		t.Fatalf("response = %+v, want success at version 2", resp)
+	}
+	if entry := aliceEntry(t, store); entry.Text != "edited" || len(entry.Tags) != 1 {
+		t.Fatalf("entry = %+v", entry)
+	}
+}
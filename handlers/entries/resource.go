@@ -0,0 +1,146 @@
+package entriesHandlers
+
+import (
+	"JourneyAppServer/authz"
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// The /api/v2/entries/{id} endpoints name an entry by its ID alone and look
+// it up among the caller's own entries. Unlike the v1 endpoints they don't
+// need the entry's exact timestamp sent back, which is just another field
+// that can be edited here.
+
+// pathEntryKey is the caller's entry named by the {id} path param. It
+// writes the error and returns false if there is no caller.
+func pathEntryKey(w http.ResponseWriter, r *http.Request, store *db.Store) (db.EntryKey, authz.Caller, bool) {
+	caller, ok := authz.Check(w, r, store, "", "")
+	if !ok {
+		return db.EntryKey{}, authz.Caller{}, false
+	}
+	return db.EntryKey{ID: r.PathValue("id"), UserID: caller.UserID}, caller, true
+}
+
+func GetEntryByIDHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		key, _, ok := pathEntryKey(w, r, store)
+		if !ok {
+			return
+		}
+
+		entry, err := getEntry(store, key.ID, key.UserID, time.Time{}, r)
+		if err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				http.Error(w, "Entry not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Error getting the entry", http.StatusInternalServerError)
+			return
+		}
+		writeEntry(w, http.StatusOK, entry)
+	}
+}
+
+// ReplaceEntryHandler overwrites every field of an entry. Like a PATCH, it
+// needs the ETag the client last read in If-Match.
+func ReplaceEntryHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		version, ok := requireIfMatch(w, r)
+		if !ok {
+			return
+		}
+		var req types.ReplaceEntryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Timestamp.IsZero() {
+			http.Error(w, "Missing required body property \"timestamp\"", http.StatusBadRequest)
+			return
+		}
+		key, caller, ok := pathEntryKey(w, r, store)
+		if !ok {
+			return
+		}
+
+		patch := replacePatch(req)
+		if !checkPatch(w, store, caller, patch) {
+			return
+		}
+		entry, err := patchEntry(store, key, patch, version, r)
+		if err != nil {
+			writePatchError(w, store, key, err)
+			return
+		}
+		writeEntry(w, http.StatusOK, entry)
+	}
+}
+
+// replacePatch sets every field of the entry from req.
+func replacePatch(req types.ReplaceEntryRequest) types.EntryPatch {
+	if req.Locations == nil {
+		req.Locations = []types.LocationData{}
+	}
+	if req.Tags == nil {
+		req.Tags = []types.TagData{}
+	}
+	if req.Images == nil {
+		req.Images = []string{}
+	}
+	return types.EntryPatch{
+		Text:      &req.Text,
+		Timestamp: &req.Timestamp,
+		Locations: &req.Locations,
+		Tags:      &req.Tags,
+		Images:    &req.Images,
+		Encrypted: req.Encrypted,
+	}
+}
+
+func PatchEntryByIDHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		servePatch(w, r, store, db.EntryKey{ID: r.PathValue("id")})
+	}
+}
+
+// DeleteEntryByIDHandler moves an entry to the trash, answering 204 on
+// success.
+func DeleteEntryByIDHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		key, _, ok := pathEntryKey(w, r, store)
+		if !ok {
+			return
+		}
+
+		deleted, err := deleteEntry(store, key.ID, key.UserID, time.Time{}, r)
+		if err != nil {
+			http.Error(w, "Error deleting the entry", http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "Entry not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
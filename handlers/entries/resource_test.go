@@ -0,0 +1,137 @@
+package entriesHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/internal/testutil"
+	"JourneyAppServer/types"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// byID builds a request to /api/v2/entries/{id} as the router would hand
+// it on, with the path value filled in.
+func byID(method, id, username, ifMatch string, body interface{}) *http.Request {
+	r := testutil.Request(method, "/api/v2/entries/"+id, username, body)
+	r.SetPathValue("id", id)
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	return r
+}
+
+func TestGetEntryByID(t *testing.T) {
+	store := newTestStore(t)
+
+	rec := httptest.NewRecorder()
+	GetEntryByIDHandler(store).ServeHTTP(rec, byID(http.MethodGet, "alice-entry", "alice", "", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+	if etag := rec.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("ETag = %s, want \"1\"", etag)
+	}
+
+	rec = httptest.NewRecorder()
+	GetEntryByIDHandler(store).ServeHTTP(rec, byID(http.MethodGet, "alice-entry", "bob", "", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("bob got status %d, want 404", rec.Code)
+	}
+}
+
+func TestReplaceEntryMovesTimestamp(t *testing.T) {
+	store := newTestStore(t)
+	moved := aliceTimestamp.Add(-48 * time.Hour)
+
+	rec := httptest.NewRecorder()
+	ReplaceEntryHandler(store).ServeHTTP(rec, byID(http.MethodPut, "alice-entry", "alice", `"1"`, types.ReplaceEntryRequest{
+		Text:      "rewritten",
+		Timestamp: moved,
+	}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+
+	entry, err := store.Entries.Get(db.EntryKey{ID: "alice-entry", UserID: "alice-id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !entry.Timestamp.Equal(moved) || entry.Text != "rewritten" || len(entry.Tags) != 0 || len(entry.Images) != 0 {
+		t.Fatalf("entry wasn't replaced: %+v", entry)
+	}
+	// The v1 endpoints find it at its new timestamp.
+	if _, err := store.Entries.Get(db.EntryKey{ID: "alice-entry", UserID: "alice-id", Timestamp: moved}); err != nil {
+		t.Fatalf("entry not found at its new timestamp: %v", err)
+	}
+}
+
+func TestReplaceEntryRequiresIfMatch(t *testing.T) {
+	store := newTestStore(t)
+	rec := httptest.NewRecorder()
+	ReplaceEntryHandler(store).ServeHTTP(rec, byID(http.MethodPut, "alice-entry", "alice", "", types.ReplaceEntryRequest{
+		Text: "rewritten", Timestamp: aliceTimestamp,
+	}))
+	if rec.Code != http.StatusPreconditionRequired {
+		t.Fatalf("status = %d, want 428", rec.Code)
+	}
+}
+
+func TestPatchEntryByID(t *testing.T) {
+	store := newTestStore(t)
+	rec := httptest.NewRecorder()
+	PatchEntryByIDHandler(store).ServeHTTP(rec, byID(http.MethodPatch, "alice-entry", "alice", `"1"`, map[string]interface{}{"images": nil}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+	var entry types.Entry
+	if err := json.NewDecoder(rec.Body).Decode(&entry); err != nil {
+		t.Fatal(err)
+	}
+	if len(entry.Images) != 0 || entry.Text != "alice's private thoughts" || entry.Version != 2 {
+		t.Fatalf("entry = %+v", entry)
+	}
+}
+
+func TestDeleteEntryByID(t *testing.T) {
+	store := newTestStore(t)
+
+	rec := httptest.NewRecorder()
+	DeleteEntryByIDHandler(store).ServeHTTP(rec, byID(http.MethodDelete, "alice-entry", "bob", "", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("bob got status %d, want 404", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	DeleteEntryByIDHandler(store).ServeHTTP(rec, byID(http.MethodDelete, "alice-entry", "alice", "", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204 (body %q)", rec.Code, rec.Body.String())
+	}
+	if _, err := store.Entries.Get(db.EntryKey{ID: "alice-entry", UserID: "alice-id"}); err != db.ErrNotFound {
+		t.Fatalf("Get after delete = %v, want ErrNotFound", err)
+	}
+}
+
+func TestPatchedTextGetsNewStats(t *testing.T) {
+	store := newTestStore(t)
+	rec := httptest.NewRecorder()
+	PatchEntryByIDHandler(store).ServeHTTP(rec, byID(http.MethodPatch, "alice-entry", "alice", `"1"`, map[string]interface{}{
+		"text": "# Plans\n- [x] *pack*\n- [ ] leave",
+	}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+	var entry types.Entry
+	if err := json.NewDecoder(rec.Body).Decode(&entry); err != nil {
+		t.Fatal(err)
+	}
+	want := types.EntryStats{
+		WordCount: 3, ReadingMinutes: 1, Checkboxes: 2, CheckboxesChecked: 1,
+		Outline: []types.OutlineHeading{{Level: 1, Text: "Plans"}},
+	}
+	if entry.Stats == nil || !reflect.DeepEqual(*entry.Stats, want) {
+		t.Fatalf("stats = %+v, want %+v", entry.Stats, want)
+	}
+}
@@ -0,0 +1,272 @@
+package entriesHandlers
+
+import (
+	"JourneyAppServer/authz"
+	"JourneyAppServer/aws"
+	"JourneyAppServer/db"
+	"JourneyAppServer/revisions"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// queryEntryKey reads the entry the "id" and "timestamp" query params name,
+// writing a 400 and returning false if they're missing or malformed. The
+// user ID comes from the caller.
+func queryEntryKey(w http.ResponseWriter, r *http.Request) (db.EntryKey, bool) {
+	id := r.URL.Query().Get("id")
+	timestampStr := r.URL.Query().Get("timestamp")
+	if id == "" {
+		http.Error(w, "Missing required param \"id\"", http.StatusBadRequest)
+		return db.EntryKey{}, false
+	}
+	if timestampStr == "" {
+		http.Error(w, "Missing required param \"timestamp\"", http.StatusBadRequest)
+		return db.EntryKey{}, false
+	}
+	timestamp, err := time.Parse(time.RFC3339, timestampStr)
+	if err != nil {
+		http.Error(w, "Invalid timestamp format", http.StatusBadRequest)
+		return db.EntryKey{}, false
+	}
+	return db.EntryKey{ID: id, Timestamp: timestamp}, true
+}
+
+// pruneRevisions applies the retention policy after a change has saved a
+// revision. Failing to prune doesn't fail the change.
+func pruneRevisions(store *db.Store, userID, entryID string) {
+	if err := revisions.Prune(store, userID, entryID); err != nil {
+		utils.LM.Logger.Printf("Error pruning revisions: entry=%s, userId=%s, error=%v", entryID, userID, err)
+	}
+}
+
+func revisionSnapshot(s types.EntrySnapshot) types.EntrySnapshot {
+	s.Encrypted = withoutBlindIndex(s.Encrypted)
+	return s
+}
+
+func ListRevisionsHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		key, ok := queryEntryKey(w, r)
+		if !ok {
+			return
+		}
+		caller, ok := authz.Check(w, r, store, "", "")
+		if !ok {
+			return
+		}
+		key.UserID = caller.UserID
+
+		revs, err := store.Entries.Revisions(key)
+		if err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				http.Error(w, "Entry not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Error listing revisions", http.StatusInternalServerError)
+			return
+		}
+		for i := range revs {
+			revs[i].Snapshot = revisionSnapshot(revs[i].Snapshot)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.ListRevisionsResponse{Revisions: revs})
+	}
+}
+
+// DiffRevisionsHandler compares revision "from" with revision "to", or with
+// the entry as it is now when "to" is left out.
+func DiffRevisionsHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		key, ok := queryEntryKey(w, r)
+		if !ok {
+			return
+		}
+		from, err := strconv.ParseInt(r.URL.Query().Get("from"), 10, 64)
+		if err != nil || from < 1 {
+			http.Error(w, "Missing or invalid param \"from\"", http.StatusBadRequest)
+			return
+		}
+		var to int64
+		if toStr := r.URL.Query().Get("to"); toStr != "" {
+			to, err = strconv.ParseInt(toStr, 10, 64)
+			if err != nil || to < 1 {
+				http.Error(w, "Invalid param \"to\"", http.StatusBadRequest)
+				return
+			}
+		}
+		caller, ok := authz.Check(w, r, store, "", "")
+		if !ok {
+			return
+		}
+		key.UserID = caller.UserID
+
+		response, err := diffRevisions(store, key, from, to)
+		if err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				http.Error(w, "Revision not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Error comparing revisions", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func diffRevisions(store *db.Store, key db.EntryKey, from, to int64) (types.RevisionDiff, error) {
+	fromRev, err := store.Entries.Revision(key, from)
+	if err != nil {
+		return types.RevisionDiff{}, err
+	}
+	var toSnapshot types.EntrySnapshot
+	if to == 0 {
+		entry, err := store.Entries.Get(key)
+		if err != nil {
+			return types.RevisionDiff{}, err
+		}
+		toSnapshot = revisions.Snapshot(entry)
+	} else {
+		toRev, err := store.Entries.Revision(key, to)
+		if err != nil {
+			return types.RevisionDiff{}, err
+		}
+		toSnapshot = toRev.Snapshot
+	}
+
+	diff := revisions.Diff(fromRev.Snapshot, toSnapshot)
+	diff.From, diff.To = from, to
+	return diff, nil
+}
+
+// RestoreRevisionHandler puts an entry back the way a revision has it. The
+// entry's current state is saved as a revision first, so a restore can be
+// undone. Images deleted from S3 since the revision was saved are left out
+// and listed in the response.
+func RestoreRevisionHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req types.RestoreRevisionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.ID == "" {
+			http.Error(w, "Missing required body property \"id\"", http.StatusBadRequest)
+			return
+		}
+		if req.Timestamp.IsZero() {
+			http.Error(w, "Missing required body property \"timestamp\"", http.StatusBadRequest)
+			return
+		}
+		if req.Revision < 1 {
+			http.Error(w, "Missing required body property \"revision\"", http.StatusBadRequest)
+			return
+		}
+
+		caller, ok := authz.Check(w, r, store, "", req.UserID)
+		if !ok {
+			return
+		}
+		req.UserID = caller.UserID
+		key := db.EntryKey{ID: req.ID, UserID: req.UserID, Timestamp: req.Timestamp}
+
+		rev, err := store.Entries.Revision(key, req.Revision)
+		if err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				http.Error(w, "Revision not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Error restoring the revision", http.StatusInternalServerError)
+			return
+		}
+		// A plaintext revision from before the user turned E2EE on can't
+		// be restored; the client has to encrypt and update it instead.
+		if !checkEncryption(w, store, caller.UserID, rev.Snapshot.Text, rev.Snapshot.Encrypted) {
+			return
+		}
+
+		missing, err := missingImages(rev.Snapshot.Images)
+		if err != nil {
+			utils.LM.Logger.Printf("Error checking images for restore: id=%s, userId=%s, error=%v", key.ID, key.UserID, err)
+			http.Error(w, "Error restoring the revision", http.StatusInternalServerError)
+			return
+		}
+
+		response, err := restoreRevision(store, key, req.Revision, missing, r)
+		if err != nil {
+			http.Error(w, "Error restoring the revision", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// imageExists is aws.ImageExists, swapped out by tests.
+var imageExists = aws.ImageExists
+
+// missingImages returns the images that are no longer in S3.
+func missingImages(images []string) ([]string, error) {
+	var missing []string
+	for _, image := range images {
+		exists, err := imageExists(image)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			missing = append(missing, image)
+		}
+	}
+	return missing, nil
+}
+
+func restoreRevision(store *db.Store, key db.EntryKey, revision int64, missing []string, r *http.Request) (types.RestoreRevisionResponse, error) {
+	err := store.Entries.Restore(key, revision, missing)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			utils.LM.Logger.Printf("Revision not found for restore: id=%s, userId=%s, revision=%d", key.ID, key.UserID, revision)
+			return types.RestoreRevisionResponse{Success: false}, nil
+		}
+		return types.RestoreRevisionResponse{Success: false}, err
+	}
+	pruneRevisions(store, key.UserID, key.ID)
+
+	go func() {
+		metadata := utils.RequestMetadata(r)
+		metadata["revision"] = strconv.FormatInt(revision, 10)
+		err := store.Events.Record(types.AnalyticsEvent{
+			UserID:     key.UserID,
+			EventType:  "restore_revision",
+			ObjectType: "entry",
+			ObjectID:   key.ID,
+			Metadata:   metadata,
+		})
+		if err != nil {
+			utils.LM.Logger.Printf("Analytics logging error for revision restore of entry %s: %v", key.ID, err)
+		}
+	}()
+
+	utils.LM.Logger.Printf("Successfully restored entry: id=%s, userId=%s, revision=%d", key.ID, key.UserID, revision)
+	return types.RestoreRevisionResponse{Success: true, MissingImages: missing}, nil
+}
@@ -0,0 +1,128 @@
+package entriesHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/internal/testutil"
+	"JourneyAppServer/types"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// withImagesInS3 makes imageExists report only images as being in S3.
+func withImagesInS3(t *testing.T, images ...string) {
+	t.Helper()
+	saved := imageExists
+	imageExists = func(key string) (bool, error) {
+		for _, image := range images {
+			if image == key {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	t.Cleanup(func() { imageExists = saved })
+}
+
+// editAliceEntry saves revision 1, alice's entry as newTestStore has it, by
+// rewriting its text and dropping its photo.
+func editAliceEntry(t *testing.T, store *db.Store) {
+	t.Helper()
+	text := "second draft"
+	_, err := store.Entries.Patch(db.EntryKey{ID: "alice-entry", UserID: "alice-id"}, types.EntryPatch{Text: &text, Images: &[]string{}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func restore(t *testing.T, store *db.Store, revision int64) types.RestoreRevisionResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	RestoreRevisionHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/revisions/restore", "alice", types.RestoreRevisionRequest{
+		ID: "alice-entry", Timestamp: aliceTimestamp, Revision: revision,
+	}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("restore: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	var response types.RestoreRevisionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestRestoreSavesTheCurrentStateFirst(t *testing.T) {
+	store := newTestStore(t)
+	withImagesInS3(t, "images/alice/alice-entry/photo.jpg")
+	editAliceEntry(t, store)
+
+	if response := restore(t, store, 1); !response.Success || len(response.MissingImages) != 0 {
+		t.Fatalf("response = %+v", response)
+	}
+	entry := aliceEntry(t, store)
+	if entry.Text != "alice's private thoughts" || !reflect.DeepEqual(entry.Images, []string{"images/alice/alice-entry/photo.jpg"}) {
+		t.Fatalf("restored entry: text %q, images %v", entry.Text, entry.Images)
+	}
+
+	revs, err := store.Entries.Revisions(db.EntryKey{ID: "alice-entry", UserID: "alice-id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 2 || revs[0].Reason != db.RevisionRestore || revs[0].Snapshot.Text != "second draft" {
+		t.Fatalf("revisions = %+v, want the pre-restore state saved as revision 2", revs)
+	}
+
+	// And so the restore can itself be undone.
+	restore(t, store, 2)
+	if entry := aliceEntry(t, store); entry.Text != "second draft" || len(entry.Images) != 0 {
+		t.Fatalf("after undoing the restore: text %q, images %v", entry.Text, entry.Images)
+	}
+}
+
+func TestRestoreLeavesOutImagesGoneFromS3(t *testing.T) {
+	store := newTestStore(t)
+	withImagesInS3(t)
+	editAliceEntry(t, store)
+
+	response := restore(t, store, 1)
+	if !response.Success || !reflect.DeepEqual(response.MissingImages, []string{"images/alice/alice-entry/photo.jpg"}) {
+		t.Fatalf("response = %+v", response)
+	}
+	if entry := aliceEntry(t, store); entry.Text != "alice's private thoughts" || len(entry.Images) != 0 {
+		t.Fatalf("restored entry: text %q, images %v", entry.Text, entry.Images)
+	}
+}
+
+func TestDiffAgainstTheCurrentEntry(t *testing.T) {
+	store := newTestStore(t)
+	editAliceEntry(t, store)
+
+	query := url.Values{
+		"id":        {"alice-entry"},
+		"timestamp": {aliceTimestamp.Format(time.RFC3339)},
+		"from":      {"1"},
+	}.Encode()
+	rec := httptest.NewRecorder()
+	DiffRevisionsHandler(store).ServeHTTP(rec, testutil.Request(http.MethodGet, "/api/entries/revisions/diff?"+query, "alice", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %q", rec.Code, rec.Body.String())
+	}
+	var diff types.RevisionDiff
+	if err := json.NewDecoder(rec.Body).Decode(&diff); err != nil {
+		t.Fatal(err)
+	}
+	wantText := []types.DiffLine{{Op: "delete", Text: "alice's private thoughts"}, {Op: "insert", Text: "second draft"}}
+	if !reflect.DeepEqual(diff.Text, wantText) || !reflect.DeepEqual(diff.ImagesRemoved, []string{"images/alice/alice-entry/photo.jpg"}) {
+		t.Fatalf("diff = %+v", diff)
+	}
+
+	rec = httptest.NewRecorder()
+	DiffRevisionsHandler(store).ServeHTTP(rec, testutil.Request(http.MethodGet, "/api/entries/revisions/diff?"+query, "bob", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("bob: status %d, want 404", rec.Code)
+	}
+}
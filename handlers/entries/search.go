@@ -1,276 +1,210 @@
 package entriesHandlers
 
 import (
+	"JourneyAppServer/authz"
 	"JourneyAppServer/db"
+	"JourneyAppServer/e2ee"
+	"JourneyAppServer/geo"
+	"JourneyAppServer/search"
 	"JourneyAppServer/types"
 	"JourneyAppServer/utils"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
-	"time"
 )
 
-func SearchEntriesHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
+func SearchEntriesHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
 
-	q := r.URL.Query()
-	pageStr := q.Get("page")
-	limitStr := q.Get("limit")
-	userStr := q.Get("user")
+		q := r.URL.Query()
+		pageStr := q.Get("page")
+		limitStr := q.Get("limit")
+		userStr := q.Get("user")
 
-	var page int64
-	var limit int64
-	page = 1   // default of page 1
-	limit = 20 // default of limit 20
-	if pageStr != "" {
-		if p, err := strconv.ParseInt(pageStr, 10, 64); err == nil {
-			page = p
-		} else {
-			utils.LM.Logger.Printf("Invalid page parameter: %s, error=%v", pageStr, err)
+		var page int64
+		var limit int64
+		page = 1   // default of page 1
+		limit = 20 // default of limit 20
+		if pageStr != "" {
+			if p, err := strconv.ParseInt(pageStr, 10, 64); err == nil {
+				page = p
+			} else {
+				utils.LM.Logger.Printf("Invalid page parameter: %s, error=%v", pageStr, err)
+			}
 		}
-	}
-	if limitStr != "" {
-		if l, err := strconv.ParseInt(limitStr, 10, 64); err == nil {
-			limit = l
-		} else {
-			utils.LM.Logger.Printf("Invalid limit parameter: %s, error=%v", limitStr, err)
+		if limitStr != "" {
+			if l, err := strconv.ParseInt(limitStr, 10, 64); err == nil {
+				limit = l
+			} else {
+				utils.LM.Logger.Printf("Invalid limit parameter: %s, error=%v", limitStr, err)
+			}
 		}
-	}
-
-	var req types.SearchEntriesRequest
-	req.Page = page
-	req.Limit = limit
-	req.User = userStr
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.LM.Logger.Printf("Invalid request body: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	if req.User == "" {
-		http.Error(w, "Missing required query param \"user\"", http.StatusBadRequest)
-		return
-	}
-	if req.Page < 1 {
-		req.Page = 1
-	}
-	if req.Limit < 1 || req.Limit > 50 {
-		req.Limit = 20
-	}
-	if req.Timeframe == "" {
-		req.Timeframe = "All"
-	}
-	if req.SortRule == "" {
-		req.SortRule = "Newest"
-	}
-	if req.Timeframe == "custom" && (req.FromDate == "" && req.ToDate == "") {
-		http.Error(w, "Missing 'fromDate' or 'toDate' for custom timeframe", http.StatusBadRequest)
-		return
-	}
 
-	response, err := searchEntries(req, r)
-	if err != nil {
-		utils.LM.Logger.Printf("Error searching entries for user %s: %v", req.User, err)
-		http.Error(w, "Error aggregating search results", http.StatusInternalServerError)
-		return
-	}
+		var req types.SearchEntriesRequest
+		req.Page = page
+		req.Limit = limit
+		req.User = userStr
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.LM.Logger.Printf("Invalid request body: %v", err)
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
+		// The user can come from the query string or the body; both have to
+		// be the caller.
+		caller, ok := authz.Check(w, r, store, req.User, "")
+		if !ok {
+			return
+		}
+		if err := caller.RequireUser(userStr, ""); err != nil {
+			authz.WriteError(w, err)
+			return
+		}
+		req.User = caller.Username
+		if req.Page < 1 {
+			req.Page = 1
+		}
+		if req.Limit < 1 || req.Limit > 50 {
+			req.Limit = 20
+		}
+		if req.Timeframe == "" {
+			req.Timeframe = "All"
+		}
+		if req.SortRule == "" {
+			req.SortRule = "Newest"
+		}
+		if req.TagMode == "" {
+			req.TagMode = types.TagModeAny
+		}
+		if req.TagMode != types.TagModeAny && req.TagMode != types.TagModeAll {
+			http.Error(w, "Invalid 'tagMode', expected 'any' or 'all'", http.StatusBadRequest)
+			return
+		}
+		if err := checkGeo(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Timeframe == "custom" && (req.FromDate == "" && req.ToDate == "") {
+			http.Error(w, "Missing 'fromDate' or 'toDate' for custom timeframe", http.StatusBadRequest)
+			return
+		}
+		encrypted, err := e2ee.Enabled(store, caller.UserID)
+		if err != nil {
+			utils.LM.Logger.Printf("Encryption lookup error: user=%s, error=%v", req.User, err)
+			http.Error(w, "Error aggregating search results", http.StatusInternalServerError)
+			return
+		}
+		query, err := search.Parse(req.SearchQuery)
+		if err != nil {
+			writeQueryError(w, err)
+			return
+		}
+		if err := e2ee.CheckSearch(encrypted, req, query); err != nil {
+			e2ee.WriteError(w, err)
+			return
+		}
 
-func searchEntries(req types.SearchEntriesRequest, r *http.Request) ([]types.Entry, error) {
-	var query = `
-        SELECT DISTINCT e.entry_id, e.user_id, e.username, e.text, e.timestamp, e.last_updated
-        FROM entries e
-    `
-	var args []interface{}
-	whereClauses := []string{"e.username = ?"}
-	args = append(args, req.User)
+		response, err := searchEntries(store, req, query, r)
+		if err != nil {
+			utils.LM.Logger.Printf("Error searching entries for user %s: %v", req.User, err)
+			http.Error(w, "Error aggregating search results", http.StatusInternalServerError)
+			return
+		}
 
-	if req.SearchQuery != "" {
-		whereClauses = append(whereClauses, "MATCH(e.text) AGAINST (? IN BOOLEAN MODE)")
-		args = append(args, req.SearchQuery)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
 	}
+}
 
-	if len(req.Locations) > 0 {
-		query += " LEFT JOIN entry_locations el ON e.entry_id = el.entry_id"
-		var locConditions []string
-		for _, loc := range req.Locations {
-			locConditions = append(locConditions, "el.display_name = ?")
-			args = append(args, loc.DisplayName)
+// checkGeo makes sure req's spatial filters are on the Earth.
+func checkGeo(req types.SearchEntriesRequest) error {
+	if r := req.WithinRadius; r != nil {
+		if !geo.Valid(r.Latitude, r.Longitude) || r.Meters <= 0 {
+			return errors.New("Invalid 'withinRadius': it needs a valid point and a positive 'meters'")
 		}
-		whereClauses = append(whereClauses, "("+strings.Join(locConditions, " OR ")+")")
 	}
-
-	if len(req.Tags) > 0 {
-		query += " LEFT JOIN entry_tags et ON e.entry_id = et.entry_id"
-		var tagConditions []string
-		for _, tag := range req.Tags {
-			tagConditions = append(tagConditions, "et.tag_key = ?")
-			args = append(args, tag.Key)
-		}
-		whereClauses = append(whereClauses, "("+strings.Join(tagConditions, " OR ")+")")
+	if b := req.WithinBounds; b != nil && !geo.Bounds(*b).Valid() {
+		return errors.New("Invalid 'withinBounds': latitudes must be within -90 to 90 with 'south' below 'north', and longitudes within -180 to 180")
 	}
-
-	switch req.Timeframe {
-	case "Past year":
-		whereClauses = append(whereClauses, "e.timestamp >= ?")
-		args = append(args, time.Now().AddDate(-1, 0, 0))
-	case "Past 6 months":
-		whereClauses = append(whereClauses, "e.timestamp >= ?")
-		args = append(args, time.Now().AddDate(0, -6, 0))
-	case "Past 3 months":
-		whereClauses = append(whereClauses, "e.timestamp >= ?")
-		args = append(args, time.Now().AddDate(0, -3, 0))
-	case "Past 30 days":
-		whereClauses = append(whereClauses, "e.timestamp >= ?")
-		args = append(args, time.Now().AddDate(0, 0, -30))
-	case "custom":
-		if req.FromDate != "" {
-			fromT, err := time.Parse(time.RFC3339, req.FromDate)
-			if err == nil {
-				whereClauses = append(whereClauses, "e.timestamp >= ?")
-				args = append(args, fromT)
-			}
+	if n := req.Nearest; n != nil {
+		if !geo.Valid(n.Latitude, n.Longitude) || n.Count < 1 || n.Count > types.MaxNearest {
+			return fmt.Errorf("Invalid 'nearest': it needs a valid point and a 'count' from 1 to %d", types.MaxNearest)
 		}
-		if req.ToDate != "" {
-			toT, err := time.Parse(time.RFC3339, req.ToDate)
-			if err == nil {
-				whereClauses = append(whereClauses, "e.timestamp <= ?")
-				args = append(args, toT)
-			}
-		}
-	}
-
-	if len(whereClauses) > 0 {
-		query += " WHERE " + strings.Join(whereClauses, " AND ")
 	}
+	return nil
+}
 
-	//if len(whereClauses) > 1 || (req.SearchQuery == "" && len(whereClauses) > 0) {
-	//	query += " WHERE " + strings.Join(whereClauses, " AND ")
-	//}
-
-	sortDir := "DESC"
-	if req.SortRule == "Oldest" {
-		sortDir = "ASC"
+// writeQueryError answers a SearchQuery that doesn't parse with a 400
+// saying where it went wrong.
+func writeQueryError(w http.ResponseWriter, err error) {
+	var syntaxErr *search.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		http.Error(w, "Invalid search query", http.StatusBadRequest)
+		return
 	}
-	query += " ORDER BY e.timestamp " + sortDir
-
-	offset := (req.Page - 1) * req.Limit
-	query += " LIMIT ? OFFSET ?"
-	args = append(args, req.Limit, offset)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(types.SearchQueryErrorResponse{
+		Error:    "invalid_query",
+		Message:  syntaxErr.Msg,
+		Position: syntaxErr.Pos,
+	})
+}
 
-	rows, err := db.SDB.Query(query, args...)
+func searchEntries(store *db.Store, req types.SearchEntriesRequest, query search.Expr, r *http.Request) (types.SearchEntriesResponse, error) {
+	hits, total, err := store.Entries.Search(req, query)
 	if err != nil {
-		utils.LM.Logger.Printf("Error querying entries: user=%s, error=%v", req.User, err)
-		return nil, err
+		return types.SearchEntriesResponse{}, err
 	}
-	defer rows.Close()
-
-	var entries []types.Entry
-	entryMap := make(map[string]*types.Entry)
-	for rows.Next() {
-		var e types.Entry
-		if err := rows.Scan(&e.ID, &e.UserID, &e.Username, &e.Text, &e.Timestamp, &e.LastUpdated); err != nil {
-			utils.LM.Logger.Printf("Error scanning entry row: user=%s, error=%v", req.User, err)
-			return nil, err
-		}
-		entryMap[e.ID] = &e
+	response := types.SearchEntriesResponse{
+		Results: make([]types.SearchResult, len(hits)),
+		Total:   total,
+		Page:    req.Page,
+		Limit:   req.Limit,
 	}
-	if err := rows.Err(); err != nil {
-		utils.LM.Logger.Printf("Row iteration error: user=%s, error=%v", req.User, err)
-		return nil, err
-	}
-
-	for _, e := range entryMap {
-		locQuery := "SELECT latitude, longitude, display_name FROM entry_locations WHERE entry_id = ?"
-		locRows, err := db.SDB.Query(locQuery, e.ID)
-		if err != nil {
-			utils.LM.Logger.Printf("Error querying locations for entry %s: %v", e.ID, err)
-			return nil, err
-		}
-		defer locRows.Close()
-		for locRows.Next() {
-			var loc types.LocationData
-			if err := locRows.Scan(&loc.Latitude, &loc.Longitude, &loc.DisplayName); err != nil {
-				utils.LM.Logger.Printf("Error scanning location for entry %s: %v", e.ID, err)
-				return nil, err
-			}
-			e.Locations = append(e.Locations, loc)
+	terms := search.Terms(query)
+	for i, hit := range hits {
+		response.Results[i] = types.SearchResult{Entry: hit.Entry, Score: hit.Score, Snippets: []types.SearchSnippet{}, DistanceMeters: hit.Distance}
+		response.Results[i].Entry.Encrypted = withoutBlindIndex(hit.Entry.Encrypted)
+		if hit.Entry.Encrypted == nil {
+			response.Results[i].Snippets = search.Snippets(hit.PlainText, terms)
 		}
-
-		tagQuery := "SELECT tag_key, tag_value FROM entry_tags WHERE entry_id = ?"
-		tagRows, err := db.SDB.Query(tagQuery, e.ID)
-		if err != nil {
-			utils.LM.Logger.Printf("Error querying tags for entry %s: %v", e.ID, err)
-			return nil, err
-		}
-		defer tagRows.Close()
-		for tagRows.Next() {
-			var tag types.TagData
-			if err := tagRows.Scan(&tag.Key, &tag.Value); err != nil {
-				utils.LM.Logger.Printf("Error scanning tag for entry %s: %v", e.ID, err)
-				return nil, err
-			}
-			e.Tags = append(e.Tags, tag)
-		}
-
-		imgQuery := "SELECT image_url FROM entry_images WHERE entry_id = ?"
-		imgRows, err := db.SDB.Query(imgQuery, e.ID)
-		if err != nil {
-			utils.LM.Logger.Printf("Error querying images for entry %s: %v", e.ID, err)
-			return nil, err
-		}
-		defer imgRows.Close()
-		for imgRows.Next() {
-			var img string
-			if err := imgRows.Scan(&img); err != nil {
-				utils.LM.Logger.Printf("Error scanning image for entry %s: %v", e.ID, err)
-				return nil, err
-			}
-			e.Images = append(e.Images, img)
-		}
-
-		entries = append(entries, *e)
 	}
 
 	go func() {
-		ip := r.Header.Get("X-Forwarded-For")
-		if ip == "" {
-			ip = r.RemoteAddr
+		metadata := utils.RequestMetadata(r)
+		metadata["search_query"] = req.SearchQuery
+		metadata["timeframe"] = req.Timeframe
+		metadata["sort_rule"] = req.SortRule
+		metadata["tag_mode"] = req.TagMode
+		metadata["page"] = strconv.FormatInt(req.Page, 10)
+		metadata["limit"] = strconv.FormatInt(req.Limit, 10)
+		if len(req.BlindTokens) > 0 {
+			metadata["blind_tokens"] = strconv.Itoa(len(req.BlindTokens))
 		}
-		metadata := map[string]string{
-			"source":       "api",
-			"client_ip":    ip,
-			"user_agent":   r.Header.Get("User-Agent"),
-			"app_version":  r.Header.Get("X-App-Version"),
-			"os_version":   r.Header.Get("X-OS-Version"),
-			"device_model": r.Header.Get("X-Device-Model"),
-			"search_query": req.SearchQuery,
-			"timeframe":    req.Timeframe,
-			"sort_rule":    req.SortRule,
-			"page":         strconv.FormatInt(req.Page, 10),
-			"limit":        strconv.FormatInt(req.Limit, 10),
+		if req.WithinRadius != nil || req.WithinBounds != nil || req.Nearest != nil {
+			metadata["geo"] = "true"
 		}
-		metadataJSON, _ := json.Marshal(metadata)
-		analyticsQuery := `
-            INSERT INTO analytics_events (
-                user_id, event_type, object_type, object_id, event_time, metadata
-            ) VALUES (?, ?, ?, ?, NOW(), ?)
-        `
-		_, err := db.SDB.Exec(analyticsQuery, req.User, "search_entries", "entries", "all", string(metadataJSON))
+		err := store.Events.Record(types.AnalyticsEvent{
+			UserID:     req.User,
+			EventType:  "search_entries",
+			ObjectType: "entries",
+			ObjectID:   "all",
+			Metadata:   metadata,
+		})
 		if err != nil {
 			utils.LM.Logger.Printf("Analytics logging error for search entries user %s: %v", req.User, err)
 		}
 	}()
 
-	utils.LM.Logger.Printf("Successfully searched entries for user %s: page=%d, limit=%d, count=%d", req.User, req.Page, req.Limit, len(entries))
-	return entries, nil
+	utils.LM.Logger.Printf("Successfully searched entries for user %s: page=%d, limit=%d, count=%d, total=%d", req.User, req.Page, req.Limit, len(hits), total)
+	return response, nil
 
 	//ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	//defer cancel()
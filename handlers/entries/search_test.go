@@ -0,0 +1,405 @@
+package entriesHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/internal/testutil"
+	"JourneyAppServer/textindex"
+	"JourneyAppServer/types"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchByRelevance(t *testing.T) {
+	store := newTestStore(t)
+	for i, text := range []string{
+		"# Lake day\nThe *lake* was cold, the lake was clear.",
+		"Walked past a lake.",
+		"Nothing to see here.",
+	} {
+		err := store.Entries.Create(types.Entry{
+			ID:        []string{"two-hits", "one-hit", "no-hits"}[i],
+			UserID:    "alice-id",
+			Username:  "alice",
+			Text:      text,
+			Timestamp: aliceTimestamp.Add(time.Duration(i) * time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	SearchEntriesHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/search?user=alice", "alice", types.SearchEntriesRequest{
+		Limit:       1,
+		SearchQuery: "lake",
+		SortRule:    "Relevance",
+	}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+	var response types.SearchEntriesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Total != 2 || len(response.Results) != 1 {
+		t.Fatalf("total = %d with %d results, want 2 with 1", response.Total, len(response.Results))
+	}
+	best := response.Results[0]
+	if best.Entry.ID != "two-hits" {
+		t.Fatalf("best match = %s, want two-hits", best.Entry.ID)
+	}
+	// Snippets come from the plain text, so there's no markup around the
+	// highlighted words.
+	if len(best.Snippets) != 1 || best.Snippets[0].Text != "Lake day The lake was cold, the lake was clear." ||
+		len(best.Snippets[0].Highlights) != 3 {
+		t.Fatalf("snippets = %+v", best.Snippets)
+	}
+}
+
+func TestSearchDoesNotMatchMarkup(t *testing.T) {
+	store := newTestStore(t)
+	err := store.Entries.Create(types.Entry{
+		ID: "colored", UserID: "alice-id", Username: "alice", Timestamp: aliceTimestamp,
+		Text: "{color: red}warm{color} morning",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	SearchEntriesHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/search?user=alice", "alice", types.SearchEntriesRequest{
+		SearchQuery: "red",
+	}))
+	var response types.SearchEntriesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Total != 0 {
+		t.Fatalf("total = %d, want 0: %+v", response.Total, response.Results)
+	}
+}
+
+func TestSearchQueryLanguage(t *testing.T) {
+	store := newTestStore(t)
+	for _, e := range []types.Entry{
+		{ID: "lisbon", Text: "Tram 28 up the hill", Timestamp: aliceTimestamp.AddDate(0, 1, 0),
+			Tags: []types.TagData{{Key: "travel"}}, Locations: []types.LocationData{{DisplayName: "Lisbon"}}},
+		{ID: "draft", Text: "Notes for the trip report", Timestamp: aliceTimestamp.AddDate(0, 2, 0),
+			Tags: []types.TagData{{Key: "travel"}, {Key: "draft"}}},
+	} {
+		e.UserID, e.Username = "alice-id", "alice"
+		if err := store.Entries.Create(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for query, want := range map[string]string{
+		"tag:travel":                          "draft lisbon",
+		"tag:travel -tag:draft":               "lisbon",
+		"tag:secret OR tag:draft":             "draft alice-entry",
+		`location:"Lisbon" has:tag`:           "lisbon",
+		"has:image":                           "alice-entry",
+		"before:2024-06-01":                   "alice-entry",
+		"after:2024-06-01 NOT has:location":   "draft",
+		`"trip report"`:                       "draft",
+		`"report trip"`:                       "",
+		"thought*":                            "alice-entry",
+		"thought":                             "",
+		"(tram OR notes) -report tag:travel":  "lisbon",
+		"tag:TRAVEL":                          "",
+		"has:tag -(tag:travel AND tag:draft)": "lisbon alice-entry",
+	} {
+		rec := httptest.NewRecorder()
+		SearchEntriesHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/search?user=alice", "alice", types.SearchEntriesRequest{
+			SearchQuery: query,
+		}))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200 (body %q)", query, rec.Code, rec.Body.String())
+		}
+		var response types.SearchEntriesResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, result := range response.Results {
+			ids = append(ids, result.Entry.ID)
+		}
+		if got := strings.Join(ids, " "); got != want {
+			t.Errorf("%s: got [%s], want [%s]", query, got, want)
+		}
+	}
+}
+
+func TestSearchTagFilters(t *testing.T) {
+	store := newTestStore(t)
+	for _, e := range []types.Entry{
+		{ID: "lisbon", Text: "Tram 28", Timestamp: aliceTimestamp.AddDate(0, 1, 0),
+			Tags: []types.TagData{{Key: "travel"}, {Key: "city", Value: "Lisbon"}}},
+		{ID: "porto", Text: "Port wine", Timestamp: aliceTimestamp.AddDate(0, 2, 0),
+			Tags: []types.TagData{{Key: "travel"}, {Key: "city", Value: "Porto"}, {Key: "draft"}}},
+	} {
+		e.UserID, e.Username = "alice-id", "alice"
+		if err := store.Entries.Create(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	travel, draft, secret := types.TagData{Key: "travel"}, types.TagData{Key: "draft"}, types.TagData{Key: "secret"}
+	lisbon, porto := types.TagData{Key: "city", Value: "Lisbon"}, types.TagData{Key: "city", Value: "Porto"}
+	tests := []struct {
+		name    string
+		mode    string
+		tags    []types.TagData
+		exclude []types.TagData
+		want    string
+	}{
+		{"any of keys", "", []types.TagData{draft, secret}, nil, "porto alice-entry"},
+		{"all of keys", types.TagModeAll, []types.TagData{travel, draft}, nil, "porto"},
+		{"all of keys none has", types.TagModeAll, []types.TagData{travel, secret}, nil, ""},
+		{"any of values", types.TagModeAny, []types.TagData{lisbon, porto}, nil, "porto lisbon"},
+		{"value", "", []types.TagData{lisbon}, nil, "lisbon"},
+		{"value is compared exactly", "", []types.TagData{{Key: "city", Value: "lisbon"}}, nil, ""},
+		{"all of key and value", types.TagModeAll, []types.TagData{travel, porto}, nil, "porto"},
+		{"all of values", types.TagModeAll, []types.TagData{lisbon, porto}, nil, ""},
+		{"exclude key", "", nil, []types.TagData{draft}, "lisbon alice-entry"},
+		{"exclude value", "", nil, []types.TagData{porto}, "lisbon alice-entry"},
+		{"any excluding", "", []types.TagData{travel, secret}, []types.TagData{draft}, "lisbon alice-entry"},
+		{"all excluding", types.TagModeAll, []types.TagData{travel}, []types.TagData{lisbon}, "porto"},
+		{"exclude everything", "", []types.TagData{travel}, []types.TagData{travel}, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		SearchEntriesHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/search?user=alice", "alice", types.SearchEntriesRequest{
+			Tags:        tt.tags,
+			TagMode:     tt.mode,
+			ExcludeTags: tt.exclude,
+		}))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200 (body %q)", tt.name, rec.Code, rec.Body.String())
+		}
+		var response types.SearchEntriesResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, result := range response.Results {
+			ids = append(ids, result.Entry.ID)
+		}
+		if got := strings.Join(ids, " "); got != tt.want || response.Total != int64(len(ids)) {
+			t.Errorf("%s: got [%s] of %d, want [%s]", tt.name, got, response.Total, tt.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	SearchEntriesHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/search?user=alice", "alice", types.SearchEntriesRequest{
+		Tags:    []types.TagData{travel},
+		TagMode: "some",
+	}))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("tagMode some: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestSearchByLocation(t *testing.T) {
+	store := newTestStore(t)
+	for i, e := range []types.Entry{
+		{ID: "lisbon", Locations: []types.LocationData{{Latitude: 38.7223, Longitude: -9.1393, DisplayName: "Lisbon"}},
+			Tags: []types.TagData{{Key: "travel"}}},
+		{ID: "porto", Locations: []types.LocationData{{Latitude: 41.1579, Longitude: -8.6291, DisplayName: "Porto"}}},
+		{ID: "madrid", Locations: []types.LocationData{{Latitude: 40.4168, Longitude: -3.7038, DisplayName: "Madrid"}}},
+		{ID: "suva", Locations: []types.LocationData{
+			{Latitude: -18.1416, Longitude: 178.4419, DisplayName: "Suva"},
+			{Latitude: 38.7223, Longitude: -9.1393, DisplayName: "Lisbon, on the way home"},
+		}},
+	} {
+		e.UserID, e.Username, e.Text = "alice-id", "alice", e.ID
+		e.Timestamp = aliceTimestamp.AddDate(0, 0, i+1)
+		if err := store.Entries.Create(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := func(req types.SearchEntriesRequest) types.SearchEntriesResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		SearchEntriesHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/search?user=alice", "alice", req))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+		}
+		var response types.SearchEntriesResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+	ids := func(response types.SearchEntriesResponse) string {
+		var ids []string
+		for _, result := range response.Results {
+			ids = append(ids, result.Entry.ID)
+		}
+		return strings.Join(ids, " ")
+	}
+
+	coimbra := func(meters float64) *types.GeoRadius {
+		return &types.GeoRadius{Latitude: 40.2033, Longitude: -8.4103, Meters: meters}
+	}
+	for _, tt := range []struct {
+		name string
+		req  types.SearchEntriesRequest
+		want string
+	}{
+		{"within 50km of Lisbon", types.SearchEntriesRequest{
+			WithinRadius: &types.GeoRadius{Latitude: 38.7, Longitude: -9.1, Meters: 50000},
+		}, "suva lisbon"},
+		{"within 200km of Coimbra", types.SearchEntriesRequest{WithinRadius: coimbra(200000)}, "suva porto lisbon"},
+		{"within 120km of Coimbra", types.SearchEntriesRequest{WithinRadius: coimbra(120000)}, "porto"},
+		{"in Portugal", types.SearchEntriesRequest{
+			WithinBounds: &types.GeoBounds{South: 36.9, West: -9.6, North: 42.2, East: -6.2},
+		}, "suva porto lisbon"},
+		{"across the antimeridian", types.SearchEntriesRequest{
+			WithinBounds: &types.GeoBounds{South: -21, West: 176, North: -12, East: -178},
+		}, "suva"},
+		{"radius and box", types.SearchEntriesRequest{
+			WithinRadius: coimbra(500000),
+			WithinBounds: &types.GeoBounds{South: 36, West: -6, North: 44, East: 0},
+		}, "madrid"},
+		{"nearest", types.SearchEntriesRequest{
+			Nearest: &types.GeoNearest{Latitude: 40.2033, Longitude: -8.4103, Count: 3},
+		}, "porto suva lisbon"},
+		{"nearest with a tag", types.SearchEntriesRequest{
+			Nearest: &types.GeoNearest{Latitude: 40.2033, Longitude: -8.4103, Count: 3},
+			Tags:    []types.TagData{{Key: "travel"}},
+		}, "lisbon"},
+		{"nearest within a box", types.SearchEntriesRequest{
+			Nearest:      &types.GeoNearest{Latitude: 38.7223, Longitude: -9.1393, Count: 1},
+			WithinBounds: &types.GeoBounds{South: -21, West: 176, North: -12, East: -178},
+		}, "suva"},
+	} {
+		if got := ids(search(tt.req)); got != tt.want {
+			t.Errorf("%s: got [%s], want [%s]", tt.name, got, tt.want)
+		}
+	}
+
+	// Nearest caps the results, pages included, and has distances.
+	response := search(types.SearchEntriesRequest{
+		Limit:   2,
+		Page:    2,
+		Nearest: &types.GeoNearest{Latitude: 40.2033, Longitude: -8.4103, Count: 3},
+	})
+	if response.Total != 3 || ids(response) != "lisbon" {
+		t.Fatalf("page 2: got [%s] of %d, want [lisbon] of 3", ids(response), response.Total)
+	}
+	if d := response.Results[0].DistanceMeters; d == nil || *d < 170000 || *d > 180000 {
+		t.Fatalf("distance from Coimbra to Lisbon = %v, want about 175km", d)
+	}
+	if response := search(types.SearchEntriesRequest{}); response.Results[0].DistanceMeters != nil {
+		t.Fatalf("distance without a point = %v, want none", *response.Results[0].DistanceMeters)
+	}
+
+	for name, req := range map[string]types.SearchEntriesRequest{
+		"radius without meters":  {WithinRadius: &types.GeoRadius{Latitude: 38.7, Longitude: -9.1}},
+		"latitude off the Earth": {WithinRadius: &types.GeoRadius{Latitude: 91, Longitude: -9.1, Meters: 10}},
+		"box upside down":        {WithinBounds: &types.GeoBounds{South: 42.2, West: -9.6, North: 36.9, East: -6.2}},
+		"nearest too many":       {Nearest: &types.GeoNearest{Count: types.MaxNearest + 1}},
+		"nearest none":           {Nearest: &types.GeoNearest{}},
+	} {
+		rec := httptest.NewRecorder()
+		SearchEntriesHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/search?user=alice", "alice", req))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, rec.Code)
+		}
+	}
+}
+
+func TestSearchQuerySyntaxError(t *testing.T) {
+	store := newTestStore(t)
+	rec := httptest.NewRecorder()
+	SearchEntriesHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/search?user=alice", "alice", types.SearchEntriesRequest{
+		SearchQuery: "tag:travel before:june",
+	}))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400 (body %q)", rec.Code, rec.Body.String())
+	}
+	var response types.SearchQueryErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Error != "invalid_query" || response.Position != 18 || response.Message == "" {
+		t.Fatalf("response = %+v, want invalid_query at 18", response)
+	}
+}
+
+func TestSearchWithEmbeddedIndex(t *testing.T) {
+	index, err := textindex.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	store := seedTestStore(t, db.NewIndexedMemoryStore(index))
+	err = store.Entries.Create(types.Entry{
+		ID: "lisbon", UserID: "alice-id", Username: "alice", Timestamp: aliceTimestamp.Add(time.Hour),
+		Text: "# Lisbon\nThe *tram* up to the castle.", Tags: []types.TagData{{Key: "travel"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(query string) string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		SearchEntriesHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/search?user=alice", "alice", types.SearchEntriesRequest{
+			SearchQuery: query,
+			SortRule:    "Relevance",
+		}))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200 (body %q)", query, rec.Code, rec.Body.String())
+		}
+		var response types.SearchEntriesResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, result := range response.Results {
+			ids = append(ids, result.Entry.ID)
+		}
+		return strings.Join(ids, " ")
+	}
+
+	for query, want := range map[string]string{
+		"lisbn":                     "lisbon",
+		"thought*":                  "alice-entry",
+		"castle -tag:travel":        "",
+		"castel OR private":         "alice-entry lisbon",
+		`"tram up" tag:travel`:      "lisbon",
+		`"up tram"`:                 "",
+		"tag:secret OR lisbon tram": "lisbon alice-entry",
+	} {
+		if got := search(query); got != want {
+			t.Errorf("%s: got [%s], want [%s]", query, got, want)
+		}
+	}
+
+	// The index follows the entry's text as it changes.
+	text := "Porto this time."
+	if _, err := store.Entries.Patch(db.EntryKey{ID: "lisbon", UserID: "alice-id"}, types.EntryPatch{Text: &text}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := search("lisbon"); got != "" {
+		t.Errorf("lisbon after the edit: got [%s], want none", got)
+	}
+	if got := search("prto"); got != "lisbon" {
+		t.Errorf("prto after the edit: got [%s], want [lisbon]", got)
+	}
+
+	// So does a rebuilt index.
+	if n, err := db.Reindex(store.Entries, index, 1); err != nil || n != 2 {
+		t.Fatalf("Reindex = %d, %v, want 2 entries", n, err)
+	}
+	if got := search("porto OR thoughts"); got != "lisbon alice-entry" {
+		t.Errorf("after reindexing: got [%s], want [lisbon alice-entry]", got)
+	}
+}
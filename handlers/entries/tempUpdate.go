@@ -4,10 +4,11 @@ import (
 	"JourneyAppServer/db"
 	"context"
 	"fmt"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 	"net/http"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func FixTimestampHandler(w http.ResponseWriter, r *http.Request) {
@@ -31,9 +32,9 @@ func fixTimestamp() (bool, error) {
 
 	updatePipeline := mongo.Pipeline{
 		{
-			{"$set", bson.D{
-				{"timestamp", bson.D{
-					{"$toDate", "$timestamp"},
+			{Key: "$set", Value: bson.D{
+				{Key: "timestamp", Value: bson.D{
+					{Key: "$toDate", Value: "$timestamp"},
 				}},
 			}},
 		},
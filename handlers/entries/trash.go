@@ -0,0 +1,156 @@
+package entriesHandlers
+
+import (
+	"JourneyAppServer/authz"
+	"JourneyAppServer/db"
+	"JourneyAppServer/trash"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+func ListTrashHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		limit, page := int64(10), int64(1)
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			n, err := strconv.ParseInt(limitStr, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid param \"limit\"", http.StatusBadRequest)
+				return
+			}
+			limit = min(max(n, 1), 50)
+		}
+		if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+			n, err := strconv.ParseInt(pageStr, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid param \"page\"", http.StatusBadRequest)
+				return
+			}
+			page = max(n, 1)
+		}
+
+		caller, ok := authz.Check(w, r, store, "", "")
+		if !ok {
+			return
+		}
+
+		entries, err := store.Entries.ListTrash(caller.UserID, page, limit)
+		if err != nil {
+			http.Error(w, "Error listing the trash", http.StatusInternalServerError)
+			return
+		}
+		for i := range entries {
+			entries[i].Encrypted = withoutBlindIndex(entries[i].Encrypted)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.ListTrashResponse{Entries: entries, RetentionDays: trash.RetentionDays()})
+	}
+}
+
+func RestoreEntryHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req types.RestoreEntryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.ID == "" {
+			http.Error(w, "Missing required body property \"id\"", http.StatusBadRequest)
+			return
+		}
+		if req.Timestamp.IsZero() {
+			http.Error(w, "Missing required body property \"timestamp\"", http.StatusBadRequest)
+			return
+		}
+
+		caller, ok := authz.Check(w, r, store, "", req.UserID)
+		if !ok {
+			return
+		}
+		req.UserID = caller.UserID
+
+		response, err := restoreEntry(store, req, r)
+		if err != nil {
+			http.Error(w, "Error restoring the entry", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func restoreEntry(store *db.Store, req types.RestoreEntryRequest, r *http.Request) (types.RestoreEntryResponse, error) {
+	err := store.Entries.Undelete(db.EntryKey{ID: req.ID, UserID: req.UserID, Timestamp: req.Timestamp})
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			utils.LM.Logger.Printf("No trashed entry found to restore: id=%s, userId=%s, timestamp=%v", req.ID, req.UserID, req.Timestamp)
+			return types.RestoreEntryResponse{Success: false}, nil
+		}
+		return types.RestoreEntryResponse{Success: false}, err
+	}
+	recordTrashEvent(store, r, req.UserID, "restore_entry", req.ID, nil)
+
+	utils.LM.Logger.Printf("Successfully restored entry from trash: id=%s, userId=%s", req.ID, req.UserID)
+	return types.RestoreEntryResponse{Success: true}, nil
+}
+
+// EmptyTrashHandler purges everything in the caller's trash now, images
+// included, instead of waiting for the retention period.
+func EmptyTrashHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		caller, ok := authz.Check(w, r, store, "", "")
+		if !ok {
+			return
+		}
+
+		purged, err := trash.Empty(store, caller.UserID)
+		if err != nil {
+			utils.LM.Logger.Printf("Error emptying trash: userId=%s, purged=%d, error=%v", caller.UserID, purged, err)
+			http.Error(w, "Error emptying the trash", http.StatusInternalServerError)
+			return
+		}
+		recordTrashEvent(store, r, caller.UserID, "empty_trash", "", map[string]string{"purged": strconv.Itoa(purged)})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.EmptyTrashResponse{Success: true, Purged: purged})
+	}
+}
+
+func recordTrashEvent(store *db.Store, r *http.Request, userID, eventType, entryID string, extra map[string]string) {
+	go func() {
+		metadata := utils.RequestMetadata(r)
+		for k, v := range extra {
+			metadata[k] = v
+		}
+		err := store.Events.Record(types.AnalyticsEvent{
+			UserID:     userID,
+			EventType:  eventType,
+			ObjectType: "entry",
+			ObjectID:   entryID,
+			Metadata:   metadata,
+		})
+		if err != nil {
+			utils.LM.Logger.Printf("Analytics logging error for %s: %v", eventType, err)
+		}
+	}()
+}
@@ -0,0 +1,86 @@
+package entriesHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/internal/testutil"
+	"JourneyAppServer/types"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrashedEntryIsHiddenUntilRestored(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.Entries.Delete(db.EntryKey{ID: "alice-entry", UserID: "alice-id"}); err != nil {
+		t.Fatal(err)
+	}
+
+	getQuery := url.Values{
+		"id":        {"alice-entry"},
+		"userId":    {"alice-id"},
+		"timestamp": {aliceTimestamp.Format(time.RFC3339)},
+	}.Encode()
+	// visible reports whether list, get and search each return the entry.
+	visible := func() (list, get, search bool) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		ListEntriesHandler(store).ServeHTTP(rec, testutil.Request(http.MethodGet, "/api/entries/list?user=alice&limit=10&page=1", "alice", nil))
+		list = strings.Contains(rec.Body.String(), "alice-entry")
+
+		rec = httptest.NewRecorder()
+		GetEntryHandler(store).ServeHTTP(rec, testutil.Request(http.MethodGet, "/api/entries/get?"+getQuery, "alice", nil))
+		get = rec.Code == http.StatusOK
+
+		rec = httptest.NewRecorder()
+		SearchEntriesHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/search?user=alice", "alice", types.SearchEntriesRequest{
+			SearchQuery: "private",
+		}))
+		var response types.SearchEntriesResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		search = response.Total > 0
+		return list, get, search
+	}
+
+	if list, get, search := visible(); list || get || search {
+		t.Fatalf("trashed entry visible: list %v, get %v, search %v", list, get, search)
+	}
+
+	rec := httptest.NewRecorder()
+	ListTrashHandler(store).ServeHTTP(rec, testutil.Request(http.MethodGet, "/api/entries/trash", "alice", nil))
+	var trashed types.ListTrashResponse
+	if err := json.NewDecoder(rec.Body).Decode(&trashed); err != nil {
+		t.Fatal(err)
+	}
+	if len(trashed.Entries) != 1 || trashed.Entries[0].ID != "alice-entry" {
+		t.Fatalf("trash = %+v", trashed.Entries)
+	}
+
+	restore := func(username string) types.RestoreEntryResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		RestoreEntryHandler(store).ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/entries/trash/restore", username, types.RestoreEntryRequest{
+			ID: "alice-entry", Timestamp: aliceTimestamp,
+		}))
+		var response types.RestoreEntryResponse
+		json.NewDecoder(rec.Body).Decode(&response)
+		return response
+	}
+	if restore("bob").Success {
+		t.Fatal("bob restored alice's entry")
+	}
+	if !restore("alice").Success {
+		t.Fatal("restore failed")
+	}
+	if list, get, search := visible(); !list || !get || !search {
+		t.Fatalf("restored entry hidden: list %v, get %v, search %v", list, get, search)
+	}
+	if restore("alice").Success {
+		t.Error("restoring an entry that isn't in the trash succeeded")
+	}
+}
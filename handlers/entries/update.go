@@ -1,183 +1,120 @@
 package entriesHandlers
 
 import (
+	"JourneyAppServer/authz"
 	"JourneyAppServer/db"
 	"JourneyAppServer/types"
 	"JourneyAppServer/utils"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"time"
 )
 
-func UpdateEntryHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var req types.UpdateEntryRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-	//if req.UserID == "" {
-	//	http.Error(w, "Missing required body property \"userId\"", http.StatusBadRequest)
-	//	return
-	//}
-	if req.Timestamp.IsZero() {
-		http.Error(w, "Missing required body property \"timestamp\"", http.StatusBadRequest)
-		return
-	}
-
-	response, err := updateEntry(req, r)
-	if err != nil {
-		http.Error(w, "Error updating the entry", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
+func UpdateEntryHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
 
-func updateEntry(req types.UpdateEntryRequest, r *http.Request) (types.UpdateEntryResponse, error) {
-	tx, err := db.SDB.Begin()
-	if err != nil {
-		utils.LM.Logger.Printf("Error starting transaction for entry update: id=%s, userId=%s, error=%v", req.ID, req.UserID, err)
-		return types.UpdateEntryResponse{Success: false}, err
-	}
-	defer func() {
+		var req types.UpdateEntryRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
 		if err != nil {
-			tx.Rollback()
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
-		tx.Commit()
-	}()
-
-	var exists bool
-	checkQuery := `SELECT EXISTS(SELECT 1 FROM entries WHERE entry_id = ? AND user_id = ? AND timestamp = ?)`
-	err = tx.QueryRow(checkQuery, req.ID, req.UserID, req.Timestamp).Scan(&exists)
-	if err != nil {
-		utils.LM.Logger.Printf("Error checking entry existence: id=%s, userId=%s, error=%v", req.ID, req.UserID, err)
-		return types.UpdateEntryResponse{Success: false}, err
-	}
-	if !exists {
-		utils.LM.Logger.Printf("Entry not found for update: id=%s, userId=%s, timestamp=%v", req.ID, req.UserID, req.Timestamp)
-		return types.UpdateEntryResponse{Success: false}, nil
-	}
-
-	if req.Text != "" || !req.LastUpdated.IsZero() {
-		updateQuery := `UPDATE entries SET `
-		var args []interface{}
-		if req.Text != "" {
-			updateQuery += "text = ?, "
-			args = append(args, req.Text)
+		//if req.UserID == "" {
+		//	http.Error(w, "Missing required body property \"userId\"", http.StatusBadRequest)
+		//	return
+		//}
+		if req.Timestamp.IsZero() {
+			http.Error(w, "Missing required body property \"timestamp\"", http.StatusBadRequest)
+			return
 		}
-		lastUpdated := req.LastUpdated
-		if lastUpdated.IsZero() {
-			lastUpdated = time.Now().UTC()
+
+		// Without If-Match a stale client would overwrite newer changes
+		// unseen. "*" still writes regardless of version.
+		version, ok := requireIfMatch(w, r)
+		if !ok {
+			return
 		}
-		updateQuery += "last_updated = ? "
-		args = append(args, lastUpdated)
-		updateQuery += "WHERE entry_id = ? AND user_id = ? AND timestamp = ?"
-		args = append(args, req.ID, req.UserID, req.Timestamp)
 
-		result, err := tx.Exec(updateQuery, args...)
-		if err != nil {
-			utils.LM.Logger.Printf("Error updating entry text/last_updated: id=%s, userId=%s, error=%v", req.ID, req.UserID, err)
-			return types.UpdateEntryResponse{Success: false}, err
+		caller, ok := authz.Check(w, r, store, req.Username, req.UserID)
+		if !ok {
+			return
 		}
-		rowsAffected, err := result.RowsAffected()
-		if err != nil || rowsAffected == 0 {
-			utils.LM.Logger.Printf("No rows affected updating entry: id=%s, userId=%s, error=%v", req.ID, req.UserID, err)
-			return types.UpdateEntryResponse{Success: false}, err
+		req.Username, req.UserID = caller.Username, caller.UserID
+		if !checkEncryption(w, store, caller.UserID, req.Text, req.Encrypted) {
+			return
+		}
+		if !checkLocations(w, req.Locations) {
+			return
 		}
-	}
 
-	if req.Locations != nil && len(req.Locations) > 0 {
-		_, err = tx.Exec(`DELETE FROM entry_locations WHERE entry_id = ?`, req.ID)
+		response, err := updateEntry(store, req, version, r)
 		if err != nil {
-			utils.LM.Logger.Printf("Error deleting old locations for entry %s: %v", req.ID, err)
-			return types.UpdateEntryResponse{Success: false}, err
-		}
-		for _, loc := range req.Locations {
-			locQuery := `
-                INSERT INTO entry_locations (entry_id, latitude, longitude, display_name)
-                VALUES (?, ?, ?, ?)
-            `
-			_, err = tx.Exec(locQuery, req.ID, loc.Latitude, loc.Longitude, loc.DisplayName)
-			if err != nil {
-				utils.LM.Logger.Printf("Error inserting location for entry %s: %v", req.ID, err)
-				return types.UpdateEntryResponse{Success: false}, err
+			if errors.Is(err, db.ErrVersionMismatch) {
+				writeConflict(w, store, db.EntryKey{ID: req.ID, UserID: req.UserID, Timestamp: req.Timestamp})
+				return
 			}
+			http.Error(w, "Error updating the entry", http.StatusInternalServerError)
+			return
 		}
-	}
 
-	if req.Tags != nil && len(req.Tags) > 0 {
-		_, err = tx.Exec(`DELETE FROM entry_tags WHERE entry_id = ?`, req.ID)
-		if err != nil {
-			utils.LM.Logger.Printf("Error deleting old tags for entry %s: %v", req.ID, err)
-			return types.UpdateEntryResponse{Success: false}, err
-		}
-		for _, tag := range req.Tags {
-			tagQuery := `
-                INSERT INTO entry_tags (entry_id, tag_key, tag_value)
-                VALUES (?, ?, ?)
-            `
-			_, err = tx.Exec(tagQuery, req.ID, tag.Key, tag.Value)
-			if err != nil {
-				utils.LM.Logger.Printf("Error inserting tag for entry %s: %v", req.ID, err)
-				return types.UpdateEntryResponse{Success: false}, err
-			}
+		w.Header().Set("Content-Type", "application/json")
+		if response.Success {
+			w.Header().Set("ETag", entryETag(response.Version))
 		}
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// updatePatch turns a PUT body into a patch. Empty text and empty lists
+// have always meant "leave as it is" here; clearing them takes a PATCH.
+func updatePatch(req types.UpdateEntryRequest) types.EntryPatch {
+	patch := types.EntryPatch{Encrypted: req.Encrypted, LastUpdated: req.LastUpdated}
+	if req.Text != "" {
+		patch.Text = &req.Text
+	}
+	if len(req.Locations) > 0 {
+		patch.Locations = &req.Locations
+	}
+	if len(req.Tags) > 0 {
+		patch.Tags = &req.Tags
 	}
+	if len(req.Images) > 0 {
+		patch.Images = &req.Images
+	}
+	return patch
+}
 
-	if req.Images != nil && len(req.Images) > 0 {
-		_, err = tx.Exec(`DELETE FROM entry_images WHERE entry_id = ?`, req.ID)
-		if err != nil {
-			utils.LM.Logger.Printf("Error deleting old images for entry %s: %v", req.ID, err)
-			return types.UpdateEntryResponse{Success: false}, err
-		}
-		for _, image := range req.Images {
-			imgQuery := `
-                INSERT INTO entry_images (entry_id, image_url)
-                VALUES (?, ?)
-            `
-			_, err = tx.Exec(imgQuery, req.ID, image)
-			if err != nil {
-				utils.LM.Logger.Printf("Error inserting image for entry %s: %v", req.ID, err)
-				return types.UpdateEntryResponse{Success: false}, err
-			}
+func updateEntry(store *db.Store, req types.UpdateEntryRequest, version int64, r *http.Request) (types.UpdateEntryResponse, error) {
+	key := db.EntryKey{ID: req.ID, UserID: req.UserID, Timestamp: req.Timestamp}
+	entry, err := store.Entries.Patch(key, updatePatch(req), version)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			utils.LM.Logger.Printf("Entry not found for update: id=%s, userId=%s, timestamp=%v", req.ID, req.UserID, req.Timestamp)
+			return types.UpdateEntryResponse{Success: false}, nil
 		}
+		return types.UpdateEntryResponse{Success: false}, err
 	}
+	pruneRevisions(store, req.UserID, req.ID)
 
 	go func() {
-		ip := r.Header.Get("X-Forwarded-For")
-		if ip == "" {
-			ip = r.RemoteAddr
-		}
-		metadata := map[string]string{
-			"source":       "api",
-			"client_ip":    ip,
-			"user_agent":   r.Header.Get("User-Agent"),
-			"app_version":  r.Header.Get("X-App-Version"),
-			"os_version":   r.Header.Get("X-OS-Version"),
-			"device_model": r.Header.Get("X-Device-Model"),
-		}
-		metadataJSON, _ := json.Marshal(metadata)
-		analyticsQuery := `
-            INSERT INTO analytics_events (
-                user_id, event_type, object_type, object_id, event_time, metadata
-            ) VALUES (?, ?, ?, ?, NOW(), ?)
-        `
-		_, err := db.SDB.Exec(analyticsQuery, req.UserID, "update_entry", "entry", req.ID, string(metadataJSON))
+		err := store.Events.Record(types.AnalyticsEvent{
+			UserID:     req.UserID,
+			EventType:  "update_entry",
+			ObjectType: "entry",
+			ObjectID:   req.ID,
+			Metadata:   utils.RequestMetadata(r),
+		})
 		if err != nil {
 			utils.LM.Logger.Printf("Analytics logging error for entry update %s: %v", req.ID, err)
 		}
 	}()
 
 	utils.LM.Logger.Printf("Successfully updated entry: id=%s, userId=%s", req.ID, req.UserID)
-	return types.UpdateEntryResponse{Success: true}, nil
+	return types.UpdateEntryResponse{Success: true, Version: entry.Version}, nil
 
 	//ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	//defer cancel()
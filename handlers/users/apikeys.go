@@ -0,0 +1,272 @@
+package userHandlers
+
+import (
+	"JourneyAppServer/apikeys"
+	"JourneyAppServer/db"
+	"JourneyAppServer/middleware"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	maxAPIKeyNameLength    = 100
+	maxAPIKeyExpiresInDays = 365
+)
+
+func CreateAPIKeyHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		username, ok := middleware.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req types.CreateAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > maxAPIKeyNameLength {
+			http.Error(w, "Name is required and must be at most 100 characters", http.StatusBadRequest)
+			return
+		}
+		if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAPIKeyExpiresInDays {
+			http.Error(w, "expiresInDays must be between 0 and 365", http.StatusBadRequest)
+			return
+		}
+		scopes, err := apikeys.ValidateScopes(req.Scopes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Scopes = scopes
+
+		response, err := createAPIKey(store, username, req, r)
+		if err != nil {
+			http.Error(w, "Error creating API key", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func createAPIKey(store *db.Store, username string, req types.CreateAPIKeyRequest, r *http.Request) (types.CreateAPIKeyResponse, error) {
+	user, err := store.Users.GetByUsername(username)
+	if err != nil {
+		utils.LM.Logger.Printf("Error fetching user for API key: username=%s, error=%v", username, err)
+		return types.CreateAPIKeyResponse{Success: false}, err
+	}
+
+	var expiresAt time.Time
+	if req.ExpiresInDays > 0 {
+		expiresAt = time.Now().UTC().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+	}
+
+	key, record, err := apikeys.Issue(store, user, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		utils.LM.Logger.Printf("Error issuing API key: username=%s, error=%v", username, err)
+		return types.CreateAPIKeyResponse{Success: false}, err
+	}
+
+	go recordAPIKeyEvent(store, r, user.UserID, "api_key_created", record)
+
+	return types.CreateAPIKeyResponse{
+		Success: true,
+		Key:     key,
+		APIKey:  record,
+	}, nil
+}
+
+func ListAPIKeysHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		username, ok := middleware.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		keys, err := store.APIKeys.List(username)
+		if err != nil {
+			utils.LM.Logger.Printf("Error listing API keys: username=%s, error=%v", username, err)
+			http.Error(w, "Error listing API keys", http.StatusInternalServerError)
+			return
+		}
+
+		response := types.ListAPIKeysResponse{APIKeys: []types.UserAPIKey{}}
+		response.APIKeys = append(response.APIKeys, keys...)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// RevokeAPIKeyHandler revokes one of the caller's keys, which may be the key
+// the request itself was made with.
+func RevokeAPIKeyHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		username, ok := middleware.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		keyID := r.PathValue("id")
+		err := store.APIKeys.Revoke(username, keyID, time.Now().UTC())
+		if err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				http.Error(w, "API key not found", http.StatusNotFound)
+				return
+			}
+			utils.LM.Logger.Printf("Error revoking API key: key=%s, error=%v", keyID, err)
+			http.Error(w, "Error revoking API key", http.StatusInternalServerError)
+			return
+		}
+
+		if user, err := store.Users.GetByUsername(username); err == nil {
+			go recordAPIKeyEvent(store, r, user.UserID, "api_key_revoked", types.UserAPIKey{ID: keyID})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.RevokeAPIKeyResponse{Success: true})
+	}
+}
+
+func recordAPIKeyEvent(store *db.Store, r *http.Request, userID, eventType string, key types.UserAPIKey) {
+	metadata := utils.RequestMetadata(r)
+	if key.Name != "" {
+		metadata["name"] = key.Name
+		metadata["scopes"] = strings.Join(key.Scopes, ",")
+	}
+	err := store.Events.Record(types.AnalyticsEvent{
+		UserID:     userID,
+		EventType:  eventType,
+		ObjectType: "api_key",
+		ObjectID:   key.ID,
+		Metadata:   metadata,
+	})
+	if err != nil {
+		utils.LM.Logger.Printf("Analytics logging error: %v", err)
+	}
+}
+
+// RotateAPIKeyHandler replaces a key with a new one; the old key keeps working
+// for the configured grace window. Any key may rotate itself, but rotating a
+// different key needs the account scope.
+func RotateAPIKeyHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		username, ok := middleware.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		currentID, _ := middleware.GetAPIKeyIDFromContext(r.Context())
+
+		var req types.RotateAPIKeyRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.KeyID == "" {
+			req.KeyID = currentID
+		}
+
+		if req.KeyID != currentID {
+			current, err := store.APIKeys.Get(username, currentID)
+			if err != nil {
+				utils.LM.Logger.Printf("Error fetching API key: key=%s, error=%v", currentID, err)
+				http.Error(w, "Error rotating API key", http.StatusInternalServerError)
+				return
+			}
+			if !apikeys.HasScope(current.Scopes, apikeys.ScopeAccount) {
+				http.Error(w, "Rotating another key needs the \"account\" scope", http.StatusForbidden)
+				return
+			}
+		}
+
+		response, err := rotateAPIKey(store, username, req, r)
+		if err != nil {
+			switch {
+			case errors.Is(err, db.ErrNotFound):
+				http.Error(w, "API key not found", http.StatusNotFound)
+			case errors.Is(err, apikeys.ErrAlreadyRotated):
+				http.Error(w, "API key has already been rotated", http.StatusConflict)
+			default:
+				http.Error(w, "Error rotating API key", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func rotateAPIKey(store *db.Store, username string, req types.RotateAPIKeyRequest, r *http.Request) (types.RotateAPIKeyResponse, error) {
+	user, err := store.Users.GetByUsername(username)
+	if err != nil {
+		utils.LM.Logger.Printf("Error fetching user for API key rotation: username=%s, error=%v", username, err)
+		return types.RotateAPIKeyResponse{Success: false}, err
+	}
+
+	old, err := store.APIKeys.Get(username, req.KeyID)
+	if err != nil {
+		return types.RotateAPIKeyResponse{Success: false}, err
+	}
+	if !old.RevokedAt.IsZero() {
+		return types.RotateAPIKeyResponse{Success: false}, db.ErrNotFound
+	}
+
+	key, record, err := apikeys.Rotate(store, user, old)
+	if err != nil {
+		if !errors.Is(err, apikeys.ErrAlreadyRotated) {
+			utils.LM.Logger.Printf("Error rotating API key: key=%s, error=%v", old.ID, err)
+		}
+		return types.RotateAPIKeyResponse{Success: false}, err
+	}
+
+	old, err = store.APIKeys.Get(username, old.ID)
+	if err != nil {
+		return types.RotateAPIKeyResponse{Success: false}, err
+	}
+
+	go recordAPIKeyEvent(store, r, user.UserID, "api_key_rotated", record)
+
+	return types.RotateAPIKeyResponse{
+		Success:              true,
+		Key:                  key,
+		APIKey:               record,
+		PreviousKeyExpiresAt: old.ExpiresAt,
+	}, nil
+}
@@ -0,0 +1,103 @@
+package userHandlers
+
+import (
+	"JourneyAppServer/apikeys"
+	"JourneyAppServer/internal/testutil"
+	"JourneyAppServer/middleware"
+	"JourneyAppServer/types"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRotatedKeyWorksUntilTheGraceWindowEnds(t *testing.T) {
+	store := newTestStore(t)
+	alice, err := store.Users.GetByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey, _, err := apikeys.Issue(store, alice, "ci", []string{apikeys.ScopeEntriesRead}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotate := middleware.ValidateAPIKeyMiddleware(store, "", RotateAPIKeyHandler(store))
+	read := middleware.ValidateAPIKeyMiddleware(store, apikeys.ScopeEntriesRead, func(w http.ResponseWriter, r *http.Request) {})
+	serve := func(handler http.HandlerFunc, method, key string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := testutil.Request(method, "/", "", nil)
+		req.Header.Set("X-API-Key", key)
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(rotate, http.MethodPost, oldKey)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rotate: status %d, body %q", rec.Code, rec.Body.String())
+	}
+	var response types.RotateAPIKeyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	graceEnds := response.PreviousKeyExpiresAt
+	if until := time.Until(graceEnds); until <= 71*time.Hour || until > 72*time.Hour {
+		t.Errorf("old key expires in %v, want the 72h grace window", until)
+	}
+
+	rec = serve(read, http.MethodGet, oldKey)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("old key within the grace window: status %d", rec.Code)
+	}
+	if got, want := rec.Header().Get(apikeys.RotatedHeader), graceEnds.UTC().Format(time.RFC3339); got != want {
+		t.Errorf("%s = %q, want %q", apikeys.RotatedHeader, got, want)
+	}
+
+	rec = serve(read, http.MethodGet, response.Key)
+	if rec.Code != http.StatusOK || rec.Header().Get(apikeys.RotatedHeader) != "" {
+		t.Errorf("new key: status %d, %s %q", rec.Code, apikeys.RotatedHeader, rec.Header().Get(apikeys.RotatedHeader))
+	}
+
+	if rec := serve(rotate, http.MethodPost, oldKey); rec.Code != http.StatusConflict {
+		t.Errorf("rotating the old key again: status %d, want 409", rec.Code)
+	}
+
+	if _, err := apikeys.Authenticate(store, oldKey, graceEnds.Add(time.Second)); !errors.Is(err, apikeys.ErrExpiredKey) {
+		t.Errorf("old key after the grace window: err = %v, want ErrExpiredKey", err)
+	}
+	if _, err := apikeys.Authenticate(store, response.Key, graceEnds.Add(time.Second)); err != nil {
+		t.Errorf("new key after the grace window: %v", err)
+	}
+}
+
+func TestRotateStoresNothingWhenTheNewKeyIsRejected(t *testing.T) {
+	store := newTestStore(t)
+	alice, err := store.Users.GetByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, old, err := apikeys.Issue(store, alice, "ci", apikeys.AllScopes, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A replacement with the old key's hash can't be inserted.
+	replacement := old
+	replacement.ID = "replacement-id"
+	if err := store.APIKeys.Rotate(old.ID, replacement, time.Now().Add(time.Hour)); err == nil {
+		t.Fatal("rotating to a duplicate key succeeded")
+	}
+
+	old, err = store.APIKeys.Get("alice", old.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.ReplacedBy != "" || !old.ExpiresAt.IsZero() {
+		t.Fatalf("old key was marked rotated: %+v", old)
+	}
+	if _, _, err := apikeys.Rotate(store, alice, old); err != nil {
+		t.Fatalf("retrying the rotation: %v", err)
+	}
+}
@@ -1,61 +1,43 @@
 package userHandlers
 
 import (
+	"JourneyAppServer/authz"
 	"JourneyAppServer/aws"
 	"JourneyAppServer/db"
 	"JourneyAppServer/types"
 	"JourneyAppServer/utils"
 	"encoding/json"
+	"errors"
 	"net/http"
 )
 
-func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
+func DeleteAccountHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
 
-	username := r.URL.Query().Get("user")
-	if username == "" {
-		http.Error(w, "Missing required param \"user\"", http.StatusBadRequest)
-		return
-	}
+		caller, ok := authz.Check(w, r, store, r.URL.Query().Get("user"), "")
+		if !ok {
+			return
+		}
+		username := caller.Username
 
-	response, err := deleteAccount(username, r)
-	if err != nil {
-		http.Error(w, "Error deleting account", http.StatusInternalServerError)
-		return
-	}
+		response, err := deleteAccount(store, username, r)
+		if err != nil {
+			http.Error(w, "Error deleting account", http.StatusInternalServerError)
+			return
+		}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
 }
 
-func deleteAccount(username string, r *http.Request) (types.DeleteAccountResponse, error) {
-	query := `
-        SELECT ei.image_url
-        FROM entries e
-        JOIN entry_images ei ON e.entry_id = ei.entry_id
-        WHERE e.username = ?
-    `
-	rows, err := db.SDB.Query(query, username)
+func deleteAccount(store *db.Store, username string, r *http.Request) (types.DeleteAccountResponse, error) {
+	imageKeys, err := store.Entries.UserImageKeys(username)
 	if err != nil {
-		utils.LM.Logger.Printf("Error querying entry images for user %s: %v", username, err)
-		return types.DeleteAccountResponse{Success: false}, err
-	}
-	defer rows.Close()
-
-	var imageKeys []string
-	for rows.Next() {
-		var imageKey string
-		if err := rows.Scan(&imageKey); err != nil {
-			utils.LM.Logger.Printf("Error scanning image key for user %s: %v", username, err)
-			return types.DeleteAccountResponse{Success: false}, err
-		}
-		imageKeys = append(imageKeys, imageKey)
-	}
-	if err := rows.Err(); err != nil {
-		utils.LM.Logger.Printf("Row iteration error for user %s: %v", username, err)
 		return types.DeleteAccountResponse{Success: false}, err
 	}
 
@@ -67,43 +49,23 @@ func deleteAccount(username string, r *http.Request) (types.DeleteAccountRespons
 		}
 	}
 
-	deleteQuery := `DELETE FROM users WHERE username = ?`
-	result, err := db.SDB.Exec(deleteQuery, username)
+	err = store.Users.Delete(username)
 	if err != nil {
-		utils.LM.Logger.Printf("Error deleting user %s from database: %v", username, err)
-		return types.DeleteAccountResponse{Success: false}, err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		utils.LM.Logger.Printf("Error checking rows affected for user %s: %v", username, err)
+		if errors.Is(err, db.ErrNotFound) {
+			utils.LM.Logger.Printf("No user found to delete for username %s", username)
+			return types.DeleteAccountResponse{Success: false}, nil
+		}
 		return types.DeleteAccountResponse{Success: false}, err
 	}
-	if rowsAffected == 0 {
-		utils.LM.Logger.Printf("No user found to delete for username %s", username)
-		return types.DeleteAccountResponse{Success: false}, nil
-	}
 
 	go func() {
-		ip := r.Header.Get("X-Forwarded-For")
-		if ip == "" {
-			ip = r.RemoteAddr
-		}
-		metadata := map[string]string{
-			"source":       "api",
-			"client_ip":    ip,
-			"user_agent":   r.Header.Get("User-Agent"),
-			"app_version":  r.Header.Get("X-App-Version"),
-			"os_version":   r.Header.Get("X-OS-Version"),
-			"device_model": r.Header.Get("X-Device-Model"),
-		}
-		metadataJSON, _ := json.Marshal(metadata)
-		analyticsQuery := `
-            INSERT INTO analytics_events (
-                user_id, event_type, object_type, object_id, event_time, metadata
-            ) VALUES (?, ?, ?, ?, NOW(), ?)
-        `
-		_, err := db.SDB.Exec(analyticsQuery, username, "delete account", "user", username, string(metadataJSON))
+		err := store.Events.Record(types.AnalyticsEvent{
+			UserID:     username,
+			EventType:  "delete account",
+			ObjectType: "user",
+			ObjectID:   username,
+			Metadata:   utils.RequestMetadata(r),
+		})
 		if err != nil {
 			utils.LM.Logger.Printf("Analytics logging error for delete account %s: %v", username, err)
 		}
@@ -0,0 +1,126 @@
+package userHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/e2ee"
+	"JourneyAppServer/lockout"
+	"JourneyAppServer/passwords"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// EncryptionStatusHandler reports whether E2EE is on and, if so, returns the
+// wrapped key so a newly signed-in device can unwrap it with the passphrase.
+func EncryptionStatusHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, ok := twoFactorUser(w, store, r)
+		if !ok {
+			return
+		}
+
+		enc, err := e2ee.Get(store, user.UserID)
+		if err != nil {
+			if errors.Is(err, e2ee.ErrNotEnabled) {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(types.EncryptionStatusResponse{Enabled: false})
+				return
+			}
+			utils.LM.Logger.Printf("Encryption lookup error: username=%s, error=%v", user.Username, err)
+			http.Error(w, "Error fetching encryption status", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.EncryptionStatusResponse{Enabled: true, Encryption: &enc})
+	}
+}
+
+// EnableEncryptionHandler turns E2EE on, or stores a re-wrapped key after the
+// passphrase changes. Overwriting the key could cut other devices off from
+// the journal, so the password is required, and wrong ones count towards the
+// login lockout.
+func EnableEncryptionHandler(store *db.Store, guard *lockout.Guard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req types.EnableEncryptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Password == "" {
+			http.Error(w, "password is required", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := twoFactorUser(w, store, r)
+		if !ok {
+			return
+		}
+		if !loginAllowed(w, guard, user.Username, r) {
+			return
+		}
+
+		isPasswordValid, err := passwords.Check(store, user, req.Password)
+		if err != nil {
+			utils.LM.Logger.Printf("Password check error: username=%s, error=%v", user.Username, err)
+			http.Error(w, "Error enabling encryption", http.StatusInternalServerError)
+			return
+		}
+		if !isPasswordValid {
+			utils.LM.Logger.Printf("Invalid password enabling encryption: username=%s, client_ip=%s", user.Username, utils.ClientIP(r))
+			if recordFailure(w, guard, user, r) {
+				http.Error(w, "Invalid password", http.StatusUnauthorized)
+			}
+			return
+		}
+
+		wasEnabled, err := e2ee.Enabled(store, user.UserID)
+		if err != nil {
+			utils.LM.Logger.Printf("Encryption lookup error: username=%s, error=%v", user.Username, err)
+			http.Error(w, "Error enabling encryption", http.StatusInternalServerError)
+			return
+		}
+		if err := e2ee.Enable(store, user.UserID, req); err != nil {
+			if e2ee.WriteError(w, err) {
+				return
+			}
+			utils.LM.Logger.Printf("Enable encryption error: username=%s, error=%v", user.Username, err)
+			http.Error(w, "Error enabling encryption", http.StatusInternalServerError)
+			return
+		}
+
+		eventType := "e2ee_enabled"
+		if wasEnabled {
+			eventType = "e2ee_key_rewrapped"
+		}
+		go recordEncryptionEvent(store, r, user.UserID, eventType)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.EnableEncryptionResponse{Success: true})
+	}
+}
+
+func recordEncryptionEvent(store *db.Store, r *http.Request, userID, eventType string) {
+	err := store.Events.Record(types.AnalyticsEvent{
+		UserID:     userID,
+		EventType:  eventType,
+		ObjectType: "user",
+		ObjectID:   userID,
+		Metadata:   utils.RequestMetadata(r),
+	})
+	if err != nil {
+		utils.LM.Logger.Printf("Analytics logging error: %v", err)
+	}
+}
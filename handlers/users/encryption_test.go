@@ -0,0 +1,42 @@
+package userHandlers
+
+import (
+	"JourneyAppServer/config"
+	"JourneyAppServer/internal/testutil"
+	"JourneyAppServer/lockout"
+	"JourneyAppServer/passwords"
+	"JourneyAppServer/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEnableEncryptionCountsWrongPasswordsTowardsLockout(t *testing.T) {
+	store := newTestStore(t)
+	hash, err := passwords.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Users.UpdatePassword("alice", hash, ""); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default().Login
+	cfg.DelayAfterFailures = 10
+	cfg.LockoutFailures = 3
+	handler := EnableEncryptionHandler(store, lockout.NewGuard(store, cfg))
+
+	req := types.EnableEncryptionRequest{Password: "wrong", WrappedKey: []byte("key"), Algorithm: "aes-256-gcm"}
+	for i := 0; i < cfg.LockoutFailures; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/users/e2ee", "alice", req))
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want 401", i+1, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/users/e2ee", "alice", req))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rec.Code)
+	}
+}
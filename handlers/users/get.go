@@ -1,60 +1,55 @@
 package userHandlers
 
 import (
+	"JourneyAppServer/authz"
 	"JourneyAppServer/db"
 	"JourneyAppServer/types"
 	"JourneyAppServer/utils"
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 )
 
-func GetUserHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
+func GetUserHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
 
-	username := r.URL.Query().Get("user")
-	if username == "" {
-		http.Error(w, "Missing required query param \"user\"", http.StatusBadRequest)
-		return
-	}
+		username := r.URL.Query().Get("user")
+		if username == "" {
+			http.Error(w, "Missing required query param \"user\"", http.StatusBadRequest)
+			return
+		}
+		if _, ok := authz.Check(w, r, store, username, ""); !ok {
+			return
+		}
 
-	response, err := getUser(username)
-	if err != nil {
-		http.Error(w, "Error fetching user", http.StatusInternalServerError)
-		return
-	}
+		response, err := getUser(store, username)
+		if err != nil {
+			http.Error(w, "Error fetching user", http.StatusInternalServerError)
+			return
+		}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
 }
 
-func getUser(username string) (types.User, error) {
-	var userResult types.User
-	query := `
-        SELECT user_id, username, password, salt, 
-               api_key, api_key_created, api_key_last_used, api_key_expires_at, font 
-        FROM users WHERE username = ?
-    `
-	err := db.SDB.QueryRow(query, username).Scan(
-		&userResult.UserID, &userResult.Username, &userResult.Password, &userResult.Salt,
-		&userResult.APIKey.Key, &userResult.APIKey.Created, &userResult.APIKey.LastUsed,
-		&userResult.APIKey.ExpiresAt, &userResult.Font,
-	)
+func getUser(store *db.Store, username string) (types.UserProfile, error) {
+	userResult, err := store.Users.GetByUsername(username)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, db.ErrNotFound) {
 			utils.LM.Logger.Printf("User not found in database: username=%s", username)
-			return types.User{}, fmt.Errorf("user not found: %s", username)
+			return types.UserProfile{}, fmt.Errorf("user not found: %s", username)
 		}
-		utils.LM.Logger.Printf("Error querying user from database: username=%s, error=%v", username, err)
-		return types.User{}, err
+		return types.UserProfile{}, err
 	}
 
 	utils.LM.Logger.Printf("Successfully retrieved user: username=%s", username)
-	return userResult, nil
+	return types.UserProfile{UserID: userResult.UserID, Username: userResult.Username, Font: userResult.Font}, nil
 
 	//ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	//defer cancel()
@@ -0,0 +1,75 @@
+package userHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/internal/testutil"
+	"JourneyAppServer/types"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestStore has alice and bob, with password hashes and salts that must
+// never be handed out.
+func newTestStore(t *testing.T) *db.Store {
+	t.Helper()
+	store := testutil.NewStore(t)
+	for _, name := range []string{"alice", "bob"} {
+		if err := store.Users.UpdatePassword(name, name+"-hash", name+"-salt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestGetUserIsForbiddenAcrossUsers(t *testing.T) {
+	store := newTestStore(t)
+	rec := httptest.NewRecorder()
+	GetUserHandler(store).ServeHTTP(rec, testutil.Request(http.MethodGet, "/api/users/get?user=alice", "bob", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "alice-hash") {
+		t.Fatalf("body leaks alice's password hash: %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	GetUserHandler(store).ServeHTTP(rec, testutil.Request(http.MethodGet, "/api/users/get?user=alice", "", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated: status = %d, want 401", rec.Code)
+	}
+}
+
+func TestGetUserLeavesOutSecrets(t *testing.T) {
+	store := newTestStore(t)
+	rec := httptest.NewRecorder()
+	GetUserHandler(store).ServeHTTP(rec, testutil.Request(http.MethodGet, "/api/users/get?user=alice", "alice", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %q)", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	for _, secret := range []string{"alice-hash", "alice-salt", "password", "apiKey"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("body has %q: %s", secret, body)
+		}
+	}
+	var profile types.UserProfile
+	if err := json.Unmarshal([]byte(body), &profile); err != nil || profile.UserID != "alice-id" {
+		t.Fatalf("profile = %+v, %v", profile, err)
+	}
+}
+
+func TestListUsersOnlyListsTheCaller(t *testing.T) {
+	store := newTestStore(t)
+	rec := httptest.NewRecorder()
+	ListUsersHandler(store).ServeHTTP(rec, testutil.Request(http.MethodGet, "/api/users/list", "bob", nil))
+	var users []types.UserListItem
+	if err := json.NewDecoder(rec.Body).Decode(&users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Username != "bob" {
+		t.Fatalf("users = %+v, want only bob", users)
+	}
+}
@@ -1,142 +1,146 @@
 package userHandlers
 
 import (
+	"JourneyAppServer/apikeys"
 	"JourneyAppServer/db"
+	"JourneyAppServer/lockout"
+	"JourneyAppServer/passwords"
+	"JourneyAppServer/sessions"
+	"JourneyAppServer/twofactor"
 	"JourneyAppServer/types"
 	"JourneyAppServer/utils"
-	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
+func LoginHandler(store *db.Store, guard *lockout.Guard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
 
-	var req types.LoginRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
+		var req types.LoginRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
 
-	if !utils.IsValidSessionOption(req.SessionOption) {
-		http.Error(w, "Invalid session option", http.StatusBadRequest)
-		return
-	}
+		if !utils.IsValidSessionOption(req.SessionOption) {
+			http.Error(w, "Invalid session option", http.StatusBadRequest)
+			return
+		}
 
-	fmt.Println("Incoming login request:", req.Username) // TODO: start maintaining logs of login requests when failed
+		if !loginAllowed(w, guard, req.Username, r) {
+			return
+		}
+
+		response, err := login(store, guard, req, r)
+		if err != nil {
+			http.Error(w, "Error logging in", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
 
-	response, err := login(req, r)
+// loginAllowed writes a 429 with Retry-After and returns false while the
+// account or client IP is locked out or has to wait before trying again.
+func loginAllowed(w http.ResponseWriter, guard *lockout.Guard, username string, r *http.Request) bool {
+	decision, err := guard.Check(username, utils.ClientIP(r), time.Now())
 	if err != nil {
+		utils.LM.Logger.Printf("Login attempt check error: %v", err)
 		http.Error(w, "Error logging in", http.StatusInternalServerError)
-		return
+		return false
 	}
+	if !decision.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+		if decision.Locked {
+			http.Error(w, "Too many failed login attempts; try again later", http.StatusTooManyRequests)
+		} else {
+			http.Error(w, "Too many failed login attempts; slow down", http.StatusTooManyRequests)
+		}
+		return false
+	}
+	return true
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+// recordFailure counts a wrong password or code given by a signed-in user
+// towards the login lockout. On an error it writes a 500 and returns false:
+// a failure that isn't counted would let guessing go on without limit.
+func recordFailure(w http.ResponseWriter, guard *lockout.Guard, user types.User, r *http.Request) bool {
+	if err := guard.RecordFailure(&user, user.Username, utils.ClientIP(r), time.Now()); err != nil {
+		utils.LM.Logger.Printf("Login attempt logging error: %v", err)
+		http.Error(w, "Error checking credentials", http.StatusInternalServerError)
+		return false
+	}
+	return true
 }
 
-func login(req types.LoginRequest, r *http.Request) (types.LoginResponse, error) {
-	var userResult types.User
-	query := `
-        SELECT user_id, username, password, salt, 
-               api_key, api_key_created, api_key_last_used, api_key_expires_at, font 
-        FROM users WHERE username = ?
-    `
-	err := db.SDB.QueryRow(query, req.Username).Scan(
-		&userResult.UserID, &userResult.Username, &userResult.Password, &userResult.Salt,
-		&userResult.APIKey.Key, &userResult.APIKey.Created, &userResult.APIKey.LastUsed,
-		&userResult.APIKey.ExpiresAt, &userResult.Font,
-	)
+func login(store *db.Store, guard *lockout.Guard, req types.LoginRequest, r *http.Request) (types.LoginResponse, error) {
+	clientIP := utils.ClientIP(r)
+
+	userResult, err := store.Users.GetByUsername(req.Username)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			utils.LM.Logger.Printf("User not found: username=%s", req.Username)
+		if errors.Is(err, db.ErrNotFound) {
+			utils.LM.Logger.Printf("User not found: username=%s, client_ip=%s", req.Username, clientIP)
+			if err := guard.RecordFailure(nil, req.Username, clientIP, time.Now()); err != nil {
+				utils.LM.Logger.Printf("Login attempt logging error: %v", err)
+				return types.LoginResponse{Success: false}, err
+			}
 			return types.LoginResponse{Success: false}, nil
 		}
-		utils.LM.Logger.Printf("Database query error: %v", err)
 		return types.LoginResponse{Success: false}, err
 	}
 
-	isPasswordValid := utils.CheckPasswordHash(req.Password+userResult.Salt, userResult.Password)
+	isPasswordValid, err := passwords.Check(store, userResult, req.Password)
+	if err != nil {
+		utils.LM.Logger.Printf("Password check error: username=%s, error=%v", req.Username, err)
+		return types.LoginResponse{Success: false}, err
+	}
 	if !isPasswordValid {
-		ip := r.Header.Get("X-Forwarded-For")
-		if ip == "" {
-			ip = r.RemoteAddr
-		}
 		utils.LM.Logger.Printf("Invalid password attempt: username=%s, client_ip=%s, user_agent=%s",
-			req.Username, ip, r.Header.Get("User-Agent"))
+			req.Username, clientIP, r.Header.Get("User-Agent"))
+		if err := guard.RecordFailure(&userResult, req.Username, clientIP, time.Now()); err != nil {
+			utils.LM.Logger.Printf("Login attempt logging error: %v", err)
+			return types.LoginResponse{Success: false}, err
+		}
 		return types.LoginResponse{Success: false}, nil
 	}
 
-	token, err := utils.GenerateAndStoreJWT(req.Username, req.SessionOption)
+	twoFactorEnabled, err := twofactor.Enabled(store, userResult.UserID)
 	if err != nil {
-		utils.LM.Logger.Printf("JWT generation error: %v", err)
+		utils.LM.Logger.Printf("Two-factor lookup error: username=%s, error=%v", req.Username, err)
 		return types.LoginResponse{Success: false}, err
 	}
-
-	APIKey := userResult.APIKey.Key
-	if utils.IsKeyRotationNeeded(&userResult.APIKey) {
-		newAPIKey, err := utils.GenerateSecureAPIKey()
+	if twoFactorEnabled {
+		// Failures stay on the books until the second factor is answered, so
+		// a known password doesn't reset the lockout on guessing codes.
+		challengeToken, expiresAt, err := twofactor.StartChallenge(store, userResult, req.SessionOption)
 		if err != nil {
-			utils.LM.Logger.Printf("API key rotation error: %v", err)
-		} else {
-			updateQuery := `
-                UPDATE users 
-                SET api_key = ?, api_key_created = ?, api_key_last_used = ?, api_key_expires_at = ?
-                WHERE username = ?
-            `
-			result, err := db.SDB.Exec(updateQuery, newAPIKey.Key, newAPIKey.Created, newAPIKey.LastUsed, newAPIKey.ExpiresAt, req.Username)
-			if err != nil {
-				utils.LM.Logger.Printf("API key update error: %v", err)
-			} else {
-				rowsAffected, err := result.RowsAffected()
-				if err == nil && rowsAffected == 1 {
-					APIKey = newAPIKey.Key
-				} else {
-					utils.LM.Logger.Printf("Unexpected API key update result: err=%v, rows=%d", err, rowsAffected)
-				}
-			}
+			utils.LM.Logger.Printf("Two-factor challenge error: username=%s, error=%v", req.Username, err)
+			return types.LoginResponse{Success: false}, err
 		}
+		utils.LM.Logger.Printf("Two-factor challenge issued: username=%s, client_ip=%s", req.Username, clientIP)
+		return types.LoginResponse{
+			Success:            false,
+			TwoFactorRequired:  true,
+			ChallengeToken:     challengeToken,
+			ChallengeExpiresAt: expiresAt,
+		}, nil
 	}
 
-	go func() {
-		ip := r.Header.Get("X-Forwarded-For")
-		if ip == "" {
-			ip = r.RemoteAddr
-		}
-		metadata := map[string]string{
-			"source":         "api",
-			"client_ip":      ip,
-			"user_agent":     r.Header.Get("User-Agent"),
-			"app_version":    r.Header.Get("X-App-Version"),
-			"os_version":     r.Header.Get("X-OS-Version"),
-			"device_model":   r.Header.Get("X-Device-Model"),
-			"session_option": req.SessionOption,
-		}
-		metadataJSON, _ := json.Marshal(metadata)
-		analyticsQuery := `
-            INSERT INTO analytics_events (
-                user_id, event_type, object_type, object_id, event_time, meta_data
-            ) VALUES (?, ?, ?, ?, NOW(), ?)
-        `
-		_, err := db.SDB.Exec(analyticsQuery, userResult.UserID, "login", "user", userResult.UserID, string(metadataJSON))
-		if err != nil {
-			utils.LM.Logger.Printf("Analytics logging error: %v", err)
-		}
-	}()
-
-	return types.LoginResponse{
-		UserID:   userResult.UserID,
-		Username: userResult.Username,
-		Success:  true,
-		Token:    token,
-		APIKey:   APIKey,
-		Font:     userResult.Font,
-	}, nil
+	if err := guard.RecordSuccess(req.Username, clientIP, time.Now()); err != nil {
+		utils.LM.Logger.Printf("Login attempt logging error: %v", err)
+	}
+	return completeLogin(store, userResult, req.SessionOption, "", r)
 
 	//
 	//ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -214,3 +218,49 @@ func login(req types.LoginRequest, r *http.Request) (types.LoginResponse, error)
 	//	Font:     userResult.Font,
 	//}, nil
 }
+
+// completeLogin starts a session for a user who has passed every factor.
+// secondFactor names the one used, if any, for analytics.
+func completeLogin(store *db.Store, user types.User, sessionOption, secondFactor string, r *http.Request) (types.LoginResponse, error) {
+	tokens, err := sessions.Start(store, user, sessionOption, sessions.DeviceFromRequest(r))
+	if err != nil {
+		utils.LM.Logger.Printf("Session start error: %v", err)
+		return types.LoginResponse{Success: false}, err
+	}
+
+	APIKey, err := apikeys.IssueLoginKey(store, user, tokens.SessionID)
+	if err != nil {
+		utils.LM.Logger.Printf("Issue API key error: %v", err)
+		return types.LoginResponse{Success: false}, err
+	}
+
+	go func() {
+		metadata := utils.RequestMetadata(r)
+		metadata["session_option"] = sessionOption
+		if secondFactor != "" {
+			metadata["two_factor"] = secondFactor
+		}
+		err := store.Events.Record(types.AnalyticsEvent{
+			UserID:     user.UserID,
+			EventType:  "login",
+			ObjectType: "user",
+			ObjectID:   user.UserID,
+			Metadata:   metadata,
+		})
+		if err != nil {
+			utils.LM.Logger.Printf("Analytics logging error: %v", err)
+		}
+	}()
+
+	return types.LoginResponse{
+		UserID:         user.UserID,
+		Username:       user.Username,
+		Success:        true,
+		Token:          tokens.AccessToken,
+		TokenExpiresAt: tokens.TokenExpiresAt,
+		RefreshToken:   tokens.RefreshToken,
+		SessionID:      tokens.SessionID,
+		APIKey:         APIKey,
+		Font:           user.Font,
+	}, nil
+}
@@ -0,0 +1,110 @@
+package userHandlers
+
+import (
+	"JourneyAppServer/apikeys"
+	"JourneyAppServer/config"
+	"JourneyAppServer/db"
+	"JourneyAppServer/internal/testutil"
+	"JourneyAppServer/lockout"
+	"JourneyAppServer/passwords"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// loginAs returns a func that logs alice in and returns the response.
+func loginAs(t *testing.T, store *db.Store) func() types.LoginResponse {
+	hash, err := passwords.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Users.UpdatePassword("alice", hash, ""); err != nil {
+		t.Fatal(err)
+	}
+	handler := LoginHandler(store, lockout.NewGuard(store, config.Default().Login))
+
+	return func() types.LoginResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := types.LoginRequest{Username: "alice", Password: "correct horse", SessionOption: "always"}
+		handler.ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/users/login", "", req))
+		var response types.LoginResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || !response.Success || response.APIKey == "" {
+			t.Fatalf("login: status %d, body %q", rec.Code, rec.Body.String())
+		}
+		return response
+	}
+}
+
+func TestLoginKeyIsRevokedWithItsSession(t *testing.T) {
+	store := newTestStore(t)
+	login := loginAs(t, store)
+
+	first := login()
+	record, err := apikeys.Authenticate(store, first.APIKey, time.Now())
+	if err != nil {
+		t.Fatalf("first key: %v", err)
+	}
+	session, err := store.Sessions.GetByRefreshHash(utils.HashToken(first.RefreshToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.SessionID != session.ID {
+		t.Fatalf("key session = %q, want %q", record.SessionID, session.ID)
+	}
+	if record.ExpiresAt.After(session.ExpiresAt) {
+		t.Errorf("key expires %v, after its session at %v", record.ExpiresAt, session.ExpiresAt)
+	}
+
+	// Logout revokes the one session.
+	if err := store.Sessions.Revoke(session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apikeys.Authenticate(store, first.APIKey, time.Now()); !errors.Is(err, apikeys.ErrRevokedKey) {
+		t.Fatalf("key after logout: err = %v, want ErrRevokedKey", err)
+	}
+
+	second := login()
+	if second.APIKey == first.APIKey {
+		t.Fatal("login handed out the revoked key again")
+	}
+	if _, err := store.APIKeys.Get("alice", record.ID); err == nil {
+		t.Error("revoked login key was not pruned")
+	}
+	if _, err := apikeys.Authenticate(store, second.APIKey, time.Now()); err != nil {
+		t.Fatalf("second key: %v", err)
+	}
+
+	// A password change revokes every session.
+	if err := store.Sessions.RevokeAllForUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apikeys.Authenticate(store, second.APIKey, time.Now()); !errors.Is(err, apikeys.ErrRevokedKey) {
+		t.Fatalf("key after password change: err = %v, want ErrRevokedKey", err)
+	}
+}
+
+func TestLoginCapsLiveLoginKeys(t *testing.T) {
+	store := newTestStore(t)
+	login := loginAs(t, store)
+
+	oldest := login()
+	for i := 0; i < 20; i++ {
+		login()
+	}
+	if _, err := apikeys.Authenticate(store, oldest.APIKey, time.Now()); !errors.Is(err, apikeys.ErrInvalidKey) {
+		t.Fatalf("oldest key: err = %v, want it revoked and pruned", err)
+	}
+	keys, err := store.APIKeys.List("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 20 {
+		t.Errorf("alice has %d keys, want 20", len(keys))
+	}
+}
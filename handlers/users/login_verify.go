@@ -0,0 +1,104 @@
+package userHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/lockout"
+	"JourneyAppServer/twofactor"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// VerifyLoginHandler is the second step of a login for accounts with 2FA. It
+// exchanges the challenge token from LoginHandler and a TOTP or recovery code
+// for a session.
+func VerifyLoginHandler(store *db.Store, guard *lockout.Guard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req types.VerifyLoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.ChallengeToken == "" || (req.Code == "") == (req.RecoveryCode == "") {
+			http.Error(w, "challengeToken and exactly one of code or recoveryCode are required", http.StatusBadRequest)
+			return
+		}
+
+		challenge, err := twofactor.Challenge(store, req.ChallengeToken)
+		if err != nil {
+			if errors.Is(err, twofactor.ErrInvalidChallenge) {
+				http.Error(w, "Invalid or expired login challenge", http.StatusUnauthorized)
+				return
+			}
+			utils.LM.Logger.Printf("Error fetching login challenge: %v", err)
+			http.Error(w, "Error logging in", http.StatusInternalServerError)
+			return
+		}
+
+		if !loginAllowed(w, guard, challenge.Username, r) {
+			return
+		}
+
+		response, err := verifyLogin(store, guard, challenge, req, r)
+		if err != nil {
+			if errors.Is(err, twofactor.ErrInvalidChallenge) {
+				http.Error(w, "Invalid or expired login challenge", http.StatusUnauthorized)
+				return
+			}
+			http.Error(w, "Error logging in", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func verifyLogin(store *db.Store, guard *lockout.Guard, challenge types.LoginChallenge, req types.VerifyLoginRequest, r *http.Request) (types.LoginResponse, error) {
+	clientIP := utils.ClientIP(r)
+
+	user, err := store.Users.GetByUsername(challenge.Username)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return types.LoginResponse{Success: false}, twofactor.ErrInvalidChallenge
+		}
+		return types.LoginResponse{Success: false}, err
+	}
+
+	err = twofactor.AnswerChallenge(store, challenge, req.Code, req.RecoveryCode)
+	if err != nil {
+		if errors.Is(err, twofactor.ErrInvalidCode) {
+			utils.LM.Logger.Printf("Invalid two-factor code: username=%s, client_ip=%s, user_agent=%s",
+				user.Username, clientIP, r.Header.Get("User-Agent"))
+			if err := guard.RecordFailure(&user, user.Username, clientIP, time.Now()); err != nil {
+				utils.LM.Logger.Printf("Login attempt logging error: %v", err)
+				return types.LoginResponse{Success: false}, err
+			}
+			return types.LoginResponse{Success: false, TwoFactorRequired: true}, nil
+		}
+		if errors.Is(err, twofactor.ErrNotEnrolled) {
+			// 2FA was turned off since the challenge was issued.
+			return types.LoginResponse{Success: false}, twofactor.ErrInvalidChallenge
+		}
+		utils.LM.Logger.Printf("Two-factor verification error: username=%s, error=%v", user.Username, err)
+		return types.LoginResponse{Success: false}, err
+	}
+
+	if err := guard.RecordSuccess(user.Username, clientIP, time.Now()); err != nil {
+		utils.LM.Logger.Printf("Login attempt logging error: %v", err)
+	}
+
+	secondFactor := "totp"
+	if req.RecoveryCode != "" {
+		secondFactor = "recovery_code"
+	}
+	return completeLogin(store, user, challenge.SessionOption, secondFactor, r)
+}
@@ -0,0 +1,203 @@
+package userHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/lockout"
+	"JourneyAppServer/middleware"
+	"JourneyAppServer/passwords"
+	"JourneyAppServer/sessions"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ChangePasswordHandler sets a new password for the caller after checking the
+// current one. Every session is revoked and a new one is returned for this
+// device.
+func ChangePasswordHandler(store *db.Store, guard *lockout.Guard, manager *passwords.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		username, ok := middleware.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req types.ChangePasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !utils.IsValidSessionOption(req.SessionOption) {
+			http.Error(w, "Invalid session option", http.StatusBadRequest)
+			return
+		}
+		if err := manager.Validate(req.NewPassword); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Wrong current passwords count towards the login lockout, so a stolen
+		// session can't be used to guess the password.
+		if !loginAllowed(w, guard, username, r) {
+			return
+		}
+
+		response, err := changePassword(store, guard, manager, username, req, r)
+		if err != nil {
+			http.Error(w, "Error changing password", http.StatusInternalServerError)
+			return
+		}
+		if !response.Success {
+			http.Error(w, "Current password is incorrect", http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func changePassword(store *db.Store, guard *lockout.Guard, manager *passwords.Manager, username string, req types.ChangePasswordRequest, r *http.Request) (types.ChangePasswordResponse, error) {
+	clientIP := utils.ClientIP(r)
+
+	user, err := store.Users.GetByUsername(username)
+	if err != nil {
+		utils.LM.Logger.Printf("Error fetching user for password change: username=%s, error=%v", username, err)
+		return types.ChangePasswordResponse{Success: false}, err
+	}
+
+	isPasswordValid, err := passwords.Check(store, user, req.CurrentPassword)
+	if err != nil {
+		utils.LM.Logger.Printf("Password check error: username=%s, error=%v", username, err)
+		return types.ChangePasswordResponse{Success: false}, err
+	}
+	if !isPasswordValid {
+		utils.LM.Logger.Printf("Invalid current password on password change: username=%s, client_ip=%s", username, clientIP)
+		if err := guard.RecordFailure(&user, username, clientIP, time.Now()); err != nil {
+			utils.LM.Logger.Printf("Login attempt logging error: %v", err)
+			return types.ChangePasswordResponse{Success: false}, err
+		}
+		return types.ChangePasswordResponse{Success: false}, nil
+	}
+
+	if err := manager.Set(user, req.NewPassword); err != nil {
+		utils.LM.Logger.Printf("Error changing password: username=%s, error=%v", username, err)
+		return types.ChangePasswordResponse{Success: false}, err
+	}
+
+	tokens, err := sessions.Start(store, user, req.SessionOption, sessions.DeviceFromRequest(r))
+	if err != nil {
+		utils.LM.Logger.Printf("Session start error: %v", err)
+		return types.ChangePasswordResponse{Success: false}, err
+	}
+
+	go recordPasswordEvent(store, r, user.UserID, "password_changed")
+
+	return types.ChangePasswordResponse{
+		Success:        true,
+		Token:          tokens.AccessToken,
+		TokenExpiresAt: tokens.TokenExpiresAt,
+		RefreshToken:   tokens.RefreshToken,
+		SessionID:      tokens.SessionID,
+	}, nil
+}
+
+// ForgotPasswordHandler sends a reset token to the account's owner. It answers
+// the same way whether or not the username exists.
+func ForgotPasswordHandler(store *db.Store, manager *passwords.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req types.ForgotPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		clientIP := utils.ClientIP(r)
+		// Sending happens in the background so the response time doesn't
+		// reveal whether the account exists.
+		go func() {
+			user, err := store.Users.GetByUsername(req.Username)
+			if err != nil {
+				if !errors.Is(err, db.ErrNotFound) {
+					utils.LM.Logger.Printf("Error fetching user for password reset: username=%s, error=%v", req.Username, err)
+				}
+				return
+			}
+			if err := manager.RequestReset(user, clientIP); err != nil {
+				utils.LM.Logger.Printf("Error sending password reset: username=%s, error=%v", req.Username, err)
+				return
+			}
+			utils.LM.Logger.Printf("Password reset requested: username=%s, client_ip=%s", req.Username, clientIP)
+			recordPasswordEvent(store, r, user.UserID, "password_reset_requested")
+		}()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.ForgotPasswordResponse{Success: true})
+	}
+}
+
+// ResetPasswordHandler sets a new password with a reset token. It signs every
+// device out and lifts any login lockout; the client logs in again afterwards.
+func ResetPasswordHandler(store *db.Store, guard *lockout.Guard, manager *passwords.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req types.ResetPasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		user, err := manager.Reset(req.Token, req.NewPassword)
+		if err != nil {
+			switch {
+			case errors.Is(err, passwords.ErrTooShort):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, passwords.ErrInvalidToken):
+				http.Error(w, "Invalid or expired password reset token", http.StatusBadRequest)
+			default:
+				utils.LM.Logger.Printf("Error resetting password: %v", err)
+				http.Error(w, "Error resetting password", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if err := guard.UnlockUser(user.Username); err != nil {
+			utils.LM.Logger.Printf("Error lifting lockout after password reset: username=%s, error=%v", user.Username, err)
+		}
+
+		go recordPasswordEvent(store, r, user.UserID, "password_reset")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.ResetPasswordResponse{Success: true})
+	}
+}
+
+func recordPasswordEvent(store *db.Store, r *http.Request, userID, eventType string) {
+	err := store.Events.Record(types.AnalyticsEvent{
+		UserID:     userID,
+		EventType:  eventType,
+		ObjectType: "user",
+		ObjectID:   userID,
+		Metadata:   utils.RequestMetadata(r),
+	})
+	if err != nil {
+		utils.LM.Logger.Printf("Analytics logging error: %v", err)
+	}
+}
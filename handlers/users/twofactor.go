@@ -0,0 +1,230 @@
+package userHandlers
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/lockout"
+	"JourneyAppServer/middleware"
+	"JourneyAppServer/passwords"
+	"JourneyAppServer/twofactor"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+func TwoFactorStatusHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, ok := twoFactorUser(w, store, r)
+		if !ok {
+			return
+		}
+
+		enabled, err := twofactor.Enabled(store, user.UserID)
+		if err != nil {
+			utils.LM.Logger.Printf("Two-factor lookup error: username=%s, error=%v", user.Username, err)
+			http.Error(w, "Error fetching two-factor status", http.StatusInternalServerError)
+			return
+		}
+		response := types.TwoFactorStatusResponse{Enabled: enabled}
+		if enabled {
+			response.RecoveryCodesRemaining, err = twofactor.RecoveryCodesRemaining(store, user.UserID)
+			if err != nil {
+				utils.LM.Logger.Printf("Recovery code count error: username=%s, error=%v", user.Username, err)
+				http.Error(w, "Error fetching two-factor status", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// EnrollTwoFactorHandler starts enrollment. The secret and otpauth URI are
+// shown to the user (usually as a QR code); nothing changes for logins until
+// ConfirmTwoFactorHandler accepts a code from it.
+func EnrollTwoFactorHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, ok := twoFactorUser(w, store, r)
+		if !ok {
+			return
+		}
+
+		secret, uri, err := twofactor.Enroll(store, user)
+		if err != nil {
+			if errors.Is(err, twofactor.ErrAlreadyEnabled) {
+				http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+				return
+			}
+			utils.LM.Logger.Printf("Two-factor enrollment error: username=%s, error=%v", user.Username, err)
+			http.Error(w, "Error enrolling two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.EnrollTwoFactorResponse{
+			Success:    true,
+			Secret:     secret,
+			OTPAuthURI: uri,
+		})
+	}
+}
+
+// ConfirmTwoFactorHandler enables 2FA and returns the recovery codes, which
+// are never shown again.
+func ConfirmTwoFactorHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req types.ConfirmTwoFactorRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := twoFactorUser(w, store, r)
+		if !ok {
+			return
+		}
+
+		codes, err := twofactor.Confirm(store, user, req.Code)
+		if err != nil {
+			switch {
+			case errors.Is(err, twofactor.ErrInvalidCode):
+				http.Error(w, "Invalid two-factor code", http.StatusBadRequest)
+			case errors.Is(err, twofactor.ErrNotEnrolled):
+				http.Error(w, "Two-factor enrollment has not been started", http.StatusConflict)
+			case errors.Is(err, twofactor.ErrAlreadyEnabled):
+				http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			default:
+				utils.LM.Logger.Printf("Two-factor confirmation error: username=%s, error=%v", user.Username, err)
+				http.Error(w, "Error enabling two-factor authentication", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		go recordTwoFactorEvent(store, r, user.UserID, "two_factor_enabled")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.ConfirmTwoFactorResponse{
+			Success:       true,
+			RecoveryCodes: codes,
+		})
+	}
+}
+
+// DisableTwoFactorHandler turns 2FA off. A stolen session alone isn't enough:
+// the password and a current or recovery code are required, and wrong ones
+// count towards the login lockout so they can't be guessed.
+func DisableTwoFactorHandler(store *db.Store, guard *lockout.Guard) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req types.DisableTwoFactorRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Password == "" || (req.Code == "") == (req.RecoveryCode == "") {
+			http.Error(w, "password and exactly one of code or recoveryCode are required", http.StatusBadRequest)
+			return
+		}
+
+		user, ok := twoFactorUser(w, store, r)
+		if !ok {
+			return
+		}
+		if !loginAllowed(w, guard, user.Username, r) {
+			return
+		}
+
+		isPasswordValid, err := passwords.Check(store, user, req.Password)
+		if err != nil {
+			utils.LM.Logger.Printf("Password check error: username=%s, error=%v", user.Username, err)
+			http.Error(w, "Error disabling two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+		if !isPasswordValid {
+			utils.LM.Logger.Printf("Invalid password disabling two-factor: username=%s, client_ip=%s", user.Username, utils.ClientIP(r))
+			if recordFailure(w, guard, user, r) {
+				http.Error(w, "Invalid password or code", http.StatusUnauthorized)
+			}
+			return
+		}
+		if err := twofactor.Verify(store, user.UserID, req.Code, req.RecoveryCode); err != nil {
+			switch {
+			case errors.Is(err, twofactor.ErrInvalidCode):
+				utils.LM.Logger.Printf("Invalid code disabling two-factor: username=%s, client_ip=%s", user.Username, utils.ClientIP(r))
+				if recordFailure(w, guard, user, r) {
+					http.Error(w, "Invalid password or code", http.StatusUnauthorized)
+				}
+			case errors.Is(err, twofactor.ErrNotEnrolled):
+				http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+			default:
+				utils.LM.Logger.Printf("Two-factor verification error: username=%s, error=%v", user.Username, err)
+				http.Error(w, "Error disabling two-factor authentication", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if err := twofactor.Disable(store, user.UserID); err != nil && !errors.Is(err, twofactor.ErrNotEnrolled) {
+			utils.LM.Logger.Printf("Two-factor disable error: username=%s, error=%v", user.Username, err)
+			http.Error(w, "Error disabling two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+
+		go recordTwoFactorEvent(store, r, user.UserID, "two_factor_disabled")
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.DisableTwoFactorResponse{Success: true})
+	}
+}
+
+// twoFactorUser loads the authenticated caller, writing an error if it can't.
+func twoFactorUser(w http.ResponseWriter, store *db.Store, r *http.Request) (types.User, bool) {
+	username, ok := middleware.GetUsernameFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return types.User{}, false
+	}
+	user, err := store.Users.GetByUsername(username)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return types.User{}, false
+		}
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return types.User{}, false
+	}
+	return user, true
+}
+
+func recordTwoFactorEvent(store *db.Store, r *http.Request, userID, eventType string) {
+	err := store.Events.Record(types.AnalyticsEvent{
+		UserID:     userID,
+		EventType:  eventType,
+		ObjectType: "user",
+		ObjectID:   userID,
+		Metadata:   utils.RequestMetadata(r),
+	})
+	if err != nil {
+		utils.LM.Logger.Printf("Analytics logging error: %v", err)
+	}
+}
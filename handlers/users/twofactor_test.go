@@ -0,0 +1,44 @@
+package userHandlers
+
+import (
+	"JourneyAppServer/config"
+	"JourneyAppServer/internal/testutil"
+	"JourneyAppServer/lockout"
+	"JourneyAppServer/passwords"
+	"JourneyAppServer/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDisableTwoFactorCountsWrongPasswordsTowardsLockout(t *testing.T) {
+	store := newTestStore(t)
+	hash, err := passwords.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Users.UpdatePassword("alice", hash, ""); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default().Login
+	cfg.DelayAfterFailures = 10
+	cfg.LockoutFailures = 3
+	handler := DisableTwoFactorHandler(store, lockout.NewGuard(store, cfg))
+
+	wrong := types.DisableTwoFactorRequest{Password: "wrong", Code: "123456"}
+	for i := 0; i < cfg.LockoutFailures; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/users/2fa/disable", "alice", wrong))
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want 401", i+1, rec.Code)
+		}
+	}
+
+	// Locked now, so even the right password is turned away.
+	right := types.DisableTwoFactorRequest{Password: "correct horse", Code: "123456"}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, testutil.Request(http.MethodPost, "/api/users/2fa/disable", "alice", right))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rec.Code)
+	}
+}
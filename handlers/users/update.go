@@ -1,68 +1,56 @@
 package userHandlers
 
 import (
+	"JourneyAppServer/apikeys"
 	"JourneyAppServer/db"
+	"JourneyAppServer/passwords"
+	"JourneyAppServer/sessions"
 	"JourneyAppServer/types"
 	"JourneyAppServer/utils"
-	"context"
 	"encoding/json"
 	"fmt"
-	"go.mongodb.org/mongo-driver/bson"
 	"net/http"
-	"time"
 )
 
-func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
+func UpdateUserHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
 
-	var req types.UpdateUserRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
+		var req types.UpdateUserRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
 
-	response, err := updateUser(req)
-	if err != nil {
-		http.Error(w, "Error updating user", http.StatusInternalServerError)
-		return
-	}
+		if !utils.IsValidSessionOption(req.SessionOption) {
+			http.Error(w, "Invalid session option", http.StatusBadRequest)
+			return
+		}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
-
-func updateUser(req types.UpdateUserRequest) (types.UpdateUserResponse, error) {
-	update := bson.M{}
+		response, err := updateUser(store, req, r)
+		if err != nil {
+			http.Error(w, "Error updating user", http.StatusInternalServerError)
+			return
+		}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	salt, err := utils.GenerateSalt(10)
-	if err != nil {
-		fmt.Println("Error generating salt...", err)
-		return types.UpdateUserResponse{
-			Success: false,
-		}, err
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
 	}
-	fmt.Println("Salt:", salt)
-	update["salt"] = salt
+}
 
-	hashedPassword, err := utils.HashPassword(req.Password + salt)
+func updateUser(store *db.Store, req types.UpdateUserRequest, r *http.Request) (types.UpdateUserResponse, error) {
+	hashedPassword, err := passwords.Hash(req.Password)
 	if err != nil {
-		fmt.Println("Error hashing password+salt:", err)
+		fmt.Println("Error hashing password:", err)
 
 		return types.UpdateUserResponse{
 			Success: false,
 		}, err
 	}
-	fmt.Println("Hashed password:", hashedPassword)
-	update["password"] = hashedPassword
-
-	collection := db.MongoClient.Database(db.DbName).Collection(db.UserCollection)
 
 	//apiKey, err := utils.GenerateSecureAPIKey()
 	//if err != nil {
@@ -72,27 +60,52 @@ func updateUser(req types.UpdateUserRequest) (types.UpdateUserResponse, error) {
 	//	}, err
 	//}
 	//update["apiKey"] = *apiKey
-	//
-	token, err := utils.GenerateAndStoreJWT(req.Username, req.SessionOption)
+
+	err = store.Users.UpdatePassword(req.Username, hashedPassword, "")
 	if err != nil {
-		fmt.Println("Error generating JWT: ", err)
+		fmt.Println("Error attempting to update user: ", err)
 		return types.UpdateUserResponse{
 			Success: false,
 		}, err
 	}
 
-	var user types.User
-	err = collection.FindOneAndUpdate(ctx, bson.M{"username": req.Username}, bson.M{"$set": update}).Decode(&user)
+	user, err := store.Users.GetByUsername(req.Username)
 	if err != nil {
-		fmt.Println("Error attempting to update user: ", err)
+		fmt.Println("Error fetching updated user: ", err)
+		return types.UpdateUserResponse{
+			Success: false,
+		}, err
+	}
+
+	// A new password signs every other device out.
+	if err := store.Sessions.RevokeAllForUser(req.Username); err != nil {
+		fmt.Println("Error revoking sessions: ", err)
+		return types.UpdateUserResponse{
+			Success: false,
+		}, err
+	}
+
+	tokens, err := sessions.Start(store, user, req.SessionOption, sessions.DeviceFromRequest(r))
+	if err != nil {
+		fmt.Println("Error starting session: ", err)
+		return types.UpdateUserResponse{
+			Success: false,
+		}, err
+	}
+
+	apiKey, err := apikeys.IssueLoginKey(store, user, tokens.SessionID)
+	if err != nil {
+		fmt.Println("Error issuing API key: ", err)
 		return types.UpdateUserResponse{
 			Success: false,
 		}, err
 	}
 
 	return types.UpdateUserResponse{
-		Success: true,
-		Token:   token,
-		APIKey:  user.APIKey.Key,
+		Success:        true,
+		Token:          tokens.AccessToken,
+		TokenExpiresAt: tokens.TokenExpiresAt,
+		RefreshToken:   tokens.RefreshToken,
+		APIKey:         apiKey,
 	}, nil
 }
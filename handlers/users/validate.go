@@ -3,49 +3,41 @@ package userHandlers
 import (
 	"JourneyAppServer/db"
 	"JourneyAppServer/types"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
 )
 
-func ValidateUsernameHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
+func ValidateUsernameHandler(store *db.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
 
-	var req types.ValidateUsernameRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
+		var req types.ValidateUsernameRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
 
-	fmt.Println("Username: ", req.Username)
+		fmt.Println("Username: ", req.Username)
 
-	response, err := validateUsername(req)
-	if err != nil {
-		http.Error(w, "Error validating username", http.StatusInternalServerError)
-		return
-	}
+		response, err := validateUsername(store, req)
+		if err != nil {
+			http.Error(w, "Error validating username", http.StatusInternalServerError)
+			return
+		}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
 }
 
-func validateUsername(req types.ValidateUsernameRequest) (types.ValidateUsernameResponse, error) {
-	var exists bool
-
-	query := `SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)`
-
-	err := db.SDB.QueryRow(query, req.Username).Scan(&exists)
+func validateUsername(store *db.Store, req types.ValidateUsernameRequest) (types.ValidateUsernameResponse, error) {
+	exists, err := store.Users.UsernameExists(req.Username)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return types.ValidateUsernameResponse{
-				UsernameAvailable: true,
-			}, nil
-		}
 		return types.ValidateUsernameResponse{
 			UsernameAvailable: false,
 		}, err
@@ -0,0 +1,47 @@
+// Package testutil holds the fixtures shared by the handler tests.
+package testutil
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// AddUsers creates alice (alice-id) and bob (bob-id) in store.
+func AddUsers(t testing.TB, store *db.Store) *db.Store {
+	t.Helper()
+	for _, u := range []types.User{
+		{UserID: "alice-id", Username: "alice"},
+		{UserID: "bob-id", Username: "bob"},
+	} {
+		if err := store.Users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+// NewStore returns a memory store with alice and bob in it.
+func NewStore(t testing.TB) *db.Store {
+	t.Helper()
+	return AddUsers(t, db.NewMemoryStore())
+}
+
+// Request builds a request as the auth middleware would hand it on: with the
+// authenticated username, if any, in the context and body encoded as JSON.
+func Request(method, target, username string, body interface{}) *http.Request {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	r := httptest.NewRequest(method, target, &buf)
+	if username != "" {
+		r = r.WithContext(context.WithValue(r.Context(), types.UsernameContextKey, username))
+	}
+	return r
+}
@@ -0,0 +1,180 @@
+// Package lockout slows down and then locks out repeated failed logins, per
+// account and per client IP.
+package lockout
+
+import (
+	"JourneyAppServer/config"
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"errors"
+	"strconv"
+	"time"
+)
+
+type Guard struct {
+	store *db.Store
+	cfg   config.LoginConfig
+}
+
+func NewGuard(store *db.Store, cfg config.LoginConfig) *Guard {
+	return &Guard{store: store, cfg: cfg}
+}
+
+// Decision says whether a login attempt may go ahead. When it may not,
+// RetryAfter says how long the client should wait.
+type Decision struct {
+	Allowed    bool
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func UserKey(username string) string { return "user:" + username }
+func IPKey(clientIP string) string   { return "ip:" + clientIP }
+
+func (g *Guard) window() time.Duration {
+	return time.Duration(g.cfg.WindowMinutes) * time.Minute
+}
+
+// delayFor is the wait required after the given number of failures: nothing
+// up to DelayAfterFailures, then 1s, 2s, 4s, ... capped at MaxDelaySeconds.
+func (g *Guard) delayFor(failures int) time.Duration {
+	over := failures - g.cfg.DelayAfterFailures
+	if over <= 0 {
+		return 0
+	}
+	maxDelay := time.Duration(g.cfg.MaxDelaySeconds) * time.Second
+	if over > 30 {
+		return maxDelay
+	}
+	delay := time.Second << (over - 1)
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+// Check runs before the password is verified, so a locked or throttled
+// client learns nothing about whether its guess was right.
+func (g *Guard) Check(username, clientIP string, now time.Time) (Decision, error) {
+	for _, key := range []string{UserKey(username), IPKey(clientIP)} {
+		until, err := g.store.LoginAttempts.LockedUntil(key)
+		if err != nil {
+			return Decision{}, err
+		}
+		if now.Before(until) {
+			return Decision{Locked: true, RetryAfter: until.Sub(now)}, nil
+		}
+	}
+
+	byUser, _, err := g.store.LoginAttempts.Failures(username, clientIP, now.Add(-g.window()))
+	if err != nil {
+		return Decision{}, err
+	}
+	if delay := g.delayFor(byUser.Count); delay > 0 {
+		if wait := byUser.Last.Add(delay).Sub(now); wait > 0 {
+			return Decision{RetryAfter: wait}, nil
+		}
+	}
+	return Decision{Allowed: true}, nil
+}
+
+// RecordFailure logs a failed attempt and locks the account or IP once it
+// crosses its threshold. user is nil when the username doesn't exist; those
+// attempts still count so lockouts don't reveal which accounts are real.
+func (g *Guard) RecordFailure(user *types.User, username, clientIP string, now time.Time) error {
+	err := g.store.LoginAttempts.Record(types.LoginAttempt{
+		Username:    username,
+		ClientIP:    clientIP,
+		AttemptedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	byUser, byIP, err := g.store.LoginAttempts.Failures(username, clientIP, now.Add(-g.window()))
+	if err != nil {
+		return err
+	}
+
+	until := now.Add(time.Duration(g.cfg.LockoutMinutes) * time.Minute)
+	if byUser.Count >= g.cfg.LockoutFailures {
+		if err := g.store.LoginAttempts.Lock(UserKey(username), until); err != nil {
+			return err
+		}
+		utils.LM.Logger.Printf("Account locked after %d failed logins: username=%s, client_ip=%s, until=%v", byUser.Count, username, clientIP, until)
+		if user != nil {
+			g.recordEvent(user.UserID, "account_locked", map[string]string{
+				"client_ip":    clientIP,
+				"failures":     strconv.Itoa(byUser.Count),
+				"locked_until": until.Format(time.RFC3339),
+			})
+		}
+	}
+	if byIP.Count >= g.cfg.IPLockoutFailures {
+		if err := g.store.LoginAttempts.Lock(IPKey(clientIP), until); err != nil {
+			return err
+		}
+		utils.LM.Logger.Printf("Client IP locked after %d failed logins: client_ip=%s, until=%v", byIP.Count, clientIP, until)
+		if user != nil {
+			g.recordEvent(user.UserID, "ip_locked", map[string]string{
+				"client_ip":    clientIP,
+				"failures":     strconv.Itoa(byIP.Count),
+				"locked_until": until.Format(time.RFC3339),
+			})
+		}
+	}
+	return nil
+}
+
+// RecordSuccess logs a successful attempt and resets the account's failures.
+func (g *Guard) RecordSuccess(username, clientIP string, now time.Time) error {
+	err := g.store.LoginAttempts.Record(types.LoginAttempt{
+		Username:    username,
+		ClientIP:    clientIP,
+		Succeeded:   true,
+		AttemptedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+	return g.store.LoginAttempts.ClearUser(username)
+}
+
+// UnlockUser lifts an account lockout and forgets its failures.
+func (g *Guard) UnlockUser(username string) error {
+	err := g.store.LoginAttempts.Unlock(UserKey(username))
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+	if err := g.store.LoginAttempts.ClearUser(username); err != nil {
+		return err
+	}
+	if user, err := g.store.Users.GetByUsername(username); err == nil {
+		g.recordEvent(user.UserID, "account_unlocked", map[string]string{})
+	}
+	return nil
+}
+
+// UnlockIP lifts a client IP lockout and forgets its failures.
+func (g *Guard) UnlockIP(clientIP string) error {
+	err := g.store.LoginAttempts.Unlock(IPKey(clientIP))
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+	return g.store.LoginAttempts.ClearIP(clientIP)
+}
+
+func (g *Guard) recordEvent(userID, eventType string, metadata map[string]string) {
+	metadata["source"] = "api"
+	err := g.store.Events.Record(types.AnalyticsEvent{
+		UserID:     userID,
+		EventType:  eventType,
+		ObjectType: "user",
+		ObjectID:   userID,
+		Metadata:   metadata,
+	})
+	if err != nil {
+		utils.LM.Logger.Printf("Analytics logging error for %s: %v", eventType, err)
+	}
+}
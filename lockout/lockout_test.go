@@ -0,0 +1,238 @@
+package lockout
+
+import (
+	"JourneyAppServer/config"
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// recordedEvents keeps the analytics events a Guard records.
+type recordedEvents []types.AnalyticsEvent
+
+func (r *recordedEvents) Record(event types.AnalyticsEvent) error {
+	*r = append(*r, event)
+	return nil
+}
+
+func newTestGuard(t *testing.T) (*Guard, *recordedEvents, *types.User) {
+	t.Helper()
+	store := db.NewMemoryStore()
+	events := &recordedEvents{}
+	store.Events = events
+	alice := types.User{UserID: "alice-id", Username: "alice"}
+	if err := store.Users.Create(alice); err != nil {
+		t.Fatal(err)
+	}
+	return NewGuard(store, config.Default().Login), events, &alice
+}
+
+func fail(t *testing.T, g *Guard, user *types.User, username, clientIP string, times int, at time.Time) {
+	t.Helper()
+	for i := 0; i < times; i++ {
+		if err := g.RecordFailure(user, username, clientIP, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDelayProgression(t *testing.T) {
+	g, _, _ := newTestGuard(t)
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{8, 16 * time.Second},
+		{9, 30 * time.Second},
+		{50, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := g.delayFor(tt.failures); got != tt.want {
+			t.Errorf("delayFor(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestCheckMakesClientsWaitOutTheDelay(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		failures int
+		after    time.Duration
+		allowed  bool
+	}{
+		{"below the threshold", 3, 0, true},
+		{"first delay", 4, 500 * time.Millisecond, false},
+		{"first delay over", 4, time.Second, true},
+		{"doubled delay", 5, 1500 * time.Millisecond, false},
+		{"doubled delay over", 5, 2 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, _, alice := newTestGuard(t)
+			fail(t, g, alice, "alice", "192.0.2.1", tt.failures, now)
+
+			d, err := g.Check("alice", "192.0.2.1", now.Add(tt.after))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Allowed != tt.allowed || d.Locked {
+				t.Fatalf("decision = %+v, want allowed %v and not locked", d, tt.allowed)
+			}
+			if !d.Allowed && d.RetryAfter != g.delayFor(tt.failures)-tt.after {
+				t.Errorf("retry after = %v, want %v", d.RetryAfter, g.delayFor(tt.failures)-tt.after)
+			}
+		})
+	}
+}
+
+func TestLockoutThresholds(t *testing.T) {
+	now := time.Now()
+	lockedFor := 15 * time.Minute
+	tests := []struct {
+		name string
+		// failures records the attempts leading up to the checks.
+		failures func(t *testing.T, g *Guard, alice *types.User)
+		// locked and open are the username and client IP pairs expected to
+		// be locked out and let through.
+		locked, open [][2]string
+	}{
+		{
+			name: "per username across IPs",
+			failures: func(t *testing.T, g *Guard, alice *types.User) {
+				for i := 0; i < 10; i++ {
+					fail(t, g, alice, "alice", fmt.Sprintf("192.0.2.%d", i), 1, now)
+				}
+			},
+			locked: [][2]string{{"alice", "198.51.100.1"}},
+			open:   [][2]string{{"bob", "192.0.2.1"}},
+		},
+		{
+			name: "one short of the username threshold",
+			failures: func(t *testing.T, g *Guard, alice *types.User) {
+				fail(t, g, alice, "alice", "192.0.2.1", 9, now.Add(-time.Minute))
+			},
+			open: [][2]string{{"alice", "192.0.2.1"}},
+		},
+		{
+			name: "per IP across usernames",
+			failures: func(t *testing.T, g *Guard, alice *types.User) {
+				for i := 0; i < 100; i++ {
+					fail(t, g, nil, fmt.Sprintf("user%d", i), "192.0.2.1", 1, now)
+				}
+			},
+			locked: [][2]string{{"alice", "192.0.2.1"}},
+			open:   [][2]string{{"alice", "198.51.100.1"}},
+		},
+		{
+			name: "failures outside the window",
+			failures: func(t *testing.T, g *Guard, alice *types.User) {
+				fail(t, g, alice, "alice", "192.0.2.1", 9, now.Add(-20*time.Minute))
+				fail(t, g, alice, "alice", "192.0.2.1", 1, now.Add(-time.Minute))
+			},
+			open: [][2]string{{"alice", "192.0.2.1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, _, alice := newTestGuard(t)
+			tt.failures(t, g, alice)
+
+			for _, pair := range tt.locked {
+				d, err := g.Check(pair[0], pair[1], now.Add(time.Second))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !d.Locked || d.Allowed || d.RetryAfter != lockedFor-time.Second {
+					t.Errorf("%v: decision = %+v, want locked for %v", pair, d, lockedFor-time.Second)
+				}
+				if d, _ := g.Check(pair[0], pair[1], now.Add(lockedFor)); d.Locked {
+					t.Errorf("%v: still locked once the lockout ended", pair)
+				}
+			}
+			for _, pair := range tt.open {
+				d, err := g.Check(pair[0], pair[1], now.Add(time.Minute))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if d.Locked {
+					t.Errorf("%v: decision = %+v, want not locked", pair, d)
+				}
+			}
+		})
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	now := time.Now()
+	g, _, alice := newTestGuard(t)
+	fail(t, g, alice, "alice", "192.0.2.1", 10, now)
+	for i := 0; i < 100; i++ {
+		fail(t, g, nil, fmt.Sprintf("user%d", i), "198.51.100.1", 1, now)
+	}
+
+	if err := g.UnlockUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+	// The failures are forgotten too, so there is no delay left to wait out.
+	if d, err := g.Check("alice", "192.0.2.1", now); err != nil || !d.Allowed {
+		t.Fatalf("alice after unlock: %+v, %v", d, err)
+	}
+	if d, _ := g.Check("alice", "198.51.100.1", now); !d.Locked {
+		t.Fatal("unlocking alice lifted the IP lockout")
+	}
+
+	if err := g.UnlockIP("198.51.100.1"); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := g.Check("alice", "198.51.100.1", now); err != nil || !d.Allowed {
+		t.Fatalf("IP after unlock: %+v, %v", d, err)
+	}
+
+	// Unlocking what isn't locked is fine.
+	if err := g.UnlockUser("alice"); err != nil {
+		t.Errorf("unlocking twice: %v", err)
+	}
+}
+
+func TestLockoutEvents(t *testing.T) {
+	now := time.Now()
+	g, events, alice := newTestGuard(t)
+	fail(t, g, nil, "nobody", "192.0.2.1", 10, now)
+	if len(*events) != 0 {
+		t.Fatalf("unknown username recorded %+v", *events)
+	}
+
+	fail(t, g, alice, "alice", "192.0.2.1", 10, now)
+	if len(*events) != 1 {
+		t.Fatalf("events = %+v, want one account_locked", *events)
+	}
+	locked := (*events)[0]
+	if locked.EventType != "account_locked" || locked.UserID != "alice-id" || locked.ObjectID != "alice-id" {
+		t.Errorf("event = %+v", locked)
+	}
+	for key, want := range map[string]string{
+		"client_ip":    "192.0.2.1",
+		"failures":     "10",
+		"locked_until": now.Add(15 * time.Minute).Format(time.RFC3339),
+		"source":       "api",
+	} {
+		if got := locked.Metadata[key]; got != want {
+			t.Errorf("metadata[%s] = %q, want %q", key, got, want)
+		}
+	}
+
+	if err := g.UnlockUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if last := (*events)[len(*events)-1]; last.EventType != "account_unlocked" || last.UserID != "alice-id" {
+		t.Errorf("last event = %+v, want account_unlocked", last)
+	}
+}
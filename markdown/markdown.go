@@ -0,0 +1,203 @@
+// Package markdown reads entry text the way the app renders its markdown,
+// to find the plain text under the markup and stats about it. Text that
+// isn't valid markup is kept as it was written, as the app shows it.
+package markdown
+
+import (
+	"JourneyAppServer/types"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// WordsPerMinute is the reading speed ReadingMinutes assumes.
+const WordsPerMinute = 200
+
+// Analysis is what Analyze finds in an entry's text.
+type Analysis struct {
+	// PlainText has one line for each line of the text, without headings'
+	// "#"s, list and checkbox markers, inline formatting or color tokens.
+	PlainText string
+	Stats     types.EntryStats
+}
+
+// Analyze parses text one line at a time:
+//
+//	# Heading, ## Subheading ...  up to six levels, with a space after the #s
+//	- item                        a bulleted list item
+//	- [ ] task, - [x] done        an unchecked and a checked checkbox
+//
+// Inline, *bold*, _italic_, ~underline~, -strikethrough- and `code` spans
+// can be nested in one another, except in code, and {color: red}...{color}
+// colors the text between its tokens.
+func Analyze(text string) Analysis {
+	stats := types.EntryStats{Outline: []types.OutlineHeading{}}
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	plain := make([]string, len(lines))
+	for i, line := range lines {
+		line = strings.TrimLeft(line, " \t")
+		if level, rest, ok := heading(line); ok {
+			plain[i] = inline(rest)
+			if plain[i] != "" {
+				stats.Outline = append(stats.Outline, types.OutlineHeading{Level: level, Text: plain[i]})
+			}
+			continue
+		}
+		if checked, rest, ok := checkbox(line); ok {
+			stats.Checkboxes++
+			if checked {
+				stats.CheckboxesChecked++
+			}
+			line = rest
+		} else if strings.HasPrefix(line, "- ") {
+			line = line[2:]
+		}
+		plain[i] = inline(line)
+	}
+
+	analysis := Analysis{PlainText: strings.Join(plain, "\n"), Stats: stats}
+	analysis.Stats.WordCount = WordCount(analysis.PlainText)
+	analysis.Stats.ReadingMinutes = ReadingMinutes(analysis.Stats.WordCount)
+	return analysis
+}
+
+// WordCount counts the whitespace-separated words of text that have a
+// letter or digit in them, so a lone "-" or "&" isn't one.
+func WordCount(text string) int {
+	count := 0
+	for _, field := range strings.Fields(text) {
+		if strings.IndexFunc(field, isWordRune) >= 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// ReadingMinutes rounds the time it takes to read words up to a whole
+// minute. Only text with no words at all takes 0.
+func ReadingMinutes(words int) int {
+	return (words + WordsPerMinute - 1) / WordsPerMinute
+}
+
+func heading(line string) (level int, rest string, ok bool) {
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(line) && line[level] != ' ') {
+		return 0, "", false
+	}
+	return level, strings.TrimSpace(line[level:]), true
+}
+
+func checkbox(line string) (checked bool, rest string, ok bool) {
+	if len(line) < 5 || !strings.HasPrefix(line, "- [") || line[4] != ']' || (len(line) > 5 && line[5] != ' ') {
+		return false, "", false
+	}
+	switch line[3] {
+	case ' ':
+	case 'x', 'X':
+		checked = true
+	default:
+		return false, "", false
+	}
+	return checked, strings.TrimPrefix(line[5:], " "), true
+}
+
+// emphasis are the characters that wrap formatted text.
+const emphasis = "*_~-"
+
+func inline(s string) string {
+	var b strings.Builder
+	writeInline(&b, s)
+	return b.String()
+}
+
+// writeInline writes s to b without its inline markup. A span runs from an
+// opening character to the first matching one that can close it; if there
+// is none, no later one of that character can open a span either, which
+// keeps this linear in unclosed markup.
+func writeInline(b *strings.Builder, s string) {
+	var unclosed [256]bool
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c == '{' {
+			if n := colorToken(s[i:]); n > 0 {
+				i += n
+				continue
+			}
+		}
+		if c == '`' && !unclosed[c] {
+			if n := strings.IndexByte(s[i+1:], '`'); n >= 0 {
+				b.WriteString(s[i+1 : i+1+n])
+				i += n + 2
+				continue
+			}
+			unclosed[c] = true
+		}
+		if strings.IndexByte(emphasis, c) >= 0 && !unclosed[c] && canOpen(s, i) {
+			if end := closer(s, i); end > 0 {
+				writeInline(b, s[i+1:end])
+				i = end + 1
+				continue
+			}
+			unclosed[c] = true
+		}
+		b.WriteByte(c)
+		i++
+	}
+}
+
+// canOpen reports whether s[i] can start a span: it mustn't be in the
+// middle of a word, as the "-" in "well-known" is, or followed by a space.
+func canOpen(s string, i int) bool {
+	if i > 0 {
+		if r, _ := utf8.DecodeLastRuneInString(s[:i]); isWordRune(r) {
+			return false
+		}
+	}
+	r, size := utf8.DecodeRuneInString(s[i+1:])
+	return size > 0 && !unicode.IsSpace(r)
+}
+
+// closer finds the character that closes the span s[open] starts, which
+// has to follow something other than a space and not be followed by a
+// letter or digit. It returns 0 if there isn't one.
+func closer(s string, open int) int {
+	for i := open + 2; i < len(s); i++ {
+		if s[i] != s[open] {
+			continue
+		}
+		if r, _ := utf8.DecodeLastRuneInString(s[:i]); unicode.IsSpace(r) {
+			continue
+		}
+		if r, size := utf8.DecodeRuneInString(s[i+1:]); size > 0 && isWordRune(r) {
+			continue
+		}
+		return i
+	}
+	return 0
+}
+
+// colorToken returns the length of the {color: name} or {color} token s
+// starts with, or 0 if it doesn't start with one.
+func colorToken(s string) int {
+	const maxLength = 40
+	if !strings.HasPrefix(s, "{color") || len(s) < 7 {
+		return 0
+	}
+	switch s[6] {
+	case '}':
+		return 7
+	case ':':
+		end := strings.IndexByte(s, '}')
+		if end < 0 || end > maxLength || strings.ContainsAny(s[1:end], "{\n") {
+			return 0
+		}
+		return end + 1
+	}
+	return 0
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
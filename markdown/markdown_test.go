@@ -0,0 +1,78 @@
+package markdown
+
+import (
+	"JourneyAppServer/types"
+	"reflect"
+	"testing"
+)
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain", "just words", "just words"},
+		{"heading", "# Day one\n## Morning", "Day one\nMorning"},
+		{"not a heading", "#hashtag and ####### seven", "#hashtag and ####### seven"},
+		{"list", "- eggs\n  - milk", "eggs\nmilk"},
+		{"checkboxes", "- [ ] call mom\n- [x] buy *bread*", "call mom\nbuy bread"},
+		{"emphasis", "*bold* _italic_ ~under~ -struck-", "bold italic under struck"},
+		{"nested", "*This is bold and ~underlined~.*", "This is bold and underlined."},
+		{"code keeps markup", "run `*not bold*` now", "run *not bold* now"},
+		{"color", "{color: red}This text will be red.{color}", "This text will be red."},
+		{"color around emphasis", "{color: blue}*blue bold*{color}", "blue bold"},
+		{"hyphenated words", "a well-known fact - mostly", "a well-known fact - mostly"},
+		{"snake case", "my_var_name", "my_var_name"},
+		{"unclosed", "2 * 3 = 6 and *open", "2 * 3 = 6 and *open"},
+		{"space before closer", "*not bold *", "*not bold *"},
+		{"unclosed brace", "{color: red", "{color: red"},
+		{"unicode", "_café_ señor", "café señor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Analyze(tt.text).PlainText; got != tt.want {
+				t.Errorf("PlainText = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	text := "# Trip\n" +
+		"## Packing\n" +
+		"- [x] tent\n" +
+		"- [X] *stove*\n" +
+		"- [ ] map\n" +
+		"- [y] not a checkbox\n" +
+		"### \n" +
+		"We left at 6 - early!"
+	want := types.EntryStats{
+		WordCount:         14,
+		ReadingMinutes:    1,
+		Checkboxes:        3,
+		CheckboxesChecked: 2,
+		Outline: []types.OutlineHeading{
+			{Level: 1, Text: "Trip"},
+			{Level: 2, Text: "Packing"},
+		},
+	}
+	if got := Analyze(text).Stats; !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestEmptyText(t *testing.T) {
+	got := Analyze("").Stats
+	if got.WordCount != 0 || got.ReadingMinutes != 0 || got.Outline == nil {
+		t.Errorf("Stats = %+v, want zero counts and an empty outline", got)
+	}
+}
+
+func TestReadingMinutes(t *testing.T) {
+	for words, want := range map[int]int{0: 0, 1: 1, WordsPerMinute: 1, WordsPerMinute + 1: 2} {
+		if got := ReadingMinutes(words); got != want {
+			t.Errorf("ReadingMinutes(%d) = %d, want %d", words, got, want)
+		}
+	}
+}
@@ -1,20 +1,23 @@
 package middleware
 
 import (
+	"JourneyAppServer/apikeys"
 	"JourneyAppServer/db"
+	"JourneyAppServer/sessions"
 	"JourneyAppServer/types"
 	"JourneyAppServer/utils"
 	"context"
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/golang-jwt/jwt/v5"
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
-func ValidateJWTMiddleware(next http.HandlerFunc) http.HandlerFunc {
+func ValidateJWTMiddleware(store *db.Store, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -59,7 +62,26 @@ func ValidateJWTMiddleware(next http.HandlerFunc) http.HandlerFunc {
 				return
 			}
 
+			sessionID, ok := claims["sid"].(string)
+			if !ok {
+				utils.LM.Logger.Printf("Invalid JWT claims: missing session for username=%s", username)
+				sendError(w, "Invalid token claims", http.StatusUnauthorized)
+				return
+			}
+
+			active, err := sessions.Active(store, sessionID, username)
+			if err != nil {
+				utils.LM.Logger.Printf("Error checking session %s: %v", sessionID, err)
+				sendError(w, "Error validating session", http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				sendError(w, "Session has been revoked", http.StatusUnauthorized)
+				return
+			}
+
 			ctx := context.WithValue(r.Context(), types.UsernameContextKey, username)
+			ctx = context.WithValue(ctx, types.SessionIDContextKey, sessionID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		} else {
 			utils.LM.Logger.Printf("Invalid JWT claims for token: %s", tokenStr)
@@ -69,7 +91,11 @@ func ValidateJWTMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func ValidateAPIKeyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// ValidateAPIKeyMiddleware checks the X-API-Key header and that the key
+// grants scope; an empty scope accepts any valid key and leaves the check to
+// the handler. Behind ValidateJWTMiddleware the key must also belong to the
+// user the token was issued to.
+func ValidateAPIKeyMiddleware(store *db.Store, scope string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		apiKey := r.Header.Get("X-API-Key")
 		if apiKey == "" {
@@ -77,48 +103,33 @@ func ValidateAPIKeyMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		var user types.User
-		query := `
-            SELECT user_id, username, password, salt, 
-                   api_key, api_key_created, api_key_last_used, api_key_expires_at, font
-            FROM users WHERE api_key = ?
-        `
-		err := db.SDB.QueryRow(query, apiKey).Scan(
-			&user.UserID, &user.Username, &user.Password, &user.Salt,
-			&user.APIKey.Key, &user.APIKey.Created, &user.APIKey.LastUsed, &user.APIKey.ExpiresAt, &user.Font,
-		)
+		key, err := apikeys.Authenticate(store, apiKey, time.Now().UTC())
 		if err != nil {
-			if err == sql.ErrNoRows {
-				utils.LM.Logger.Printf("No user found for API key: %s", apiKey)
+			switch {
+			case errors.Is(err, apikeys.ErrInvalidKey):
 				sendError(w, "Invalid API key", http.StatusUnauthorized)
-				return
+			case errors.Is(err, apikeys.ErrExpiredKey), errors.Is(err, apikeys.ErrRevokedKey):
+				sendError(w, fmt.Sprintf("API key validation failed: %v", err), http.StatusUnauthorized)
+			default:
+				utils.LM.Logger.Printf("Error validating API key: %v", err)
+				sendError(w, "Error validating API key", http.StatusInternalServerError)
 			}
-			utils.LM.Logger.Printf("Database error validating API key %s: %v", apiKey, err)
-			sendError(w, "Invalid API key", http.StatusUnauthorized)
 			return
 		}
 
-		if err := utils.ValidateAPIKey(&user.APIKey); err != nil {
-			utils.LM.Logger.Printf("API key validation failed for %s: %v", apiKey, err)
-			sendError(w, fmt.Sprintf("API key validation failed: %v", err), http.StatusUnauthorized)
+		if username, ok := GetUsernameFromContext(r.Context()); ok && username != key.Username {
+			utils.LM.Logger.Printf("API key %s belongs to %s, not token user %s", key.ID, key.Username, username)
+			sendError(w, "API key does not belong to this user", http.StatusUnauthorized)
 			return
 		}
 
-		limiter := utils.NewRateLimiter().GetLimiter(apiKey)
-		if !limiter.Allow() {
-			utils.LM.Logger.Printf("Rate limit exceeded for API key: %s", apiKey)
-			sendError(w, "Rate limit exceeded", http.StatusTooManyRequests)
-			return
+		if key.ReplacedBy != "" {
+			w.Header().Set(apikeys.RotatedHeader, key.ExpiresAt.UTC().Format(time.RFC3339))
 		}
 
-		updateQuery := `
-            UPDATE users 
-            SET api_key_last_used = NOW()
-            WHERE api_key = ?
-        `
-		_, err = db.SDB.Exec(updateQuery, apiKey)
-		if err != nil {
-			utils.LM.Logger.Printf("Error updating API key last used time for %s: %v", apiKey, err)
+		if scope != "" && !apikeys.HasScope(key.Scopes, scope) {
+			sendError(w, fmt.Sprintf("API key lacks the %q scope", scope), http.StatusForbidden)
+			return
 		}
 
 		//ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -153,13 +164,14 @@ func ValidateAPIKeyMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		//}
 
 		ctx := context.WithValue(r.Context(), types.APIKeyContextKey, apiKey)
-		ctx = context.WithValue(ctx, types.UsernameContextKey, user.Username)
+		ctx = context.WithValue(ctx, types.APIKeyIDContextKey, key.ID)
+		ctx = context.WithValue(ctx, types.UsernameContextKey, key.Username)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
 
-func CombinedAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return ValidateJWTMiddleware(ValidateAPIKeyMiddleware(next))
+func CombinedAuthMiddleware(store *db.Store, scope string, next http.HandlerFunc) http.HandlerFunc {
+	return ValidateJWTMiddleware(store, ValidateAPIKeyMiddleware(store, scope, next))
 }
 
 func sendError(w http.ResponseWriter, message string, status int) {
@@ -176,7 +188,17 @@ func GetUsernameFromContext(ctx context.Context) (string, bool) {
 	return username, ok
 }
 
+func GetSessionIDFromContext(ctx context.Context) (string, bool) {
+	sessionID, ok := ctx.Value(types.SessionIDContextKey).(string)
+	return sessionID, ok
+}
+
 func GetAPIKeyFromContext(ctx context.Context) (string, bool) {
 	apiKey, ok := ctx.Value(types.APIKeyContextKey).(string)
 	return apiKey, ok
 }
+
+func GetAPIKeyIDFromContext(ctx context.Context) (string, bool) {
+	keyID, ok := ctx.Value(types.APIKeyIDContextKey).(string)
+	return keyID, ok
+}
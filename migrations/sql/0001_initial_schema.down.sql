@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS analytics_events;
+DROP TABLE IF EXISTS entry_images;
+DROP TABLE IF EXISTS entry_tags;
+DROP TABLE IF EXISTS entry_locations;
+DROP TABLE IF EXISTS entries;
+DROP TABLE IF EXISTS users;
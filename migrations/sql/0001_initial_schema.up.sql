@@ -0,0 +1,74 @@
+-- Baseline schema. Matches what db.createTables() used to create, so databases
+-- provisioned before migrations existed adopt it as a no-op.
+CREATE TABLE IF NOT EXISTS users (
+    user_id VARCHAR(36) PRIMARY KEY,
+    username VARCHAR(50) NOT NULL UNIQUE,
+    password VARCHAR(255) NOT NULL,
+    salt VARCHAR(50) NOT NULL,
+    api_key VARCHAR(100) NOT NULL UNIQUE,
+    api_key_created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    api_key_last_used DATETIME,
+    api_key_expires_at DATETIME,
+    font VARCHAR(50),
+    INDEX idx_username (username)
+);
+
+CREATE TABLE IF NOT EXISTS entries (
+    entry_id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    username VARCHAR(50) NOT NULL,
+    text TEXT NOT NULL,
+    timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_updated DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    INDEX idx_user_timestamp (user_id, timestamp),
+    INDEX idx_username (username),
+    INDEX idx_entries_username (username),
+    INDEX idx_entries_id_user_timestamp (entry_id, user_id, timestamp),
+    INDEX idx_entries_username_timestamp (username, timestamp),
+    FULLTEXT INDEX idx_entries_text (text)
+);
+
+CREATE TABLE IF NOT EXISTS entry_locations (
+    location_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    entry_id VARCHAR(36) NOT NULL,
+    latitude DOUBLE NOT NULL,
+    longitude DOUBLE NOT NULL,
+    display_name VARCHAR(255),
+    FOREIGN KEY (entry_id) REFERENCES entries(entry_id) ON DELETE CASCADE,
+    INDEX idx_entry_id (entry_id),
+    INDEX idx_entry_locations_entry_id (entry_id)
+);
+
+CREATE TABLE IF NOT EXISTS entry_tags (
+    tag_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    entry_id VARCHAR(36) NOT NULL,
+    tag_key VARCHAR(50) NOT NULL,
+    tag_value VARCHAR(255),
+    FOREIGN KEY (entry_id) REFERENCES entries(entry_id) ON DELETE CASCADE,
+    INDEX idx_entry_tag (entry_id, tag_key),
+    INDEX idx_tag_key (tag_key),
+    INDEX idx_entry_tags_entry_id_key (entry_id, tag_key)
+);
+
+CREATE TABLE IF NOT EXISTS entry_images (
+    image_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    entry_id VARCHAR(36) NOT NULL,
+    image_url VARCHAR(255) NOT NULL,
+    FOREIGN KEY (entry_id) REFERENCES entries(entry_id) ON DELETE CASCADE,
+    INDEX idx_entry_id (entry_id),
+    INDEX idx_entry_images_entry_id (entry_id)
+);
+
+CREATE TABLE IF NOT EXISTS analytics_events (
+    event_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    object_type VARCHAR(100),
+    object_id VARCHAR(36),
+    event_time DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    meta_data JSON,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    INDEX idx_user_event_time (user_id, event_time),
+    INDEX idx_event_type (event_type)
+);
@@ -0,0 +1 @@
+ALTER TABLE analytics_events CHANGE COLUMN metadata meta_data JSON;
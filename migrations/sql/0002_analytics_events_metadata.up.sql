@@ -0,0 +1,4 @@
+-- Every writer inserts into analytics_events.metadata, but the table was
+-- created with meta_data, so analytics inserts have been failing with
+-- "Unknown column 'metadata'".
+ALTER TABLE analytics_events CHANGE COLUMN meta_data metadata JSON;
@@ -0,0 +1,19 @@
+-- One row per signed-in device. Only hashes of refresh tokens are stored;
+-- previous_token_hash lets a replayed (already rotated) token be detected.
+CREATE TABLE IF NOT EXISTS sessions (
+    session_id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    username VARCHAR(50) NOT NULL,
+    refresh_token_hash CHAR(64) NOT NULL UNIQUE,
+    previous_token_hash CHAR(64),
+    device_name VARCHAR(255),
+    user_agent VARCHAR(512),
+    client_ip VARCHAR(64),
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    INDEX idx_sessions_username (username),
+    INDEX idx_sessions_previous_token_hash (previous_token_hash)
+);
@@ -0,0 +1,10 @@
+-- Fixed-window request counters shared by every server instance when
+-- rateLimit.backend is "mysql".
+CREATE TABLE IF NOT EXISTS rate_limit_counters (
+    bucket_key VARCHAR(255) NOT NULL,
+    window_start DATETIME NOT NULL,
+    window_end DATETIME NOT NULL,
+    hits INT NOT NULL,
+    PRIMARY KEY (bucket_key, window_start),
+    INDEX idx_rate_limit_counters_window_end (window_end)
+);
@@ -0,0 +1,19 @@
+-- Every login attempt, successful or not. cleared_at is set when a success or
+-- an unlock resets the failure count.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    attempt_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    username VARCHAR(50) NOT NULL,
+    client_ip VARCHAR(64) NOT NULL,
+    succeeded BOOLEAN NOT NULL,
+    attempted_at DATETIME NOT NULL,
+    cleared_at DATETIME,
+    INDEX idx_login_attempts_username (username, attempted_at),
+    INDEX idx_login_attempts_client_ip (client_ip, attempted_at)
+);
+
+-- Active lockouts keyed by "user:<username>" or "ip:<address>".
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    lockout_key VARCHAR(255) PRIMARY KEY,
+    locked_until DATETIME NOT NULL,
+    created_at DATETIME NOT NULL
+);
@@ -0,0 +1,30 @@
+-- A user can hold several named API keys, each limited to a set of scopes.
+-- Only a SHA-256 hash of each key is stored; key_prefix is kept so a user can
+-- tell their keys apart.
+CREATE TABLE IF NOT EXISTS api_keys (
+    key_id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    username VARCHAR(50) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    key_prefix VARCHAR(16) NOT NULL,
+    scopes VARCHAR(255) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME,
+    expires_at DATETIME,
+    revoked_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    INDEX idx_api_keys_username (username)
+);
+
+-- Every existing users.api_key becomes that user's "default" key with every
+-- scope, so clients keep working.
+INSERT INTO api_keys (
+    key_id, user_id, username, name, key_hash, key_prefix, scopes,
+    created_at, last_used_at, expires_at
+)
+SELECT
+    UUID(), user_id, username, 'default', SHA2(api_key, 256), LEFT(api_key, 11),
+    'entries:read,entries:write,images,account',
+    api_key_created, api_key_last_used, api_key_expires_at
+FROM users;
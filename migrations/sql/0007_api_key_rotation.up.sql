@@ -0,0 +1,3 @@
+-- A rotated key points at the key that replaced it and keeps working until
+-- its (shortened) expires_at, so clients can be told to pick up the new one.
+ALTER TABLE api_keys ADD COLUMN replaced_by VARCHAR(36) NULL AFTER revoked_at;
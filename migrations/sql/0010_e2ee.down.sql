@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS entry_blind_index;
+ALTER TABLE entries
+    DROP COLUMN algorithm,
+    DROP COLUMN nonce,
+    DROP COLUMN wrapped_key,
+    DROP COLUMN ciphertext;
+DROP TABLE IF EXISTS user_encryption;
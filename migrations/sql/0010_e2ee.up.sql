@@ -0,0 +1,30 @@
+-- Opt-in end-to-end encryption. The client derives and wraps the user's
+-- content key; the server only keeps the wrapped form so other devices can
+-- fetch it, and can't unwrap it.
+CREATE TABLE IF NOT EXISTS user_encryption (
+    user_id VARCHAR(36) PRIMARY KEY,
+    wrapped_key BLOB NOT NULL,
+    key_algorithm VARCHAR(50) NOT NULL,
+    kdf_params VARCHAR(255),
+    enabled_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Entries of E2EE users keep text empty and carry the ciphertext, the entry's
+-- own data key wrapped by the user's content key, and the nonce.
+ALTER TABLE entries
+    ADD COLUMN ciphertext MEDIUMBLOB,
+    ADD COLUMN wrapped_key BLOB,
+    ADD COLUMN nonce VARBINARY(64),
+    ADD COLUMN algorithm VARCHAR(50);
+
+-- Blind index tokens (keyed hashes of words, computed by the client) stand in
+-- for MATCH() AGAINST when searching encrypted entries.
+CREATE TABLE IF NOT EXISTS entry_blind_index (
+    entry_id VARCHAR(36) NOT NULL,
+    token VARCHAR(128) NOT NULL,
+    PRIMARY KEY (entry_id, token),
+    FOREIGN KEY (entry_id) REFERENCES entries(entry_id) ON DELETE CASCADE,
+    INDEX idx_entry_blind_index_token (token)
+);
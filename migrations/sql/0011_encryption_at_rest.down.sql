@@ -0,0 +1,9 @@
+-- Sealed values have to be opened (or the rows dropped) first; they don't
+-- fit the original column sizes.
+ALTER TABLE entry_locations
+    DROP INDEX idx_entry_locations_name_token,
+    DROP COLUMN display_name_token,
+    MODIFY display_name VARCHAR(255);
+ALTER TABLE entry_tags MODIFY tag_value VARCHAR(255);
+ALTER TABLE entries MODIFY text TEXT NOT NULL;
+DROP TABLE IF EXISTS user_data_keys;
@@ -0,0 +1,22 @@
+-- Per-user data keys for encryption at rest, each wrapped by the master key
+-- named by master_key_id. Re-keying re-wraps them when the master key changes.
+CREATE TABLE IF NOT EXISTS user_data_keys (
+    user_id VARCHAR(36) PRIMARY KEY,
+    wrapped_key VARBINARY(255) NOT NULL,
+    master_key_id VARCHAR(64) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    rewrapped_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    INDEX idx_user_data_keys_master_key_id (master_key_id)
+);
+
+-- Sealed values are base64 and longer than the plaintext they replace.
+ALTER TABLE entries MODIFY text MEDIUMTEXT NOT NULL;
+ALTER TABLE entry_tags MODIFY tag_value VARCHAR(2048);
+
+-- display_name_token is a keyed hash of the plaintext name, so a sealed
+-- name can still be filtered on.
+ALTER TABLE entry_locations
+    MODIFY display_name VARCHAR(2048),
+    ADD COLUMN display_name_token VARCHAR(128),
+    ADD INDEX idx_entry_locations_name_token (display_name_token);
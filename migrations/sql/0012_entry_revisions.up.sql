@@ -0,0 +1,16 @@
+-- Earlier states of entries, saved whenever an update or restore replaces
+-- them. snapshot is a JSON types.EntrySnapshot, sealed as a whole when
+-- encryption at rest is on. revision counts up per entry.
+CREATE TABLE IF NOT EXISTS entry_revisions (
+    revision_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    entry_id VARCHAR(36) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    revision BIGINT NOT NULL,
+    reason VARCHAR(20) NOT NULL,
+    snapshot MEDIUMTEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (entry_id) REFERENCES entries(entry_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
+    UNIQUE KEY uq_entry_revisions_entry_revision (entry_id, revision),
+    INDEX idx_entry_revisions_user_created (user_id, created_at)
+);
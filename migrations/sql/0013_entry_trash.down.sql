@@ -0,0 +1,5 @@
+-- Trashed entries would reappear as live ones, so they are dropped first.
+DELETE FROM entries WHERE deleted_at IS NOT NULL;
+ALTER TABLE entries
+    DROP INDEX idx_entries_deleted_at,
+    DROP COLUMN deleted_at;
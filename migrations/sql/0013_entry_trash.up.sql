@@ -0,0 +1,6 @@
+-- Deleted entries stay in the trash, with their children and images, until
+-- they are restored or purged. Every read of live entries filters on
+-- deleted_at IS NULL.
+ALTER TABLE entries
+    ADD COLUMN deleted_at DATETIME NULL,
+    ADD INDEX idx_entries_deleted_at (deleted_at);
@@ -0,0 +1,5 @@
+-- version counts the writes to an entry. Clients send the version they last
+-- read (as an If-Match ETag) with an update, and it only applies if nothing
+-- else has changed the entry since.
+ALTER TABLE entries
+    ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,5 @@
+ALTER TABLE entries
+    DROP INDEX idx_entries_plain_text,
+    DROP COLUMN stats,
+    DROP COLUMN plain_text,
+    ADD FULLTEXT INDEX idx_entries_text (text);
@@ -0,0 +1,9 @@
+-- plain_text is the entry's text without its markdown, and takes over the
+-- FULLTEXT index so searches don't match markup. stats is a JSON
+-- types.EntryStats. Both are NULL for E2EE entries, and for older entries
+-- until `admin analyze` fills them in.
+ALTER TABLE entries
+    ADD COLUMN plain_text MEDIUMTEXT NULL,
+    ADD COLUMN stats TEXT NULL,
+    DROP INDEX idx_entries_text,
+    ADD FULLTEXT INDEX idx_entries_plain_text (plain_text);
@@ -0,0 +1,3 @@
+ALTER TABLE entry_tags
+    DROP INDEX idx_entry_tags_value_token,
+    DROP COLUMN tag_value_token;
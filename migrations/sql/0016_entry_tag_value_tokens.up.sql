@@ -0,0 +1,6 @@
+-- tag_value_token is a keyed hash of the plaintext tag value, so a sealed
+-- value can still be filtered on, like entry_locations.display_name_token.
+-- Values sealed before it have theirs filled in by the re-keyer.
+ALTER TABLE entry_tags
+    ADD COLUMN tag_value_token VARCHAR(128),
+    ADD INDEX idx_entry_tags_value_token (tag_value_token);
@@ -0,0 +1,3 @@
+ALTER TABLE entry_locations
+    DROP INDEX idx_entry_locations_point,
+    DROP COLUMN point;
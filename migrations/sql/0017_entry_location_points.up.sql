@@ -0,0 +1,6 @@
+-- point is (longitude, latitude) for spatial search. It is on a plane,
+-- SRID 0, so MBRContains on a box of degrees can use the SPATIAL index;
+-- ST_Distance_Sphere reads its coordinates as degrees for distances.
+ALTER TABLE entry_locations
+    ADD COLUMN point POINT SRID 0 GENERATED ALWAYS AS (POINT(longitude, latitude)) STORED NOT NULL,
+    ADD SPATIAL INDEX idx_entry_locations_point (point);
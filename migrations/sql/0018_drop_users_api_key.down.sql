@@ -0,0 +1,7 @@
+-- The plaintext keys are gone for good; the columns come back empty, and
+-- api_key can't be NOT NULL UNIQUE again until each row has one.
+ALTER TABLE users
+    ADD COLUMN api_key VARCHAR(100),
+    ADD COLUMN api_key_created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN api_key_last_used DATETIME,
+    ADD COLUMN api_key_expires_at DATETIME;
@@ -0,0 +1,7 @@
+-- Every key already has its hash in api_keys, so the plaintext copy kept on
+-- users for login to hand back out goes. Login issues a new key instead.
+ALTER TABLE users
+    DROP COLUMN api_key,
+    DROP COLUMN api_key_created,
+    DROP COLUMN api_key_last_used,
+    DROP COLUMN api_key_expires_at;
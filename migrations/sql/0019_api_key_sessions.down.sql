@@ -0,0 +1,3 @@
+ALTER TABLE api_keys
+    DROP INDEX idx_api_keys_session_id,
+    DROP COLUMN session_id;
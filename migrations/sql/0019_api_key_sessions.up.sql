@@ -0,0 +1,5 @@
+-- The key login hands out belongs to the session it started and is revoked
+-- with it, so keys no longer pile up with every sign-in.
+ALTER TABLE api_keys
+    ADD COLUMN session_id VARCHAR(36) NULL AFTER replaced_by,
+    ADD INDEX idx_api_keys_session_id (session_id);
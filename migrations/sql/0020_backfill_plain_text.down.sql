@@ -0,0 +1 @@
+UPDATE entries SET plain_text = NULL WHERE stats IS NULL;
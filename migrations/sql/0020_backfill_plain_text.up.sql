@@ -0,0 +1,9 @@
+-- 0015 moved the FULLTEXT index to plain_text, which is NULL for entries
+-- written before it, so they dropped out of text search. Until
+-- `admin analyze` works out their real plain text, they are matched on their
+-- text, markup and all, as before. stats stays NULL so analyze still picks
+-- them up. Sealed text is already searchable through the blind index.
+UPDATE entries
+SET plain_text = text
+WHERE plain_text IS NULL AND stats IS NULL AND ciphertext IS NULL
+    AND text <> '' AND text NOT LIKE '$enc$v1$%';
@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Local is for development: instead of reaching the user it appends each
+// message to a file, or to the server log when no file is configured. Config
+// validation won't allow the log in production.
+type Local struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewLocal(path string) *Local {
+	return &Local{path: path}
+}
+
+func (l *Local) PasswordReset(user types.User, token string, expiresAt time.Time) error {
+	return l.write(fmt.Sprintf("password reset for %s: token=%s expires=%s",
+		user.Username, token, expiresAt.UTC().Format(time.RFC3339)))
+}
+
+func (l *Local) write(message string) error {
+	if l.path == "" {
+		utils.LM.Logger.Printf("Notification: %s", message)
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s %s\n", time.Now().UTC().Format(time.RFC3339), message)
+	return err
+}
@@ -0,0 +1,25 @@
+// Package notify delivers out-of-band messages, such as password reset
+// tokens, to users.
+package notify
+
+import (
+	"JourneyAppServer/config"
+	"JourneyAppServer/types"
+	"fmt"
+	"time"
+)
+
+type Notifier interface {
+	// PasswordReset sends user the token that lets them choose a new
+	// password. It must not be logged anywhere it could be read by others.
+	PasswordReset(user types.User, token string, expiresAt time.Time) error
+}
+
+func New(cfg config.NotifierConfig) (Notifier, error) {
+	switch cfg.Backend {
+	case "local":
+		return NewLocal(cfg.File), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,206 @@
+package passwords
+
+import (
+	"JourneyAppServer/config"
+	"JourneyAppServer/types"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hasher hashes passwords into a self-describing string that records the
+// algorithm and its parameters, so the policy can change without breaking
+// existing hashes.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Matches reports whether encoded is a hash this Hasher understands.
+	Matches(encoded string) bool
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether encoded was made with other parameters
+	// than the Hasher's current ones.
+	NeedsRehash(encoded string) bool
+}
+
+var ErrUnknownHash = errors.New("unrecognized password hash")
+
+var (
+	current Hasher = NewArgon2id(config.Default().Passwords.Argon2)
+	// known verifies hashes made under any policy, including old ones.
+	known = []Hasher{current, NewBcrypt(config.Default().Passwords.BcryptCost)}
+)
+
+// Configure sets the hashing policy. It must run before the server starts
+// handling requests.
+func Configure(cfg config.PasswordsConfig) {
+	argon := NewArgon2id(cfg.Argon2)
+	bc := NewBcrypt(cfg.BcryptCost)
+	known = []Hasher{argon, bc}
+	if cfg.Algorithm == "bcrypt" {
+		current = bc
+	} else {
+		current = argon
+	}
+}
+
+// Hash hashes password under the current policy.
+func Hash(password string) (string, error) {
+	return current.Hash(password)
+}
+
+// Verify checks password against user's stored hash. needsRehash is set when
+// the password is right but its hash should be replaced with Hash's, which
+// is always the case for the legacy bcrypt(password+salt) hashes.
+func Verify(user types.User, password string) (ok, needsRehash bool, err error) {
+	if user.Salt != "" {
+		err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password+user.Salt))
+		if err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, false, nil
+			}
+			return false, false, err
+		}
+		return true, true, nil
+	}
+
+	for _, h := range known {
+		if !h.Matches(user.Password) {
+			continue
+		}
+		ok, err := h.Verify(password, user.Password)
+		if err != nil || !ok {
+			return false, false, err
+		}
+		return true, h != current || current.NeedsRehash(user.Password), nil
+	}
+	return false, false, ErrUnknownHash
+}
+
+type Bcrypt struct {
+	cost int
+}
+
+func NewBcrypt(cost int) *Bcrypt {
+	return &Bcrypt{cost: cost}
+}
+
+func (b *Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.cost)
+	return string(hash), err
+}
+
+func (b *Bcrypt) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (b *Bcrypt) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *Bcrypt) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != b.cost
+}
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// Argon2id encodes hashes in the PHC string format used by the reference
+// implementation: $argon2id$v=19$m=<KiB>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+type Argon2id struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func NewArgon2id(cfg config.Argon2Config) *Argon2id {
+	return &Argon2id{
+		memory:      uint32(cfg.MemoryKiB),
+		iterations:  uint32(cfg.Iterations),
+		parallelism: uint8(cfg.Parallelism),
+	}
+}
+
+var b64 = base64.RawStdEncoding
+
+func (a *Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.iterations, a.memory, a.parallelism, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.memory, a.iterations, a.parallelism, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (a *Argon2id) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func parseArgon2id(encoded string) (argon2Params, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return argon2Params{}, ErrUnknownHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	var p argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return argon2Params{}, fmt.Errorf("invalid argon2 parameters %q: %w", parts[3], err)
+	}
+	// argon2.IDKey panics on these.
+	if p.iterations < 1 || p.parallelism < 1 {
+		return argon2Params{}, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+	var err error
+	if p.salt, err = b64.DecodeString(parts[4]); err != nil {
+		return argon2Params{}, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	if p.key, err = b64.DecodeString(parts[5]); err != nil {
+		return argon2Params{}, fmt.Errorf("invalid argon2 hash: %w", err)
+	}
+	// An empty hash would match any password.
+	if len(p.salt) == 0 || len(p.key) == 0 {
+		return argon2Params{}, errors.New("empty argon2 salt or hash")
+	}
+	return p, nil
+}
+
+func (a *Argon2id) Verify(password, encoded string) (bool, error) {
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+func (a *Argon2id) NeedsRehash(encoded string) bool {
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return p.memory != a.memory || p.iterations != a.iterations || p.parallelism != a.parallelism ||
+		len(p.salt) != argon2SaltLength || len(p.key) != argon2KeyLength
+}
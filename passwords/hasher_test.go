@@ -0,0 +1,113 @@
+package passwords
+
+import (
+	"JourneyAppServer/config"
+	"JourneyAppServer/types"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2 keeps the tests fast; the parameters only have to be valid.
+var testArgon2 = config.Argon2Config{MemoryKiB: 64, Iterations: 1, Parallelism: 1}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	a := NewArgon2id(testArgon2)
+	encoded, err := a.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") || !a.Matches(encoded) {
+		t.Fatalf("hash %q isn't a PHC argon2id string", encoded)
+	}
+	if ok, err := a.Verify("correct horse", encoded); !ok || err != nil {
+		t.Fatalf("right password: ok = %v, err = %v", ok, err)
+	}
+	if ok, err := a.Verify("wrong horse", encoded); ok || err != nil {
+		t.Fatalf("wrong password: ok = %v, err = %v", ok, err)
+	}
+	if a.NeedsRehash(encoded) {
+		t.Fatal("fresh hash needs a rehash")
+	}
+}
+
+func TestArgon2idNeedsRehashWhenParametersChange(t *testing.T) {
+	encoded, err := NewArgon2id(testArgon2).Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range []config.Argon2Config{
+		{MemoryKiB: 128, Iterations: 1, Parallelism: 1},
+		{MemoryKiB: 64, Iterations: 2, Parallelism: 1},
+		{MemoryKiB: 64, Iterations: 1, Parallelism: 2},
+	} {
+		if !NewArgon2id(cfg).NeedsRehash(encoded) {
+			t.Errorf("%+v: NeedsRehash = false, want true", cfg)
+		}
+	}
+}
+
+func TestVerifyUpgradesHashesFromOtherPolicies(t *testing.T) {
+	Configure(config.PasswordsConfig{Algorithm: "argon2id", Argon2: testArgon2, BcryptCost: bcrypt.MinCost})
+	defer Configure(config.Default().Passwords)
+
+	bcryptHash, err := NewBcrypt(bcrypt.MinCost).Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, needsRehash, err := Verify(types.User{Password: bcryptHash}, "correct horse")
+	if !ok || !needsRehash || err != nil {
+		t.Fatalf("bcrypt hash: ok = %v, needsRehash = %v, err = %v", ok, needsRehash, err)
+	}
+
+	current, err := Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, needsRehash, err = Verify(types.User{Password: current}, "correct horse")
+	if !ok || needsRehash || err != nil {
+		t.Fatalf("current hash: ok = %v, needsRehash = %v, err = %v", ok, needsRehash, err)
+	}
+}
+
+func TestVerifyLegacyBcryptWithSalt(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse"+"pepper"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := types.User{Password: string(legacy), Salt: "pepper"}
+
+	ok, needsRehash, err := Verify(user, "correct horse")
+	if !ok || !needsRehash || err != nil {
+		t.Fatalf("right password: ok = %v, needsRehash = %v, err = %v", ok, needsRehash, err)
+	}
+	ok, _, err = Verify(user, "wrong horse")
+	if ok || err != nil {
+		t.Fatalf("wrong password: ok = %v, err = %v", ok, err)
+	}
+}
+
+func TestMalformedHashesAreRejected(t *testing.T) {
+	a := NewArgon2id(testArgon2)
+	for _, encoded := range []string{
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdHNhbHRzYWx0$aGFzaA",
+		"$argon2id$v=19$m=x,t=1,p=1$c2FsdHNhbHRzYWx0$aGFzaA",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHRzYWx0$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=0$c2FsdHNhbHRzYWx0$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHRzYWx0$",
+	} {
+		if ok, err := a.Verify("", encoded); ok || err == nil {
+			t.Errorf("%q: ok = %v, err = %v; want an error", encoded, ok, err)
+		}
+	}
+
+	for _, encoded := range []string{"", "plaintext", "$1$md5$crypt"} {
+		if ok, _, err := Verify(types.User{Password: encoded}, ""); ok || !errors.Is(err, ErrUnknownHash) {
+			t.Errorf("%q: ok = %v, err = %v; want ErrUnknownHash", encoded, ok, err)
+		}
+	}
+}
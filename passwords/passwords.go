@@ -0,0 +1,146 @@
+// Package passwords changes and resets account passwords. Either way every
+// existing session is revoked, so a leaked password or session stops working.
+package passwords
+
+import (
+	"JourneyAppServer/config"
+	"JourneyAppServer/db"
+	"JourneyAppServer/notify"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrTooShort     = errors.New("password is too short")
+	ErrInvalidToken = errors.New("invalid or expired password reset token")
+)
+
+type Manager struct {
+	store    *db.Store
+	notifier notify.Notifier
+	cfg      config.PasswordsConfig
+}
+
+func NewManager(store *db.Store, notifier notify.Notifier, cfg config.PasswordsConfig) *Manager {
+	return &Manager{store: store, notifier: notifier, cfg: cfg}
+}
+
+func (m *Manager) Validate(password string) error {
+	if len(password) < m.cfg.MinLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrTooShort, m.cfg.MinLength)
+	}
+	return nil
+}
+
+// Set stores a new password for user, then revokes all of their sessions and
+// any outstanding reset tokens.
+func (m *Manager) Set(user types.User, password string) error {
+	if err := m.Validate(password); err != nil {
+		return err
+	}
+
+	hashedPassword, err := Hash(password)
+	if err != nil {
+		return err
+	}
+	if err := m.store.Users.UpdatePassword(user.Username, hashedPassword, ""); err != nil {
+		return err
+	}
+
+	if err := m.store.Sessions.RevokeAllForUser(user.Username); err != nil {
+		return err
+	}
+	return m.store.PasswordResets.InvalidateAll(user.UserID, time.Now().UTC())
+}
+
+// RequestReset sends user a reset token. Earlier tokens stop working.
+func (m *Manager) RequestReset(user types.User, clientIP string) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("error generating random bytes: %v", err)
+	}
+	token := "prt_" + hex.EncodeToString(b)
+
+	now := time.Now().UTC()
+	if err := m.store.PasswordResets.InvalidateAll(user.UserID, now); err != nil {
+		return err
+	}
+	reset := types.PasswordResetToken{
+		Hash:        utils.HashToken(token),
+		UserID:      user.UserID,
+		Username:    user.Username,
+		RequestedIP: clientIP,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Duration(m.cfg.ResetTokenMinutes) * time.Minute),
+	}
+	if err := m.store.PasswordResets.Create(reset); err != nil {
+		return err
+	}
+	return m.notifier.PasswordReset(user, token, reset.ExpiresAt)
+}
+
+// Reset sets a new password using a token from RequestReset and returns the
+// user it belonged to. A password too short to accept doesn't spend the token.
+func (m *Manager) Reset(token, password string) (types.User, error) {
+	if err := m.Validate(password); err != nil {
+		return types.User{}, err
+	}
+
+	hash := utils.HashToken(token)
+	reset, err := m.store.PasswordResets.Get(hash)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return types.User{}, ErrInvalidToken
+		}
+		return types.User{}, err
+	}
+	if !reset.UsedAt.IsZero() || time.Now().After(reset.ExpiresAt) {
+		return types.User{}, ErrInvalidToken
+	}
+
+	// Spending the token first means two concurrent resets can't both win.
+	if err := m.store.PasswordResets.Use(hash, time.Now().UTC()); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return types.User{}, ErrInvalidToken
+		}
+		return types.User{}, err
+	}
+
+	user, err := m.store.Users.GetByUsername(reset.Username)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return types.User{}, ErrInvalidToken
+		}
+		return types.User{}, err
+	}
+	if err := m.Set(user, password); err != nil {
+		return types.User{}, err
+	}
+	return user, nil
+}
+
+// Check verifies password for user and, when it is right but hashed under an
+// older policy, replaces the stored hash. A failed upgrade is only logged.
+func Check(store *db.Store, user types.User, password string) (bool, error) {
+	ok, needsRehash, err := Verify(user, password)
+	if err != nil || !ok {
+		return false, err
+	}
+	if needsRehash {
+		hashedPassword, err := Hash(password)
+		if err == nil {
+			err = store.Users.UpdatePassword(user.Username, hashedPassword, "")
+		}
+		if err != nil {
+			utils.LM.Logger.Printf("Password rehash error: username=%s, error=%v", user.Username, err)
+		} else {
+			utils.LM.Logger.Printf("Password rehashed to current policy: username=%s", user.Username)
+		}
+	}
+	return true, nil
+}
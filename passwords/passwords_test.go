@@ -0,0 +1,139 @@
+package passwords
+
+import (
+	"JourneyAppServer/config"
+	"JourneyAppServer/db"
+	"JourneyAppServer/sessions"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"errors"
+	"testing"
+	"time"
+)
+
+// sentTokens records the reset tokens a Manager sends.
+type sentTokens []string
+
+func (s *sentTokens) PasswordReset(user types.User, token string, expiresAt time.Time) error {
+	*s = append(*s, token)
+	return nil
+}
+
+func newTestManager(t *testing.T) (*Manager, *db.Store, types.User, *sentTokens) {
+	t.Helper()
+	Configure(config.PasswordsConfig{Algorithm: "argon2id", Argon2: testArgon2})
+	t.Cleanup(func() { Configure(config.Default().Passwords) })
+
+	store := db.NewMemoryStore()
+	alice := types.User{UserID: "alice-id", Username: "alice"}
+	if err := store.Users.Create(alice); err != nil {
+		t.Fatal(err)
+	}
+	sent := &sentTokens{}
+	return NewManager(store, sent, config.Default().Passwords), store, alice, sent
+}
+
+func checkPassword(t *testing.T, store *db.Store, password string) bool {
+	t.Helper()
+	user, err := store.Users.GetByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, _, err := Verify(user, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
+
+func TestResetTokenIsSingleUse(t *testing.T) {
+	m, store, alice, sent := newTestManager(t)
+	if err := m.RequestReset(alice, "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	token := (*sent)[0]
+
+	if _, err := m.Reset(token, "first new password"); err != nil {
+		t.Fatal(err)
+	}
+	if !checkPassword(t, store, "first new password") {
+		t.Fatal("reset didn't set the new password")
+	}
+	if _, err := m.Reset(token, "second new password"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("reusing the token: err = %v, want ErrInvalidToken", err)
+	}
+	if !checkPassword(t, store, "first new password") {
+		t.Fatal("a spent token changed the password")
+	}
+}
+
+func TestResetRejectsExpiredAndUnknownTokens(t *testing.T) {
+	m, store, alice, _ := newTestManager(t)
+	now := time.Now().UTC()
+	err := store.PasswordResets.Create(types.PasswordResetToken{
+		Hash:      utils.HashToken("prt_expired"),
+		UserID:    alice.UserID,
+		Username:  alice.Username,
+		CreatedAt: now.Add(-time.Hour),
+		ExpiresAt: now.Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{"prt_expired", "prt_unknown"} {
+		if _, err := m.Reset(token, "a new password"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidToken", token, err)
+		}
+	}
+}
+
+func TestRequestResetInvalidatesEarlierTokens(t *testing.T) {
+	m, _, alice, sent := newTestManager(t)
+	for i := 0; i < 2; i++ {
+		if err := m.RequestReset(alice, "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, second := (*sent)[0], (*sent)[1]
+
+	if _, err := m.Reset(first, "a new password"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("earlier token: err = %v, want ErrInvalidToken", err)
+	}
+	if _, err := m.Reset(second, "a new password"); err != nil {
+		t.Fatalf("latest token: %v", err)
+	}
+}
+
+func TestResetWithShortPasswordKeepsTheToken(t *testing.T) {
+	m, _, alice, sent := newTestManager(t)
+	if err := m.RequestReset(alice, "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	token := (*sent)[0]
+
+	if _, err := m.Reset(token, "short"); !errors.Is(err, ErrTooShort) {
+		t.Fatalf("short password: err = %v, want ErrTooShort", err)
+	}
+	if _, err := m.Reset(token, "long enough now"); err != nil {
+		t.Fatalf("token was spent by the rejected password: %v", err)
+	}
+}
+
+func TestResetRevokesExistingSessions(t *testing.T) {
+	m, store, alice, sent := newTestManager(t)
+	tokens, err := sessions.Start(store, alice, "weekly", sessions.Device{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RequestReset(alice, "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Reset((*sent)[0], "a new password"); err != nil {
+		t.Fatal(err)
+	}
+	if active, err := sessions.Active(store, tokens.SessionID, "alice"); active || err != nil {
+		t.Fatalf("session after reset: active = %v, err = %v", active, err)
+	}
+}
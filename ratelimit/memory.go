@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type memoryEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// MemoryBackend keeps a token bucket per key in this process. Counters aren't
+// shared between instances.
+type MemoryBackend struct {
+	mu          sync.Mutex
+	entries     map[string]*memoryEntry
+	idleTimeout time.Duration
+}
+
+func NewMemoryBackend(idleTimeout time.Duration) *MemoryBackend {
+	return &MemoryBackend{entries: make(map[string]*memoryEntry), idleTimeout: idleTimeout}
+}
+
+func (m *MemoryBackend) Allow(key string, p Policy, now time.Time) (Result, error) {
+	perSecond := float64(p.Requests) / p.Window.Seconds()
+
+	m.mu.Lock()
+	entry, ok := m.entries[key]
+	if !ok {
+		entry = &memoryEntry{limiter: rate.NewLimiter(rate.Limit(perSecond), p.Requests)}
+		m.entries[key] = entry
+	}
+	entry.lastSeen = now
+	m.mu.Unlock()
+
+	allowed := entry.limiter.AllowN(now, 1)
+	tokens := entry.limiter.TokensAt(now)
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     p.Requests,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     time.Duration((float64(p.Requests) - tokens) / perSecond * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / perSecond * float64(time.Second))
+	}
+	return result, nil
+}
+
+func (m *MemoryBackend) Sweep(now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, entry := range m.entries {
+		if now.Sub(entry.lastSeen) > m.idleTimeout {
+			delete(m.entries, key)
+		}
+	}
+	return nil
+}
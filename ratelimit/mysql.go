@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MySQLBackend counts requests in fixed windows in the rate_limit_counters
+// table, so every server using the same database shares the limits.
+type MySQLBackend struct {
+	sdb *sql.DB
+}
+
+func NewMySQLBackend(sdb *sql.DB) *MySQLBackend {
+	return &MySQLBackend{sdb: sdb}
+}
+
+func (m *MySQLBackend) Allow(key string, p Policy, now time.Time) (Result, error) {
+	windowStart := now.Truncate(p.Window)
+	windowEnd := windowStart.Add(p.Window)
+
+	// LAST_INSERT_ID(expr) hands the post-increment count back in the OK
+	// packet, so counting costs a single round trip.
+	query := `
+        INSERT INTO rate_limit_counters (bucket_key, window_start, window_end, hits)
+        VALUES (?, ?, ?, LAST_INSERT_ID(1))
+        ON DUPLICATE KEY UPDATE hits = LAST_INSERT_ID(hits + 1)
+    `
+	res, err := m.sdb.Exec(query, key, windowStart, windowEnd)
+	if err != nil {
+		return Result{}, err
+	}
+	hits, err := res.LastInsertId()
+	if err != nil {
+		return Result{}, err
+	}
+
+	reset := windowEnd.Sub(now)
+	result := Result{
+		Allowed:   hits <= int64(p.Requests),
+		Limit:     p.Requests,
+		Remaining: p.Requests - int(hits),
+		Reset:     reset,
+	}
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	if !result.Allowed {
+		result.RetryAfter = reset
+	}
+	return result, nil
+}
+
+func (m *MySQLBackend) Sweep(now time.Time) error {
+	_, err := m.sdb.Exec(`DELETE FROM rate_limit_counters WHERE window_end < ?`, now)
+	return err
+}
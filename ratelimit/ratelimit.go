@@ -0,0 +1,161 @@
+// Package ratelimit throttles requests per caller with policies chosen by
+// route and user. Counters live in a Backend so several server instances can
+// share them.
+package ratelimit
+
+import (
+	"JourneyAppServer/config"
+	"JourneyAppServer/middleware"
+	"JourneyAppServer/utils"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Policy allows Requests per Window for each caller.
+type Policy struct {
+	Name     string
+	Requests int
+	Window   time.Duration
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the caller's full quota is available again.
+	Reset time.Duration
+	// RetryAfter is how long a rejected caller should wait before retrying.
+	RetryAfter time.Duration
+}
+
+type Backend interface {
+	// Allow counts one request for key under p.
+	Allow(key string, p Policy, now time.Time) (Result, error)
+	// Sweep drops counters that are idle or whose window has passed.
+	Sweep(now time.Time) error
+}
+
+type Limiter struct {
+	backend       Backend
+	defaultPolicy Policy
+	ipPolicy      Policy
+	routes        map[string]Policy
+	users         map[string]Policy
+	stop          chan struct{}
+	stopOnce      sync.Once
+}
+
+func policyFromConfig(name string, p config.RateLimitPolicy) Policy {
+	return Policy{Name: name, Requests: p.Requests, Window: time.Duration(p.WindowSeconds) * time.Second}
+}
+
+// New builds a Limiter and starts sweeping idle counters in the background
+// until Close is called.
+func New(cfg config.RateLimitConfig, backend Backend) *Limiter {
+	l := &Limiter{
+		backend:       backend,
+		defaultPolicy: policyFromConfig("default", cfg.Default),
+		ipPolicy:      policyFromConfig("ip", cfg.PerIP),
+		routes:        make(map[string]Policy),
+		users:         make(map[string]Policy),
+		stop:          make(chan struct{}),
+	}
+	for route, p := range cfg.Routes {
+		l.routes[route] = policyFromConfig("route:"+route, p)
+	}
+	for user, p := range cfg.Users {
+		l.users[user] = policyFromConfig("user:"+user, p)
+	}
+
+	interval := time.Duration(cfg.IdleTimeoutSeconds) * time.Second
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	go l.sweep(interval)
+	return l
+}
+
+func (l *Limiter) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-ticker.C:
+			if err := l.backend.Sweep(now); err != nil {
+				utils.LM.Logger.Printf("Rate limit sweep error: %v", err)
+			}
+		}
+	}
+}
+
+func (l *Limiter) Close() {
+	l.stopOnce.Do(func() { close(l.stop) })
+}
+
+// policyFor picks the caller's own policy first, then the route's, then the
+// default.
+func (l *Limiter) policyFor(route, username string) Policy {
+	if p, ok := l.users[username]; ok && username != "" {
+		return p
+	}
+	if p, ok := l.routes[route]; ok {
+		return p
+	}
+	return l.defaultPolicy
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// Wrap limits next under route's policy. Behind the auth middleware callers
+// are counted by username; otherwise by client IP.
+func (l *Limiter) Wrap(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, _ := middleware.GetUsernameFromContext(r.Context())
+		identity := "ip:" + utils.ClientIP(r)
+		if username != "" {
+			identity = "user:" + username
+		}
+		l.limit(w, r, route, identity, l.policyFor(route, username), next)
+	}
+}
+
+// WrapIP limits next under the per-IP policy, whoever the caller claims to
+// be. It goes in front of the auth middleware so requests that fail
+// authentication are counted too.
+func (l *Limiter) WrapIP(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l.limit(w, r, route, "ip:"+utils.ClientIP(r), l.ipPolicy, next)
+	}
+}
+
+func (l *Limiter) limit(w http.ResponseWriter, r *http.Request, route, identity string, policy Policy, next http.HandlerFunc) {
+	result, err := l.backend.Allow(policy.Name+"|"+identity, policy, time.Now())
+	if err != nil {
+		// Fail open: a broken counter store shouldn't take the API down.
+		utils.LM.Logger.Printf("Rate limit backend error: route=%s, error=%v", route, err)
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	h := w.Header()
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", policy.Requests, seconds(policy.Window)))
+	h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	h.Set("RateLimit-Reset", seconds(result.Reset))
+
+	if !result.Allowed {
+		utils.LM.Logger.Printf("Rate limit exceeded: route=%s, caller=%s", route, identity)
+		h.Set("Retry-After", seconds(result.RetryAfter))
+		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+	next.ServeHTTP(w, r)
+}
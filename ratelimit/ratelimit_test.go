@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"JourneyAppServer/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryBackendRejectsPastTheBurst(t *testing.T) {
+	backend := NewMemoryBackend(time.Minute)
+	policy := Policy{Name: "test", Requests: 3, Window: time.Minute}
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		result, err := backend.Allow("alice", policy, now)
+		if err != nil || !result.Allowed {
+			t.Fatalf("request %d: %+v, %v", i+1, result, err)
+		}
+		if result.Remaining != 2-i {
+			t.Errorf("request %d: remaining = %d, want %d", i+1, result.Remaining, 2-i)
+		}
+	}
+
+	result, err := backend.Allow("alice", policy, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed {
+		t.Fatal("request past the burst was allowed")
+	}
+	// One token comes back every 20 seconds.
+	if result.RetryAfter <= 0 || result.RetryAfter > 20*time.Second {
+		t.Errorf("retry after = %v, want (0, 20s]", result.RetryAfter)
+	}
+
+	if result, _ := backend.Allow("bob", policy, now); !result.Allowed {
+		t.Error("bob was limited by alice's requests")
+	}
+	if result, _ := backend.Allow("alice", policy, now.Add(20*time.Second)); !result.Allowed {
+		t.Error("alice still limited after a token came back")
+	}
+}
+
+func TestMemoryBackendSweepEvictsIdleLimiters(t *testing.T) {
+	backend := NewMemoryBackend(time.Minute)
+	policy := Policy{Name: "test", Requests: 1, Window: time.Minute}
+	start := time.Now()
+
+	backend.Allow("idle", policy, start)
+	backend.Allow("busy", policy, start.Add(50*time.Second))
+	if err := backend.Sweep(start.Add(90 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := backend.entries["idle"]; ok {
+		t.Error("idle limiter was kept")
+	}
+	if _, ok := backend.entries["busy"]; !ok {
+		t.Error("limiter used within the idle timeout was evicted")
+	}
+
+	// An evicted caller starts again with a full bucket.
+	if result, _ := backend.Allow("idle", policy, start.Add(90*time.Second)); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("after eviction: %+v", result)
+	}
+}
+
+func newTestLimiter(t *testing.T) *Limiter {
+	t.Helper()
+	cfg := config.Default().RateLimit
+	cfg.Routes = map[string]config.RateLimitPolicy{"GET /test": {Requests: 2, WindowSeconds: 60}}
+	cfg.PerIP = config.RateLimitPolicy{Requests: 1, WindowSeconds: 60}
+	l := New(cfg, NewMemoryBackend(time.Minute))
+	t.Cleanup(l.Close)
+	return l
+}
+
+func serve(handler http.HandlerFunc, remoteAddr string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.RemoteAddr = remoteAddr
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWrapRejectsWithRateLimitHeaders(t *testing.T) {
+	calls := 0
+	handler := newTestLimiter(t).Wrap("GET /test", func(w http.ResponseWriter, r *http.Request) { calls++ })
+
+	for i := 0; i < 2; i++ {
+		if rec := serve(handler, "192.0.2.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i+1, rec.Code)
+		}
+	}
+	rec := serve(handler, "192.0.2.1:1234")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rec.Code)
+	}
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+
+	for header, want := range map[string]string{
+		"RateLimit-Policy":    "2;w=60",
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "60",
+		"Retry-After":         "30",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	if rec := serve(handler, "198.51.100.7:1234"); rec.Code != http.StatusOK {
+		t.Errorf("another client IP: status %d", rec.Code)
+	}
+}
+
+func TestWrapIPLimitsBeforeTheInnerHandler(t *testing.T) {
+	calls := 0
+	handler := newTestLimiter(t).WrapIP("GET /test", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+
+	if rec := serve(handler, "192.0.2.1:1234"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("first request: status %d", rec.Code)
+	}
+	rec := serve(handler, "192.0.2.1:1234")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rec.Code)
+	}
+	if calls != 1 {
+		t.Errorf("inner handler ran %d times, want 1", calls)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+}
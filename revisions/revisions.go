@@ -0,0 +1,155 @@
+// Package revisions applies the retention policy to entry revisions and
+// compares them. The revisions themselves are saved by the entry repository
+// as part of every change.
+package revisions
+
+import (
+	"JourneyAppServer/config"
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"bytes"
+	"strings"
+	"time"
+)
+
+var policy = config.Default().Revisions
+
+// Configure sets the retention policy. It must run before the server starts
+// handling requests.
+func Configure(cfg config.RevisionsConfig) {
+	policy = cfg
+}
+
+// Prune drops the revisions of userID, and of entryID in particular, that
+// the retention policy no longer keeps.
+func Prune(store *db.Store, userID, entryID string) error {
+	return pruneAt(store, userID, entryID, time.Now().UTC())
+}
+
+func pruneAt(store *db.Store, userID, entryID string, now time.Time) error {
+	var olderThan time.Time
+	if policy.MaxAgeDays > 0 {
+		olderThan = now.AddDate(0, 0, -policy.MaxAgeDays)
+	}
+	return store.Entries.PruneRevisions(userID, entryID, policy.MaxPerEntry, policy.MaxPerUser, olderThan)
+}
+
+// Snapshot captures an entry as a revision would.
+func Snapshot(entry types.Entry) types.EntrySnapshot {
+	return types.EntrySnapshot{
+		Text:      entry.Text,
+		Locations: entry.Locations,
+		Tags:      entry.Tags,
+		Images:    entry.Images,
+		Encrypted: entry.Encrypted,
+	}
+}
+
+// Diff compares two snapshots. The caller fills in From and To.
+func Diff(from, to types.EntrySnapshot) types.RevisionDiff {
+	diff := types.RevisionDiff{Text: []types.DiffLine{}}
+	if from.Encrypted != nil || to.Encrypted != nil {
+		diff.EncryptedChanged = !sameEnvelope(from.Encrypted, to.Encrypted) || from.Text != to.Text
+	} else {
+		diff.Text = diffLines(splitLines(from.Text), splitLines(to.Text))
+	}
+	diff.TagsAdded, diff.TagsRemoved = diffSets(from.Tags, to.Tags)
+	diff.LocationsAdded, diff.LocationsRemoved = diffSets(from.Locations, to.Locations)
+	diff.ImagesAdded, diff.ImagesRemoved = diffSets(from.Images, to.Images)
+	return diff
+}
+
+func sameEnvelope(a, b *types.EncryptedPayload) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return bytes.Equal(a.Ciphertext, b.Ciphertext) && bytes.Equal(a.WrappedKey, b.WrappedKey) &&
+		bytes.Equal(a.Nonce, b.Nonce) && a.Algorithm == b.Algorithm
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// maxDiffCells bounds the LCS table. Texts too long for it are shown as
+// entirely replaced rather than diffed.
+const maxDiffCells = 4_000_000
+
+// diffLines is a longest-common-subsequence line diff.
+func diffLines(a, b []string) []types.DiffLine {
+	lines := []types.DiffLine{}
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, line := range a {
+			lines = append(lines, types.DiffLine{Op: "delete", Text: line})
+		}
+		for _, line := range b {
+			lines = append(lines, types.DiffLine{Op: "insert", Text: line})
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, types.DiffLine{Op: "equal", Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, types.DiffLine{Op: "delete", Text: a[i]})
+			i++
+		default:
+			lines = append(lines, types.DiffLine{Op: "insert", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, types.DiffLine{Op: "delete", Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, types.DiffLine{Op: "insert", Text: b[j]})
+	}
+	return lines
+}
+
+// diffSets returns the values of to missing from from and the other way
+// round, counting duplicates.
+func diffSets[T comparable](from, to []T) (added, removed []T) {
+	added, removed = []T{}, []T{}
+	counts := make(map[T]int)
+	for _, v := range from {
+		counts[v]++
+	}
+	for _, v := range to {
+		if counts[v] > 0 {
+			counts[v]--
+		} else {
+			added = append(added, v)
+		}
+	}
+	for _, v := range from {
+		if counts[v] > 0 {
+			counts[v]--
+			removed = append(removed, v)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,148 @@
+package revisions
+
+import (
+	"JourneyAppServer/config"
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     []types.DiffLine
+	}{
+		{"unchanged", "a\nb", "a\nb", []types.DiffLine{{Op: "equal", Text: "a"}, {Op: "equal", Text: "b"}}},
+		{"from nothing", "", "a", []types.DiffLine{{Op: "insert", Text: "a"}}},
+		{"to nothing", "a", "", []types.DiffLine{{Op: "delete", Text: "a"}}},
+		{"both empty", "", "", []types.DiffLine{}},
+		{
+			"line changed",
+			"a\nb\nc", "a\nB\nc",
+			[]types.DiffLine{{Op: "equal", Text: "a"}, {Op: "delete", Text: "b"}, {Op: "insert", Text: "B"}, {Op: "equal", Text: "c"}},
+		},
+		{
+			// The longest common subsequence is b, c, d, not a.
+			"keeps the longest run",
+			"a\nb\nc\nd", "b\nc\nd\na",
+			[]types.DiffLine{
+				{Op: "delete", Text: "a"}, {Op: "equal", Text: "b"}, {Op: "equal", Text: "c"},
+				{Op: "equal", Text: "d"}, {Op: "insert", Text: "a"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Diff(types.EntrySnapshot{Text: tt.from}, types.EntrySnapshot{Text: tt.to}).Text
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diff = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffFields(t *testing.T) {
+	from := types.EntrySnapshot{
+		Tags:   []types.TagData{{Key: "travel"}, {Key: "draft"}},
+		Images: []string{"a.jpg", "b.jpg"},
+	}
+	to := types.EntrySnapshot{
+		Tags:      []types.TagData{{Key: "travel"}, {Key: "lake"}},
+		Images:    []string{"b.jpg"},
+		Locations: []types.LocationData{{DisplayName: "Tahoe"}},
+	}
+	diff := Diff(from, to)
+	if !reflect.DeepEqual(diff.TagsAdded, []types.TagData{{Key: "lake"}}) || !reflect.DeepEqual(diff.TagsRemoved, []types.TagData{{Key: "draft"}}) {
+		t.Errorf("tags: added %v, removed %v", diff.TagsAdded, diff.TagsRemoved)
+	}
+	if len(diff.ImagesAdded) != 0 || !reflect.DeepEqual(diff.ImagesRemoved, []string{"a.jpg"}) {
+		t.Errorf("images: added %v, removed %v", diff.ImagesAdded, diff.ImagesRemoved)
+	}
+	if len(diff.LocationsAdded) != 1 || len(diff.LocationsRemoved) != 0 {
+		t.Errorf("locations: added %v, removed %v", diff.LocationsAdded, diff.LocationsRemoved)
+	}
+
+	// Ciphertext can't be diffed line by line.
+	sealed := func(ciphertext string) types.EntrySnapshot {
+		return types.EntrySnapshot{Encrypted: &types.EncryptedPayload{Ciphertext: []byte(ciphertext), Algorithm: "AES-256-GCM"}}
+	}
+	if diff := Diff(sealed("one"), sealed("two")); !diff.EncryptedChanged || len(diff.Text) != 0 {
+		t.Errorf("different envelopes: %+v", diff)
+	}
+	if diff := Diff(sealed("one"), sealed("one")); diff.EncryptedChanged {
+		t.Errorf("same envelope: %+v", diff)
+	}
+}
+
+// editEntries gives alice the named entries and changes each one edits
+// times, saving a revision per change.
+func editEntries(t *testing.T, store *db.Store, edits int, ids ...string) {
+	t.Helper()
+	for i, id := range ids {
+		key := db.EntryKey{ID: id, UserID: "alice-id"}
+		err := store.Entries.Create(types.Entry{
+			ID: id, UserID: "alice-id", Username: "alice",
+			Timestamp: time.Date(2024, 5, 1+i, 12, 0, 0, 0, time.UTC),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for edit := 0; edit < edits; edit++ {
+			text := fmt.Sprintf("edit %d", edit)
+			if _, err := store.Entries.Patch(key, types.EntryPatch{Text: &text}, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func revisionCount(t *testing.T, store *db.Store, id string) int {
+	t.Helper()
+	revs, err := store.Entries.Revisions(db.EntryKey{ID: id, UserID: "alice-id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(revs)
+}
+
+func TestPruneRetention(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy config.RevisionsConfig
+		// after is how long after the edits pruning runs.
+		after time.Duration
+		// want is how many revisions each of "first" and "second" keeps
+		// after "second" is pruned.
+		want [2]int
+	}{
+		{"no limits", config.RevisionsConfig{}, 0, [2]int{5, 5}},
+		{"per entry", config.RevisionsConfig{MaxPerEntry: 2}, 0, [2]int{5, 2}},
+		{"per user drops the oldest first", config.RevisionsConfig{MaxPerUser: 7}, 0, [2]int{2, 5}},
+		{"young enough", config.RevisionsConfig{MaxAgeDays: 3}, 48 * time.Hour, [2]int{5, 5}},
+		{"too old", config.RevisionsConfig{MaxAgeDays: 1}, 48 * time.Hour, [2]int{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Configure(tt.policy)
+			t.Cleanup(func() { Configure(config.Default().Revisions) })
+
+			store := db.NewMemoryStore()
+			if err := store.Users.Create(types.User{UserID: "alice-id", Username: "alice"}); err != nil {
+				t.Fatal(err)
+			}
+			editEntries(t, store, 5, "first", "second")
+
+			if err := pruneAt(store, "alice-id", "second", time.Now().UTC().Add(tt.after)); err != nil {
+				t.Fatal(err)
+			}
+			got := [2]int{revisionCount(t, store, "first"), revisionCount(t, store, "second")}
+			if got != tt.want {
+				t.Errorf("revisions kept = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,531 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The query language. Terms next to each other must all match, AND binds
+// tighter than OR, and parentheses group:
+//
+//	lisbon "exact phrase" hik*   words (or word prefixes) and phrases in the text
+//	tag:travel                   an entry tagged with the key travel
+//	location:"Lisbon, Portugal"  an entry at a location with that name
+//	before:2024-06-01            earlier than that day (or RFC3339 time)
+//	after:2024-06-01             on or after that day (or RFC3339 time)
+//	has:image, has:location, has:tag
+//	-term, NOT term              an entry the term doesn't match
+//	a OR b, a AND b, (a OR b) c
+//
+// A "+" before a term, as MySQL's boolean mode has it, changes nothing.
+
+const (
+	// MaxQueryLength bounds a query, in characters.
+	MaxQueryLength = 500
+	// maxTerms bounds how many terms a query has, as each becomes its own
+	// condition on the entries.
+	maxTerms = 32
+	// maxDepth bounds how deeply parentheses and NOTs nest.
+	maxDepth = 16
+)
+
+// Expr is a parsed query or part of one.
+type Expr interface {
+	// Pos is where the expression starts in the query, counted in Unicode
+	// code points from 0.
+	Pos() int
+	// String is the expression written out as a query that parses back to
+	// the same thing.
+	String() string
+}
+
+type (
+	// And matches entries every one of Terms matches.
+	And struct{ Terms []Expr }
+	// Or matches entries any one of Terms matches.
+	Or  struct{ Terms []Expr }
+	Not struct {
+		Expr Expr
+		At   int
+	}
+	// Text matches entries whose plain text has Value in it: as a phrase,
+	// or otherwise as a word, or a word starting with it if Prefix is set.
+	Text struct {
+		Value          string
+		Phrase, Prefix bool
+		At             int
+	}
+	Tag struct {
+		Key string
+		At  int
+	}
+	Location struct {
+		Name string
+		At   int
+	}
+	Before struct {
+		Time time.Time
+		At   int
+	}
+	After struct {
+		Time time.Time
+		At   int
+	}
+	// Has matches entries with at least one image, location or tag.
+	Has struct {
+		What string
+		At   int
+	}
+)
+
+// The values Has.What can take.
+const (
+	HasImage    = "image"
+	HasLocation = "location"
+	HasTag      = "tag"
+)
+
+func (e And) Pos() int      { return e.Terms[0].Pos() }
+func (e Or) Pos() int       { return e.Terms[0].Pos() }
+func (e Not) Pos() int      { return e.At }
+func (e Text) Pos() int     { return e.At }
+func (e Tag) Pos() int      { return e.At }
+func (e Location) Pos() int { return e.At }
+func (e Before) Pos() int   { return e.At }
+func (e After) Pos() int    { return e.At }
+func (e Has) Pos() int      { return e.At }
+
+func (e And) String() string {
+	terms := make([]string, len(e.Terms))
+	for i, term := range e.Terms {
+		terms[i] = group(term, e)
+	}
+	return strings.Join(terms, " ")
+}
+
+func (e Or) String() string {
+	terms := make([]string, len(e.Terms))
+	for i, term := range e.Terms {
+		terms[i] = group(term, e)
+	}
+	return strings.Join(terms, " OR ")
+}
+
+func (e Not) String() string {
+	// "--x" would read back as a single "-x".
+	if _, ok := e.Expr.(Not); ok {
+		return "NOT " + e.Expr.String()
+	}
+	return "-" + group(e.Expr, e)
+}
+
+// group wraps expr in parentheses if it wouldn't otherwise parse back as
+// one term of parent: an Or anywhere but in another Or, and an And in a
+// Not.
+func group(expr, parent Expr) string {
+	_, inOr := parent.(Or)
+	_, inNot := parent.(Not)
+	switch expr.(type) {
+	case Or:
+		if !inOr {
+			return "(" + expr.String() + ")"
+		}
+	case And:
+		if inNot {
+			return "(" + expr.String() + ")"
+		}
+	}
+	return expr.String()
+}
+
+func (e Text) String() string {
+	if e.Phrase {
+		return `"` + e.Value + `"`
+	}
+	if e.Prefix {
+		return e.Value + "*"
+	}
+	return e.Value
+}
+
+func (e Tag) String() string      { return "tag:" + quote(e.Key) }
+func (e Location) String() string { return "location:" + quote(e.Name) }
+func (e Before) String() string   { return "before:" + formatTime(e.Time) }
+func (e After) String() string    { return "after:" + formatTime(e.Time) }
+func (e Has) String() string      { return "has:" + e.What }
+
+// quote quotes field values that wouldn't be read back as one word.
+func quote(value string) string {
+	if strings.ContainsAny(value, "()") || strings.IndexFunc(value, unicode.IsSpace) >= 0 {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+func formatTime(t time.Time) string {
+	if t.Equal(t.Truncate(24*time.Hour)) && t.Location() == time.UTC {
+		return t.Format(time.DateOnly)
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// SyntaxError is a query that can't be parsed, with where the problem is.
+type SyntaxError struct {
+	// Pos is counted in Unicode code points from 0.
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid search query at position %d: %s", e.Pos, e.Msg)
+}
+
+// Parse parses a query. A query without any terms parses to nil.
+func Parse(query string) (Expr, error) {
+	runes := []rune(query)
+	if len(runes) > MaxQueryLength {
+		return nil, &SyntaxError{Pos: MaxQueryLength, Msg: fmt.Sprintf("the query is longer than %d characters", MaxQueryLength)}
+	}
+	tokens, err := lex(runes)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, nil
+	}
+	expr, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, &SyntaxError{Pos: tok.pos, Msg: "unexpected " + tok.describe()}
+	}
+	return expr, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokPhrase
+	// tokField is a "name:" with its value, quoted or not, in text.
+	tokField
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// name is a field's name.
+	name string
+	pos  int
+	// valuePos is where a field's value starts.
+	valuePos int
+}
+
+func (t token) describe() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokRParen:
+		return `")"`
+	case tokLParen:
+		return `"("`
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// fields are the names that make a word a field.
+var fields = map[string]bool{"tag": true, "location": true, "before": true, "after": true, "has": true}
+
+func lex(runes []rune) ([]token, error) {
+	var tokens []token
+	i := 0
+	// readPhrase reads the quoted text starting at runes[i].
+	readPhrase := func() (string, error) {
+		start := i
+		i++
+		for i < len(runes) && runes[i] != '"' {
+			i++
+		}
+		if i == len(runes) {
+			return "", &SyntaxError{Pos: start, Msg: "the quote is never closed"}
+		}
+		i++
+		return string(runes[start+1 : i-1]), nil
+	}
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r), r == '+':
+			i++
+		case r == '-':
+			// "-" negates the term right after it; on its own it's
+			// ignored.
+			if i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != ')' {
+				tokens = append(tokens, token{kind: tokNot, text: "-", pos: i})
+			}
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case r == '"':
+			start := i
+			text, err := readPhrase()
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokPhrase, text: text, pos: start})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(`()"`, runes[i]) {
+				i++
+			}
+			word := string(runes[start:i])
+			if name, value, ok := strings.Cut(word, ":"); ok && fields[strings.ToLower(name)] {
+				tok := token{kind: tokField, name: strings.ToLower(name), text: value, pos: start,
+					valuePos: start + len([]rune(name)) + 1}
+				if value == "" && i < len(runes) && runes[i] == '"' {
+					text, err := readPhrase()
+					if err != nil {
+						return nil, err
+					}
+					tok.text = text
+				}
+				tokens = append(tokens, tok)
+				continue
+			}
+			kind := tokWord
+			switch word {
+			case "AND":
+				kind = tokAnd
+			case "OR":
+				kind = tokOr
+			case "NOT":
+				kind = tokNot
+			}
+			tokens = append(tokens, token{kind: kind, text: word, pos: start})
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(runes)}), nil
+}
+
+type parser struct {
+	tokens []token
+	next   int
+	terms  int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	tok := p.tokens[p.next]
+	if tok.kind != tokEOF {
+		p.next++
+	}
+	return tok
+}
+
+func (p *parser) parseOr(depth int) (Expr, error) {
+	first, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	terms := []Expr{first}
+	for p.peek().kind == tokOr {
+		p.take()
+		term, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 1 {
+		return first, nil
+	}
+	return Or{Terms: terms}, nil
+}
+
+func (p *parser) parseAnd(depth int) (Expr, error) {
+	first, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	terms := []Expr{first}
+	for {
+		switch p.peek().kind {
+		case tokAnd:
+			p.take()
+		case tokWord, tokPhrase, tokField, tokLParen, tokNot:
+		default:
+			if len(terms) == 1 {
+				return first, nil
+			}
+			return And{Terms: terms}, nil
+		}
+		term, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+}
+
+func (p *parser) parseUnary(depth int) (Expr, error) {
+	tok := p.peek()
+	if depth > maxDepth {
+		return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("the query nests more than %d deep", maxDepth)}
+	}
+	if tok.kind == tokNot {
+		p.take()
+		expr, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Expr: expr, At: tok.pos}, nil
+	}
+	return p.parsePrimary(depth)
+}
+
+func (p *parser) parsePrimary(depth int) (Expr, error) {
+	tok := p.take()
+	switch tok.kind {
+	case tokLParen:
+		expr, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, &SyntaxError{Pos: tok.pos, Msg: `the "(" is never closed`}
+		}
+		p.take()
+		return expr, nil
+	case tokWord, tokPhrase, tokField:
+		p.terms++
+		if p.terms > maxTerms {
+			return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("the query has more than %d terms", maxTerms)}
+		}
+		if tok.kind == tokField {
+			return parseField(tok)
+		}
+		return parseText(tok)
+	case tokEOF:
+		return nil, &SyntaxError{Pos: tok.pos, Msg: "the query ends where a search term should be"}
+	}
+	return nil, &SyntaxError{Pos: tok.pos, Msg: "expected a search term, not " + tok.describe()}
+}
+
+func parseText(tok token) (Expr, error) {
+	text := Text{Value: tok.text, Phrase: tok.kind == tokPhrase, At: tok.pos}
+	if !text.Phrase && strings.HasSuffix(text.Value, "*") {
+		text.Value = strings.TrimRight(text.Value, "*")
+		text.Prefix = true
+	}
+	if len(text.Words()) == 0 {
+		return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("%s has no letters or digits to search for", tok.describe())}
+	}
+	return text, nil
+}
+
+func parseField(tok token) (Expr, error) {
+	if tok.text == "" {
+		return nil, &SyntaxError{Pos: tok.valuePos, Msg: fmt.Sprintf("%s: needs a value", tok.name)}
+	}
+	switch tok.name {
+	case "tag":
+		return Tag{Key: tok.text, At: tok.pos}, nil
+	case "location":
+		return Location{Name: tok.text, At: tok.pos}, nil
+	case "before", "after":
+		t, err := parseTime(tok.text)
+		if err != nil {
+			return nil, &SyntaxError{Pos: tok.valuePos, Msg: fmt.Sprintf("%s: needs a date like 2024-06-01 or an RFC3339 time", tok.name)}
+		}
+		if tok.name == "before" {
+			return Before{Time: t, At: tok.pos}, nil
+		}
+		return After{Time: t, At: tok.pos}, nil
+	case "has":
+		switch what := strings.ToLower(tok.text); what {
+		case HasImage, HasLocation, HasTag:
+			return Has{What: what, At: tok.pos}, nil
+		}
+		return nil, &SyntaxError{Pos: tok.valuePos, Msg: "has: needs image, location or tag"}
+	}
+	panic("search: unhandled field " + tok.name)
+}
+
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// Words returns the lowercased runs of letters and digits in the text
+// term's value, which are what it matches.
+func (e Text) Words() []string {
+	return strings.FieldsFunc(strings.ToLower(e.Value), func(r rune) bool {
+		return !isWordRune(r)
+	})
+}
+
+// Walk calls fn for expr and every expression in it, with whether it is
+// under a Not.
+func Walk(expr Expr, fn func(expr Expr, negated bool)) {
+	var walk func(Expr, bool)
+	walk = func(expr Expr, negated bool) {
+		fn(expr, negated)
+		switch e := expr.(type) {
+		case And:
+			for _, term := range e.Terms {
+				walk(term, negated)
+			}
+		case Or:
+			for _, term := range e.Terms {
+				walk(term, negated)
+			}
+		case Not:
+			walk(e.Expr, !negated)
+		}
+	}
+	if expr != nil {
+		walk(expr, false)
+	}
+}
+
+// TextTerms returns the text terms an entry has to, or may, contain to
+// match expr, leaving out those under a Not.
+func TextTerms(expr Expr) []Text {
+	var terms []Text
+	Walk(expr, func(expr Expr, negated bool) {
+		if text, ok := expr.(Text); ok && !negated {
+			terms = append(terms, text)
+		}
+	})
+	return terms
+}
+
+// HasText reports whether any part of expr searches the text.
+func HasText(expr Expr) bool {
+	found := false
+	Walk(expr, func(expr Expr, _ bool) {
+		if _, ok := expr.(Text); ok {
+			found = true
+		}
+	})
+	return found
+}
@@ -0,0 +1,154 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	june := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		query string
+		want  Expr
+	}{
+		{"", nil},
+		{"  + ", nil},
+		{"lisbon", Text{Value: "lisbon", At: 0}},
+		{"+lisbon hik*", And{Terms: []Expr{Text{Value: "lisbon", At: 1}, Text{Value: "hik", Prefix: true, At: 8}}}},
+		{`"exact phrase"`, Text{Value: "exact phrase", Phrase: true, At: 0}},
+		{"tag:travel -tag:draft", And{Terms: []Expr{
+			Tag{Key: "travel", At: 0},
+			Not{Expr: Tag{Key: "draft", At: 12}, At: 11},
+		}}},
+		{`location:"Lisbon, Portugal"`, Location{Name: "Lisbon, Portugal", At: 0}},
+		{"before:2024-06-01 after:2024-06-01T00:00:00Z", And{Terms: []Expr{
+			Before{Time: june, At: 0},
+			After{Time: june, At: 18},
+		}}},
+		{"has:Image", Has{What: HasImage, At: 0}},
+		{"a OR b c", Or{Terms: []Expr{
+			Text{Value: "a", At: 0},
+			And{Terms: []Expr{Text{Value: "b", At: 5}, Text{Value: "c", At: 7}}},
+		}}},
+		{"(a OR b) AND NOT c", And{Terms: []Expr{
+			Or{Terms: []Expr{Text{Value: "a", At: 1}, Text{Value: "b", At: 6}}},
+			Not{Expr: Text{Value: "c", At: 17}, At: 13},
+		}}},
+		{"well-known re:trip or", And{Terms: []Expr{
+			Text{Value: "well-known", At: 0},
+			Text{Value: "re:trip", At: 11},
+			Text{Value: "or", At: 19},
+		}}},
+		{"a - b", And{Terms: []Expr{Text{Value: "a", At: 0}, Text{Value: "b", At: 4}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+	}{
+		{`"unclosed`, 0},
+		{`tag:"unclosed`, 4},
+		{"(a OR b", 0},
+		{"a)", 1},
+		{"OR a", 0},
+		{"a OR", 4},
+		{"a AND", 5},
+		{"NOT", 3},
+		{"()", 1},
+		{"tag: x", 4},
+		{"before:yesterday", 7},
+		{"has:map", 4},
+		{"lisbon &&", 7},
+		{`""`, 0},
+		{strings.Repeat("(", maxDepth+2) + "a", maxDepth + 1},
+		{strings.Repeat("a ", maxTerms+1), 2 * maxTerms},
+		{strings.Repeat("a", MaxQueryLength+1), MaxQueryLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Parse(tt.query)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Parse error = %v, want a SyntaxError", err)
+			}
+			if syntaxErr.Pos != tt.pos {
+				t.Errorf("error %q at position %d, want %d", syntaxErr.Msg, syntaxErr.Pos, tt.pos)
+			}
+		})
+	}
+}
+
+func TestStringParsesBack(t *testing.T) {
+	for _, query := range []string{
+		`a OR (b c)`,
+		`-(a OR b) (c d) OR e`,
+		`NOT -a`,
+		`--a`,
+		`tag:"two words" location:x(y) before:2024-06-01T10:00:00+02:00`,
+	} {
+		expr, err := Parse(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := Parse(expr.String())
+		if err != nil {
+			t.Fatalf("%q: String() = %q doesn't parse: %v", query, expr.String(), err)
+		}
+		if again.String() != expr.String() {
+			t.Errorf("%q: %q parses back as %q", query, expr.String(), again.String())
+		}
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{
+		`tag:travel tag:work -tag:draft location:"Lisbon" before:2024-06-01 "exact phrase" has:image`,
+		`(a OR b) AND NOT c`,
+		`+hik* -"rain" after:2024-01-01T00:00:00Z`,
+		`((( NOT - ")`,
+		`tag: has:x before:`,
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, query string) {
+		expr, err := Parse(query)
+		if err != nil {
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Parse(%q) error %v isn't a SyntaxError", query, err)
+			}
+			if n := len([]rune(query)); syntaxErr.Pos < 0 || syntaxErr.Pos > n {
+				t.Fatalf("Parse(%q) error at %d, outside the query's %d characters", query, syntaxErr.Pos, n)
+			}
+			return
+		}
+		// Spaces and parentheses String adds can push it past the limit.
+		if expr == nil || len([]rune(expr.String())) > MaxQueryLength {
+			return
+		}
+		// Written back out, the query means the same thing.
+		again, err := Parse(expr.String())
+		if err != nil {
+			t.Fatalf("Parse(%q).String() = %q, which doesn't parse: %v", query, expr.String(), err)
+		}
+		if again.String() != expr.String() {
+			t.Fatalf("Parse(%q).String() = %q parses back as %q", query, expr.String(), again.String())
+		}
+	})
+}
@@ -0,0 +1,160 @@
+// Package search holds the parts of entry search that don't depend on the
+// store: picking out the terms of a query and highlighting them in results.
+package search
+
+import (
+	"JourneyAppServer/types"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxSnippets is how many snippets a result gets at most.
+	maxSnippets = 3
+	// snippetContext is about how many characters of text are kept on
+	// either side of a match.
+	snippetContext = 40
+	ellipsis       = "…"
+)
+
+// Terms returns the lowercased words and phrases of a query to highlight
+// in the entries it matches, leaving out those under a Not.
+func Terms(expr Expr) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, text := range TextTerms(expr) {
+		term := strings.TrimFunc(strings.ToLower(text.Value), func(r rune) bool { return !isWordRune(r) })
+		if term != "" && !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// Snippets cuts the parts of text around words starting with one of terms
+// out of it, with those words highlighted. If nothing matches, as when an
+// entry was found by its tags, the one snippet is the start of the text.
+// Offsets count Unicode code points.
+func Snippets(text string, terms []string) []types.SearchSnippet {
+	runes := []rune(text)
+	matches := findTerms(runes, terms)
+	if len(matches) == 0 {
+		if len(runes) == 0 {
+			return []types.SearchSnippet{}
+		}
+		return []types.SearchSnippet{snippet(runes, 0, boundaryAfter(runes, 2*snippetContext), nil)}
+	}
+
+	// Windows around nearby matches are merged into one snippet.
+	var snippets []types.SearchSnippet
+	previousEnd := 0
+	for i := 0; i < len(matches) && len(snippets) < maxSnippets; {
+		start := boundaryBefore(runes, matches[i].Start-snippetContext)
+		if start < previousEnd {
+			start = previousEnd
+			for unicode.IsSpace(runes[start]) {
+				start++
+			}
+		}
+		end := boundaryAfter(runes, matches[i].End+snippetContext)
+		j := i + 1
+		for j < len(matches) && matches[j].Start < end {
+			end = boundaryAfter(runes, matches[j].End+snippetContext)
+			j++
+		}
+		snippets = append(snippets, snippet(runes, start, end, matches[i:j]))
+		previousEnd = end
+		i = j
+	}
+	return snippets
+}
+
+// findTerms returns where words starting with a term are in text, in order.
+func findTerms(text []rune, terms []string) []types.TextRange {
+	lower := make([]rune, len(text))
+	for i, r := range text {
+		lower[i] = unicode.ToLower(r)
+	}
+	termRunes := make([][]rune, len(terms))
+	for i, term := range terms {
+		termRunes[i] = []rune(term)
+	}
+	var matches []types.TextRange
+	for i := 0; i < len(lower); i++ {
+		if i > 0 && isWordRune(lower[i-1]) {
+			continue
+		}
+		// The longest term wins when several start here.
+		best := 0
+		for _, term := range termRunes {
+			if len(term) > best && hasPrefix(lower[i:], term) {
+				best = len(term)
+			}
+		}
+		if best > 0 {
+			matches = append(matches, types.TextRange{Start: i, End: i + best})
+			i += best - 1
+		}
+	}
+	return matches
+}
+
+func hasPrefix(s, prefix []rune) bool {
+	if len(prefix) > len(s) {
+		return false
+	}
+	for i := range prefix {
+		if s[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// snippet is text[start:end] on one line, with an ellipsis on either end
+// that cuts the text short and the matches moved to match.
+func snippet(text []rune, start, end int, matches []types.TextRange) types.SearchSnippet {
+	var b strings.Builder
+	offset := -start
+	if start > 0 {
+		b.WriteString(ellipsis)
+		offset += len([]rune(ellipsis))
+	}
+	b.WriteString(strings.ReplaceAll(string(text[start:end]), "\n", " "))
+	if end < len(text) {
+		b.WriteString(ellipsis)
+	}
+	highlights := make([]types.TextRange, len(matches))
+	for i, m := range matches {
+		highlights[i] = types.TextRange{Start: m.Start + offset, End: m.End + offset}
+	}
+	return types.SearchSnippet{Text: b.String(), Highlights: highlights}
+}
+
+// boundaryBefore moves i back to the start of the word it falls in, and
+// boundaryAfter moves it forward to the end of one, so snippets don't cut
+// words in half.
+func boundaryBefore(text []rune, i int) int {
+	if i <= 0 {
+		return 0
+	}
+	for i > 0 && !unicode.IsSpace(text[i-1]) {
+		i--
+	}
+	return i
+}
+
+func boundaryAfter(text []rune, i int) int {
+	if i >= len(text) {
+		return len(text)
+	}
+	for i < len(text) && !unicode.IsSpace(text[i]) {
+		i++
+	}
+	return i
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,73 @@
+package search
+
+import (
+	"JourneyAppServer/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTerms(t *testing.T) {
+	expr, err := Parse(`+Hiking "Lake Bled" -rain NOT (snow OR hail) hik* tag:trip Hiking,`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := Terms(expr)
+	want := []string{"hiking", "lake bled", "hik"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Terms = %q, want %q", got, want)
+	}
+}
+
+func TestSnippetsHighlightMatches(t *testing.T) {
+	got := Snippets("We went Hiking by the lake.", []string{"hiking", "lake"})
+	want := []types.SearchSnippet{{
+		Text:       "We went Hiking by the lake.",
+		Highlights: []types.TextRange{{Start: 8, End: 14}, {Start: 22, End: 26}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Snippets = %+v, want %+v", got, want)
+	}
+}
+
+func TestSnippetsOnlyMatchWordStarts(t *testing.T) {
+	got := Snippets("a stake and a lakeside", []string{"lake"})
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Highlights, []types.TextRange{{Start: 14, End: 18}}) {
+		t.Errorf("Snippets = %+v, want only lakeside highlighted", got)
+	}
+}
+
+func TestSnippetsAreCutAroundMatches(t *testing.T) {
+	filler := strings.Repeat("filler ", 30)
+	text := filler + "first café\n" + filler + "second café " + filler
+	got := Snippets(text, []string{"café"})
+	if len(got) != 2 {
+		t.Fatalf("got %d snippets, want 2: %+v", len(got), got)
+	}
+	for _, snippet := range got {
+		if !strings.HasPrefix(snippet.Text, "…") || !strings.HasSuffix(snippet.Text, "…") {
+			t.Errorf("snippet %q isn't cut at both ends", snippet.Text)
+		}
+		if strings.Contains(snippet.Text, "\n") {
+			t.Errorf("snippet %q has a line break", snippet.Text)
+		}
+		if len(snippet.Highlights) != 1 {
+			t.Fatalf("snippet %q has %d highlights, want 1", snippet.Text, len(snippet.Highlights))
+		}
+		h := snippet.Highlights[0]
+		if got := string([]rune(snippet.Text)[h.Start:h.End]); got != "café" {
+			t.Errorf("highlight of %q is %q, want café", snippet.Text, got)
+		}
+	}
+}
+
+func TestSnippetsWithoutMatchesStartTheText(t *testing.T) {
+	got := Snippets("tagged, not matched", nil)
+	want := []types.SearchSnippet{{Text: "tagged, not matched", Highlights: []types.TextRange{}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Snippets = %+v, want %+v", got, want)
+	}
+	if got := Snippets("", []string{"x"}); len(got) != 0 {
+		t.Errorf("Snippets of empty text = %+v, want none", got)
+	}
+}
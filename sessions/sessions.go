@@ -0,0 +1,137 @@
+package sessions
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidRefreshToken covers unknown, expired, revoked and replayed
+// refresh tokens; callers respond with 401 either way.
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+type Tokens struct {
+	SessionID      string
+	AccessToken    string
+	TokenExpiresAt time.Time
+	RefreshToken   string
+}
+
+// Device describes where a session was started, for the per-device list.
+type Device struct {
+	Name      string
+	UserAgent string
+	ClientIP  string
+}
+
+func DeviceFromRequest(r *http.Request) Device {
+	return Device{
+		Name:      r.Header.Get("X-Device-Model"),
+		UserAgent: r.Header.Get("User-Agent"),
+		ClientIP:  utils.ClientIP(r),
+	}
+}
+
+// Start creates a session for user and returns its first token pair.
+func Start(store *db.Store, user types.User, sessionOption string, device Device) (Tokens, error) {
+	lifetime, err := utils.SessionLifetime(sessionOption)
+	if err != nil {
+		return Tokens{}, err
+	}
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	now := time.Now().UTC()
+	session := types.Session{
+		ID:               uuid.New().String(),
+		UserID:           user.UserID,
+		Username:         user.Username,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		DeviceName:       device.Name,
+		UserAgent:        device.UserAgent,
+		ClientIP:         device.ClientIP,
+		CreatedAt:        now,
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(lifetime),
+	}
+	if err := store.Sessions.Create(session); err != nil {
+		return Tokens{}, err
+	}
+
+	accessToken, expiresAt, err := utils.GenerateAccessToken(user.Username, session.ID, session.ExpiresAt)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{
+		SessionID:      session.ID,
+		AccessToken:    accessToken,
+		TokenExpiresAt: expiresAt,
+		RefreshToken:   refreshToken,
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair. Presenting a token
+// that has already been rotated means it was copied, so the whole session is
+// revoked.
+func Refresh(store *db.Store, refreshToken string) (Tokens, error) {
+	hash := utils.HashToken(refreshToken)
+	session, err := store.Sessions.GetByRefreshHash(hash)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return Tokens{}, ErrInvalidRefreshToken
+		}
+		return Tokens{}, err
+	}
+
+	if session.RefreshTokenHash != hash {
+		utils.LM.Logger.Printf("Refresh token reuse detected, revoking session: username=%s, session=%s", session.Username, session.ID)
+		if err := store.Sessions.Revoke(session.ID); err != nil && !errors.Is(err, db.ErrNotFound) {
+			return Tokens{}, err
+		}
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+	if !session.RevokedAt.IsZero() || time.Now().After(session.ExpiresAt) {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+
+	newRefreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return Tokens{}, err
+	}
+	if err := store.Sessions.Rotate(session.ID, hash, utils.HashToken(newRefreshToken)); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return Tokens{}, ErrInvalidRefreshToken
+		}
+		return Tokens{}, err
+	}
+
+	accessToken, expiresAt, err := utils.GenerateAccessToken(session.Username, session.ID, session.ExpiresAt)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{
+		SessionID:      session.ID,
+		AccessToken:    accessToken,
+		TokenExpiresAt: expiresAt,
+		RefreshToken:   newRefreshToken,
+	}, nil
+}
+
+// Active reports whether an access token's session can still be used.
+func Active(store *db.Store, sessionID, username string) (bool, error) {
+	session, err := store.Sessions.Get(sessionID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return session.Username == username && session.RevokedAt.IsZero() && time.Now().Before(session.ExpiresAt), nil
+}
@@ -0,0 +1,72 @@
+package sessions
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"errors"
+	"testing"
+)
+
+func start(t *testing.T) (*db.Store, Tokens) {
+	t.Helper()
+	store := db.NewMemoryStore()
+	alice := types.User{UserID: "alice-id", Username: "alice"}
+	if err := store.Users.Create(alice); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := Start(store, alice, "weekly", Device{Name: "iPhone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, tokens
+}
+
+func TestRefreshRotatesTheRefreshToken(t *testing.T) {
+	store, first := start(t)
+
+	second, err := Refresh(store, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.SessionID != first.SessionID {
+		t.Fatalf("session = %s, want %s", second.SessionID, first.SessionID)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == "" {
+		t.Fatalf("refresh didn't hand out new tokens: %+v", second)
+	}
+
+	third, err := Refresh(store, second.RefreshToken)
+	if err != nil {
+		t.Fatalf("refreshing with the new token: %v", err)
+	}
+	if active, err := Active(store, third.SessionID, "alice"); !active || err != nil {
+		t.Fatalf("Active = %v, %v", active, err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesTheSession(t *testing.T) {
+	store, first := start(t)
+	second, err := Refresh(store, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rotated-out token turning up again means it was copied.
+	if _, err := Refresh(store, first.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("reused token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+	if active, err := Active(store, first.SessionID, "alice"); active || err != nil {
+		t.Fatalf("Active after reuse = %v, %v; want revoked", active, err)
+	}
+	// Whoever holds the current token is signed out too.
+	if _, err := Refresh(store, second.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("current token after reuse: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestRefreshRejectsUnknownTokens(t *testing.T) {
+	store, _ := start(t)
+	if _, err := Refresh(store, "rt_unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
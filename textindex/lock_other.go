@@ -0,0 +1,11 @@
+//go:build !unix
+
+package textindex
+
+import "os"
+
+// lockFile does nothing where flock isn't available, which leaves it to
+// whoever runs the server not to open an index from two processes.
+func lockFile(f *os.File) error {
+	return nil
+}
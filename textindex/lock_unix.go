@@ -0,0 +1,14 @@
+//go:build unix
+
+package textindex
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on f that lasts until it is closed, or
+// fails at once if another process has one.
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
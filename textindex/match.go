@@ -0,0 +1,169 @@
+package textindex
+
+import (
+	"JourneyAppServer/search"
+	"math"
+	"strings"
+)
+
+// prefixWeight is how much a word a prefix term's last word starts counts
+// for, against 1 for the word itself. A word a typo away counts half, and
+// one two away a third.
+const prefixWeight = 0.8
+
+// BM25's parameters, at their usual values.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Match returns the IDs of userID's entries that term matches, with their
+// BM25 scores. A word of the term matches itself and, unless the term is a
+// quoted phrase, words a typo or two away; the last word of a prefix term
+// matches any word it starts. Several words have to be next to each other
+// in that order.
+func (x *Index) Match(userID string, term search.Text) (map[string]float64, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	scores := make(map[string]float64)
+	u := x.users[userID]
+	words := tokenize(term.Value)
+	if u == nil || len(words) == 0 {
+		return scores, nil
+	}
+
+	alternatives := make([]map[string]float64, len(words))
+	for i, word := range words {
+		alternatives[i] = u.alternatives(word, term.Prefix && i == len(words)-1, !term.Phrase)
+		if len(alternatives[i]) == 0 {
+			return scores, nil
+		}
+	}
+
+	// frequencies are how often, weighted, the term is in each entry.
+	frequencies := make(map[string]float64)
+	for first, weight := range alternatives[0] {
+		for entryID, positions := range u.postings[first] {
+			doc := u.docs[entryID]
+			for _, p := range positions {
+				if w := occurrence(doc, p, alternatives, weight); w > 0 {
+					frequencies[entryID] += w
+				}
+			}
+		}
+	}
+
+	n := float64(len(u.docs))
+	averageLength := float64(u.totalWords) / n
+	df := float64(len(frequencies))
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+	for entryID, tf := range frequencies {
+		length := float64(len(u.docs[entryID]))
+		scores[entryID] = idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*length/averageLength))
+	}
+	return scores, nil
+}
+
+// occurrence is the weight of the term starting at doc[p], whose first word
+// has weight, or 0 if the rest of the term doesn't follow it.
+func occurrence(doc []string, p int, alternatives []map[string]float64, weight float64) float64 {
+	if p+len(alternatives) > len(doc) {
+		return 0
+	}
+	for i := 1; i < len(alternatives); i++ {
+		w, ok := alternatives[i][doc[p+i]]
+		if !ok {
+			return 0
+		}
+		weight = math.Min(weight, w)
+	}
+	return weight
+}
+
+// alternatives returns the words of the user's vocabulary word matches,
+// with their weights. The vocabulary is scanned for prefixes and typos,
+// which is quick enough at the size of one person's journal.
+func (u *userIndex) alternatives(word string, prefix, typos bool) map[string]float64 {
+	found := make(map[string]float64)
+	if _, ok := u.postings[word]; ok {
+		found[word] = 1
+	}
+	maxEdits := 0
+	if typos && !prefix {
+		maxEdits = editsAllowed(word)
+	}
+	if !prefix && maxEdits == 0 {
+		return found
+	}
+	for candidate := range u.postings {
+		if candidate == word {
+			continue
+		}
+		if prefix {
+			if strings.HasPrefix(candidate, word) {
+				found[candidate] = prefixWeight
+			}
+			continue
+		}
+		if d := distance([]rune(word), []rune(candidate), maxEdits); d <= maxEdits {
+			found[candidate] = 1 / float64(1+d)
+		}
+	}
+	return found
+}
+
+// editsAllowed is how many typos a word can have and still match: none in
+// short words, where one would match too much, and two in long ones.
+func editsAllowed(word string) int {
+	switch n := len([]rune(word)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	}
+	return 2
+}
+
+// distance is the number of insertions, deletions, substitutions and swaps
+// of neighbouring characters that turn a into b, or limit+1 if it is more
+// than limit.
+func distance(a, b []rune, limit int) int {
+	if abs(len(a)-len(b)) > limit {
+		return limit + 1
+	}
+	// prev2, prev and row are the last three rows of the usual dynamic
+	// programming table.
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	row := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		row[0] = i
+		rowMin := row[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			row[j] = min(prev[j]+1, row[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				row[j] = min(row[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, row[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, row = prev, row, prev2
+	}
+	return min(prev[len(b)], limit+1)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
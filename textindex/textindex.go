@@ -0,0 +1,311 @@
+// Package textindex is an inverted index of entry text kept in a directory
+// on disk, for searching without MySQL's FULLTEXT index and its minimum word
+// length and stopwords. On top of whole words and phrases it matches words
+// by prefix and with a typo or two.
+//
+// The index is held in memory and made durable by a log of every change,
+// which is folded into a snapshot of the whole index from time to time. Only
+// one process can have a directory open at once.
+package textindex
+
+import (
+	"JourneyAppServer/utils"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	snapshotName = "snapshot.jsonl"
+	logName      = "log.jsonl"
+	lockName     = "LOCK"
+
+	// compactAfter is how many changes are logged before they are folded
+	// into a new snapshot.
+	compactAfter = 10000
+)
+
+// record is one line of the snapshot or the log. The snapshot only holds
+// opIndex records, one for each entry.
+type record struct {
+	Op      string   `json:"op"`
+	UserID  string   `json:"user,omitempty"`
+	EntryID string   `json:"entry,omitempty"`
+	Words   []string `json:"words,omitempty"`
+}
+
+const (
+	opIndex      = "index"
+	opRemove     = "remove"
+	opRemoveUser = "removeUser"
+	opClear      = "clear"
+)
+
+// Index is an open index directory. It is safe for concurrent use.
+type Index struct {
+	mu   sync.RWMutex
+	dir  string
+	lock *os.File
+	log  *os.File
+	// logged is how many records the log has.
+	logged int
+	users  map[string]*userIndex
+}
+
+// userIndex is one user's entries. Searches never cross users, so each has
+// its own vocabulary and document frequencies.
+type userIndex struct {
+	// docs has the words of each entry, in order.
+	docs map[string][]string
+	// postings has the entries each word is in, and where.
+	postings   map[string]map[string][]int
+	totalWords int
+}
+
+// Open opens the index in dir, creating it if it doesn't exist.
+func Open(dir string) (*Index, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(filepath.Join(dir, lockName), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(lock); err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("search index %s is in use by another process: %w", dir, err)
+	}
+
+	x := &Index{dir: dir, lock: lock, users: make(map[string]*userIndex)}
+	if _, err := x.replay(filepath.Join(dir, snapshotName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		lock.Close()
+		return nil, fmt.Errorf("reading search index snapshot: %w", err)
+	}
+	if x.logged, err = x.replay(filepath.Join(dir, logName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		lock.Close()
+		return nil, fmt.Errorf("reading search index log: %w", err)
+	}
+	if x.log, err = os.OpenFile(filepath.Join(dir, logName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return x, nil
+}
+
+// replay applies the records in the file at path, returning how many there
+// were. A last line cut short by a crash while it was written is dropped.
+func (x *Index) replay(path string) (int, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	count := 0
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(bytes.TrimSpace(line)) > 0 {
+				utils.LM.Logger.Printf("Dropping an incomplete record at the end of %s", path)
+				return count, f.Truncate(offset)
+			}
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return count, fmt.Errorf("%s at byte %d: %w", path, offset, err)
+		}
+		x.apply(rec)
+		offset += int64(len(line))
+		count++
+	}
+}
+
+// Close writes a new snapshot if anything has changed since the last one
+// and releases the directory.
+func (x *Index) Close() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var err error
+	if x.logged > 0 {
+		err = x.compact()
+	}
+	if closeErr := x.log.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := x.lock.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Index adds or replaces the plain text of one of userID's entries.
+func (x *Index) Index(userID, entryID, plainText string) error {
+	return x.write(record{Op: opIndex, UserID: userID, EntryID: entryID, Words: tokenize(plainText)})
+}
+
+// Remove drops an entry from the index, if it is there.
+func (x *Index) Remove(userID, entryID string) error {
+	return x.write(record{Op: opRemove, UserID: userID, EntryID: entryID})
+}
+
+// RemoveUser drops every one of userID's entries.
+func (x *Index) RemoveUser(userID string) error {
+	return x.write(record{Op: opRemoveUser, UserID: userID})
+}
+
+// Clear empties the index, as before rebuilding it.
+func (x *Index) Clear() error {
+	return x.write(record{Op: opClear})
+}
+
+// write logs rec and then applies it, so the index in memory never has a
+// change the log doesn't.
+func (x *Index) write(rec record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if _, err := x.log.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := x.log.Sync(); err != nil {
+		return err
+	}
+	x.apply(rec)
+	x.logged++
+	if x.logged >= compactAfter {
+		return x.compact()
+	}
+	return nil
+}
+
+func (x *Index) apply(rec record) {
+	switch rec.Op {
+	case opIndex:
+		x.user(rec.UserID).remove(rec.EntryID)
+		x.user(rec.UserID).add(rec.EntryID, rec.Words)
+	case opRemove:
+		if u := x.users[rec.UserID]; u != nil {
+			u.remove(rec.EntryID)
+		}
+	case opRemoveUser:
+		delete(x.users, rec.UserID)
+	case opClear:
+		x.users = make(map[string]*userIndex)
+	}
+}
+
+func (x *Index) user(userID string) *userIndex {
+	u := x.users[userID]
+	if u == nil {
+		u = &userIndex{docs: make(map[string][]string), postings: make(map[string]map[string][]int)}
+		x.users[userID] = u
+	}
+	return u
+}
+
+// compact writes the whole index to a new snapshot and empties the log. A
+// crash part way through leaves either the old snapshot and the whole log,
+// or the new snapshot and a log that changes nothing when replayed on it.
+func (x *Index) compact() error {
+	tmp, err := os.CreateTemp(x.dir, snapshotName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for userID, u := range x.users {
+		for entryID, words := range u.docs {
+			if err := enc.Encode(record{Op: opIndex, UserID: userID, EntryID: entryID, Words: words}); err != nil {
+				tmp.Close()
+				return err
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(x.dir, snapshotName)); err != nil {
+		return err
+	}
+	if dir, err := os.Open(x.dir); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	if err := x.log.Truncate(0); err != nil {
+		return err
+	}
+	x.logged = 0
+	return x.log.Sync()
+}
+
+func (u *userIndex) add(entryID string, words []string) {
+	u.docs[entryID] = words
+	u.totalWords += len(words)
+	for i, word := range words {
+		if u.postings[word] == nil {
+			u.postings[word] = make(map[string][]int)
+		}
+		u.postings[word][entryID] = append(u.postings[word][entryID], i)
+	}
+}
+
+func (u *userIndex) remove(entryID string) {
+	words, ok := u.docs[entryID]
+	if !ok {
+		return
+	}
+	for _, word := range words {
+		delete(u.postings[word], entryID)
+		if len(u.postings[word]) == 0 {
+			delete(u.postings, word)
+		}
+	}
+	u.totalWords -= len(words)
+	delete(u.docs, entryID)
+}
+
+// tokenize splits text into the words the index keeps: runs of letters and
+// digits, lowercased and without accents, so "Café" and "cafe" are the same
+// word.
+func tokenize(text string) []string {
+	fold := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(fold, strings.ToLower(text))
+	if err != nil {
+		folded = strings.ToLower(text)
+	}
+	return strings.FieldsFunc(folded, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
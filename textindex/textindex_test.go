@@ -0,0 +1,182 @@
+package textindex
+
+import (
+	"JourneyAppServer/search"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func open(t *testing.T, dir string) *Index {
+	t.Helper()
+	x, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return x
+}
+
+// matched returns the IDs of alice's entries query matches, best first.
+func matched(t *testing.T, x *Index, query string) string {
+	t.Helper()
+	expr, err := search.Parse(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scores, err := x.Match("alice", expr.(search.Text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	return strings.Join(ids, " ")
+}
+
+func TestMatch(t *testing.T) {
+	x := open(t, t.TempDir())
+	defer x.Close()
+	for id, text := range map[string]string{
+		"lisbon":  "Took the tram up to the castle in Lisbon.",
+		"cafe":    "Coffee at the Café Central, then the museum.",
+		"hiking":  "Hiking all day, hiking boots soaked.",
+		"hikers":  "Met two hikers at the hut.",
+		"unicode": "Über-long day.",
+	} {
+		if err := x.Index("alice", id, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := x.Index("bob", "bobs", "Lisbon again"); err != nil {
+		t.Fatal(err)
+	}
+
+	for query, want := range map[string]string{
+		"lisbon":             "lisbon",
+		"Lisbon":             "lisbon",
+		"lisbn":              "lisbon",
+		"lsibon":             "lisbon",
+		"cafe":               "cafe",
+		"café":               "cafe",
+		"uber":               "unicode",
+		"hik*":               "hiking hikers",
+		"hiking":             "hiking",
+		`"tram up"`:          "lisbon",
+		`"up tram"`:          "",
+		`"the castel"`:       "",
+		"castel":             "lisbon",
+		"the":                "cafe lisbon hikers",
+		"a":                  "",
+		"tap":                "",
+		"cafe-centrl":        "cafe",
+		`"central then the"`: "cafe",
+	} {
+		if got := matched(t, x, query); got != want {
+			t.Errorf("%s: got [%s], want [%s]", query, got, want)
+		}
+	}
+}
+
+func TestIndexSurvivesReopening(t *testing.T) {
+	dir := t.TempDir()
+	x := open(t, dir)
+	x.Index("alice", "kept", "kept entry")
+	x.Index("alice", "changed", "first text")
+	x.Index("alice", "changed", "second text")
+	x.Index("alice", "removed", "removed entry")
+	x.Remove("alice", "removed")
+	x.Index("carol", "gone", "carol's entry")
+	x.RemoveUser("carol")
+
+	check := func(x *Index) {
+		t.Helper()
+		for query, want := range map[string]string{
+			"entry":  "kept",
+			"first":  "",
+			"second": "changed",
+		} {
+			if got := matched(t, x, query); got != want {
+				t.Errorf("%s: got [%s], want [%s]", query, got, want)
+			}
+		}
+		if x.users["carol"] != nil {
+			t.Errorf("carol's entries are still indexed")
+		}
+	}
+
+	// Reopening without closing replays the log.
+	x.log.Close()
+	x.lock.Close()
+	x = open(t, dir)
+	check(x)
+	// Closing folds it into the snapshot.
+	if err := x.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, logName)); err != nil || info.Size() != 0 {
+		t.Fatalf("log after Close: %v, %v", info, err)
+	}
+	x = open(t, dir)
+	defer x.Close()
+	check(x)
+}
+
+func TestIncompleteLastRecordIsDropped(t *testing.T) {
+	dir := t.TempDir()
+	x := open(t, dir)
+	x.Index("alice", "kept", "kept entry")
+	x.log.Write([]byte(`{"op":"index","user":"alice","entry":"torn","words":["to`))
+	x.log.Close()
+	x.lock.Close()
+
+	x = open(t, dir)
+	if got := matched(t, x, "entry"); got != "kept" {
+		t.Fatalf("got [%s], want [kept]", got)
+	}
+	x.Index("alice", "after", "entry written after")
+	x.log.Close()
+	x.lock.Close()
+	x = open(t, dir)
+	defer x.Close()
+	if got := matched(t, x, "entry"); got != "after kept" && got != "kept after" {
+		t.Fatalf("got [%s], want after and kept", got)
+	}
+}
+
+func TestOpenLocksTheDirectory(t *testing.T) {
+	dir := t.TempDir()
+	x := open(t, dir)
+	if _, err := Open(dir); err == nil {
+		t.Fatal("opened an index that is already open")
+	}
+	x.Close()
+	x = open(t, dir)
+	x.Close()
+}
+
+func TestDistance(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"lisbon", "lisbon", 0},
+		{"lisbon", "lisbn", 1},
+		{"lisbon", "lsibon", 1},
+		{"lisbon", "lisboa", 1},
+		{"lisbon", "lsbona", 2},
+		{"lisbon", "porto", 3},
+	} {
+		if got := distance([]rune(tc.a), []rune(tc.b), 2); got != tc.want {
+			t.Errorf("distance(%s, %s) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
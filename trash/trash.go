@@ -0,0 +1,107 @@
+// Package trash purges deleted entries, and their images in S3, once they
+// have been in the trash for the retention period or the user empties it.
+package trash
+
+import (
+	"JourneyAppServer/aws"
+	"JourneyAppServer/config"
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"errors"
+	"time"
+)
+
+var policy = config.Default().Trash
+
+// deleteImage and deleteEntryImages are the S3 calls, swapped out by tests.
+var (
+	deleteImage       = aws.DeleteImage
+	deleteEntryImages = aws.BulkDeleteImages
+)
+
+// Configure sets the retention period. It must run before the server starts
+// handling requests.
+func Configure(cfg config.TrashConfig) {
+	policy = cfg
+}
+
+func RetentionDays() int {
+	return policy.RetentionDays
+}
+
+// Empty purges every entry in userID's trash and returns how many it purged.
+func Empty(store *db.Store, userID string) (int, error) {
+	return purge(store, userID, time.Time{})
+}
+
+// PurgeExpired purges every user's entries that have been in the trash
+// longer than the retention period.
+func PurgeExpired(store *db.Store) (int, error) {
+	return purge(store, "", time.Now().UTC().AddDate(0, 0, -policy.RetentionDays))
+}
+
+func purge(store *db.Store, userID string, before time.Time) (int, error) {
+	purged := 0
+	for {
+		entries, err := store.Entries.Trashed(userID, before, policy.PurgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		for _, e := range entries {
+			err := purgeEntry(store, e)
+			if errors.Is(err, db.ErrNotFound) {
+				// Restored since it was listed.
+				continue
+			}
+			if err != nil {
+				return purged, err
+			}
+			purged++
+		}
+		if len(entries) < policy.PurgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// purgeEntry deletes the row before the images, so an entry restored in the
+// meantime keeps them. Images that fail to delete are logged and left behind
+// rather than keeping the entry around to retry.
+func purgeEntry(store *db.Store, e types.Entry) error {
+	err := store.Entries.Purge(db.EntryKey{ID: e.ID, UserID: e.UserID, Timestamp: e.Timestamp})
+	if err != nil {
+		return err
+	}
+	for _, imageKey := range e.Images {
+		if res := deleteImage(imageKey); !res.Success {
+			utils.LM.Logger.Printf("Error deleting S3 image %s for purged entry %s", imageKey, e.ID)
+		}
+	}
+	// Uploads that never made it onto the entry are under its prefix too.
+	if res := deleteEntryImages(e.Username, e.ID); !res.Success {
+		utils.LM.Logger.Printf("Error deleting S3 prefix of purged entry %s", e.ID)
+	}
+	utils.LM.Logger.Printf("Purged entry: id=%s, userId=%s", e.ID, e.UserID)
+	return nil
+}
+
+// RunPurger calls PurgeExpired every interval until stop is closed.
+func RunPurger(store *db.Store, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			purged, err := PurgeExpired(store)
+			if err != nil {
+				utils.LM.Logger.Printf("Trash purge error: %v", err)
+			}
+			if purged > 0 {
+				utils.LM.Logger.Printf("Purged %d entries from the trash", purged)
+			}
+		}
+	}
+}
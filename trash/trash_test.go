@@ -0,0 +1,155 @@
+package trash
+
+import (
+	"JourneyAppServer/config"
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// deletedImages stands in for S3, recording what purging deletes.
+type deletedImages struct {
+	images   []string
+	prefixes []string
+}
+
+func fakeS3(t *testing.T) *deletedImages {
+	t.Helper()
+	deleted := &deletedImages{}
+	savedImage, savedPrefix := deleteImage, deleteEntryImages
+	deleteImage = func(key string) types.DeleteImageResponse {
+		deleted.images = append(deleted.images, key)
+		return types.DeleteImageResponse{Success: true}
+	}
+	deleteEntryImages = func(username, entryID string) types.DeleteImageResponse {
+		deleted.prefixes = append(deleted.prefixes, username+"/"+entryID)
+		return types.DeleteImageResponse{Success: true}
+	}
+	t.Cleanup(func() { deleteImage, deleteEntryImages = savedImage, savedPrefix })
+	return deleted
+}
+
+func keyOf(id string) db.EntryKey {
+	return db.EntryKey{ID: id, UserID: "alice-id"}
+}
+
+// trashedStore has alice's entries, each edited once so it has a revision,
+// and then moved to the trash.
+func trashedStore(t *testing.T, ids ...string) *db.Store {
+	t.Helper()
+	store := db.NewMemoryStore()
+	if err := store.Users.Create(types.User{UserID: "alice-id", Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	for i, id := range ids {
+		entry := types.Entry{
+			ID: id, UserID: "alice-id", Username: "alice", Text: "first draft",
+			Timestamp: time.Date(2024, 5, 1+i, 12, 0, 0, 0, time.UTC),
+			Images:    []string{"images/alice/" + id + "/photo.jpg"},
+		}
+		if err := store.Entries.Create(entry); err != nil {
+			t.Fatal(err)
+		}
+		text := "second draft"
+		if _, err := store.Entries.Patch(keyOf(id), types.EntryPatch{Text: &text}, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Entries.Delete(keyOf(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestEmptyPurgesEntriesAndRevisions(t *testing.T) {
+	deleted := fakeS3(t)
+	store := trashedStore(t, "lake")
+
+	purged, err := Empty(store, "alice-id")
+	if err != nil || purged != 1 {
+		t.Fatalf("Empty = %d, %v; want 1", purged, err)
+	}
+	if err := store.Entries.Undelete(keyOf("lake")); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("restoring a purged entry: err = %v, want ErrNotFound", err)
+	}
+	if !reflect.DeepEqual(deleted.images, []string{"images/alice/lake/photo.jpg"}) || !reflect.DeepEqual(deleted.prefixes, []string{"alice/lake"}) {
+		t.Errorf("S3 deletes: images %v, prefixes %v", deleted.images, deleted.prefixes)
+	}
+
+	// An entry created with the same ID starts without the old revisions.
+	if err := store.Entries.Create(types.Entry{ID: "lake", UserID: "alice-id", Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if revs, err := store.Entries.Revisions(keyOf("lake")); err != nil || len(revs) != 0 {
+		t.Fatalf("revisions after purge = %v, %v; want none", revs, err)
+	}
+}
+
+func TestPurgeWorksThroughBatches(t *testing.T) {
+	fakeS3(t)
+	Configure(config.TrashConfig{RetentionDays: 30, PurgeBatchSize: 2})
+	t.Cleanup(func() { Configure(config.Default().Trash) })
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		ids = append(ids, fmt.Sprintf("entry-%d", i))
+	}
+	store := trashedStore(t, ids...)
+
+	// Nothing has been in the trash for 30 days yet.
+	if purged, err := PurgeExpired(store); err != nil || purged != 0 {
+		t.Fatalf("PurgeExpired = %d, %v; want 0", purged, err)
+	}
+	if purged, err := Empty(store, "alice-id"); err != nil || purged != 5 {
+		t.Fatalf("Empty = %d, %v; want 5", purged, err)
+	}
+	if left, err := store.Entries.Trashed("alice-id", time.Time{}, 10); err != nil || len(left) != 0 {
+		t.Fatalf("still in the trash: %v, %v", left, err)
+	}
+}
+
+// restoringEntries restores an entry as soon as a purge batch has listed
+// it, as a user might while the purge is running.
+type restoringEntries struct {
+	db.EntryRepository
+	restore db.EntryKey
+}
+
+func (r restoringEntries) Trashed(userID string, before time.Time, limit int) ([]types.Entry, error) {
+	entries, err := r.EntryRepository.Trashed(userID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.EntryRepository.Undelete(r.restore); err != nil && !errors.Is(err, db.ErrNotFound) {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func TestPurgeSkipsEntriesRestoredMidBatch(t *testing.T) {
+	deleted := fakeS3(t)
+	store := trashedStore(t, "lake", "hike")
+	store.Entries = restoringEntries{EntryRepository: store.Entries, restore: keyOf("lake")}
+
+	purged, err := Empty(store, "alice-id")
+	if err != nil || purged != 1 {
+		t.Fatalf("Empty = %d, %v; want 1", purged, err)
+	}
+	entry, err := store.Entries.Get(keyOf("lake"))
+	if err != nil {
+		t.Fatalf("restored entry: %v", err)
+	}
+	if len(entry.Images) != 1 {
+		t.Errorf("restored entry lost its images: %v", entry.Images)
+	}
+	if !reflect.DeepEqual(deleted.images, []string{"images/alice/hike/photo.jpg"}) {
+		t.Errorf("deleted images %v, want only hike's", deleted.images)
+	}
+	if revs, err := store.Entries.Revisions(keyOf("lake")); err != nil || len(revs) != 1 {
+		t.Errorf("restored entry's revisions = %v, %v; want 1", revs, err)
+	}
+}
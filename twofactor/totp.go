@@ -0,0 +1,83 @@
+package twofactor
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238). They are the defaults every authenticator app
+// assumes, so they are left out of the otpauth URI.
+const (
+	secretBytes = 20
+	codeDigits  = 6
+	stepSeconds = 30
+	// skewSteps accepts the codes either side of the current one, for clocks
+	// that drift or a code typed just as it changes.
+	skewSteps = 1
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func generateSecret() (string, error) {
+	b := make([]byte, secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating random bytes: %v", err)
+	}
+	return secretEncoding.EncodeToString(b), nil
+}
+
+// otpauthURI is what authenticator apps read from the enrollment QR code.
+func otpauthURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+func step(t time.Time) int64 {
+	return t.Unix() / stepSeconds
+}
+
+func codeAt(secret string, counter int64) (string, error) {
+	key, err := secretEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", codeDigits, value%1000000), nil
+}
+
+// matchStep returns the time step code is valid for around now, or false.
+func matchStep(secret, code string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != codeDigits {
+		return 0, false
+	}
+	current := step(now)
+	for s := current - skewSteps; s <= current+skewSteps; s++ {
+		expected, err := codeAt(secret, s)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
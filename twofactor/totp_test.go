@@ -0,0 +1,65 @@
+package twofactor
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of RFC 6238 Appendix B, "12345678901234567890",
+// in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeAtMatchesRFC6238(t *testing.T) {
+	// The RFC's codes are 8 digits; ours are their last 6.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := codeAt(rfc6238Secret, step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.code {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestMatchStepAcceptsOneStepOfSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := step(now)
+	for offset := int64(-2); offset <= 2; offset++ {
+		code, err := codeAt(rfc6238Secret, current+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, ok := matchStep(rfc6238Secret, code, now)
+		want := offset >= -skewSteps && offset <= skewSteps
+		if ok != want {
+			t.Errorf("offset %d: matched = %v, want %v", offset, ok, want)
+		}
+		if ok && s != current+offset {
+			t.Errorf("offset %d: step = %d, want %d", offset, s, current+offset)
+		}
+	}
+}
+
+func TestMatchStepIgnoresSpacesAndRejectsOtherLengths(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	if _, ok := matchStep(rfc6238Secret, " 005 924 ", now); !ok {
+		t.Error("spaced code was rejected")
+	}
+	for _, code := range []string{"", "05924", "0005924", "abcdef"} {
+		if _, ok := matchStep(rfc6238Secret, code, now); ok {
+			t.Errorf("code %q was accepted", code)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Package twofactor implements optional TOTP two-factor authentication:
+// enrollment, single-use recovery codes, and the challenge a 2FA login has to
+// answer before a session is started.
+package twofactor
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"JourneyAppServer/utils"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	issuer = "JourneyApp"
+
+	recoveryCodeCount = 10
+
+	challengeLifetime = 5 * time.Minute
+	// maxChallengeAttempts bounds how many codes can be tried against one
+	// challenge; after that the password has to be entered again.
+	maxChallengeAttempts = 5
+)
+
+var (
+	ErrAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrNotEnrolled      = errors.New("two-factor authentication is not enrolled")
+	ErrInvalidCode      = errors.New("invalid two-factor code")
+	ErrInvalidChallenge = errors.New("invalid or expired login challenge")
+)
+
+// Enabled reports whether logins for userID need a second factor.
+func Enabled(store *db.Store, userID string) (bool, error) {
+	tf, err := store.TwoFactor.Get(userID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return !tf.EnabledAt.IsZero(), nil
+}
+
+// Enroll generates a new secret for user and returns it with its otpauth URI.
+// The factor isn't used for logins until Confirm succeeds.
+func Enroll(store *db.Store, user types.User) (secret, uri string, err error) {
+	enabled, err := Enabled(store, user.UserID)
+	if err != nil {
+		return "", "", err
+	}
+	if enabled {
+		return "", "", ErrAlreadyEnabled
+	}
+
+	secret, err = generateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := store.TwoFactor.SavePending(user.UserID, secret, time.Now().UTC()); err != nil {
+		return "", "", err
+	}
+	return secret, otpauthURI(issuer, user.Username, secret), nil
+}
+
+// Confirm enables 2FA once the user proves their authenticator works, and
+// returns the recovery codes. Only their hashes are kept.
+func Confirm(store *db.Store, user types.User, code string) ([]string, error) {
+	tf, err := store.TwoFactor.Get(user.UserID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return nil, ErrNotEnrolled
+		}
+		return nil, err
+	}
+	if !tf.EnabledAt.IsZero() {
+		return nil, ErrAlreadyEnabled
+	}
+	if err := useCode(store, tf, code, time.Now()); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := store.TwoFactor.Enable(user.UserID, time.Now().UTC(), hashes); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return nil, ErrAlreadyEnabled
+		}
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify checks either a TOTP code or a recovery code for an enabled factor.
+// Both are single-use.
+func Verify(store *db.Store, userID, code, recoveryCode string) error {
+	tf, err := store.TwoFactor.Get(userID)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return ErrNotEnrolled
+		}
+		return err
+	}
+	if tf.EnabledAt.IsZero() {
+		return ErrNotEnrolled
+	}
+
+	if recoveryCode != "" {
+		err := store.TwoFactor.UseRecoveryCode(userID, hashRecoveryCode(recoveryCode), time.Now().UTC())
+		if errors.Is(err, db.ErrNotFound) {
+			return ErrInvalidCode
+		}
+		return err
+	}
+	return useCode(store, tf, code, time.Now())
+}
+
+func useCode(store *db.Store, tf types.TwoFactor, code string, now time.Time) error {
+	s, ok := matchStep(tf.Secret, code, now)
+	if !ok {
+		return ErrInvalidCode
+	}
+	// A code that has already been used (e.g. read over a shoulder) is
+	// rejected even while it is still current.
+	if err := store.TwoFactor.UseStep(tf.UserID, s); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return ErrInvalidCode
+		}
+		return err
+	}
+	return nil
+}
+
+// Disable turns 2FA off. Callers re-authenticate the user first.
+func Disable(store *db.Store, userID string) error {
+	err := store.TwoFactor.Disable(userID)
+	if errors.Is(err, db.ErrNotFound) {
+		return ErrNotEnrolled
+	}
+	return err
+}
+
+func RecoveryCodesRemaining(store *db.Store, userID string) (int, error) {
+	return store.TwoFactor.RecoveryCodesRemaining(userID)
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns codes like "abcde-fghij" and their hashes.
+func generateRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("error generating random bytes: %v", err)
+		}
+		raw := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores case, spaces and dashes, which users tend to get
+// wrong when typing a code back in.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	return utils.HashToken(normalized)
+}
+
+// StartChallenge is called once the password checks out for a 2FA account.
+// The returned token stands in for the password on the second step.
+func StartChallenge(store *db.Store, user types.User, sessionOption string) (string, time.Time, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, fmt.Errorf("error generating random bytes: %v", err)
+	}
+	token := "mfa_" + hex.EncodeToString(b)
+
+	now := time.Now().UTC()
+	challenge := types.LoginChallenge{
+		Hash:          utils.HashToken(token),
+		UserID:        user.UserID,
+		Username:      user.Username,
+		SessionOption: sessionOption,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(challengeLifetime),
+	}
+	if err := store.TwoFactor.CreateChallenge(challenge); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, challenge.ExpiresAt, nil
+}
+
+// Challenge looks up a usable challenge by its token.
+func Challenge(store *db.Store, token string) (types.LoginChallenge, error) {
+	challenge, err := store.TwoFactor.GetChallenge(utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return types.LoginChallenge{}, ErrInvalidChallenge
+		}
+		return types.LoginChallenge{}, err
+	}
+	if !challenge.ConsumedAt.IsZero() || time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= maxChallengeAttempts {
+		return types.LoginChallenge{}, ErrInvalidChallenge
+	}
+	return challenge, nil
+}
+
+// AnswerChallenge verifies a code against the challenge and, if it is right,
+// consumes the challenge so it can't start a second session.
+func AnswerChallenge(store *db.Store, challenge types.LoginChallenge, code, recoveryCode string) error {
+	if err := Verify(store, challenge.UserID, code, recoveryCode); err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			if err := store.TwoFactor.FailChallenge(challenge.Hash); err != nil {
+				utils.LM.Logger.Printf("Error recording failed challenge for %s: %v", challenge.Username, err)
+			}
+		}
+		return err
+	}
+	if err := store.TwoFactor.ConsumeChallenge(challenge.Hash, time.Now().UTC()); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return ErrInvalidChallenge
+		}
+		return err
+	}
+	return nil
+}
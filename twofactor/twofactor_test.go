@@ -0,0 +1,77 @@
+package twofactor
+
+import (
+	"JourneyAppServer/db"
+	"JourneyAppServer/types"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// enable enrolls alice and confirms with the current code, returning her
+// secret and recovery codes.
+func enable(t *testing.T, store *db.Store) (string, []string) {
+	t.Helper()
+	alice := types.User{UserID: "alice-id", Username: "alice"}
+	if err := store.Users.Create(alice); err != nil {
+		t.Fatal(err)
+	}
+	secret, _, err := Enroll(store, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := codeAt(secret, step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := Confirm(store, alice, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+	return secret, codes
+}
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	store := db.NewMemoryStore()
+	_, codes := enable(t, store)
+
+	if err := Verify(store, "alice-id", "", codes[0]); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := Verify(store, "alice-id", "", codes[0]); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("second use: err = %v, want ErrInvalidCode", err)
+	}
+	// Case and dashes don't matter.
+	if err := Verify(store, "alice-id", "", strings.ToUpper(strings.ReplaceAll(codes[1], "-", ""))); err != nil {
+		t.Fatalf("retyped code: %v", err)
+	}
+	if err := Verify(store, "alice-id", "", "aaaaa-bbbbb"); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("made-up code: err = %v, want ErrInvalidCode", err)
+	}
+
+	remaining, err := RecoveryCodesRemaining(store, "alice-id")
+	if err != nil || remaining != recoveryCodeCount-2 {
+		t.Fatalf("remaining = %d, %v; want %d", remaining, err, recoveryCodeCount-2)
+	}
+}
+
+func TestTOTPCodesAreSingleUse(t *testing.T) {
+	store := db.NewMemoryStore()
+	secret, _ := enable(t, store)
+
+	// Confirm used the current step, so only the next one is left.
+	code, err := codeAt(secret, step(time.Now())+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(store, "alice-id", code, ""); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := Verify(store, "alice-id", code, ""); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("second use: err = %v, want ErrInvalidCode", err)
+	}
+}
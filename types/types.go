@@ -5,8 +5,10 @@ import "time"
 type contextKey string
 
 const (
-	UsernameContextKey contextKey = "username"
-	APIKeyContextKey   contextKey = "apiKey"
+	UsernameContextKey  contextKey = "username"
+	APIKeyContextKey    contextKey = "apiKey"
+	SessionIDContextKey contextKey = "sessionId"
+	APIKeyIDContextKey  contextKey = "apiKeyId"
 )
 
 type ErrorResponse struct {
@@ -26,10 +28,17 @@ type User struct {
 	Username string `bson:"username" json:"username"`
 	Password string `bson:"password" json:"password"`
 	Salt     string `bson:"salt" json:"salt"`
-	APIKey   APIKey `bson:"apiKey" json:"apiKey"`
 	Font     string `bson:"font" json:"font"`
 }
 
+// UserProfile is what GET /api/users/get returns: a User without its
+// password hash, salt or API key.
+type UserProfile struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	Font     string `json:"font"`
+}
+
 type UserListItem struct {
 	UserID   string `bson:"userId" json:"userId"`
 	Username string `bson:"username" json:"username"`
@@ -50,12 +59,15 @@ type CreateUserRequest struct {
 }
 
 type CreateUserResponse struct {
-	UserID   string `json:"userId"`
-	Username string `json:"username"`
-	Success  bool   `json:"success"`
-	Token    string `json:"token,omitempty"`
-	APIKey   string `json:"apiKey,omitempty"`
-	Font     string `json:"font"`
+	UserID         string    `json:"userId"`
+	Username       string    `json:"username"`
+	Success        bool      `json:"success"`
+	Token          string    `json:"token,omitempty"`
+	TokenExpiresAt time.Time `json:"tokenExpiresAt,omitempty"`
+	RefreshToken   string    `json:"refreshToken,omitempty"`
+	SessionID      string    `json:"sessionId,omitempty"`
+	APIKey         string    `json:"apiKey,omitempty"`
+	Font           string    `json:"font"`
 }
 
 type UpdateUserRequest struct {
@@ -67,9 +79,11 @@ type UpdateUserRequest struct {
 }
 
 type UpdateUserResponse struct {
-	Success bool   `json:"success"`
-	Token   string `json:"token,omitempty"`
-	APIKey  string `json:"apiKey,omitempty"`
+	Success        bool      `json:"success"`
+	Token          string    `json:"token,omitempty"`
+	TokenExpiresAt time.Time `json:"tokenExpiresAt,omitempty"`
+	RefreshToken   string    `json:"refreshToken,omitempty"`
+	APIKey         string    `json:"apiKey,omitempty"`
 }
 
 type DeleteAccountResponse struct {
@@ -85,12 +99,20 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	UserID   string `json:"userId,omitempty"`
-	Username string `json:"username,omitempty"`
-	Success  bool   `json:"success"`
-	Token    string `json:"token,omitempty"`
-	APIKey   string `json:"apiKey,omitempty"`
-	Font     string `json:"font,omitempty"`
+	UserID         string    `json:"userId,omitempty"`
+	Username       string    `json:"username,omitempty"`
+	Success        bool      `json:"success"`
+	Token          string    `json:"token,omitempty"`
+	TokenExpiresAt time.Time `json:"tokenExpiresAt,omitempty"`
+	RefreshToken   string    `json:"refreshToken,omitempty"`
+	SessionID      string    `json:"sessionId,omitempty"`
+	APIKey         string    `json:"apiKey,omitempty"`
+	Font           string    `json:"font,omitempty"`
+	// TwoFactorRequired means the password was right but the account has 2FA;
+	// the client finishes with ChallengeToken at /api/users/login/verify.
+	TwoFactorRequired  bool      `json:"twoFactorRequired,omitempty"`
+	ChallengeToken     string    `json:"challengeToken,omitempty"`
+	ChallengeExpiresAt time.Time `json:"challengeExpiresAt,omitempty"`
 }
 
 type LocationData struct {
@@ -105,62 +127,125 @@ type TagData struct {
 }
 
 type CreateNewEntryRequest struct {
-	UserID    string         `json:"userId"`
-	Username  string         `bson:"username" json:"username"`
-	Text      string         `bson:"text" json:"text"`
-	Timestamp time.Time      `bson:"timestamp" json:"timestamp"`
-	Locations []LocationData `bson:"locations" json:"locations"`
-	Tags      []TagData      `bson:"tags" json:"tags"`
-	Images    []string       `bson:"images" json:"images"`
+	UserID    string            `json:"userId"`
+	Username  string            `bson:"username" json:"username"`
+	Text      string            `bson:"text" json:"text"`
+	Timestamp time.Time         `bson:"timestamp" json:"timestamp"`
+	Locations []LocationData    `bson:"locations" json:"locations"`
+	Tags      []TagData         `bson:"tags" json:"tags"`
+	Images    []string          `bson:"images" json:"images"`
+	Encrypted *EncryptedPayload `json:"encrypted,omitempty"`
 }
 
 type CreateNewEntryResponse struct {
-	ID          string         `bson:"id" json:"id"`
-	UserID      string         `json:"userId"`
-	Username    string         `bson:"username" json:"username"`
-	Text        string         `bson:"text" json:"text"`
-	Timestamp   time.Time      `bson:"timestamp" json:"timestamp"`
-	LastUpdated time.Time      `bson:"lastUpdated" json:"lastUpdated"`
-	Locations   []LocationData `bson:"locations" json:"locations"`
-	Tags        []TagData      `bson:"tags" json:"tags"`
-	Images      []string       `bson:"images" json:"images"`
+	ID          string            `bson:"id" json:"id"`
+	UserID      string            `json:"userId"`
+	Username    string            `bson:"username" json:"username"`
+	Text        string            `bson:"text" json:"text"`
+	Timestamp   time.Time         `bson:"timestamp" json:"timestamp"`
+	LastUpdated time.Time         `bson:"lastUpdated" json:"lastUpdated"`
+	Locations   []LocationData    `bson:"locations" json:"locations"`
+	Tags        []TagData         `bson:"tags" json:"tags"`
+	Images      []string          `bson:"images" json:"images"`
+	Encrypted   *EncryptedPayload `json:"encrypted,omitempty"`
+	Version     int64             `json:"version"`
 }
 
 type UpdateEntryRequest struct {
-	ID          string         `bson:"id" json:"id"`
-	UserID      string         `json:"userId"`
-	Username    string         `bson:"username" json:"username"`
-	Text        string         `bson:"text" json:"text"`
-	Timestamp   time.Time      `bson:"timestamp" json:"timestamp"`
-	LastUpdated time.Time      `bson:"lastUpdated" json:"lastUpdated"`
-	Locations   []LocationData `bson:"locations" json:"locations"`
-	Tags        []TagData      `bson:"tags" json:"tags"`
-	Images      []string       `bson:"images" json:"images"`
+	ID          string            `bson:"id" json:"id"`
+	UserID      string            `json:"userId"`
+	Username    string            `bson:"username" json:"username"`
+	Text        string            `bson:"text" json:"text"`
+	Timestamp   time.Time         `bson:"timestamp" json:"timestamp"`
+	LastUpdated time.Time         `bson:"lastUpdated" json:"lastUpdated"`
+	Locations   []LocationData    `bson:"locations" json:"locations"`
+	Tags        []TagData         `bson:"tags" json:"tags"`
+	Images      []string          `bson:"images" json:"images"`
+	Encrypted   *EncryptedPayload `json:"encrypted,omitempty"`
 }
 
 type UpdateEntryResponse struct {
-	Success bool `bson:"success" json:"success"`
+	Success bool  `bson:"success" json:"success"`
+	Version int64 `json:"version,omitempty"`
+}
+
+// ReplaceEntryRequest is the body of PUT /api/v2/entries/{id}. Every field
+// is written as sent, so one left out is cleared; the exception is
+// Encrypted, since an E2EE entry can't go back to plaintext.
+type ReplaceEntryRequest struct {
+	Text      string            `json:"text"`
+	Timestamp time.Time         `json:"timestamp"`
+	Locations []LocationData    `json:"locations"`
+	Tags      []TagData         `json:"tags"`
+	Images    []string          `json:"images"`
+	Encrypted *EncryptedPayload `json:"encrypted,omitempty"`
+}
+
+// EntryPatch is a partial update of an entry. Nil fields are left as they
+// are; a non-nil one replaces the field, so pointing at "" or an empty slice
+// clears it. A zero LastUpdated means now.
+type EntryPatch struct {
+	Text        *string
+	Timestamp   *time.Time
+	Locations   *[]LocationData
+	Tags        *[]TagData
+	Images      *[]string
+	Encrypted   *EncryptedPayload
+	LastUpdated time.Time
+}
+
+// EntryConflictResponse comes with a 412 when a write was made against a
+// version of the entry that is no longer current. Current is the entry as
+// the server has it, for the client to merge with and retry.
+type EntryConflictResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	Current Entry  `json:"current"`
 }
 
 type Entry struct {
-	ID          string         `bson:"id" json:"id"`
-	UserID      string         `bson:"userId" json:"userId"`
-	Username    string         `bson:"username" json:"username"`
-	Text        string         `bson:"text" json:"text"`
-	Timestamp   time.Time      `bson:"timestamp" json:"timestamp"`
-	LastUpdated time.Time      `bson:"lastUpdated" json:"lastUpdated"`
-	Locations   []LocationData `bson:"locations" json:"locations"`
-	Tags        []TagData      `bson:"tags" json:"tags"`
-	Images      []string       `bson:"images" json:"images"`
+	ID          string            `bson:"id" json:"id"`
+	UserID      string            `bson:"userId" json:"userId"`
+	Username    string            `bson:"username" json:"username"`
+	Text        string            `bson:"text" json:"text"`
+	Timestamp   time.Time         `bson:"timestamp" json:"timestamp"`
+	LastUpdated time.Time         `bson:"lastUpdated" json:"lastUpdated"`
+	Locations   []LocationData    `bson:"locations" json:"locations"`
+	Tags        []TagData         `bson:"tags" json:"tags"`
+	Images      []string          `bson:"images" json:"images"`
+	Encrypted   *EncryptedPayload `json:"encrypted,omitempty"`
+	DeletedAt   *time.Time        `json:"deletedAt,omitempty"`
+	// Version goes up by one with every change to the entry.
+	Version int64 `json:"version"`
+	// Stats is nil for E2EE entries, whose text the server can't read.
+	Stats *EntryStats `json:"stats,omitempty"`
+}
+
+// EntryStats describes an entry's text as the app's markdown renders it.
+// The server works it out again whenever the text changes.
+type EntryStats struct {
+	WordCount         int              `json:"wordCount"`
+	ReadingMinutes    int              `json:"readingMinutes"`
+	Checkboxes        int              `json:"checkboxes"`
+	CheckboxesChecked int              `json:"checkboxesChecked"`
+	Outline           []OutlineHeading `json:"outline"`
+}
+
+// OutlineHeading is a heading of an entry, level 1 for "#" through 6.
+type OutlineHeading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
 }
 
 type EntryListItem struct {
-	ID        string         `bson:"id" json:"id"`
-	Text      string         `bson:"text" json:"text"`
-	Timestamp time.Time      `bson:"timestamp" json:"timestamp"`
-	Locations []LocationData `bson:"locations" json:"locations"`
-	Tags      []TagData      `bson:"tags" json:"tags"`
-	Images    []string       `bson:"images" json:"images"`
+	ID        string            `bson:"id" json:"id"`
+	Text      string            `bson:"text" json:"text"`
+	Timestamp time.Time         `bson:"timestamp" json:"timestamp"`
+	Locations []LocationData    `bson:"locations" json:"locations"`
+	Tags      []TagData         `bson:"tags" json:"tags"`
+	Images    []string          `bson:"images" json:"images"`
+	Encrypted *EncryptedPayload `json:"encrypted,omitempty"`
+	DeletedAt *time.Time        `json:"deletedAt,omitempty"`
 }
 
 type ListEntriesParams struct {
@@ -172,24 +257,212 @@ type ListEntriesParams struct {
 	SortRule  string
 }
 
+// ListTrashResponse lists deleted entries, most recently deleted first.
+// Each is purged RetentionDays after its DeletedAt.
+type ListTrashResponse struct {
+	Entries       []EntryListItem `json:"entries"`
+	RetentionDays int             `json:"retentionDays"`
+}
+
+type RestoreEntryRequest struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"userId"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type RestoreEntryResponse struct {
+	Success bool `json:"success"`
+}
+
+type EmptyTrashResponse struct {
+	Success bool `json:"success"`
+	Purged  int  `json:"purged"`
+}
+
+// EntrySnapshot is the state of an entry saved in a revision. Images are
+// only references: one deleted from S3 since stays deleted after a restore.
+type EntrySnapshot struct {
+	Text      string            `json:"text"`
+	Locations []LocationData    `json:"locations"`
+	Tags      []TagData         `json:"tags"`
+	Images    []string          `json:"images"`
+	Encrypted *EncryptedPayload `json:"encrypted,omitempty"`
+}
+
+// EntryRevision is an earlier state of an entry, saved when it was replaced
+// by an update ("update") or a restore ("restore").
+type EntryRevision struct {
+	EntryID   string        `json:"entryId"`
+	Revision  int64         `json:"revision"`
+	Reason    string        `json:"reason"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Snapshot  EntrySnapshot `json:"snapshot"`
+}
+
+type ListRevisionsResponse struct {
+	Revisions []EntryRevision `json:"revisions"`
+}
+
+// DiffLine is one line of a text diff; Op is "equal", "insert" or "delete".
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// RevisionDiff describes the changes from revision From to revision To,
+// where To is 0 for the entry as it is now. The text of E2EE entries can't
+// be compared, so only EncryptedChanged is set for them.
+type RevisionDiff struct {
+	From             int64          `json:"from"`
+	To               int64          `json:"to"`
+	Text             []DiffLine     `json:"text"`
+	EncryptedChanged bool           `json:"encryptedChanged,omitempty"`
+	TagsAdded        []TagData      `json:"tagsAdded"`
+	TagsRemoved      []TagData      `json:"tagsRemoved"`
+	LocationsAdded   []LocationData `json:"locationsAdded"`
+	LocationsRemoved []LocationData `json:"locationsRemoved"`
+	ImagesAdded      []string       `json:"imagesAdded"`
+	ImagesRemoved    []string       `json:"imagesRemoved"`
+}
+
+type RestoreRevisionRequest struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"userId"`
+	Timestamp time.Time `json:"timestamp"`
+	Revision  int64     `json:"revision"`
+}
+
+type RestoreRevisionResponse struct {
+	Success bool `json:"success"`
+	// MissingImages are images of the revision that had been deleted, and
+	// so were left out of the restored entry.
+	MissingImages []string `json:"missingImages,omitempty"`
+}
+
 type GetEntryRequest struct{}
 
 type GetEntryResponse struct{}
 
 type SearchEntriesRequest struct {
-	User        string         `bson:"user" json:"user"`
-	Page        int64          `bson:"page" json:"page"`
-	Limit       int64          `bson:"limit" json:"limit"`
+	User  string `bson:"user" json:"user"`
+	Page  int64  `bson:"page" json:"page"`
+	Limit int64  `bson:"limit" json:"limit"`
+	// SearchQuery is written in the search package's query language, as in
+	// `tag:travel -tag:draft "exact phrase" has:image`. Locations match
+	// entries with any one of them, on top of it.
 	SearchQuery string         `bson:"searchQuery" json:"searchQuery"`
 	Locations   []LocationData `bson:"locations" json:"locations"`
-	Tags        []TagData      `bson:"tags" json:"tags"`
-	SortRule    string         `bson:"sortRule" json:"sortRule"`
-	Timeframe   string         `bson:"timeframe" json:"timeframe"`
-	FromDate    string         `bson:"fromDate" json:"fromDate"`
-	ToDate      string         `bson:"toDate" json:"toDate"`
-}
+	// Tags match by key, or by key and value for those with a Value. An
+	// entry matches with any one of them, or every one if TagMode is
+	// TagModeAll, and not with any one of ExcludeTags.
+	Tags        []TagData `bson:"tags" json:"tags"`
+	TagMode     string    `bson:"tagMode" json:"tagMode,omitempty"`
+	ExcludeTags []TagData `bson:"excludeTags" json:"excludeTags,omitempty"`
+	// SortRule is "Newest", "Oldest" or "Relevance", which is best match
+	// first and the same as "Newest" without a SearchQuery.
+	SortRule  string `bson:"sortRule" json:"sortRule"`
+	Timeframe string `bson:"timeframe" json:"timeframe"`
+	FromDate  string `bson:"fromDate" json:"fromDate"`
+	ToDate    string `bson:"toDate" json:"toDate"`
+	// BlindTokens replaces SearchQuery for users with E2EE on: every token
+	// has to be in an entry's blind index for it to match.
+	BlindTokens []string `json:"blindTokens,omitempty"`
+	// WithinRadius and WithinBounds match entries with a location inside
+	// them. Nearest keeps only the entries with a location closest to its
+	// point, nearest first in place of SortRule.
+	WithinRadius *GeoRadius  `bson:"withinRadius" json:"withinRadius,omitempty"`
+	WithinBounds *GeoBounds  `bson:"withinBounds" json:"withinBounds,omitempty"`
+	Nearest      *GeoNearest `bson:"nearest" json:"nearest,omitempty"`
+}
+
+// GeoRadius is a circle of Meters around a point.
+type GeoRadius struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Meters    float64 `json:"meters"`
+}
+
+// GeoBounds is a box of latitudes and longitudes. West is more than East
+// for a box that crosses the antimeridian.
+type GeoBounds struct {
+	South float64 `json:"south"`
+	West  float64 `json:"west"`
+	North float64 `json:"north"`
+	East  float64 `json:"east"`
+}
+
+// GeoNearest asks for the Count entries closest to a point.
+type GeoNearest struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Count     int     `json:"count"`
+}
+
+// MaxNearest bounds GeoNearest.Count.
+const MaxNearest = 100
+
+// The values SearchEntriesRequest.TagMode can take; "" is TagModeAny.
+const (
+	TagModeAny = "any"
+	TagModeAll = "all"
+)
 
-type SearchEntriesResponse struct{} // May not need this. TODO: remove if not needed
+// SearchQueryErrorResponse is the 400 for a SearchQuery that can't be
+// parsed.
+type SearchQueryErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	// Position is where in the query the problem is, counted in Unicode
+	// code points from 0.
+	Position int `json:"position"`
+}
+
+// EncryptedPayload is the envelope an E2EE client sends and receives in place
+// of entry text. The server stores it as-is and never sees the key to open it.
+type EncryptedPayload struct {
+	Ciphertext []byte `json:"ciphertext"`
+	// WrappedKey is the entry's data key, wrapped by the user's content key.
+	WrappedKey []byte `json:"wrappedKey"`
+	Nonce      []byte `json:"nonce"`
+	Algorithm  string `json:"algorithm"`
+	// BlindIndex holds the client's keyed hashes of the entry's words. It is
+	// written on create/update and not returned.
+	BlindIndex []string `json:"blindIndex,omitempty"`
+}
+
+type SearchEntriesResponse struct {
+	Results []SearchResult `json:"results"`
+	// Total counts the matches on every page, not just this one.
+	Total int64 `json:"total"`
+	Page  int64 `json:"page"`
+	Limit int64 `json:"limit"`
+}
+
+type SearchResult struct {
+	Entry Entry `json:"entry"`
+	// Score is how well the entry matches the search query; higher is
+	// better. It is 0 without a query.
+	Score float64 `json:"score"`
+	// Snippets are cut from the entry's plain text. E2EE entries have none.
+	Snippets []SearchSnippet `json:"snippets"`
+	// DistanceMeters is how far the entry's closest location is from the
+	// point of the search's Nearest or WithinRadius, if it has one.
+	DistanceMeters *float64 `json:"distanceMeters,omitempty"`
+}
+
+// SearchSnippet is a part of an entry's text with the words that matched
+// the query highlighted.
+type SearchSnippet struct {
+	Text       string      `json:"text"`
+	Highlights []TextRange `json:"highlights"`
+}
+
+// TextRange is the part of a string from Start up to End, counted in
+// Unicode code points.
+type TextRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
 
 type AddTagRequest struct {
 	Username  string    `json:"username"`
@@ -263,3 +536,272 @@ type DeleteImageRequest struct {
 type DeleteImageResponse struct {
 	Success bool `json:"success"`
 }
+
+type AnalyticsEvent struct {
+	UserID     string            `json:"userId"`
+	EventType  string            `json:"eventType"`
+	ObjectType string            `json:"objectType"`
+	ObjectID   string            `json:"objectId"`
+	Metadata   map[string]string `json:"metadata"`
+}
+
+// Session is one signed-in device. Only the hash of its current refresh token
+// is kept; the token itself is handed to the client once.
+type Session struct {
+	ID                string    `json:"sessionId"`
+	UserID            string    `json:"userId"`
+	Username          string    `json:"username"`
+	RefreshTokenHash  string    `json:"-"`
+	PreviousTokenHash string    `json:"-"`
+	DeviceName        string    `json:"deviceName"`
+	UserAgent         string    `json:"userAgent"`
+	ClientIP          string    `json:"clientIp"`
+	CreatedAt         time.Time `json:"createdAt"`
+	LastUsedAt        time.Time `json:"lastUsedAt"`
+	ExpiresAt         time.Time `json:"expiresAt"`
+	RevokedAt         time.Time `json:"revokedAt,omitempty"`
+}
+
+type SessionListItem struct {
+	Session
+	Current bool `json:"current"`
+}
+
+type ListSessionsResponse struct {
+	Sessions []SessionListItem `json:"sessions"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type RefreshResponse struct {
+	Success        bool      `json:"success"`
+	Token          string    `json:"token,omitempty"`
+	TokenExpiresAt time.Time `json:"tokenExpiresAt,omitempty"`
+	RefreshToken   string    `json:"refreshToken,omitempty"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type LogoutResponse struct {
+	Success bool `json:"success"`
+}
+
+type RevokeSessionResponse struct {
+	Success bool `json:"success"`
+}
+
+type LoginAttempt struct {
+	Username    string    `json:"username"`
+	ClientIP    string    `json:"clientIp"`
+	Succeeded   bool      `json:"succeeded"`
+	AttemptedAt time.Time `json:"attemptedAt"`
+}
+
+// LoginFailures summarizes uncleared failed attempts since some point in time.
+type LoginFailures struct {
+	Count int
+	Last  time.Time
+}
+
+// UserAPIKey is one of a user's named API keys. Only the hash of the key is
+// stored; the key itself is handed to the client once, when it is created.
+type UserAPIKey struct {
+	ID         string    `json:"keyId"`
+	UserID     string    `json:"userId"`
+	Username   string    `json:"username"`
+	Name       string    `json:"name"`
+	KeyHash    string    `json:"-"`
+	Prefix     string    `json:"prefix"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt,omitempty"`
+	ExpiresAt  time.Time `json:"expiresAt,omitempty"`
+	RevokedAt  time.Time `json:"revokedAt,omitempty"`
+	// ReplacedBy is set once the key has been rotated; it stays valid until
+	// ExpiresAt.
+	ReplacedBy string `json:"replacedBy,omitempty"`
+	// SessionID is set on the key handed out by login, which is revoked
+	// along with its session.
+	SessionID string `json:"sessionId,omitempty"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays of zero creates a key that never expires.
+	ExpiresInDays int `json:"expiresInDays,omitempty"`
+}
+
+type CreateAPIKeyResponse struct {
+	Success bool       `json:"success"`
+	Key     string     `json:"key,omitempty"`
+	APIKey  UserAPIKey `json:"apiKey"`
+}
+
+type ListAPIKeysResponse struct {
+	APIKeys []UserAPIKey `json:"apiKeys"`
+}
+
+type RevokeAPIKeyResponse struct {
+	Success bool `json:"success"`
+}
+
+type RotateAPIKeyRequest struct {
+	// KeyID defaults to the key the request was made with.
+	KeyID string `json:"keyId,omitempty"`
+}
+
+type RotateAPIKeyResponse struct {
+	Success bool       `json:"success"`
+	Key     string     `json:"key,omitempty"`
+	APIKey  UserAPIKey `json:"apiKey"`
+	// PreviousKeyExpiresAt is when the rotated key stops working.
+	PreviousKeyExpiresAt time.Time `json:"previousKeyExpiresAt"`
+}
+
+// TwoFactor is a user's TOTP enrollment. It only applies to logins once
+// EnabledAt is set.
+type TwoFactor struct {
+	UserID       string    `json:"userId"`
+	Secret       string    `json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+	EnabledAt    time.Time `json:"enabledAt,omitempty"`
+	LastUsedStep int64     `json:"-"`
+}
+
+// LoginChallenge is the pending second step of a 2FA login.
+type LoginChallenge struct {
+	Hash          string    `json:"-"`
+	UserID        string    `json:"userId"`
+	Username      string    `json:"username"`
+	SessionOption string    `json:"sessionOption"`
+	CreatedAt     time.Time `json:"createdAt"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	Attempts      int       `json:"attempts"`
+	ConsumedAt    time.Time `json:"consumedAt,omitempty"`
+}
+
+type VerifyLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code,omitempty"`
+	RecoveryCode   string `json:"recoveryCode,omitempty"`
+}
+
+type TwoFactorStatusResponse struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
+}
+
+type EnrollTwoFactorResponse struct {
+	Success    bool   `json:"success"`
+	Secret     string `json:"secret,omitempty"`
+	OTPAuthURI string `json:"otpauthUri,omitempty"`
+}
+
+type ConfirmTwoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+type ConfirmTwoFactorResponse struct {
+	Success       bool     `json:"success"`
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+}
+
+// DisableTwoFactorRequest re-authenticates with the password and either a
+// current code or a recovery code.
+type DisableTwoFactorRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recoveryCode,omitempty"`
+}
+
+type DisableTwoFactorResponse struct {
+	Success bool `json:"success"`
+}
+
+type PasswordResetToken struct {
+	Hash        string    `json:"-"`
+	UserID      string    `json:"userId"`
+	Username    string    `json:"username"`
+	RequestedIP string    `json:"requestedIp"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	UsedAt      time.Time `json:"usedAt,omitempty"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+	// SessionOption is for the new session that replaces every existing one.
+	SessionOption string `json:"sessionOption"`
+}
+
+type ChangePasswordResponse struct {
+	Success        bool      `json:"success"`
+	Token          string    `json:"token,omitempty"`
+	TokenExpiresAt time.Time `json:"tokenExpiresAt,omitempty"`
+	RefreshToken   string    `json:"refreshToken,omitempty"`
+	SessionID      string    `json:"sessionId,omitempty"`
+}
+
+type ForgotPasswordRequest struct {
+	Username string `json:"username"`
+}
+
+// ForgotPasswordResponse is the same whether or not the username exists.
+type ForgotPasswordResponse struct {
+	Success bool `json:"success"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+type ResetPasswordResponse struct {
+	Success bool `json:"success"`
+}
+
+// UserEncryption is a user's E2EE key material. WrappedKey is opaque to the
+// server: the client wraps it with a key derived from a passphrase described
+// by KDFParams.
+type UserEncryption struct {
+	UserID     string    `json:"-"`
+	WrappedKey []byte    `json:"wrappedKey"`
+	Algorithm  string    `json:"algorithm"`
+	KDFParams  string    `json:"kdfParams,omitempty"`
+	EnabledAt  time.Time `json:"enabledAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+type EncryptionStatusResponse struct {
+	Enabled    bool            `json:"enabled"`
+	Encryption *UserEncryption `json:"encryption,omitempty"`
+}
+
+// EnableEncryptionRequest turns E2EE on, or re-wraps the content key (e.g.
+// after a passphrase change) when it is already on.
+type EnableEncryptionRequest struct {
+	Password   string `json:"password"`
+	WrappedKey []byte `json:"wrappedKey"`
+	Algorithm  string `json:"algorithm"`
+	KDFParams  string `json:"kdfParams"`
+}
+
+type EnableEncryptionResponse struct {
+	Success bool `json:"success"`
+}
+
+// DataKey is a user's key for encryption at rest, wrapped by the master key
+// named MasterKeyID.
+type DataKey struct {
+	UserID      string
+	WrappedKey  []byte
+	MasterKeyID string
+	CreatedAt   time.Time
+	RewrappedAt time.Time
+}
@@ -20,6 +20,8 @@ func GenerateSalt(length int) (string, error) {
 }
 
 // Hash password
+//
+// Deprecated: use passwords.Hash, which doesn't need a separate salt.
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 15)
 
@@ -27,6 +29,8 @@ func HashPassword(password string) (string, error) {
 }
 
 // Check password hash
+//
+// Deprecated: use passwords.Verify, which also understands newer hashes.
 func CheckPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 
@@ -1,79 +1,94 @@
 package utils
 
 import (
+	"JourneyAppServer/config"
 	"JourneyAppServer/types"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/time/rate"
-	"sync"
 	"time"
 )
 
 const (
-	jwtSecretKey = "my-temp-secret-key-here"
+	apiKeyLength       = 32
+	refreshTokenLength = 32
+	keyRotationDays    = 90
 
-	apiKeyLength    = 32
-	maxRequestRate  = 100
-	keyRotationDays = 90
+	accessTokenLifetime = 15 * time.Minute
 )
 
-func GetJWTSecret() string {
-	return jwtSecretKey
-}
-
-type RateLimiter struct {
-	limiters sync.Map
-}
+var jwtSecretKey = config.Default().JWT.Secret
 
-func NewRateLimiter() *RateLimiter {
-	return &RateLimiter{}
+// ConfigureJWT sets the key tokens are signed and verified with. It must run
+// before the server starts handling requests.
+func ConfigureJWT(cfg config.JWTConfig) {
+	jwtSecretKey = cfg.Secret
 }
 
-func (rl *RateLimiter) GetLimiter(apiKey string) *rate.Limiter {
-	limiter, exists := rl.limiters.Load(apiKey)
-	if !exists {
-		newLimiter := rate.NewLimiter(rate.Limit(maxRequestRate), maxRequestRate)
-		rl.limiters.Store(apiKey, newLimiter)
-		return newLimiter
-	}
-	return limiter.(*rate.Limiter)
+func GetJWTSecret() string {
+	return jwtSecretKey
 }
 
-func GenerateAndStoreJWT(username, sessionOption string) (string, error) {
-	var expirationTime time.Time
-
+// SessionLifetime maps a sessionOption onto how long the refresh token (and
+// so the device's session) stays valid.
+func SessionLifetime(sessionOption string) (time.Duration, error) {
 	switch sessionOption {
 	case "always":
-		expirationTime = time.Now().Add(366 * 244 * time.Hour)
+		return 365 * 24 * time.Hour, nil
 	case "daily":
-		expirationTime = time.Now().Add(24 * time.Hour)
+		return 24 * time.Hour, nil
 	case "weekly":
-		expirationTime = time.Now().Add(7 * 24 * time.Hour)
+		return 7 * 24 * time.Hour, nil
 	case "monthly":
-		expirationTime = time.Now().Add(30 * 24 * time.Hour)
+		return 30 * 24 * time.Hour, nil
 	case "never":
-		expirationTime = time.Now().Add(1 * time.Minute)
+		return 1 * time.Minute, nil
 	default:
-		return "", errors.New("invalid session option")
+		return 0, errors.New("invalid session option")
+	}
+}
+
+// GenerateAccessToken mints a short-lived token bound to sessionID. It never
+// outlives the session it belongs to.
+func GenerateAccessToken(username, sessionID string, sessionExpiresAt time.Time) (string, time.Time, error) {
+	now := time.Now()
+	expirationTime := now.Add(accessTokenLifetime)
+	if sessionExpiresAt.Before(expirationTime) {
+		expirationTime = sessionExpiresAt
 	}
 
 	claims := jwt.MapClaims{
 		"username": username,
+		"sid":      sessionID,
 		"exp":      expirationTime.Unix(),
-		"iat":      time.Now().Unix(),
+		"iat":      now.Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenString, err := token.SignedString([]byte(jwtSecretKey))
 	if err != nil {
-		return "", fmt.Errorf("error signing token: %v", err)
+		return "", time.Time{}, fmt.Errorf("error signing token: %v", err)
 	}
 
-	return tokenString, nil
+	return tokenString, expirationTime, nil
+}
+
+func GenerateRefreshToken() (string, error) {
+	randomBytes := make([]byte, refreshTokenLength)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("error generating random bytes: %v", err)
+	}
+	return fmt.Sprintf("rt_%s", hex.EncodeToString(randomBytes)), nil
+}
+
+// HashToken is how refresh tokens are stored and looked up.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 func GenerateSecureAPIKey() (*types.APIKey, error) {
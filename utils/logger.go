@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"JourneyAppServer/config"
 	"fmt"
 	"log"
 	"os"
@@ -13,12 +14,17 @@ type LogManager struct {
 	Logger *log.Logger
 	File   *os.File
 	Mutex  sync.Mutex
+	closed bool
 }
 
-var LM = &LogManager{}
+// LM starts out writing to stderr so code paths that run before (or without)
+// SetupDailyLogging, like tests against the in-memory store, can still log.
+var LM = &LogManager{
+	Logger: log.New(os.Stderr, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile),
+}
 
-func SetupDailyLogging() error {
-	logDir := "./logs"
+func SetupDailyLogging(cfg config.LogConfig) error {
+	logDir := cfg.Dir
 
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return fmt.Errorf("failed to create log directory: %v", err)
@@ -50,6 +56,10 @@ func SetupDailyLogging() error {
 			time.Sleep(durationUntilMidnight)
 
 			LM.Mutex.Lock()
+			if LM.closed {
+				LM.Mutex.Unlock()
+				return
+			}
 			newFile, err := openLogFile()
 			if err != nil {
 				log.Printf("Failed to rotate log file: %v", err)
@@ -71,3 +81,18 @@ func SetupDailyLogging() error {
 
 	return nil
 }
+
+// Close closes the current log file and stops rotation. Anything
+// logged afterwards goes to stderr.
+func (lm *LogManager) Close() error {
+	lm.Mutex.Lock()
+	defer lm.Mutex.Unlock()
+	lm.closed = true
+	lm.Logger = log.New(os.Stderr, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
+	if lm.File == nil {
+		return nil
+	}
+	err := lm.File.Close()
+	lm.File = nil
+	return err
+}
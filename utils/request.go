@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"JourneyAppServer/config"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+var trustedProxies []netip.Prefix
+
+// ConfigureTrustedProxies sets the proxies ClientIP believes X-Forwarded-For
+// from. It must run before the server starts handling requests.
+func ConfigureTrustedProxies(cfg config.ServerConfig) error {
+	prefixes, err := cfg.TrustedProxyPrefixes()
+	if err != nil {
+		return err
+	}
+	trustedProxies = prefixes
+	return nil
+}
+
+func trusted(addr netip.Addr) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP is the address of the client a request came from. That is the
+// connection's address, unless it is a trusted proxy: then it is the last
+// X-Forwarded-For hop that isn't one, as the earlier hops are whatever the
+// client sent. A hop that isn't an IP address ends the walk there.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap().WithZone("")
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0 && trusted(addr); i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		hop, _ := netip.AddrFromSlice(ip)
+		addr = hop.Unmap()
+	}
+	return addr.String()
+}
+
+// RequestMetadata is the analytics metadata every event records about the
+// request behind it. Callers add their own keys to the map.
+func RequestMetadata(r *http.Request) map[string]string {
+	return map[string]string{
+		"source":       "api",
+		"client_ip":    ClientIP(r),
+		"user_agent":   r.Header.Get("User-Agent"),
+		"app_version":  r.Header.Get("X-App-Version"),
+		"os_version":   r.Header.Get("X-OS-Version"),
+		"device_model": r.Header.Get("X-Device-Model"),
+	}
+}
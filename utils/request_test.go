@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"JourneyAppServer/config"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	if err := ConfigureTrustedProxies(config.ServerConfig{TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1"}}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { trustedProxies = nil }()
+
+	for _, tc := range []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"no proxy", "203.0.113.9:4000", nil, "203.0.113.9"},
+		{"forged header from a client", "203.0.113.9:4000", []string{"198.51.100.1"}, "203.0.113.9"},
+		{"from a trusted proxy", "10.1.2.3:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"client's own hops are skipped", "10.1.2.3:4000", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"through two proxies", "192.0.2.1:4000", []string{"198.51.100.1, 10.9.9.9"}, "198.51.100.1"},
+		{"header sent twice", "10.1.2.3:4000", []string{"1.1.1.1", "198.51.100.1"}, "198.51.100.1"},
+		{"IPv6", "[2001:db8::1]:4000", nil, "2001:db8::1"},
+		{"garbage hop", "10.1.2.3:4000", []string{"1.1.1.1, " + strings.Repeat("x", 100)}, "10.1.2.3"},
+		{"empty header", "10.1.2.3:4000", []string{""}, "10.1.2.3"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tc.remoteAddr
+		for _, f := range tc.forwarded {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		if got := ClientIP(r); got != tc.want {
+			t.Errorf("%s: ClientIP = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRequestMetadataIgnoresForgedForwardedFor(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.9:4000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	r.Header.Set("X-Device-Model", "iPhone")
+
+	metadata := RequestMetadata(r)
+	if metadata["client_ip"] != "203.0.113.9" {
+		t.Errorf("client_ip = %q, want the connection's address", metadata["client_ip"])
+	}
+	if metadata["source"] != "api" || metadata["device_model"] != "iPhone" {
+		t.Errorf("metadata = %v", metadata)
+	}
+}